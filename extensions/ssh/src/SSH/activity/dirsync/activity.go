@@ -0,0 +1,86 @@
+package dirsync
+
+import (
+	"fmt"
+	"path"
+
+	ssh "github.com/mmussett/extensions/SSH/connector/connection"
+	"github.com/project-flogo/core/activity"
+	"github.com/project-flogo/core/support/log"
+)
+
+var activityMd = activity.ToMetadata(&Input{}, &Output{})
+
+func init() {
+	_ = activity.Register(&MyActivity{}, New)
+}
+
+// New creates a new activity
+func New(ctx activity.InitContext) (activity.Activity, error) {
+	return &MyActivity{logger: log.ChildLogger(ctx.Logger(), "SSH-activity-dirsync"), activityName: "dirsync"}, nil
+}
+
+// MyActivity mirrors a local directory tree to a remote directory over SFTP
+type MyActivity struct {
+	logger       log.Logger
+	activityName string
+}
+
+// Metadata implements activity.Activity.Metadata
+func (*MyActivity) Metadata() *activity.Metadata {
+	return activityMd
+}
+
+// Eval implements activity.Activity.Eval
+func (activity *MyActivity) Eval(context activity.Context) (done bool, err error) {
+
+	input := &Input{}
+	output := &Output{}
+
+	//Get Input Object
+	err = context.GetInputObject(input)
+	if err != nil {
+		return false, err
+	}
+
+	if input.LocalDir == "" || input.RemoteDir == "" {
+		return false, fmt.Errorf("required inputs 'localDir' and 'remoteDir' must be specified")
+	}
+
+	sshClient, err := ssh.GetHostClient(input.Connection, input.Host, input.Port)
+	if err != nil {
+		return false, err
+	}
+
+	client, err := sshClient.SFTP()
+	if err != nil {
+		return false, err
+	}
+	defer client.Close()
+
+	rep, err := synchronize(client, &options{
+		localDir:  input.LocalDir,
+		remoteDir: path.Clean(input.RemoteDir),
+		compare:   input.Compare,
+		delete:    input.Delete,
+		dryRun:    input.DryRun,
+	})
+	if err != nil {
+		return false, err
+	}
+
+	activity.logger.Debugf("Synchronized '%s' to '%s': %d added, %d updated, %d deleted, %d unchanged (dry run: %t)",
+		input.LocalDir, input.RemoteDir, len(rep.added), len(rep.updated), len(rep.deleted), len(rep.unchanged), input.DryRun)
+
+	output.Report = rep.toMap()
+	output.Changed = len(rep.added)+len(rep.updated)+len(rep.deleted) > 0
+	output.BytesTransferred = rep.bytesTransferred
+
+	//Set output object
+	err = context.SetOutputObject(output)
+	if err != nil {
+		return false, err
+	}
+
+	return true, nil
+}
@@ -0,0 +1,107 @@
+package dirsync
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/mmussett/extensions/SSH/internal/sshtest"
+	"github.com/project-flogo/core/activity"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRegister(t *testing.T) {
+	ref := activity.GetRef(&MyActivity{})
+	act := activity.Get(ref)
+
+	assert.NotNil(t, act)
+}
+
+func writeFile(t *testing.T, p string, content string) {
+	assert.Nil(t, os.MkdirAll(filepath.Dir(p), 0755))
+	assert.Nil(t, os.WriteFile(p, []byte(content), 0644))
+}
+
+func TestSynchronize(t *testing.T) {
+	client := sshtest.NewSFTPClient(t)
+	local := filepath.Join(t.TempDir(), "bundle")
+	remote := filepath.ToSlash(filepath.Join(t.TempDir(), "mirror"))
+
+	writeFile(t, filepath.Join(local, "app.conf"), "port=80")
+	writeFile(t, filepath.Join(local, "conf.d", "db.conf"), "host=db")
+
+	rep, err := synchronize(client, &options{localDir: local, remoteDir: remote, dryRun: true})
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"app.conf", "conf.d/db.conf"}, rep.added)
+	_, err = os.Stat(remote)
+	assert.True(t, os.IsNotExist(err), "dry run must not change the remote side")
+
+	rep, err = synchronize(client, &options{localDir: local, remoteDir: remote})
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"app.conf", "conf.d/db.conf"}, rep.added)
+	assert.Equal(t, int64(14), rep.bytesTransferred)
+
+	rep, err = synchronize(client, &options{localDir: local, remoteDir: remote})
+	assert.Nil(t, err)
+	assert.Empty(t, rep.added)
+	assert.Empty(t, rep.updated)
+	assert.Equal(t, []string{"app.conf", "conf.d/db.conf"}, rep.unchanged)
+
+	// same size and mtime with different content is only detected by checksum
+	writeFile(t, filepath.Join(local, "app.conf"), "port=81")
+	mtime := time.Now().Add(-time.Hour).Truncate(time.Second)
+	assert.Nil(t, os.Chtimes(filepath.Join(local, "app.conf"), mtime, mtime))
+	assert.Nil(t, os.Chtimes(filepath.Join(remote, "app.conf"), mtime, mtime))
+
+	rep, err = synchronize(client, &options{localDir: local, remoteDir: remote, compare: compareSizeMtime})
+	assert.Nil(t, err)
+	assert.Empty(t, rep.updated)
+
+	rep, err = synchronize(client, &options{localDir: local, remoteDir: remote, compare: compareChecksum})
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"app.conf"}, rep.updated)
+	data, err := os.ReadFile(filepath.Join(remote, "app.conf"))
+	assert.Nil(t, err)
+	assert.Equal(t, "port=81", string(data))
+
+	writeFile(t, filepath.Join(remote, "old", "stale.conf"), "stale")
+	rep, err = synchronize(client, &options{localDir: local, remoteDir: remote})
+	assert.Nil(t, err)
+	assert.Empty(t, rep.deleted)
+
+	rep, err = synchronize(client, &options{localDir: local, remoteDir: remote, delete: true})
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"old/stale.conf"}, rep.deleted)
+	_, err = os.Stat(filepath.Join(remote, "old"))
+	assert.True(t, os.IsNotExist(err))
+}
+
+func TestSynchronizeSymlinkedDirectory(t *testing.T) {
+	client := sshtest.NewSFTPClient(t)
+	shared := t.TempDir()
+	local := filepath.Join(t.TempDir(), "bundle")
+	remote := filepath.ToSlash(filepath.Join(t.TempDir(), "mirror"))
+
+	writeFile(t, filepath.Join(shared, "db.conf"), "host=db")
+	assert.Nil(t, os.MkdirAll(local, 0755))
+	if err := os.Symlink(shared, filepath.Join(local, "conf.d")); err != nil {
+		t.Skip("symbolic links are not supported: " + err.Error())
+	}
+
+	// the content of a symbolic link to a directory is mirrored, and not deleted as extra
+	rep, err := synchronize(client, &options{localDir: local, remoteDir: remote, delete: true})
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"conf.d/db.conf"}, rep.added)
+	rep, err = synchronize(client, &options{localDir: local, remoteDir: remote, delete: true})
+	assert.Nil(t, err)
+	assert.Empty(t, rep.deleted)
+	assert.Equal(t, []string{"conf.d/db.conf"}, rep.unchanged)
+
+	// a link back to an ancestor fails rather than deleting anything
+	assert.Nil(t, os.Symlink(local, filepath.Join(shared, "loop")))
+	_, err = synchronize(client, &options{localDir: local, remoteDir: remote, delete: true})
+	assert.NotNil(t, err)
+	_, err = os.Stat(filepath.Join(remote, "conf.d", "db.conf"))
+	assert.Nil(t, err)
+}
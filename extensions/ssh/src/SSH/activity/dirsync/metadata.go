@@ -0,0 +1,115 @@
+package dirsync
+
+import (
+	ssh "github.com/mmussett/extensions/SSH/connector/connection"
+	"github.com/project-flogo/core/data/coerce"
+	"github.com/project-flogo/core/support/connection"
+)
+
+// Input corresponds to activity.json inputs
+type Input struct {
+	Connection connection.Manager `md:"SSH Connection,required"`
+	Host       string             `md:"host"`
+	Port       int                `md:"port"`
+	Compare    string             `md:"compare,allowed(sizemtime,checksum)"`
+	Delete     bool               `md:"delete"`
+	DryRun     bool               `md:"dryRun"`
+	LocalDir   string             `md:"localDir,required"`
+	RemoteDir  string             `md:"remoteDir,required"`
+}
+
+// Output corresponds to activity.json outputs
+type Output struct {
+	Report           map[string]interface{} `md:"report"`
+	Changed          bool                   `md:"changed"`
+	BytesTransferred int64                  `md:"bytesTransferred"`
+}
+
+// ToMap converts Input struct to map
+func (i *Input) ToMap() map[string]interface{} {
+	return map[string]interface{}{
+		"SSH Connection": i.Connection,
+		"host":           i.Host,
+		"port":           i.Port,
+		"compare":        i.Compare,
+		"delete":         i.Delete,
+		"dryRun":         i.DryRun,
+		"localDir":       i.LocalDir,
+		"remoteDir":      i.RemoteDir,
+	}
+}
+
+// FromMap converts a map to Input struct
+func (i *Input) FromMap(values map[string]interface{}) error {
+	var err error
+	i.Connection, err = ssh.GetSharedConfiguration(values["SSH Connection"])
+	if err != nil {
+		return err
+	}
+
+	i.Host, err = coerce.ToString(values["host"])
+	if err != nil {
+		return err
+	}
+
+	i.Port, err = coerce.ToInt(values["port"])
+	if err != nil {
+		return err
+	}
+
+	i.Compare, err = coerce.ToString(values["compare"])
+	if err != nil {
+		return err
+	}
+
+	i.Delete, err = coerce.ToBool(values["delete"])
+	if err != nil {
+		return err
+	}
+
+	i.DryRun, err = coerce.ToBool(values["dryRun"])
+	if err != nil {
+		return err
+	}
+
+	i.LocalDir, err = coerce.ToString(values["localDir"])
+	if err != nil {
+		return err
+	}
+
+	i.RemoteDir, err = coerce.ToString(values["remoteDir"])
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// ToMap converts Output struct to map
+func (o *Output) ToMap() map[string]interface{} {
+	return map[string]interface{}{
+		"report":           o.Report,
+		"changed":          o.Changed,
+		"bytesTransferred": o.BytesTransferred,
+	}
+}
+
+// FromMap converts a map to Output struct
+func (o *Output) FromMap(values map[string]interface{}) error {
+	var err error
+	o.Report, err = coerce.ToObject(values["report"])
+	if err != nil {
+		return err
+	}
+
+	o.Changed, err = coerce.ToBool(values["changed"])
+	if err != nil {
+		return err
+	}
+
+	o.BytesTransferred, err = coerce.ToInt64(values["bytesTransferred"])
+	if err != nil {
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,336 @@
+package dirsync
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/pkg/sftp"
+)
+
+const (
+	compareSizeMtime = "sizemtime"
+	compareChecksum  = "checksum"
+)
+
+// options controls a synchronization run
+type options struct {
+	localDir  string
+	remoteDir string
+	compare   string
+	delete    bool
+	dryRun    bool
+}
+
+// report lists the relative paths of the files handled by a synchronization run
+type report struct {
+	added            []string
+	updated          []string
+	deleted          []string
+	unchanged        []string
+	bytesTransferred int64
+}
+
+func (r *report) toMap() map[string]interface{} {
+	return map[string]interface{}{
+		"added":     toArray(r.added),
+		"updated":   toArray(r.updated),
+		"deleted":   toArray(r.deleted),
+		"unchanged": toArray(r.unchanged),
+	}
+}
+
+func toArray(values []string) []interface{} {
+	arr := make([]interface{}, len(values))
+	for i, v := range values {
+		arr[i] = v
+	}
+	return arr
+}
+
+// synchronize mirrors the local directory tree to the remote directory
+func synchronize(client *sftp.Client, opts *options) (*report, error) {
+	if opts.compare == "" {
+		opts.compare = compareSizeMtime
+	}
+	if opts.compare != compareSizeMtime && opts.compare != compareChecksum {
+		return nil, fmt.Errorf("unsupported compare mode '%s'", opts.compare)
+	}
+
+	localEntries, err := walkLocal(opts.localDir)
+	if err != nil {
+		return nil, err
+	}
+	remoteEntries, err := walkRemote(client, opts.remoteDir)
+	if err != nil {
+		return nil, err
+	}
+
+	rep := &report{}
+	if !opts.dryRun {
+		if err = client.MkdirAll(opts.remoteDir); err != nil {
+			return nil, fmt.Errorf("failed to create remote directory '%s': %s", opts.remoteDir, err.Error())
+		}
+	}
+
+	for _, rel := range sortedKeys(localEntries) {
+		local := localEntries[rel]
+		remote, exists := remoteEntries[rel]
+		remotePath := path.Join(opts.remoteDir, rel)
+
+		if local.IsDir() {
+			if exists && !remote.IsDir() {
+				return nil, fmt.Errorf("remote path '%s' is a file but the local path is a directory", remotePath)
+			}
+			if !exists && !opts.dryRun {
+				if err = client.MkdirAll(remotePath); err != nil {
+					return nil, fmt.Errorf("failed to create remote directory '%s': %s", remotePath, err.Error())
+				}
+			}
+			continue
+		}
+
+		localPath := filepath.Join(opts.localDir, filepath.FromSlash(rel))
+		if exists {
+			if remote.IsDir() {
+				return nil, fmt.Errorf("remote path '%s' is a directory but the local path is a file", remotePath)
+			}
+			same, err := sameContent(client, opts.compare, localPath, local, remotePath, remote)
+			if err != nil {
+				return nil, err
+			}
+			if same {
+				rep.unchanged = append(rep.unchanged, rel)
+				continue
+			}
+			rep.updated = append(rep.updated, rel)
+		} else {
+			rep.added = append(rep.added, rel)
+		}
+
+		if !opts.dryRun {
+			n, err := upload(client, localPath, local, remotePath)
+			if err != nil {
+				return nil, err
+			}
+			rep.bytesTransferred += n
+		}
+	}
+
+	if opts.delete {
+		// remove the deepest entries first so directories are empty when they are removed
+		extras := []string{}
+		for rel := range remoteEntries {
+			if _, ok := localEntries[rel]; !ok {
+				extras = append(extras, rel)
+			}
+		}
+		sort.Slice(extras, func(i, j int) bool {
+			return strings.Count(extras[i], "/") > strings.Count(extras[j], "/") || (strings.Count(extras[i], "/") == strings.Count(extras[j], "/") && extras[i] < extras[j])
+		})
+		for _, rel := range extras {
+			remote := remoteEntries[rel]
+			if !remote.IsDir() {
+				rep.deleted = append(rep.deleted, rel)
+			}
+			if opts.dryRun {
+				continue
+			}
+			remotePath := path.Join(opts.remoteDir, rel)
+			if remote.IsDir() {
+				err = client.RemoveDirectory(remotePath)
+			} else {
+				err = client.Remove(remotePath)
+			}
+			if err != nil {
+				return nil, fmt.Errorf("failed to delete remote path '%s': %s", remotePath, err.Error())
+			}
+		}
+		sort.Strings(rep.deleted)
+	}
+
+	return rep, nil
+}
+
+// walkLocal returns the entries below dir keyed by their slash separated relative path. Symbolic links
+// to directories are followed, so the remote side mirrors the content they point to.
+func walkLocal(dir string) (map[string]os.FileInfo, error) {
+	entries := map[string]os.FileInfo{}
+	if err := walkLocalDir(dir, "", map[string]bool{}, entries); err != nil {
+		return nil, fmt.Errorf("failed to read local directory '%s': %s", dir, err.Error())
+	}
+	return entries, nil
+}
+
+// walkLocalDir adds the entries of dir to entries. ancestors holds the resolved paths of the directories
+// being walked, so that a symbolic link back to one of them fails instead of looping.
+func walkLocalDir(dir string, rel string, ancestors map[string]bool, entries map[string]os.FileInfo) error {
+	resolved, err := filepath.EvalSymlinks(dir)
+	if err != nil {
+		return err
+	}
+	if ancestors[resolved] {
+		return fmt.Errorf("symbolic link loop at '%s'", dir)
+	}
+	ancestors[resolved] = true
+	defer delete(ancestors, resolved)
+
+	dirEntries, err := os.ReadDir(dir)
+	if err != nil {
+		return err
+	}
+	for _, d := range dirEntries {
+		p := filepath.Join(dir, d.Name())
+		info, err := os.Stat(p)
+		if err != nil {
+			return err
+		}
+		name := path.Join(rel, d.Name())
+		if info.IsDir() {
+			entries[name] = info
+			if err = walkLocalDir(p, name, ancestors, entries); err != nil {
+				return err
+			}
+		} else if info.Mode().IsRegular() {
+			entries[name] = info
+		}
+	}
+	return nil
+}
+
+// walkRemote returns the entries below dir keyed by their relative path. A missing directory has no entries.
+func walkRemote(client *sftp.Client, dir string) (map[string]os.FileInfo, error) {
+	entries := map[string]os.FileInfo{}
+	if _, err := client.Stat(dir); err != nil {
+		if os.IsNotExist(err) {
+			return entries, nil
+		}
+		return nil, fmt.Errorf("failed to stat remote directory '%s': %s", dir, err.Error())
+	}
+
+	walker := client.Walk(dir)
+	for walker.Step() {
+		if err := walker.Err(); err != nil {
+			return nil, fmt.Errorf("failed to read remote directory '%s': %s", walker.Path(), err.Error())
+		}
+		p := walker.Path()
+		if p == dir {
+			continue
+		}
+		info := walker.Stat()
+		if !info.IsDir() && !info.Mode().IsRegular() {
+			continue
+		}
+		entries[strings.TrimPrefix(strings.TrimPrefix(p, dir), "/")] = info
+	}
+	return entries, nil
+}
+
+func sameContent(client *sftp.Client, compare string, localPath string, local os.FileInfo, remotePath string, remote os.FileInfo) (bool, error) {
+	if local.Size() != remote.Size() {
+		return false, nil
+	}
+	if compare == compareSizeMtime {
+		return local.ModTime().Unix() == remote.ModTime().Unix(), nil
+	}
+
+	localSum, err := localChecksum(localPath)
+	if err != nil {
+		return false, err
+	}
+	remoteSum, err := remoteChecksum(client, remotePath)
+	if err != nil {
+		return false, err
+	}
+	return localSum == remoteSum, nil
+}
+
+// upload writes the local file to a temporary name and renames it over the target,
+// then copies the modification time so a later size+mtime comparison sees it as unchanged
+func upload(client *sftp.Client, localPath string, local os.FileInfo, remotePath string) (int64, error) {
+	src, err := os.Open(localPath)
+	if err != nil {
+		return 0, fmt.Errorf("failed to open local file '%s': %s", localPath, err.Error())
+	}
+	defer src.Close()
+
+	dir, name := path.Split(remotePath)
+	tmp := dir + "." + name + ".sync.tmp"
+	dst, err := client.Create(tmp)
+	if err != nil {
+		return 0, fmt.Errorf("failed to create remote file '%s': %s", tmp, err.Error())
+	}
+	n, err := io.Copy(dst, src)
+	closeErr := dst.Close()
+	if err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		client.Remove(tmp)
+		return 0, fmt.Errorf("failed to write remote file '%s': %s", tmp, err.Error())
+	}
+
+	if err = client.Chmod(tmp, local.Mode().Perm()); err != nil {
+		client.Remove(tmp)
+		return 0, fmt.Errorf("failed to chmod '%s': %s", tmp, err.Error())
+	}
+	if err = client.Chtimes(tmp, local.ModTime(), local.ModTime()); err != nil {
+		client.Remove(tmp)
+		return 0, fmt.Errorf("failed to set modification time of '%s': %s", tmp, err.Error())
+	}
+
+	if _, ok := client.HasExtension("posix-rename@openssh.com"); ok {
+		err = client.PosixRename(tmp, remotePath)
+	} else {
+		client.Remove(remotePath)
+		err = client.Rename(tmp, remotePath)
+	}
+	if err != nil {
+		client.Remove(tmp)
+		return 0, fmt.Errorf("failed to rename '%s' to '%s': %s", tmp, remotePath, err.Error())
+	}
+	return n, nil
+}
+
+func localChecksum(p string) (string, error) {
+	f, err := os.Open(p)
+	if err != nil {
+		return "", fmt.Errorf("failed to open local file '%s': %s", p, err.Error())
+	}
+	defer f.Close()
+
+	hash := sha256.New()
+	if _, err = io.Copy(hash, f); err != nil {
+		return "", fmt.Errorf("failed to read local file '%s': %s", p, err.Error())
+	}
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+func remoteChecksum(client *sftp.Client, p string) (string, error) {
+	f, err := client.Open(p)
+	if err != nil {
+		return "", fmt.Errorf("failed to open remote file '%s': %s", p, err.Error())
+	}
+	defer f.Close()
+
+	hash := sha256.New()
+	if _, err = io.Copy(hash, f); err != nil {
+		return "", fmt.Errorf("failed to read remote file '%s': %s", p, err.Error())
+	}
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+func sortedKeys(m map[string]os.FileInfo) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
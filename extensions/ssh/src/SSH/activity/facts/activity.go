@@ -0,0 +1,77 @@
+package facts
+
+import (
+	gocontext "context"
+	"fmt"
+	"time"
+
+	ssh "github.com/mmussett/extensions/SSH/connector/connection"
+	"github.com/project-flogo/core/activity"
+	"github.com/project-flogo/core/support/log"
+)
+
+var activityMd = activity.ToMetadata(&Input{}, &Output{})
+
+func init() {
+	_ = activity.Register(&MyActivity{}, New)
+}
+
+// New creates a new activity
+func New(ctx activity.InitContext) (activity.Activity, error) {
+	return &MyActivity{logger: log.ChildLogger(ctx.Logger(), "SSH-activity-facts"), activityName: "facts"}, nil
+}
+
+// MyActivity gathers facts about the host of the SSH connection
+type MyActivity struct {
+	logger       log.Logger
+	activityName string
+}
+
+// Metadata implements activity.Activity.Metadata
+func (*MyActivity) Metadata() *activity.Metadata {
+	return activityMd
+}
+
+// Eval implements activity.Activity.Eval
+func (activity *MyActivity) Eval(context activity.Context) (done bool, err error) {
+
+	input := &Input{}
+
+	//Get Input Object
+	err = context.GetInputObject(input)
+	if err != nil {
+		return false, err
+	}
+
+	selected, err := selectGatherers(input.Facts)
+	if err != nil {
+		return false, err
+	}
+	timeout := input.Timeout
+	if timeout <= 0 {
+		timeout = defaultTimeout
+	}
+
+	client, err := ssh.GetHostClient(input.Connection, input.Host, input.Port)
+	if err != nil {
+		return false, err
+	}
+
+	activity.logger.Debugf("Gathering %d facts from %s", len(selected), client.Host())
+	ctx := ssh.WithActivity(gocontext.Background(), context.ActivityHost().Name(), context.Name())
+	facts, errs := gather(ctx, client, selected, time.Duration(timeout)*time.Second)
+	for _, e := range errs {
+		activity.logger.Debugf("Fact %s not gathered from %s: %s", e["fact"], client.Host(), e["error"])
+	}
+	if len(facts) == 0 {
+		return false, fmt.Errorf("no facts gathered from %s: %s", client.Host(), errs[0]["error"])
+	}
+
+	//Set output object
+	err = context.SetOutputObject(&Output{Facts: facts, Errors: errs})
+	if err != nil {
+		return false, err
+	}
+
+	return true, nil
+}
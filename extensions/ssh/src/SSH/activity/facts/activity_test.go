@@ -0,0 +1,210 @@
+package facts
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"os/exec"
+	"strings"
+	"testing"
+	"time"
+
+	ssh "github.com/mmussett/extensions/SSH/connector/connection"
+	"github.com/mmussett/extensions/SSH/internal/sshtest"
+	"github.com/project-flogo/core/activity"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRegister(t *testing.T) {
+	ref := activity.GetRef(&MyActivity{})
+	act := activity.Get(ref)
+
+	assert.NotNil(t, act)
+}
+
+// fakeRunner returns canned results by command, other commands are rejected by the policy
+type fakeRunner map[string]*ssh.RunResult
+
+func (f fakeRunner) Run(ctx context.Context, cmd string, opts *ssh.RunOptions) (*ssh.RunResult, error) {
+	if result, ok := f[cmd]; ok {
+		return result, nil
+	}
+	return nil, &ssh.PolicyError{Command: cmd, Reason: "not allowed"}
+}
+
+func stdout(s string) *ssh.RunResult {
+	return &ssh.RunResult{Stdout: []byte(s)}
+}
+
+func TestGatherLinux(t *testing.T) {
+	client := fakeRunner{
+		"cat /etc/os-release": stdout(`PRETTY_NAME="Ubuntu 22.04.4 LTS"
+NAME="Ubuntu"
+VERSION_ID="22.04"
+ID=ubuntu
+ID_LIKE=debian
+`),
+		"uname -s":                  stdout("Linux\n"),
+		"uname -r":                  stdout("5.15.0-105-generic\n"),
+		"uname -v":                  stdout("#115-Ubuntu SMP Mon Apr 15 09:52:04 UTC 2024\n"),
+		"uname -m":                  stdout("x86_64\n"),
+		"hostname":                  stdout("web-1\n"),
+		"date +%s":                  stdout("1714560000\n"),
+		"cat /proc/uptime":          stdout("356400.52 1402035.13\n"),
+		"getconf _NPROCESSORS_ONLN": stdout("8\n"),
+		"cat /proc/meminfo":         stdout("MemTotal:       16307588 kB\nMemFree:         1022016 kB\nMemAvailable:   11950240 kB\n"),
+		"df -P -k": stdout(`Filesystem     1024-blocks     Used Available Capacity Mounted on
+/dev/sda1         101445540 42105432  59323724      42% /
+/dev/sdb1          51475068        0  48837820       0% /mnt/backup disk
+`),
+		"ss -tuln": stdout(`Netid State  Recv-Q Send-Q Local Address:Port  Peer Address:PortProcess
+udp   UNCONN 0      0      127.0.0.53%lo:53         0.0.0.0:*
+tcp   LISTEN 0      4096   127.0.0.53%lo:53         0.0.0.0:*
+tcp   LISTEN 0      128          0.0.0.0:22         0.0.0.0:*
+tcp   LISTEN 0      128             [::]:22            [::]:*
+tcp   LISTEN 0      511                *:80               *:*
+`),
+	}
+
+	selected, err := selectGatherers("")
+	assert.Nil(t, err)
+	facts, errs := gather(context.Background(), sshtest.RunFunc(client.Run), selected, time.Second)
+	assert.Empty(t, errs)
+
+	assert.Equal(t, map[string]interface{}{
+		"name": "Ubuntu", "distribution": "ubuntu", "version": "22.04", "prettyName": "Ubuntu 22.04.4 LTS",
+	}, facts["os"])
+	assert.Equal(t, map[string]interface{}{
+		"name": "Linux", "release": "5.15.0-105-generic", "version": "#115-Ubuntu SMP Mon Apr 15 09:52:04 UTC 2024",
+	}, facts["kernel"])
+	assert.Equal(t, "x86_64", facts["architecture"])
+	assert.Equal(t, "web-1", facts["hostname"])
+	assert.Equal(t, map[string]interface{}{"seconds": int64(356400), "bootTime": "2024-04-27T07:40:00Z"}, facts["uptime"])
+	assert.Equal(t, 8, facts["cpuCount"])
+	assert.Equal(t, map[string]interface{}{"totalBytes": int64(16307588 * 1024), "availableBytes": int64(11950240 * 1024)}, facts["memory"])
+	assert.Equal(t, []interface{}{
+		map[string]interface{}{"filesystem": "/dev/sda1", "mountPoint": "/", "sizeBytes": int64(101445540 * 1024), "usedBytes": int64(42105432 * 1024), "availableBytes": int64(59323724 * 1024), "usedPercent": 42},
+		map[string]interface{}{"filesystem": "/dev/sdb1", "mountPoint": "/mnt/backup disk", "sizeBytes": int64(51475068 * 1024), "usedBytes": int64(0), "availableBytes": int64(48837820 * 1024), "usedPercent": 0},
+	}, facts["filesystems"])
+	assert.Equal(t, []interface{}{
+		map[string]interface{}{"protocol": "tcp", "address": "0.0.0.0", "port": 22},
+		map[string]interface{}{"protocol": "tcp", "address": "::", "port": 22},
+		map[string]interface{}{"protocol": "tcp", "address": "127.0.0.53", "port": 53},
+		map[string]interface{}{"protocol": "tcp", "address": "*", "port": 80},
+		map[string]interface{}{"protocol": "udp", "address": "127.0.0.53", "port": 53},
+	}, facts["listeningPorts"])
+}
+
+func TestGatherMacOS(t *testing.T) {
+	// the Linux commands are not available
+	client := fakeRunner{
+		"cat /etc/os-release":       {Stderr: []byte("cat: /etc/os-release: No such file or directory\n"), ExitCode: 1},
+		"sw_vers":                   stdout("ProductName:\t\tmacOS\nProductVersion:\t\t14.4.1\nBuildVersion:\t\t23E224\n"),
+		"date +%s":                  stdout("1714560000\n"),
+		"cat /proc/uptime":          {ExitCode: 1},
+		"sysctl -n kern.boottime":   stdout("{ sec = 1714500000, usec = 0 } Tue Apr 30 18:00:00 2024\n"),
+		"getconf _NPROCESSORS_ONLN": stdout("10\n"),
+		"cat /proc/meminfo":         {ExitCode: 1},
+		"sysctl -n hw.memsize":      stdout("17179869184\n"),
+		"ss -tuln":                  {ExitCode: 127},
+		"netstat -an": stdout(`Active Internet connections (including servers)
+Proto Recv-Q Send-Q  Local Address          Foreign Address        (state)
+tcp4       0      0  192.168.1.20.52144     17.57.146.20.5223      ESTABLISHED
+tcp46      0      0  *.5000                 *.*                    LISTEN
+tcp6       0      0  ::1.631                *.*                    LISTEN
+udp4       0      0  *.5353                 *.*
+udp4       0      0  192.168.1.20.60001     8.8.8.8.53
+Active LOCAL (UNIX) domain sockets
+Address          Type   Recv-Q Send-Q            Inode             Conn             Refs          Nextref Addr
+49f8c53f3f2a64e7 stream      0      0                0 49f8c53f3f2a4a5f                0                0
+`),
+	}
+
+	selected, err := selectGatherers("os, uptime,CPUCOUNT,memory,listeningPorts,hostname")
+	assert.Nil(t, err)
+	facts, errs := gather(context.Background(), sshtest.RunFunc(client.Run), selected, time.Second)
+
+	assert.Equal(t, map[string]interface{}{
+		"name": "macOS", "distribution": "macos", "version": "14.4.1", "prettyName": "macOS 14.4.1",
+	}, facts["os"])
+	assert.Equal(t, map[string]interface{}{"seconds": int64(60000), "bootTime": "2024-04-30T18:00:00Z"}, facts["uptime"])
+	assert.Equal(t, 10, facts["cpuCount"])
+	assert.Equal(t, map[string]interface{}{"totalBytes": int64(17179869184)}, facts["memory"])
+	assert.Equal(t, []interface{}{
+		map[string]interface{}{"protocol": "tcp", "address": "::1", "port": 631},
+		map[string]interface{}{"protocol": "tcp", "address": "*", "port": 5000},
+		map[string]interface{}{"protocol": "udp", "address": "*", "port": 5353},
+	}, facts["listeningPorts"])
+
+	// the hostname commands are rejected by the command policy of the connection
+	assert.NotContains(t, facts, "hostname")
+	if assert.Len(t, errs, 1) {
+		assert.Equal(t, "hostname", errs[0]["fact"])
+		assert.Equal(t, "uname -n", errs[0]["command"])
+		assert.Equal(t, -1, errs[0]["exitCode"])
+		assert.Contains(t, errs[0]["error"], "not allowed")
+	}
+}
+
+func TestGatherErrors(t *testing.T) {
+	client := fakeRunner{
+		"df -P -k":                  {Stderr: []byte("df: /proc/foo: Permission denied\n"), ExitCode: 1},
+		"ss -tuln":                  {ExitCode: 127},
+		"netstat -an":               {ExitCode: 127},
+		"getconf _NPROCESSORS_ONLN": stdout("many\n"),
+		// output printed before the command failed is still parsed
+		"cat /proc/meminfo":    {Stdout: []byte("MemTotal: 2048 kB\nMemFree: 1024 kB\n"), ExitCode: 1},
+		"sysctl -n hw.memsize": {ExitCode: 1},
+	}
+	selected, err := selectGatherers("filesystems,listeningPorts,cpuCount,memory")
+	assert.Nil(t, err)
+	facts, errs := gather(context.Background(), sshtest.RunFunc(client.Run), selected, time.Second)
+
+	assert.Equal(t, map[string]interface{}{"totalBytes": int64(2048 * 1024), "availableBytes": int64(1024 * 1024)}, facts["memory"])
+	assert.Len(t, errs, 3)
+	assert.Equal(t, "command exited with status 1: df: /proc/foo: Permission denied", errs[0]["error"])
+	assert.Equal(t, "netstat -an", errs[1]["command"])
+	assert.Equal(t, 127, errs[1]["exitCode"])
+	assert.Equal(t, "command exited with status 127, the fact is not available on this host", errs[1]["error"])
+	assert.Equal(t, "cannot parse output: invalid CPU count 'many'", errs[2]["error"])
+
+	_, err = selectGatherers("os,processes")
+	assert.EqualError(t, err, "unknown fact 'processes'")
+	_, err = selectGatherers(" , ")
+	assert.NotNil(t, err)
+}
+
+// localRunner runs the commands with the local shell, as an SSH server would. Like a server
+// with Forbid Shell Metacharacters, it rejects commands that use shell syntax.
+type localRunner struct{}
+
+func (localRunner) Run(ctx context.Context, cmd string, opts *ssh.RunOptions) (*ssh.RunResult, error) {
+	if strings.ContainsAny(cmd, ";&|`$<>()\n\r'\"") {
+		return nil, errors.New("unexpected shell syntax in " + cmd)
+	}
+	var stdout, stderr bytes.Buffer
+	c := exec.CommandContext(ctx, "sh", "-c", cmd)
+	c.Stdout, c.Stderr = &stdout, &stderr
+	err := c.Run()
+	result := &ssh.RunResult{Stdout: stdout.Bytes(), Stderr: stderr.Bytes()}
+	if exitErr, ok := err.(*exec.ExitError); ok {
+		result.ExitCode = exitErr.ExitCode()
+	} else if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+func TestGatherLocal(t *testing.T) {
+	if _, err := exec.LookPath("sh"); err != nil {
+		t.Skip("no shell available")
+	}
+	facts, errs := gather(context.Background(), sshtest.RunFunc(localRunner{}.Run), gatherers, 10*time.Second)
+	for _, e := range errs {
+		// listening ports depend on the tools installed on the host
+		assert.Equal(t, "listeningPorts", e["fact"], e["error"])
+	}
+	for _, name := range []string{"os", "kernel", "architecture", "hostname", "uptime", "cpuCount", "memory", "filesystems"} {
+		assert.Contains(t, facts, name)
+	}
+}
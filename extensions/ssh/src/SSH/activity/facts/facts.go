@@ -0,0 +1,440 @@
+package facts
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	ssh "github.com/mmussett/extensions/SSH/connector/connection"
+)
+
+const defaultTimeout = 30
+
+// gatherer collects one fact. Its steps run in order and their outputs are parsed together, one
+// after the other. Each step lists alternative commands: the Linux source of the fact before the
+// BSD and macOS ones. The commands use no shell syntax, so they do not depend on the login shell
+// of the user and pass a policy that forbids shell metacharacters.
+type gatherer struct {
+	name  string
+	steps [][]string
+	parse func(stdout string) (interface{}, error)
+}
+
+var gatherers = []gatherer{
+	{"os", [][]string{{"cat /etc/os-release", "sw_vers", "uname -s"}}, parseOS},
+	{"kernel", [][]string{{"uname -s"}, {"uname -r"}, {"uname -v"}}, parseKernel},
+	{"architecture", [][]string{{"uname -m"}}, parseLine},
+	{"hostname", [][]string{{"hostname", "uname -n"}}, parseLine},
+	{"uptime", [][]string{{"date +%s"}, {"cat /proc/uptime", "sysctl -n kern.boottime"}}, parseUptime},
+	{"cpuCount", [][]string{{"getconf _NPROCESSORS_ONLN", "nproc", "sysctl -n hw.ncpu"}}, parseCPUCount},
+	{"memory", [][]string{{"cat /proc/meminfo", "sysctl -n hw.memsize"}}, parseMemory},
+	{"filesystems", [][]string{{"df -P -k"}}, parseFilesystems},
+	{"listeningPorts", [][]string{{"ss -tuln", "netstat -an"}}, parseListeningPorts},
+}
+
+// selectGatherers returns the gatherers of a comma separated list of fact names, by default all
+func selectGatherers(names string) ([]gatherer, error) {
+	if strings.TrimSpace(names) == "" {
+		return gatherers, nil
+	}
+	var selected []gatherer
+	for _, name := range strings.Split(names, ",") {
+		name = strings.TrimSpace(name)
+		if name == "" {
+			continue
+		}
+		found := false
+		for _, g := range gatherers {
+			if strings.EqualFold(g.name, name) {
+				selected = append(selected, g)
+				found = true
+				break
+			}
+		}
+		if !found {
+			return nil, fmt.Errorf("unknown fact '%s'", name)
+		}
+	}
+	if len(selected) == 0 {
+		return nil, fmt.Errorf("no facts specified")
+	}
+	return selected, nil
+}
+
+// gather runs the steps of each gatherer and returns the parsed facts and an error entry
+// for each fact that could not be gathered. A fact fails when the last alternative of a step
+// exits with a non-zero status without output or is rejected by the command policy of the
+// connection, or when the output cannot be parsed.
+func gather(ctx context.Context, client ssh.Client, selected []gatherer, timeout time.Duration) (map[string]interface{}, []map[string]interface{}) {
+	facts := make(map[string]interface{}, len(selected))
+	errs := []map[string]interface{}{}
+	for _, g := range selected {
+		value, cmd, exitCode, err := runGatherer(ctx, client, g, timeout)
+		if err != nil {
+			errs = append(errs, map[string]interface{}{
+				"fact":     g.name,
+				"command":  cmd,
+				"exitCode": exitCode,
+				"error":    err.Error(),
+			})
+			continue
+		}
+		facts[g.name] = value
+	}
+	return facts, errs
+}
+
+// runGatherer runs the steps of g within timeout and parses their output. It returns the
+// command that failed, or the commands whose output could not be parsed.
+func runGatherer(ctx context.Context, client ssh.Client, g gatherer, timeout time.Duration) (interface{}, string, int, error) {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	var outputs, cmds []string
+	exitCode := 0
+	for _, alternatives := range g.steps {
+		cmd, result, err := runStep(ctx, client, alternatives)
+		if err != nil {
+			return nil, cmd, -1, err
+		}
+		stdout := strings.TrimSpace(string(result.Stdout))
+		if result.ExitCode != 0 && stdout == "" {
+			if stderr := strings.TrimSpace(string(result.Stderr)); stderr != "" {
+				return nil, cmd, result.ExitCode, fmt.Errorf("command exited with status %d: %s", result.ExitCode, stderr)
+			}
+			return nil, cmd, result.ExitCode, fmt.Errorf("command exited with status %d, the fact is not available on this host", result.ExitCode)
+		}
+		outputs = append(outputs, stdout)
+		cmds = append(cmds, cmd)
+		if result.ExitCode != 0 {
+			exitCode = result.ExitCode
+		}
+	}
+
+	cmd := strings.Join(cmds, "; ")
+	value, err := g.parse(strings.Join(outputs, "\n"))
+	if err != nil {
+		return nil, cmd, exitCode, fmt.Errorf("cannot parse output: %s", err.Error())
+	}
+	return value, cmd, exitCode, nil
+}
+
+// stepResult is the outcome of one command of a step
+type stepResult struct {
+	cmd    string
+	result *ssh.RunResult
+	err    error
+}
+
+// runStep runs the alternatives of a step until one exits with status 0. An alternative that is
+// not available on the host or is rejected by the command policy is followed by the next one.
+// When none succeeds, the first that printed output is returned, or else the last one.
+func runStep(ctx context.Context, client ssh.Client, alternatives []string) (string, *ssh.RunResult, error) {
+	var partial, last *stepResult
+	for _, cmd := range alternatives {
+		result, err := client.Run(ctx, cmd, nil)
+		last = &stepResult{cmd: cmd, result: result, err: err}
+		if err == nil && result.ExitCode == 0 {
+			break
+		}
+		if err == nil && partial == nil && strings.TrimSpace(string(result.Stdout)) != "" {
+			partial = last
+		}
+		if ctx.Err() != nil {
+			break
+		}
+	}
+	if partial != nil && (last.err != nil || last.result.ExitCode != 0) {
+		last = partial
+	}
+	return last.cmd, last.result, last.err
+}
+
+// parseLine returns the first line of the output
+func parseLine(stdout string) (interface{}, error) {
+	line := strings.TrimSpace(strings.SplitN(stdout, "\n", 2)[0])
+	if line == "" {
+		return nil, fmt.Errorf("empty output")
+	}
+	return line, nil
+}
+
+// parseOS parses /etc/os-release, the output of sw_vers, or the kernel name as last resort
+func parseOS(stdout string) (interface{}, error) {
+	values := make(map[string]string)
+	for _, line := range strings.Split(stdout, "\n") {
+		line = strings.TrimSpace(line)
+		if key, value, ok := strings.Cut(line, "="); ok {
+			values[key] = strings.Trim(value, `"'`)
+		} else if key, value, ok := strings.Cut(line, ":"); ok {
+			values[key] = strings.TrimSpace(value)
+		}
+	}
+
+	switch {
+	case values["ID"] != "" || values["NAME"] != "":
+		os := map[string]interface{}{
+			"name":         values["NAME"],
+			"distribution": values["ID"],
+			"version":      values["VERSION_ID"],
+			"prettyName":   values["PRETTY_NAME"],
+		}
+		if os["distribution"] == "" {
+			os["distribution"] = strings.ToLower(values["NAME"])
+		}
+		if os["prettyName"] == "" {
+			os["prettyName"] = strings.TrimSpace(values["NAME"] + " " + values["VERSION_ID"])
+		}
+		return os, nil
+	case values["ProductName"] != "":
+		return map[string]interface{}{
+			"name":         values["ProductName"],
+			"distribution": strings.ToLower(values["ProductName"]),
+			"version":      values["ProductVersion"],
+			"prettyName":   strings.TrimSpace(values["ProductName"] + " " + values["ProductVersion"]),
+		}, nil
+	}
+
+	name, err := parseLine(stdout)
+	if err != nil {
+		return nil, err
+	}
+	return map[string]interface{}{
+		"name":         name,
+		"distribution": strings.ToLower(name.(string)),
+		"version":      "",
+		"prettyName":   name,
+	}, nil
+}
+
+// parseKernel parses the kernel name, release and version printed on separate lines
+func parseKernel(stdout string) (interface{}, error) {
+	lines := strings.Split(stdout, "\n")
+	if len(lines) < 2 {
+		return nil, fmt.Errorf("expected the kernel name and release")
+	}
+	kernel := map[string]interface{}{
+		"name":    strings.TrimSpace(lines[0]),
+		"release": strings.TrimSpace(lines[1]),
+		"version": "",
+	}
+	if len(lines) > 2 {
+		kernel["version"] = strings.TrimSpace(lines[2])
+	}
+	return kernel, nil
+}
+
+var bootTimeRegexp = regexp.MustCompile(`sec = (\d+)`)
+
+// parseUptime parses the current time in seconds followed by /proc/uptime or kern.boottime
+func parseUptime(stdout string) (interface{}, error) {
+	lines := strings.SplitN(stdout, "\n", 2)
+	if len(lines) < 2 {
+		return nil, fmt.Errorf("expected the current time and the uptime")
+	}
+	now, err := strconv.ParseInt(strings.TrimSpace(lines[0]), 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("invalid current time '%s'", lines[0])
+	}
+
+	var seconds int64
+	if m := bootTimeRegexp.FindStringSubmatch(lines[1]); m != nil {
+		boot, _ := strconv.ParseInt(m[1], 10, 64)
+		seconds = now - boot
+	} else {
+		fields := strings.Fields(lines[1])
+		if len(fields) == 0 {
+			return nil, fmt.Errorf("empty uptime")
+		}
+		uptime, err := strconv.ParseFloat(fields[0], 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid uptime '%s'", fields[0])
+		}
+		seconds = int64(uptime)
+	}
+	return map[string]interface{}{
+		"seconds":  seconds,
+		"bootTime": time.Unix(now-seconds, 0).UTC().Format(time.RFC3339),
+	}, nil
+}
+
+func parseCPUCount(stdout string) (interface{}, error) {
+	line, err := parseLine(stdout)
+	if err != nil {
+		return nil, err
+	}
+	count, err := strconv.Atoi(line.(string))
+	if err != nil || count < 1 {
+		return nil, fmt.Errorf("invalid CPU count '%s'", line)
+	}
+	return count, nil
+}
+
+// parseMemory parses /proc/meminfo, or the total memory in bytes reported by hw.memsize.
+// The available memory is only known on Linux.
+func parseMemory(stdout string) (interface{}, error) {
+	if !strings.Contains(stdout, "MemTotal:") {
+		total, err := strconv.ParseInt(strings.TrimSpace(stdout), 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid memory size '%s'", stdout)
+		}
+		return map[string]interface{}{"totalBytes": total}, nil
+	}
+
+	values := make(map[string]int64)
+	for _, line := range strings.Split(stdout, "\n") {
+		key, value, ok := strings.Cut(line, ":")
+		if !ok {
+			continue
+		}
+		fields := strings.Fields(value)
+		if len(fields) == 0 {
+			continue
+		}
+		kb, err := strconv.ParseInt(fields[0], 10, 64)
+		if err != nil {
+			continue
+		}
+		values[key] = kb * 1024
+	}
+	available, ok := values["MemAvailable"]
+	if !ok {
+		// kernels before 3.14 do not report MemAvailable
+		available = values["MemFree"] + values["Buffers"] + values["Cached"]
+	}
+	return map[string]interface{}{
+		"totalBytes":     values["MemTotal"],
+		"availableBytes": available,
+	}, nil
+}
+
+// parseFilesystems parses the POSIX output of df -P -k. Mount points may contain spaces.
+func parseFilesystems(stdout string) (interface{}, error) {
+	filesystems := []interface{}{}
+	for _, line := range strings.Split(stdout, "\n")[1:] {
+		fields := strings.Fields(line)
+		if len(fields) < 6 {
+			continue
+		}
+		size, err1 := strconv.ParseInt(fields[1], 10, 64)
+		used, err2 := strconv.ParseInt(fields[2], 10, 64)
+		available, err3 := strconv.ParseInt(fields[3], 10, 64)
+		if err1 != nil || err2 != nil || err3 != nil {
+			continue
+		}
+		percent, _ := strconv.Atoi(strings.TrimSuffix(fields[4], "%"))
+		filesystems = append(filesystems, map[string]interface{}{
+			"filesystem":     fields[0],
+			"mountPoint":     strings.Join(fields[5:], " "),
+			"sizeBytes":      size * 1024,
+			"usedBytes":      used * 1024,
+			"availableBytes": available * 1024,
+			"usedPercent":    percent,
+		})
+	}
+	if len(filesystems) == 0 {
+		return nil, fmt.Errorf("no filesystems listed")
+	}
+	return filesystems, nil
+}
+
+// listeningPort is a TCP port in the LISTEN state or a bound UDP port
+type listeningPort struct {
+	protocol string
+	address  string
+	port     int
+}
+
+// parseListeningPorts parses the output of ss -tuln or netstat -an. Linux lists addresses as
+// host:port, BSD and macOS as host.port.
+func parseListeningPorts(stdout string) (interface{}, error) {
+	seen := make(map[listeningPort]bool)
+	var ports []listeningPort
+	ssFormat := strings.HasPrefix(stdout, "Netid")
+	for _, line := range strings.Split(stdout, "\n") {
+		fields := strings.Fields(line)
+		var protocol, local string
+		switch {
+		case ssFormat && len(fields) >= 5:
+			protocol, local = fields[0], fields[4]
+		case !ssFormat && len(fields) >= 5:
+			protocol, local = fields[0], fields[3]
+			if strings.HasPrefix(protocol, "tcp") && fields[len(fields)-1] != "LISTEN" {
+				continue
+			}
+			// connected UDP sockets have a foreign address
+			if strings.HasPrefix(protocol, "udp") && !strings.HasSuffix(fields[4], "*") {
+				continue
+			}
+		default:
+			continue
+		}
+		switch {
+		case strings.HasPrefix(protocol, "tcp"):
+			protocol = "tcp"
+		case strings.HasPrefix(protocol, "udp"):
+			protocol = "udp"
+		default:
+			continue
+		}
+		address, port, ok := splitAddress(local)
+		if !ok {
+			continue
+		}
+		p := listeningPort{protocol: protocol, address: address, port: port}
+		if !seen[p] {
+			seen[p] = true
+			ports = append(ports, p)
+		}
+	}
+	if !ssFormat && len(ports) == 0 && !strings.Contains(stdout, "Proto") {
+		return nil, fmt.Errorf("unrecognized output")
+	}
+
+	sort.Slice(ports, func(i, j int) bool {
+		if ports[i].protocol != ports[j].protocol {
+			return ports[i].protocol < ports[j].protocol
+		}
+		if ports[i].port != ports[j].port {
+			return ports[i].port < ports[j].port
+		}
+		return ports[i].address < ports[j].address
+	})
+	list := make([]interface{}, len(ports))
+	for idx, p := range ports {
+		list[idx] = map[string]interface{}{"protocol": p.protocol, "address": p.address, "port": p.port}
+	}
+	return list, nil
+}
+
+// splitAddress splits host:port, [host]:port and host.port local addresses. The interface
+// suffix of link-local addresses, such as %lo, is removed.
+func splitAddress(local string) (string, int, bool) {
+	idx := strings.LastIndex(local, ":")
+	if _, err := strconv.Atoi(local[idx+1:]); idx < 0 || err != nil {
+		idx = strings.LastIndex(local, ".")
+	}
+	if idx < 0 {
+		return "", 0, false
+	}
+	port, err := strconv.Atoi(local[idx+1:])
+	if err != nil {
+		return "", 0, false
+	}
+	address := strings.Trim(local[:idx], "[]")
+	if i := strings.Index(address, "%"); i >= 0 {
+		address = address[:i]
+	}
+	if address == "" {
+		address = "*"
+	}
+	if ip := net.ParseIP(address); ip != nil {
+		address = ip.String()
+	}
+	return address, port, true
+}
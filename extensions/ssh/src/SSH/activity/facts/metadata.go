@@ -0,0 +1,111 @@
+package facts
+
+import (
+	ssh "github.com/mmussett/extensions/SSH/connector/connection"
+	"github.com/project-flogo/core/data/coerce"
+	"github.com/project-flogo/core/support/connection"
+)
+
+// Input corresponds to activity.json inputs
+type Input struct {
+	Connection connection.Manager `md:"SSH Connection,required"`
+	Host       string             `md:"host"`
+	Port       int                `md:"port"`
+	Facts      string             `md:"facts"`
+	Timeout    int                `md:"timeout"`
+}
+
+// Output corresponds to activity.json outputs
+type Output struct {
+	Facts  map[string]interface{}   `md:"facts"`
+	Errors []map[string]interface{} `md:"errors"`
+}
+
+// ToMap converts Input struct to map
+func (i *Input) ToMap() map[string]interface{} {
+	return map[string]interface{}{
+		"SSH Connection": i.Connection,
+		"host":           i.Host,
+		"port":           i.Port,
+		"facts":          i.Facts,
+		"timeout":        i.Timeout,
+	}
+}
+
+// FromMap converts a map to Input struct
+func (i *Input) FromMap(values map[string]interface{}) error {
+	var err error
+	i.Connection, err = ssh.GetSharedConfiguration(values["SSH Connection"])
+	if err != nil {
+		return err
+	}
+
+	i.Host, err = coerce.ToString(values["host"])
+	if err != nil {
+		return err
+	}
+
+	i.Port, err = coerce.ToInt(values["port"])
+	if err != nil {
+		return err
+	}
+
+	i.Facts, err = coerce.ToString(values["facts"])
+	if err != nil {
+		return err
+	}
+
+	i.Timeout, err = coerce.ToInt(values["timeout"])
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// ToMap converts Output struct to map
+func (o *Output) ToMap() map[string]interface{} {
+	return map[string]interface{}{
+		"facts":  o.Facts,
+		"errors": toArray(o.Errors),
+	}
+}
+
+// FromMap converts a map to Output struct
+func (o *Output) FromMap(values map[string]interface{}) error {
+	var err error
+	o.Facts, err = coerce.ToObject(values["facts"])
+	if err != nil {
+		return err
+	}
+
+	o.Errors, err = toObjects(values["errors"])
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+func toArray(objects []map[string]interface{}) []interface{} {
+	array := make([]interface{}, len(objects))
+	for idx, obj := range objects {
+		array[idx] = obj
+	}
+	return array
+}
+
+func toObjects(value interface{}) ([]map[string]interface{}, error) {
+	array, err := coerce.ToArray(value)
+	if err != nil {
+		return nil, err
+	}
+	objects := make([]map[string]interface{}, 0, len(array))
+	for _, v := range array {
+		obj, err := coerce.ToObject(v)
+		if err != nil {
+			return nil, err
+		}
+		objects = append(objects, obj)
+	}
+	return objects, nil
+}
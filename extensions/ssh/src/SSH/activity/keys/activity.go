@@ -0,0 +1,120 @@
+package keys
+
+import (
+	"fmt"
+
+	ssh "github.com/mmussett/extensions/SSH/connector/connection"
+	"github.com/mmussett/extensions/SSH/server"
+	"github.com/project-flogo/core/activity"
+	"github.com/project-flogo/core/support/log"
+	gossh "golang.org/x/crypto/ssh"
+)
+
+var activityMd = activity.ToMetadata(&Input{}, &Output{})
+
+func init() {
+	_ = activity.Register(&MyActivity{}, New)
+}
+
+// New creates a new activity
+func New(ctx activity.InitContext) (activity.Activity, error) {
+	return &MyActivity{logger: log.ChildLogger(ctx.Logger(), "SSH-activity-keys"), activityName: "keys"}, nil
+}
+
+// MyActivity generates SSH key pairs and manages the authorized_keys file of a remote user
+type MyActivity struct {
+	logger       log.Logger
+	activityName string
+}
+
+// Metadata implements activity.Activity.Metadata
+func (*MyActivity) Metadata() *activity.Metadata {
+	return activityMd
+}
+
+// Eval implements activity.Activity.Eval
+func (activity *MyActivity) Eval(context activity.Context) (done bool, err error) {
+
+	input := &Input{}
+
+	//Get Input Object
+	err = context.GetInputObject(input)
+	if err != nil {
+		return false, err
+	}
+
+	var output *Output
+	if input.Operation == "generate" {
+		activity.logger.Debugf("Generating %s key pair", input.KeyType)
+		output, err = generate(input.KeyType, input.Bits, input.Passphrase, input.Comment)
+	} else {
+		output, err = activity.remote(input)
+	}
+	if err != nil {
+		return false, err
+	}
+
+	//Set output object
+	err = context.SetOutputObject(output)
+	if err != nil {
+		return false, err
+	}
+
+	return true, nil
+}
+
+// remote runs the operations that use the SSH connection
+func (activity *MyActivity) remote(input *Input) (*Output, error) {
+	if input.Connection == nil {
+		return nil, fmt.Errorf("an SSH connection is required for operation '%s'", input.Operation)
+	}
+
+	if input.Operation == "verify" {
+		if input.PrivateKey == "" {
+			return nil, fmt.Errorf("required input 'privateKey' not specified for verify")
+		}
+		pem, err := server.DecodeContent(input.PrivateKey)
+		if err != nil {
+			return nil, fmt.Errorf("invalid private key: %s", err.Error())
+		}
+		signer, err := ssh.ParsePrivateKey(pem, input.Passphrase)
+		if err != nil {
+			return nil, fmt.Errorf("invalid private key: %s", err.Error())
+		}
+
+		activity.logger.Debugf("Verifying login with key %s", gossh.FingerprintSHA256(signer.PublicKey()))
+		verified, err := ssh.VerifyLogin(input.Connection, input.Host, input.Port, input.User, signer)
+		if err != nil {
+			return nil, err
+		}
+		return &Output{Fingerprint: gossh.FingerprintSHA256(signer.PublicKey()), Verified: verified}, nil
+	}
+
+	file := input.AuthorizedKeysFile
+	if file == "" {
+		file = defaultAuthorizedKeysFile
+	}
+
+	sshClient, err := ssh.GetHostClient(input.Connection, input.Host, input.Port)
+	if err != nil {
+		return nil, err
+	}
+	client, err := sshClient.SFTP()
+	if err != nil {
+		return nil, err
+	}
+	defer client.Close()
+
+	switch input.Operation {
+	case "deploy":
+		if input.PublicKey == "" {
+			return nil, fmt.Errorf("required input 'publicKey' not specified for deploy")
+		}
+		activity.logger.Debugf("Deploying public key to '%s' on %s", file, sshClient.Host())
+		return deploy(client, file, input.PublicKey, input.Options, input.Comment)
+	case "revoke":
+		activity.logger.Debugf("Revoking keys from '%s' on %s", file, sshClient.Host())
+		return revoke(client, file, input.Fingerprint, input.Comment)
+	}
+	return nil, fmt.Errorf("unsupported operation '%s'", input.Operation)
+}
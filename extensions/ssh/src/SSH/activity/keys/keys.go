@@ -0,0 +1,248 @@
+package keys
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/hex"
+	"encoding/pem"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"strings"
+
+	"github.com/pkg/sftp"
+	"golang.org/x/crypto/ssh"
+)
+
+const (
+	defaultAuthorizedKeysFile = ".ssh/authorized_keys"
+	defaultRSABits            = 3072
+	minRSABits                = 2048
+)
+
+// generate creates a key pair and returns the private key in OpenSSH format, encrypted when
+// a passphrase is given, and the public key as an authorized_keys line
+func generate(keyType string, bits int, passphrase, comment string) (*Output, error) {
+	var key crypto.Signer
+	var err error
+	switch keyType {
+	case "", "ed25519":
+		_, key, err = ed25519.GenerateKey(rand.Reader)
+	case "rsa":
+		if bits == 0 {
+			bits = defaultRSABits
+		}
+		if bits < minRSABits {
+			return nil, fmt.Errorf("RSA keys must have at least %d bits", minRSABits)
+		}
+		key, err = rsa.GenerateKey(rand.Reader, bits)
+	case "ecdsa":
+		var curve elliptic.Curve
+		switch bits {
+		case 0, 256:
+			curve = elliptic.P256()
+		case 384:
+			curve = elliptic.P384()
+		case 521:
+			curve = elliptic.P521()
+		default:
+			return nil, fmt.Errorf("ECDSA keys have 256, 384 or 521 bits, not %d", bits)
+		}
+		key, err = ecdsa.GenerateKey(curve, rand.Reader)
+	default:
+		return nil, fmt.Errorf("unsupported key type '%s'", keyType)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate key: %s", err.Error())
+	}
+
+	var block *pem.Block
+	if passphrase != "" {
+		block, err = ssh.MarshalPrivateKeyWithPassphrase(key, comment, []byte(passphrase))
+	} else {
+		block, err = ssh.MarshalPrivateKey(key, comment)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode private key: %s", err.Error())
+	}
+
+	pub, err := ssh.NewPublicKey(key.Public())
+	if err != nil {
+		return nil, err
+	}
+	return &Output{
+		PrivateKey:  string(pem.EncodeToMemory(block)),
+		PublicKey:   authorizedKeyLine("", pub, comment),
+		Fingerprint: ssh.FingerprintSHA256(pub),
+	}, nil
+}
+
+// authorizedKeyLine formats an authorized_keys entry
+func authorizedKeyLine(options string, pub ssh.PublicKey, comment string) string {
+	line := strings.TrimSpace(string(ssh.MarshalAuthorizedKey(pub)))
+	if options = strings.TrimSpace(options); options != "" {
+		line = options + " " + line
+	}
+	if comment = strings.TrimSpace(comment); comment != "" {
+		line += " " + comment
+	}
+	return line
+}
+
+// parsePublicKey parses an authorized_keys line, or a public key file, and returns the key
+// and its comment
+func parsePublicKey(value string) (ssh.PublicKey, string, error) {
+	pub, comment, _, _, err := ssh.ParseAuthorizedKey([]byte(strings.TrimSpace(value)))
+	if err != nil {
+		return nil, "", fmt.Errorf("invalid public key: %s", err.Error())
+	}
+	return pub, comment, nil
+}
+
+// deploy adds the public key to the authorized_keys file unless a key with the same fingerprint
+// is already present. The file and its directory are created when missing.
+func deploy(client *sftp.Client, file, publicKey, options, comment string) (*Output, error) {
+	pub, keyComment, err := parsePublicKey(publicKey)
+	if err != nil {
+		return nil, err
+	}
+	if comment == "" {
+		comment = keyComment
+	}
+	fingerprint := ssh.FingerprintSHA256(pub)
+	output := &Output{PublicKey: authorizedKeyLine("", pub, comment), Fingerprint: fingerprint}
+
+	lines, err := readAuthorizedKeys(client, file)
+	if err != nil {
+		return nil, err
+	}
+	for _, line := range lines {
+		if existing, _, _, _, err := ssh.ParseAuthorizedKey([]byte(line)); err == nil && ssh.FingerprintSHA256(existing) == fingerprint {
+			return output, nil
+		}
+	}
+
+	if err = createKeyDir(client, path.Dir(file)); err != nil {
+		return nil, fmt.Errorf("failed to create directory of '%s': %s", file, err.Error())
+	}
+	if err = writeAuthorizedKeys(client, file, append(lines, authorizedKeyLine(options, pub, comment))); err != nil {
+		return nil, err
+	}
+	output.Changed = true
+	return output, nil
+}
+
+// createKeyDir creates dir when it does not exist. sshd ignores authorized_keys files in directories
+// writable by others, so a created directory gets mode 0700 whatever the umask of the server.
+func createKeyDir(client *sftp.Client, dir string) error {
+	if _, err := client.Stat(dir); err == nil {
+		return nil
+	}
+	if err := client.MkdirAll(dir); err != nil {
+		return err
+	}
+	return client.Chmod(dir, 0700)
+}
+
+// revoke removes the keys matching the fingerprint or the comment from the authorized_keys file
+func revoke(client *sftp.Client, file, fingerprint, comment string) (*Output, error) {
+	if fingerprint == "" && comment == "" {
+		return nil, fmt.Errorf("input 'fingerprint' or 'comment' is required to revoke keys")
+	}
+	lines, err := readAuthorizedKeys(client, file)
+	if err != nil {
+		return nil, err
+	}
+
+	kept := make([]string, 0, len(lines))
+	output := &Output{Fingerprint: fingerprint}
+	for _, line := range lines {
+		pub, keyComment, _, _, err := ssh.ParseAuthorizedKey([]byte(line))
+		if err == nil && ((fingerprint != "" && ssh.FingerprintSHA256(pub) == fingerprint) || (comment != "" && keyComment == comment)) {
+			output.Removed++
+			continue
+		}
+		kept = append(kept, line)
+	}
+	if output.Removed == 0 {
+		return output, nil
+	}
+	if err = writeAuthorizedKeys(client, file, kept); err != nil {
+		return nil, err
+	}
+	output.Changed = true
+	return output, nil
+}
+
+// readAuthorizedKeys returns the lines of the authorized_keys file, which may not exist yet
+func readAuthorizedKeys(client *sftp.Client, file string) ([]string, error) {
+	f, err := client.Open(file)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to open '%s': %s", file, err.Error())
+	}
+	defer f.Close()
+
+	data, err := io.ReadAll(f)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read '%s': %s", file, err.Error())
+	}
+	var lines []string
+	for _, line := range strings.Split(string(bytes.TrimRight(data, "\n")), "\n") {
+		if line = strings.TrimRight(line, "\r"); line != "" {
+			lines = append(lines, line)
+		}
+	}
+	return lines, nil
+}
+
+// writeAuthorizedKeys replaces the authorized_keys file through a temporary file, so that the
+// server never reads a partially written file, and keeps it readable by the owner only
+func writeAuthorizedKeys(client *sftp.Client, file string, lines []string) error {
+	suffix := make([]byte, 6)
+	if _, err := rand.Read(suffix); err != nil {
+		return err
+	}
+	dir, name := path.Split(file)
+	temp := dir + "." + name + "." + hex.EncodeToString(suffix) + ".tmp"
+
+	f, err := client.OpenFile(temp, os.O_WRONLY|os.O_CREATE|os.O_TRUNC)
+	if err != nil {
+		return fmt.Errorf("failed to create '%s': %s", temp, err.Error())
+	}
+	content := strings.Join(lines, "\n")
+	if content != "" {
+		content += "\n"
+	}
+	_, err = f.Write([]byte(content))
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = client.Chmod(temp, 0600)
+	}
+	if err != nil {
+		client.Remove(temp)
+		return fmt.Errorf("failed to write '%s': %s", file, err.Error())
+	}
+
+	if _, ok := client.HasExtension("posix-rename@openssh.com"); ok {
+		err = client.PosixRename(temp, file)
+	} else {
+		client.Remove(file)
+		err = client.Rename(temp, file)
+	}
+	if err != nil {
+		client.Remove(temp)
+		return fmt.Errorf("failed to replace '%s': %s", file, err.Error())
+	}
+	return nil
+}
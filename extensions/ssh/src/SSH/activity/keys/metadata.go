@@ -0,0 +1,181 @@
+package keys
+
+import (
+	ssh "github.com/mmussett/extensions/SSH/connector/connection"
+	"github.com/project-flogo/core/data/coerce"
+	"github.com/project-flogo/core/support/connection"
+)
+
+// Input corresponds to activity.json inputs
+type Input struct {
+	Connection         connection.Manager `md:"SSH Connection"`
+	Host               string             `md:"host"`
+	Port               int                `md:"port"`
+	Operation          string             `md:"operation,required,allowed(generate,deploy,verify,revoke)"`
+	KeyType            string             `md:"keyType,allowed(ed25519,rsa,ecdsa)"`
+	Bits               int                `md:"bits"`
+	Passphrase         string             `md:"passphrase"`
+	Comment            string             `md:"comment"`
+	PublicKey          string             `md:"publicKey"`
+	PrivateKey         string             `md:"privateKey"`
+	Options            string             `md:"options"`
+	AuthorizedKeysFile string             `md:"authorizedKeysFile"`
+	User               string             `md:"user"`
+	Fingerprint        string             `md:"fingerprint"`
+}
+
+// Output corresponds to activity.json outputs
+type Output struct {
+	PrivateKey  string `md:"privateKey"`
+	PublicKey   string `md:"publicKey"`
+	Fingerprint string `md:"fingerprint"`
+	Changed     bool   `md:"changed"`
+	Removed     int    `md:"removed"`
+	Verified    bool   `md:"verified"`
+}
+
+// ToMap converts Input struct to map
+func (i *Input) ToMap() map[string]interface{} {
+	return map[string]interface{}{
+		"SSH Connection":     i.Connection,
+		"host":               i.Host,
+		"port":               i.Port,
+		"operation":          i.Operation,
+		"keyType":            i.KeyType,
+		"bits":               i.Bits,
+		"passphrase":         i.Passphrase,
+		"comment":            i.Comment,
+		"publicKey":          i.PublicKey,
+		"privateKey":         i.PrivateKey,
+		"options":            i.Options,
+		"authorizedKeysFile": i.AuthorizedKeysFile,
+		"user":               i.User,
+		"fingerprint":        i.Fingerprint,
+	}
+}
+
+// FromMap converts a map to Input struct
+func (i *Input) FromMap(values map[string]interface{}) error {
+	var err error
+	// generate does not use the connection, so it may be left empty
+	if values["SSH Connection"] != nil {
+		i.Connection, err = ssh.GetSharedConfiguration(values["SSH Connection"])
+		if err != nil {
+			return err
+		}
+	}
+
+	i.Host, err = coerce.ToString(values["host"])
+	if err != nil {
+		return err
+	}
+
+	i.Port, err = coerce.ToInt(values["port"])
+	if err != nil {
+		return err
+	}
+
+	i.Operation, err = coerce.ToString(values["operation"])
+	if err != nil {
+		return err
+	}
+
+	i.KeyType, err = coerce.ToString(values["keyType"])
+	if err != nil {
+		return err
+	}
+
+	i.Bits, err = coerce.ToInt(values["bits"])
+	if err != nil {
+		return err
+	}
+
+	i.Passphrase, err = coerce.ToString(values["passphrase"])
+	if err != nil {
+		return err
+	}
+
+	i.Comment, err = coerce.ToString(values["comment"])
+	if err != nil {
+		return err
+	}
+
+	i.PublicKey, err = coerce.ToString(values["publicKey"])
+	if err != nil {
+		return err
+	}
+
+	i.PrivateKey, err = coerce.ToString(values["privateKey"])
+	if err != nil {
+		return err
+	}
+
+	i.Options, err = coerce.ToString(values["options"])
+	if err != nil {
+		return err
+	}
+
+	i.AuthorizedKeysFile, err = coerce.ToString(values["authorizedKeysFile"])
+	if err != nil {
+		return err
+	}
+
+	i.User, err = coerce.ToString(values["user"])
+	if err != nil {
+		return err
+	}
+
+	i.Fingerprint, err = coerce.ToString(values["fingerprint"])
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// ToMap converts Output struct to map
+func (o *Output) ToMap() map[string]interface{} {
+	return map[string]interface{}{
+		"privateKey":  o.PrivateKey,
+		"publicKey":   o.PublicKey,
+		"fingerprint": o.Fingerprint,
+		"changed":     o.Changed,
+		"removed":     o.Removed,
+		"verified":    o.Verified,
+	}
+}
+
+// FromMap converts a map to Output struct
+func (o *Output) FromMap(values map[string]interface{}) error {
+	var err error
+	o.PrivateKey, err = coerce.ToString(values["privateKey"])
+	if err != nil {
+		return err
+	}
+
+	o.PublicKey, err = coerce.ToString(values["publicKey"])
+	if err != nil {
+		return err
+	}
+
+	o.Fingerprint, err = coerce.ToString(values["fingerprint"])
+	if err != nil {
+		return err
+	}
+
+	o.Changed, err = coerce.ToBool(values["changed"])
+	if err != nil {
+		return err
+	}
+
+	o.Removed, err = coerce.ToInt(values["removed"])
+	if err != nil {
+		return err
+	}
+
+	o.Verified, err = coerce.ToBool(values["verified"])
+	if err != nil {
+		return err
+	}
+	return nil
+}
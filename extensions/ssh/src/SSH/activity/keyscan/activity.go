@@ -0,0 +1,76 @@
+package keyscan
+
+import (
+	"time"
+
+	"github.com/project-flogo/core/activity"
+	"github.com/project-flogo/core/support/log"
+)
+
+var activityMd = activity.ToMetadata(&Input{}, &Output{})
+
+func init() {
+	_ = activity.Register(&MyActivity{}, New)
+}
+
+// New creates a new activity
+func New(ctx activity.InitContext) (activity.Activity, error) {
+	return &MyActivity{logger: log.ChildLogger(ctx.Logger(), "SSH-activity-keyscan"), activityName: "keyscan"}, nil
+}
+
+// MyActivity collects the host keys of SSH servers, like ssh-keyscan
+type MyActivity struct {
+	logger       log.Logger
+	activityName string
+}
+
+// Metadata implements activity.Activity.Metadata
+func (*MyActivity) Metadata() *activity.Metadata {
+	return activityMd
+}
+
+// Eval implements activity.Activity.Eval
+func (activity *MyActivity) Eval(context activity.Context) (done bool, err error) {
+
+	input := &Input{}
+
+	//Get Input Object
+	err = context.GetInputObject(input)
+	if err != nil {
+		return false, err
+	}
+
+	targets, err := parseTargets(input.Targets)
+	if err != nil {
+		return false, err
+	}
+	keyTypes, err := parseKeyTypes(input.KeyTypes)
+	if err != nil {
+		return false, err
+	}
+	timeout := input.Timeout
+	if timeout <= 0 {
+		timeout = defaultTimeout
+	}
+
+	activity.logger.Debugf("Scanning %d targets for %v host keys", len(targets), keyTypes)
+	results := scan(targets, keyTypes, time.Duration(timeout)*time.Second)
+	for _, r := range results {
+		if r.err != nil {
+			activity.logger.Debugf("No %s host key from %s: %s", r.keyType, r.target.address(), r.err.Error())
+		}
+	}
+
+	output, err := knownHostsOutput(results, input.HashHosts)
+	if err != nil {
+		return false, err
+	}
+
+	//Set output object
+	err = context.SetOutputObject(output)
+	if err != nil {
+		return false, err
+	}
+
+	return true, nil
+}
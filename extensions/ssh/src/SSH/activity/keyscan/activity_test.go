@@ -0,0 +1,184 @@
+package keyscan
+
+import (
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	sshconn "github.com/mmussett/extensions/SSH/connector/connection"
+	"github.com/project-flogo/core/activity"
+	"github.com/project-flogo/core/support"
+	"github.com/project-flogo/core/support/connection"
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/knownhosts"
+)
+
+func TestRegister(t *testing.T) {
+	ref := activity.GetRef(&MyActivity{})
+	act := activity.Get(ref)
+
+	assert.NotNil(t, act)
+}
+
+// startServer starts an SSH server with ed25519, ecdsa and rsa host keys that accepts the
+// user tester with password secret
+func startServer(t *testing.T) (string, []ssh.PublicKey) {
+	config := &ssh.ServerConfig{
+		PasswordCallback: func(c ssh.ConnMetadata, pass []byte) (*ssh.Permissions, error) {
+			if c.User() == "tester" && string(pass) == "secret" {
+				return nil, nil
+			}
+			return nil, ssh.ErrNoAuth
+		},
+	}
+	_, edKey, _ := ed25519.GenerateKey(rand.Reader)
+	ecKey, _ := ecdsa.GenerateKey(elliptic.P384(), rand.Reader)
+	rsaKey, _ := rsa.GenerateKey(rand.Reader, 2048)
+	var keys []ssh.PublicKey
+	for _, k := range []interface{}{edKey, ecKey, rsaKey} {
+		signer, err := ssh.NewSignerFromKey(k)
+		assert.Nil(t, err)
+		config.AddHostKey(signer)
+		keys = append(keys, signer.PublicKey())
+	}
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.Nil(t, err)
+	t.Cleanup(func() { listener.Close() })
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				sconn, chans, reqs, err := ssh.NewServerConn(conn, config)
+				if err != nil {
+					return
+				}
+				defer sconn.Close()
+				go ssh.DiscardRequests(reqs)
+				// the SSH connection opens a session when it connects
+				for ch := range chans {
+					channel, requests, err := ch.Accept()
+					if err != nil {
+						continue
+					}
+					go ssh.DiscardRequests(requests)
+					defer channel.Close()
+				}
+			}()
+		}
+	}()
+	return listener.Addr().String(), keys
+}
+
+func TestScan(t *testing.T) {
+	addr, keys := startServer(t)
+
+	closed, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.Nil(t, err)
+	closed.Close()
+
+	targets, err := parseTargets(addr + ",\n" + closed.Addr().String())
+	assert.Nil(t, err)
+	keyTypes, err := parseKeyTypes("")
+	assert.Nil(t, err)
+
+	output, err := knownHostsOutput(scan(targets, keyTypes, 5*time.Second), false)
+	assert.Nil(t, err)
+	assert.Len(t, output.Keys, 3)
+	assert.Len(t, output.Errors, 3)
+	assert.Equal(t, closed.Addr().String(), output.Errors[0]["target"])
+
+	for idx, key := range keys {
+		assert.Equal(t, key.Type(), output.Keys[idx]["keyType"])
+		assert.Equal(t, ssh.FingerprintSHA256(key), output.Keys[idx]["fingerprint"])
+	}
+	assert.True(t, strings.HasPrefix(output.KnownHosts, "[127.0.0.1]:"))
+
+	// the known_hosts content is accepted for the host keys
+	file := filepath.Join(t.TempDir(), "known_hosts")
+	assert.Nil(t, os.WriteFile(file, []byte(output.KnownHosts), 0600))
+	callback, err := knownhosts.New(file)
+	assert.Nil(t, err)
+	tcpAddr, _ := net.ResolveTCPAddr("tcp", addr)
+	for _, key := range keys {
+		assert.Nil(t, callback(addr, tcpAddr, key))
+	}
+
+	hashed, err := knownHostsOutput(scan(targets[:1], []string{"ed25519"}, 5*time.Second), true)
+	assert.Nil(t, err)
+	assert.True(t, strings.HasPrefix(hashed.KnownHosts, "|1|"))
+	assert.Nil(t, os.WriteFile(file, []byte(hashed.KnownHosts), 0600))
+	callback, err = knownhosts.New(file)
+	assert.Nil(t, err)
+	assert.Nil(t, callback(addr, tcpAddr, keys[0]))
+
+	_, err = knownHostsOutput(scan(targets[1:], []string{"rsa"}, 5*time.Second), false)
+	assert.NotNil(t, err)
+}
+
+func TestKnownHostFileConnection(t *testing.T) {
+	addr, _ := startServer(t)
+	targets, err := parseTargets(addr)
+	assert.Nil(t, err)
+	output, err := knownHostsOutput(scan(targets, defaultKeyTypes, 5*time.Second), true)
+	assert.Nil(t, err)
+
+	content := map[string]string{}
+	assert.Nil(t, json.Unmarshal([]byte(output.KnownHostFile), &content))
+	assert.Equal(t, "known_hosts", content["filename"])
+	data, err := base64.StdEncoding.DecodeString(strings.TrimPrefix(content["content"], "data:application/octet-stream;base64,"))
+	assert.Nil(t, err)
+	assert.Equal(t, output.KnownHosts, string(data))
+
+	// the file selector value is accepted by an SSH connection with strict host key checking
+	host, port, _ := net.SplitHostPort(addr)
+	factory := connection.GetManagerFactory(support.GetRef(&sshconn.SshFactory{}))
+	assert.NotNil(t, factory)
+	manager, err := factory.NewManager(map[string]interface{}{
+		"name":          "keyscan",
+		"host":          host,
+		"port":          port,
+		"user":          "tester",
+		"password":      "secret",
+		"publicKeyFlag": false,
+		"hostKeyFlag":   true,
+		"knownHostFile": output.KnownHostFile,
+	})
+	assert.Nil(t, err)
+	if manager != nil {
+		manager.(*sshconn.SshSharedConfigManager).Stop()
+	}
+}
+
+func TestParse(t *testing.T) {
+	targets, err := parseTargets("web1 web2:2222\n[::1]:2200, db.internal")
+	assert.Nil(t, err)
+	assert.Equal(t, []target{{"web1", 22}, {"web2", 2222}, {"::1", 2200}, {"db.internal", 22}}, targets)
+
+	_, err = parseTargets("web1:99999")
+	assert.NotNil(t, err)
+	_, err = parseTargets(" \n")
+	assert.NotNil(t, err)
+
+	keyTypes, err := parseKeyTypes("RSA, ed25519")
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"rsa", "ed25519"}, keyTypes)
+	_, err = parseKeyTypes("dsa")
+	assert.NotNil(t, err)
+	_, err = parseKeyTypes(",")
+	assert.NotNil(t, err)
+}
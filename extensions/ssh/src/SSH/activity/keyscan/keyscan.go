@@ -0,0 +1,210 @@
+package keyscan
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/knownhosts"
+)
+
+const (
+	defaultTimeout  = 10
+	maxParallelScan = 16
+)
+
+// hostKeyAlgorithms are the algorithms offered for each key type. The server picks one
+// of them, so each key type is collected with one connection.
+var hostKeyAlgorithms = map[string][]string{
+	"ed25519": {ssh.KeyAlgoED25519},
+	"ecdsa":   {ssh.KeyAlgoECDSA256, ssh.KeyAlgoECDSA384, ssh.KeyAlgoECDSA521},
+	"rsa":     {ssh.KeyAlgoRSASHA512, ssh.KeyAlgoRSASHA256, ssh.KeyAlgoRSA},
+}
+
+var defaultKeyTypes = []string{"ed25519", "ecdsa", "rsa"}
+
+// errKeyCollected aborts the handshake once the host key was received
+var errKeyCollected = errors.New("host key collected")
+
+// target is a host and port to scan
+type target struct {
+	host string
+	port int
+}
+
+func (t target) address() string {
+	return net.JoinHostPort(t.host, strconv.Itoa(t.port))
+}
+
+// parseTargets parses host[:port] targets separated by line breaks, commas or spaces.
+// IPv6 addresses with a port are written in brackets, [::1]:2222.
+func parseTargets(value string) ([]target, error) {
+	var targets []target
+	for _, field := range strings.FieldsFunc(value, func(r rune) bool {
+		return r == '\n' || r == '\r' || r == ',' || r == ' ' || r == '\t'
+	}) {
+		t := target{host: field, port: 22}
+		if host, port, err := net.SplitHostPort(field); err == nil {
+			p, err := strconv.Atoi(port)
+			if err != nil || p < 1 || p > 65535 {
+				return nil, fmt.Errorf("invalid port in target '%s'", field)
+			}
+			t = target{host: host, port: p}
+		}
+		t.host = strings.Trim(t.host, "[]")
+		if t.host == "" {
+			return nil, fmt.Errorf("invalid target '%s'", field)
+		}
+		targets = append(targets, t)
+	}
+	if len(targets) == 0 {
+		return nil, fmt.Errorf("no targets specified")
+	}
+	return targets, nil
+}
+
+// parseKeyTypes parses a comma separated list of key types, by default all supported types
+func parseKeyTypes(value string) ([]string, error) {
+	if strings.TrimSpace(value) == "" {
+		return defaultKeyTypes, nil
+	}
+	var keyTypes []string
+	for _, keyType := range strings.Split(value, ",") {
+		keyType = strings.ToLower(strings.TrimSpace(keyType))
+		if keyType == "" {
+			continue
+		}
+		if _, ok := hostKeyAlgorithms[keyType]; !ok {
+			return nil, fmt.Errorf("unsupported key type '%s', expected ed25519, ecdsa or rsa", keyType)
+		}
+		keyTypes = append(keyTypes, keyType)
+	}
+	if len(keyTypes) == 0 {
+		return nil, fmt.Errorf("no key types specified")
+	}
+	return keyTypes, nil
+}
+
+// scanKey connects to the target offering only the algorithms of keyType and returns the host
+// key presented by the server. No authentication is attempted.
+func scanKey(t target, keyType string, timeout time.Duration) (ssh.PublicKey, error) {
+	var key ssh.PublicKey
+	config := &ssh.ClientConfig{
+		User:              "keyscan",
+		HostKeyAlgorithms: hostKeyAlgorithms[keyType],
+		Timeout:           timeout,
+		HostKeyCallback: func(hostname string, remote net.Addr, k ssh.PublicKey) error {
+			key = k
+			return errKeyCollected
+		},
+	}
+
+	conn, err := net.DialTimeout("tcp", t.address(), timeout)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(timeout))
+
+	_, _, _, err = ssh.NewClientConn(conn, t.address(), config)
+	if key != nil {
+		return key, nil
+	}
+	if err == nil {
+		err = errors.New("server did not present a host key")
+	}
+	return nil, err
+}
+
+// scanResult is the outcome of scanning one key type of a target
+type scanResult struct {
+	target  target
+	keyType string
+	key     ssh.PublicKey
+	err     error
+}
+
+// scan collects the host keys of all targets and key types, at most maxParallelScan at once.
+// The results are in the order of the targets and key types.
+func scan(targets []target, keyTypes []string, timeout time.Duration) []scanResult {
+	results := make([]scanResult, 0, len(targets)*len(keyTypes))
+	for _, t := range targets {
+		for _, keyType := range keyTypes {
+			results = append(results, scanResult{target: t, keyType: keyType})
+		}
+	}
+
+	var wg sync.WaitGroup
+	sem := make(chan struct{}, maxParallelScan)
+	for idx := range results {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(r *scanResult) {
+			defer wg.Done()
+			defer func() { <-sem }()
+			r.key, r.err = scanKey(r.target, r.keyType, timeout)
+		}(&results[idx])
+	}
+	wg.Wait()
+	return results
+}
+
+// knownHostsOutput builds the known_hosts lines, the key details and the errors of the results
+func knownHostsOutput(results []scanResult, hashHosts bool) (*Output, error) {
+	output := &Output{Keys: []map[string]interface{}{}, Errors: []map[string]interface{}{}}
+	var lines []string
+	for _, r := range results {
+		if r.err != nil {
+			output.Errors = append(output.Errors, map[string]interface{}{
+				"target":  r.target.address(),
+				"keyType": r.keyType,
+				"error":   r.err.Error(),
+			})
+			continue
+		}
+		address := knownhosts.Normalize(r.target.address())
+		if hashHosts {
+			address = knownhosts.HashHostname(address)
+		}
+		line := knownhosts.Line([]string{address}, r.key)
+		lines = append(lines, line)
+		output.Keys = append(output.Keys, map[string]interface{}{
+			"host":        r.target.host,
+			"port":        r.target.port,
+			"keyType":     r.key.Type(),
+			"fingerprint": ssh.FingerprintSHA256(r.key),
+			"line":        line,
+		})
+	}
+	if len(lines) == 0 {
+		return nil, fmt.Errorf("no host keys collected: %s", output.Errors[0]["error"])
+	}
+
+	output.KnownHosts = strings.Join(lines, "\n") + "\n"
+	file, err := fileSelectorContent("known_hosts", []byte(output.KnownHosts))
+	if err != nil {
+		return nil, err
+	}
+	output.KnownHostFile = file
+	return output, nil
+}
+
+// fileSelectorContent encodes data like the value of a file selector field, such as the
+// Known Host File of the SSH connection
+func fileSelectorContent(filename string, data []byte) (string, error) {
+	value, err := json.Marshal(map[string]string{
+		"filename": filename,
+		"content":  "data:application/octet-stream;base64," + base64.StdEncoding.EncodeToString(data),
+	})
+	if err != nil {
+		return "", err
+	}
+	return string(value), nil
+}
@@ -0,0 +1,116 @@
+package keyscan
+
+import (
+	"github.com/project-flogo/core/data/coerce"
+)
+
+// Input corresponds to activity.json inputs
+type Input struct {
+	Targets   string `md:"targets,required"`
+	KeyTypes  string `md:"keyTypes"`
+	HashHosts bool   `md:"hashHosts"`
+	Timeout   int    `md:"timeout"`
+}
+
+// Output corresponds to activity.json outputs
+type Output struct {
+	KnownHosts    string                   `md:"knownHosts"`
+	KnownHostFile string                   `md:"knownHostFile"`
+	Keys          []map[string]interface{} `md:"keys"`
+	Errors        []map[string]interface{} `md:"errors"`
+}
+
+// ToMap converts Input struct to map
+func (i *Input) ToMap() map[string]interface{} {
+	return map[string]interface{}{
+		"targets":   i.Targets,
+		"keyTypes":  i.KeyTypes,
+		"hashHosts": i.HashHosts,
+		"timeout":   i.Timeout,
+	}
+}
+
+// FromMap converts a map to Input struct
+func (i *Input) FromMap(values map[string]interface{}) error {
+	var err error
+	i.Targets, err = coerce.ToString(values["targets"])
+	if err != nil {
+		return err
+	}
+
+	i.KeyTypes, err = coerce.ToString(values["keyTypes"])
+	if err != nil {
+		return err
+	}
+
+	i.HashHosts, err = coerce.ToBool(values["hashHosts"])
+	if err != nil {
+		return err
+	}
+
+	i.Timeout, err = coerce.ToInt(values["timeout"])
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// ToMap converts Output struct to map
+func (o *Output) ToMap() map[string]interface{} {
+	return map[string]interface{}{
+		"knownHosts":    o.KnownHosts,
+		"knownHostFile": o.KnownHostFile,
+		"keys":          toArray(o.Keys),
+		"errors":        toArray(o.Errors),
+	}
+}
+
+// FromMap converts a map to Output struct
+func (o *Output) FromMap(values map[string]interface{}) error {
+	var err error
+	o.KnownHosts, err = coerce.ToString(values["knownHosts"])
+	if err != nil {
+		return err
+	}
+
+	o.KnownHostFile, err = coerce.ToString(values["knownHostFile"])
+	if err != nil {
+		return err
+	}
+
+	o.Keys, err = toObjects(values["keys"])
+	if err != nil {
+		return err
+	}
+
+	o.Errors, err = toObjects(values["errors"])
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+func toArray(objects []map[string]interface{}) []interface{} {
+	array := make([]interface{}, len(objects))
+	for idx, obj := range objects {
+		array[idx] = obj
+	}
+	return array
+}
+
+func toObjects(value interface{}) ([]map[string]interface{}, error) {
+	array, err := coerce.ToArray(value)
+	if err != nil {
+		return nil, err
+	}
+	objects := make([]map[string]interface{}, 0, len(array))
+	for _, v := range array {
+		obj, err := coerce.ToObject(v)
+		if err != nil {
+			return nil, err
+		}
+		objects = append(objects, obj)
+	}
+	return objects, nil
+}
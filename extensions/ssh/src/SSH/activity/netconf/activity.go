@@ -0,0 +1,135 @@
+package netconf
+
+import (
+	gocontext "context"
+	"fmt"
+	"strings"
+
+	ssh "github.com/mmussett/extensions/SSH/connector/connection"
+	"github.com/project-flogo/core/activity"
+	"github.com/project-flogo/core/support/log"
+)
+
+var activityMd = activity.ToMetadata(&Input{}, &Output{})
+
+func init() {
+	_ = activity.Register(&MyActivity{}, New)
+}
+
+// New creates a new activity
+func New(ctx activity.InitContext) (activity.Activity, error) {
+	return &MyActivity{logger: log.ChildLogger(ctx.Logger(), "SSH-activity-netconf"), activityName: "netconf"}, nil
+}
+
+// MyActivity performs NETCONF operations over the netconf subsystem of an SSH connection
+type MyActivity struct {
+	logger       log.Logger
+	activityName string
+}
+
+// Metadata implements activity.Activity.Metadata
+func (*MyActivity) Metadata() *activity.Metadata {
+	return activityMd
+}
+
+// Eval implements activity.Activity.Eval
+func (activity *MyActivity) Eval(context activity.Context) (done bool, err error) {
+
+	input := &Input{}
+
+	//Get Input Object
+	err = context.GetInputObject(input)
+	if err != nil {
+		return false, err
+	}
+
+	sshClient, err := ssh.GetHostClient(input.Connection, input.Host, input.Port)
+	if err != nil {
+		return false, err
+	}
+
+	// the command or subsystem of the session is recorded in the audit trail of the connection
+	ctx := ssh.WithActivity(gocontext.Background(), context.ActivityHost().Name(), context.Name())
+	session, err := sshClient.NewSession(ctx)
+	if err != nil {
+		return false, err
+	}
+	defer session.Close()
+
+	stdin, err := session.StdinPipe()
+	if err != nil {
+		return false, fmt.Errorf("failed to open netconf input: %s", err.Error())
+	}
+	stdout, err := session.StdoutPipe()
+	if err != nil {
+		return false, fmt.Errorf("failed to open netconf output: %s", err.Error())
+	}
+	if err = session.RequestSubsystem("netconf"); err != nil {
+		return false, fmt.Errorf("failed to start netconf subsystem: %s", err.Error())
+	}
+
+	client, err := newClient(stdout, stdin)
+	if err != nil {
+		return false, err
+	}
+	defer client.close()
+
+	activity.logger.Debugf("Executing NETCONF operation '%s' in session %s", input.Operation, client.SessionID)
+	output, err := execute(client, input)
+	if err != nil {
+		return false, err
+	}
+
+	//Set output object
+	err = context.SetOutputObject(output)
+	if err != nil {
+		return false, err
+	}
+
+	return true, nil
+}
+
+// execute runs the operation, wrapped in a lock of the target datastore and followed by a commit
+// when requested. Uncommitted changes to the candidate datastore are discarded on failure.
+func execute(c *client, input *Input) (*Output, error) {
+	op, err := operation(input)
+	if err != nil {
+		return nil, err
+	}
+
+	target := input.Target
+	if target == "" {
+		target = "running"
+	}
+	if input.Lock {
+		if _, err = c.call("<lock><target>" + datastore(target) + "</target></lock>"); err != nil {
+			return nil, fmt.Errorf("failed to lock '%s': %s", target, err.Error())
+		}
+		defer c.call("<unlock><target>" + datastore(target) + "</target></unlock>")
+	}
+
+	reply, err := c.call(op)
+	if err == nil && input.Commit && input.Operation == "edit-config" {
+		if _, err = c.call("<commit/>"); err != nil {
+			err = fmt.Errorf("failed to commit: %s", err.Error())
+		}
+	}
+	if err != nil {
+		if target == "candidate" && (input.Operation == "edit-config" || input.Operation == "commit") {
+			c.call("<discard-changes/>")
+		}
+		return nil, fmt.Errorf("NETCONF %s failed: %s", input.Operation, err.Error())
+	}
+
+	output := &Output{Reply: string(reply), SessionID: c.SessionID}
+	for _, capability := range c.Capabilities {
+		output.Capabilities = append(output.Capabilities, strings.TrimSpace(capability))
+	}
+	if input.ConvertToJSON {
+		output.Data, err = toJSON(reply)
+		if err != nil {
+			return nil, fmt.Errorf("failed to convert rpc-reply to JSON: %s", err.Error())
+		}
+	}
+	return output, nil
+}
@@ -0,0 +1,189 @@
+package netconf
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/project-flogo/core/activity"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRegister(t *testing.T) {
+	ref := activity.GetRef(&MyActivity{})
+	act := activity.Get(ref)
+
+	assert.NotNil(t, act)
+}
+
+// fakeDevice is a NETCONF server standing in for a network device
+type fakeDevice struct {
+	base11    bool
+	mu        sync.Mutex
+	ops       []string
+	running   string
+	candidate string
+}
+
+func (d *fakeDevice) operations() []string {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return append([]string(nil), d.ops...)
+}
+
+// serve runs the device until the client closes the session
+func (d *fakeDevice) serve(r io.Reader, w io.WriteCloser) {
+	defer w.Close()
+	tr := newTransport(r, w)
+
+	caps := `<capability>urn:ietf:params:netconf:base:1.0</capability><capability>urn:ietf:params:netconf:capability:candidate:1.0</capability>`
+	if d.base11 {
+		caps += `<capability>urn:ietf:params:netconf:base:1.1</capability>`
+	}
+	tr.writeMessage([]byte(`<hello xmlns="urn:ietf:params:xml:ns:netconf:base:1.0"><capabilities>` + caps + `</capabilities><session-id>42</session-id></hello>`))
+	if _, err := tr.readMessage(); err != nil {
+		return
+	}
+	tr.chunked = d.base11
+
+	for {
+		msg, err := tr.readMessage()
+		if err != nil {
+			return
+		}
+		var rpc struct {
+			MessageID string `xml:"message-id,attr"`
+			Inner     []byte `xml:",innerxml"`
+		}
+		if err = xml.Unmarshal(msg, &rpc); err != nil {
+			return
+		}
+		op, _ := parseXML(rpc.Inner)
+		if op == nil {
+			op, _ = parseXML([]byte("<" + strings.Fields(strings.TrimPrefix(strings.TrimSpace(string(rpc.Inner)), "<"))[0]))
+		}
+
+		d.mu.Lock()
+		d.ops = append(d.ops, op.name)
+		body := "<ok/>"
+		switch op.name {
+		case "get", "get-config":
+			body = `<data><interfaces xmlns="urn:ietf:params:xml:ns:yang:ietf-interfaces"><interface><name>eth0</name><enabled>true</enabled></interface><interface><name>eth1</name><enabled>false</enabled></interface></interfaces><hostname>` + d.running + `</hostname></data>`
+		case "edit-config":
+			value := strings.TrimSpace(op.children[len(op.children)-1].children[0].text.String())
+			if value == "invalid" {
+				body = `<rpc-error><error-type>application</error-type><error-tag>invalid-value</error-tag><error-severity>error</error-severity><error-path>/hostname</error-path><error-message>bad hostname</error-message></rpc-error>`
+			} else {
+				d.candidate = value
+			}
+		case "commit":
+			d.running = d.candidate
+		case "discard-changes":
+			d.candidate = d.running
+		case "close-session":
+			d.mu.Unlock()
+			tr.writeMessage([]byte(fmt.Sprintf(`<rpc-reply message-id="%s" xmlns="urn:ietf:params:xml:ns:netconf:base:1.0"><ok/></rpc-reply>`, rpc.MessageID)))
+			return
+		}
+		d.mu.Unlock()
+
+		tr.writeMessage([]byte(fmt.Sprintf(`<rpc-reply message-id="%s" xmlns="urn:ietf:params:xml:ns:netconf:base:1.0">%s</rpc-reply>`, rpc.MessageID, body)))
+	}
+}
+
+func connect(t *testing.T, d *fakeDevice) *client {
+	clientRead, deviceWrite := io.Pipe()
+	deviceRead, clientWrite := io.Pipe()
+	go d.serve(deviceRead, deviceWrite)
+
+	c, err := newClient(clientRead, clientWrite)
+	assert.Nil(t, err)
+	t.Cleanup(func() { c.close() })
+	return c
+}
+
+func TestFraming(t *testing.T) {
+	var buf bytes.Buffer
+	tr := newTransport(&buf, &buf)
+	assert.Nil(t, tr.writeMessage([]byte("<a/>")))
+	msg, err := tr.readMessage()
+	assert.Nil(t, err)
+	assert.Equal(t, "<a/>", string(msg))
+
+	tr.chunked = true
+	assert.Nil(t, tr.writeMessage([]byte("<b/>")))
+	msg, err = tr.readMessage()
+	assert.Nil(t, err)
+	assert.Equal(t, "<b/>", string(msg))
+
+	// a message split over several chunks, as in RFC 6242 section 4.2
+	tr = newTransport(strings.NewReader("\n#4\n<rpc\n#18\n message-id=\"102\"\n\n#79\n     xmlns=\"urn:ietf:params:xml:ns:netconf:base:1.0\">\n  <close-session/>\n</rpc>\n##\n"), nil)
+	tr.chunked = true
+	msg, err = tr.readMessage()
+	assert.Nil(t, err)
+	assert.Equal(t, "<rpc message-id=\"102\"\n     xmlns=\"urn:ietf:params:xml:ns:netconf:base:1.0\">\n  <close-session/>\n</rpc>", string(msg))
+
+	tr = newTransport(strings.NewReader("\n#0\n\n##\n"), nil)
+	tr.chunked = true
+	_, err = tr.readMessage()
+	assert.NotNil(t, err)
+}
+
+func TestGet(t *testing.T) {
+	for _, base11 := range []bool{false, true} {
+		d := &fakeDevice{base11: base11, running: "r1"}
+		c := connect(t, d)
+		assert.Equal(t, "42", c.SessionID)
+		assert.Equal(t, base11, c.t.chunked)
+
+		output, err := execute(c, &Input{Operation: "get-config", Source: "running", Filter: "<interfaces/>", ConvertToJSON: true})
+		assert.Nil(t, err)
+		assert.Contains(t, output.Reply, "<name>eth0</name>")
+		assert.Contains(t, output.Capabilities, "urn:ietf:params:netconf:capability:candidate:1.0")
+
+		interfaces := output.Data["data"].(map[string]interface{})["interfaces"].(map[string]interface{})["interface"].([]interface{})
+		assert.Len(t, interfaces, 2)
+		assert.Equal(t, map[string]interface{}{"name": "eth1", "enabled": "false"}, interfaces[1])
+		assert.Equal(t, "r1", output.Data["data"].(map[string]interface{})["hostname"])
+	}
+}
+
+func TestEditConfig(t *testing.T) {
+	d := &fakeDevice{base11: true, running: "r1", candidate: "r1"}
+	c := connect(t, d)
+
+	output, err := execute(c, &Input{Operation: "edit-config", Target: "candidate", Config: "<hostname>r2</hostname>", Lock: true, Commit: true, ConvertToJSON: true})
+	assert.Nil(t, err)
+	assert.Equal(t, map[string]interface{}{"@message-id": "2", "ok": ""}, output.Data)
+	assert.Equal(t, "r2", d.running)
+	assert.Equal(t, []string{"lock", "edit-config", "commit", "unlock"}, d.operations())
+
+	_, err = execute(c, &Input{Operation: "edit-config", Target: "candidate", Config: "<hostname>invalid</hostname>", Lock: true, Commit: true})
+	assert.NotNil(t, err)
+	assert.Contains(t, err.Error(), "invalid-value")
+	assert.Contains(t, err.Error(), "bad hostname")
+	assert.Equal(t, []string{"lock", "edit-config", "commit", "unlock", "lock", "edit-config", "discard-changes", "unlock"}, d.operations())
+	assert.Equal(t, "r2", d.running)
+
+	_, err = execute(c, &Input{Operation: "custom", RPC: `<get-schema xmlns="urn:ietf:params:xml:ns:yang:ietf-netconf-monitoring"><identifier>x</identifier></get-schema>`})
+	assert.Nil(t, err)
+	assert.Equal(t, "get-schema", d.operations()[8])
+
+	_, err = execute(c, &Input{Operation: "edit-config"})
+	assert.NotNil(t, err)
+
+	// locks end with the session of the activity, and datastore names are not XML
+	_, err = execute(c, &Input{Operation: "lock", Target: "candidate"})
+	assert.NotNil(t, err)
+	_, err = execute(c, &Input{Operation: "edit-config", Target: "running/><delete-config", Config: "<hostname>r3</hostname>"})
+	if assert.NotNil(t, err) {
+		assert.Contains(t, err.Error(), "invalid datastore")
+	}
+	_, err = execute(c, &Input{Operation: "get-config", Source: "file://backup.cfg"})
+	assert.Nil(t, err)
+	assert.Len(t, d.operations(), 10)
+}
@@ -0,0 +1,226 @@
+package netconf
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+const (
+	baseNamespace = "urn:ietf:params:xml:ns:netconf:base:1.0"
+	capBase10     = "urn:ietf:params:netconf:base:1.0"
+	capBase11     = "urn:ietf:params:netconf:base:1.1"
+)
+
+// hello is the capabilities exchange message of RFC 6241 section 8.1
+type hello struct {
+	XMLName      xml.Name `xml:"urn:ietf:params:xml:ns:netconf:base:1.0 hello"`
+	Capabilities []string `xml:"capabilities>capability"`
+	SessionID    string   `xml:"session-id,omitempty"`
+}
+
+// rpcReply holds the parts of an rpc-reply needed to match it to its request and detect errors
+type rpcReply struct {
+	XMLName   xml.Name   `xml:"rpc-reply"`
+	MessageID string     `xml:"message-id,attr"`
+	Errors    []rpcError `xml:"rpc-error"`
+}
+
+// rpcError is an rpc-error of RFC 6241 section 4.3
+type rpcError struct {
+	Type     string `xml:"error-type"`
+	Tag      string `xml:"error-tag"`
+	Severity string `xml:"error-severity"`
+	Path     string `xml:"error-path"`
+	Message  string `xml:"error-message"`
+}
+
+func (e rpcError) Error() string {
+	msg := fmt.Sprintf("%s error '%s'", e.Type, e.Tag)
+	if e.Message != "" {
+		msg += ": " + strings.TrimSpace(e.Message)
+	}
+	if e.Path != "" {
+		msg += " at " + strings.TrimSpace(e.Path)
+	}
+	return msg
+}
+
+// client is a NETCONF session over a subsystem channel
+type client struct {
+	t            *transport
+	closer       io.Closer
+	messageID    int
+	SessionID    string
+	Capabilities []string
+}
+
+// newClient exchanges hello messages and switches to chunked framing when both peers support base:1.1
+func newClient(r io.Reader, w io.WriteCloser) (*client, error) {
+	c := &client{t: newTransport(r, w), closer: w}
+
+	clientHello, err := xml.Marshal(&hello{Capabilities: []string{capBase10, capBase11}})
+	if err != nil {
+		return nil, err
+	}
+	// both peers send their hello at once, so it is written while the hello of the server is read
+	sent := make(chan error, 1)
+	go func() {
+		sent <- c.t.writeMessage(append([]byte(xml.Header), clientHello...))
+	}()
+
+	msg, err := c.t.readMessage()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read hello: %s", err.Error())
+	}
+	if err = <-sent; err != nil {
+		return nil, fmt.Errorf("failed to send hello: %s", err.Error())
+	}
+	server := &hello{}
+	if err = xml.Unmarshal(msg, server); err != nil {
+		return nil, fmt.Errorf("invalid hello: %s", err.Error())
+	}
+	c.SessionID, c.Capabilities = strings.TrimSpace(server.SessionID), server.Capabilities
+
+	for _, capability := range c.Capabilities {
+		if strings.TrimSpace(capability) == capBase11 {
+			c.t.chunked = true
+		}
+	}
+	return c, nil
+}
+
+// call sends an rpc with the given operation element and returns the rpc-reply.
+// A reply with an rpc-error of severity error is returned together with the error.
+func (c *client) call(operation string) ([]byte, error) {
+	c.messageID++
+	id := strconv.Itoa(c.messageID)
+
+	var msg bytes.Buffer
+	msg.WriteString(xml.Header)
+	fmt.Fprintf(&msg, `<rpc message-id="%s" xmlns="%s">%s</rpc>`, id, baseNamespace, operation)
+	if err := c.t.writeMessage(msg.Bytes()); err != nil {
+		return nil, fmt.Errorf("failed to send rpc: %s", err.Error())
+	}
+
+	for {
+		data, err := c.t.readMessage()
+		if err != nil {
+			return nil, fmt.Errorf("failed to read rpc-reply: %s", err.Error())
+		}
+		reply := &rpcReply{}
+		if err = xml.Unmarshal(data, reply); err != nil {
+			// notifications and other messages are skipped
+			if strings.Contains(err.Error(), "expected element type <rpc-reply>") {
+				continue
+			}
+			return nil, fmt.Errorf("invalid rpc-reply: %s", err.Error())
+		}
+		if reply.MessageID != id {
+			return nil, fmt.Errorf("rpc-reply has message-id '%s', expected '%s'", reply.MessageID, id)
+		}
+		for _, rpcErr := range reply.Errors {
+			if rpcErr.Severity != "warning" {
+				return data, rpcErr
+			}
+		}
+		return data, nil
+	}
+}
+
+// close ends the session with close-session and closes the channel
+func (c *client) close() error {
+	_, err := c.call("<close-session/>")
+	c.closer.Close()
+	return err
+}
+
+// datastore returns the element selecting a configuration datastore, or a URL. The name must have
+// been checked with checkDatastore.
+func datastore(name string) string {
+	if strings.Contains(name, "://") {
+		return "<url>" + escape(name) + "</url>"
+	}
+	return "<" + name + "/>"
+}
+
+// checkDatastore fails unless name is running, candidate, startup or a URL
+func checkDatastore(name string) error {
+	switch name {
+	case "running", "candidate", "startup":
+		return nil
+	}
+	if u, err := url.Parse(name); err == nil && u.Scheme != "" && strings.Contains(name, "://") {
+		return nil
+	}
+	return fmt.Errorf("invalid datastore '%s', expected running, candidate, startup or a URL", name)
+}
+
+func filter(f string) string {
+	f = strings.TrimSpace(f)
+	if f == "" {
+		return ""
+	}
+	if strings.HasPrefix(f, "/") {
+		return `<filter type="xpath" select="` + escape(f) + `"/>`
+	}
+	return `<filter type="subtree">` + f + `</filter>`
+}
+
+func escape(s string) string {
+	var b strings.Builder
+	xml.EscapeText(&b, []byte(s))
+	return b.String()
+}
+
+// operation builds the operation element of an rpc from the activity input
+func operation(input *Input) (string, error) {
+	source, target := input.Source, input.Target
+	if source == "" {
+		source = "running"
+	}
+	if target == "" {
+		target = "running"
+	}
+	if err := checkDatastore(source); err != nil {
+		return "", err
+	}
+	if err := checkDatastore(target); err != nil {
+		return "", err
+	}
+
+	switch input.Operation {
+	case "get":
+		return "<get>" + filter(input.Filter) + "</get>", nil
+	case "get-config":
+		return "<get-config><source>" + datastore(source) + "</source>" + filter(input.Filter) + "</get-config>", nil
+	case "edit-config":
+		if strings.TrimSpace(input.Config) == "" {
+			return "", fmt.Errorf("'config' is required for edit-config")
+		}
+		op := "<edit-config><target>" + datastore(target) + "</target>"
+		if input.DefaultOperation != "" {
+			op += "<default-operation>" + escape(input.DefaultOperation) + "</default-operation>"
+		}
+		config := strings.TrimSpace(input.Config)
+		if !strings.HasPrefix(config, "<config") {
+			config = "<config>" + config + "</config>"
+		}
+		return op + config + "</edit-config>", nil
+	case "lock", "unlock":
+		// close-session releases the locks of the session, so a lock cannot outlive the activity
+		return "", fmt.Errorf("unsupported operation '%s', set 'lock' to lock the target for the duration of an operation", input.Operation)
+	case "commit":
+		return "<commit/>", nil
+	case "custom":
+		if strings.TrimSpace(input.RPC) == "" {
+			return "", fmt.Errorf("'rpc' is required for custom operations")
+		}
+		return strings.TrimSpace(input.RPC), nil
+	}
+	return "", fmt.Errorf("unsupported operation '%s'", input.Operation)
+}
@@ -0,0 +1,133 @@
+package netconf
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"strconv"
+)
+
+// endOfMessage delimits messages in NETCONF 1.0 framing (RFC 6242 section 4.3)
+const endOfMessage = "]]>]]>"
+
+// maxChunk is the largest chunk size allowed by RFC 6242 section 4.2
+const maxChunk = 4294967295
+
+// transport reads and writes NETCONF messages in end-of-message or chunked framing
+type transport struct {
+	r       *bufio.Reader
+	w       io.Writer
+	chunked bool
+}
+
+func newTransport(r io.Reader, w io.Writer) *transport {
+	return &transport{r: bufio.NewReader(r), w: w}
+}
+
+func (t *transport) writeMessage(msg []byte) error {
+	var err error
+	if t.chunked {
+		if len(msg) > 0 {
+			_, err = fmt.Fprintf(t.w, "\n#%d\n%s\n##\n", len(msg), msg)
+		} else {
+			_, err = io.WriteString(t.w, "\n##\n")
+		}
+	} else {
+		_, err = fmt.Fprintf(t.w, "%s\n%s", msg, endOfMessage)
+	}
+	return err
+}
+
+func (t *transport) readMessage() ([]byte, error) {
+	if t.chunked {
+		return t.readChunked()
+	}
+	return t.readEOM()
+}
+
+func (t *transport) readEOM() ([]byte, error) {
+	var msg bytes.Buffer
+	for {
+		b, err := t.r.ReadByte()
+		if err != nil {
+			if err == io.EOF && msg.Len() > 0 {
+				err = io.ErrUnexpectedEOF
+			}
+			return nil, err
+		}
+		msg.WriteByte(b)
+		if b == '>' && bytes.HasSuffix(msg.Bytes(), []byte(endOfMessage)) {
+			return bytes.TrimSpace(msg.Bytes()[:msg.Len()-len(endOfMessage)]), nil
+		}
+	}
+}
+
+// readChunked reads chunks of the form "\n#<size>\n<data>" until the end-of-chunks marker "\n##\n"
+func (t *transport) readChunked() ([]byte, error) {
+	var msg bytes.Buffer
+	// some devices follow the end-of-message delimiter of their hello with a new line
+	if err := t.skipSpace(); err != nil {
+		return nil, err
+	}
+	for {
+		if err := t.expect("\n#"); err != nil {
+			return nil, err
+		}
+		b, err := t.r.ReadByte()
+		if err != nil {
+			return nil, err
+		}
+		if b == '#' {
+			if err = t.expect("\n"); err != nil {
+				return nil, err
+			}
+			return msg.Bytes(), nil
+		}
+		if err = t.r.UnreadByte(); err != nil {
+			return nil, err
+		}
+
+		line, err := t.r.ReadString('\n')
+		if err != nil {
+			return nil, err
+		}
+		size, err := strconv.ParseUint(line[:len(line)-1], 10, 32)
+		if err != nil || size == 0 || size > maxChunk || len(line) > 11 {
+			return nil, fmt.Errorf("invalid chunk size '%s'", line[:len(line)-1])
+		}
+		if _, err = io.CopyN(&msg, t.r, int64(size)); err != nil {
+			return nil, err
+		}
+	}
+}
+
+func (t *transport) expect(s string) error {
+	for i := 0; i < len(s); i++ {
+		b, err := t.r.ReadByte()
+		if err != nil {
+			return err
+		}
+		if b != s[i] {
+			return fmt.Errorf("invalid chunked framing: expected %q", s)
+		}
+	}
+	return nil
+}
+
+// skipSpace skips white space up to the new line that starts the next chunk
+func (t *transport) skipSpace() error {
+	for {
+		b, err := t.r.Peek(2)
+		if err != nil {
+			return err
+		}
+		if b[0] == '\n' && b[1] == '#' {
+			return nil
+		}
+		if b[0] != ' ' && b[0] != '\t' && b[0] != '\r' && b[0] != '\n' {
+			return nil
+		}
+		t.r.ReadByte()
+	}
+}
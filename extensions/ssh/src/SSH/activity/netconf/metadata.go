@@ -0,0 +1,157 @@
+package netconf
+
+import (
+	ssh "github.com/mmussett/extensions/SSH/connector/connection"
+	"github.com/project-flogo/core/data/coerce"
+	"github.com/project-flogo/core/support/connection"
+)
+
+// Input corresponds to activity.json inputs
+type Input struct {
+	Connection       connection.Manager `md:"SSH Connection,required"`
+	Host             string             `md:"host"`
+	Port             int                `md:"port"`
+	Operation        string             `md:"operation,required,allowed(get,get-config,edit-config,commit,custom)"`
+	Source           string             `md:"source"`
+	Target           string             `md:"target"`
+	Filter           string             `md:"filter"`
+	Config           string             `md:"config"`
+	DefaultOperation string             `md:"defaultOperation"`
+	RPC              string             `md:"rpc"`
+	Lock             bool               `md:"lock"`
+	Commit           bool               `md:"commit"`
+	ConvertToJSON    bool               `md:"convertToJSON"`
+}
+
+// Output corresponds to activity.json outputs
+type Output struct {
+	Reply        string                 `md:"reply"`
+	Data         map[string]interface{} `md:"data"`
+	SessionID    string                 `md:"sessionId"`
+	Capabilities []interface{}          `md:"capabilities"`
+}
+
+// ToMap converts Input struct to map
+func (i *Input) ToMap() map[string]interface{} {
+	return map[string]interface{}{
+		"SSH Connection":   i.Connection,
+		"host":             i.Host,
+		"port":             i.Port,
+		"operation":        i.Operation,
+		"source":           i.Source,
+		"target":           i.Target,
+		"filter":           i.Filter,
+		"config":           i.Config,
+		"defaultOperation": i.DefaultOperation,
+		"rpc":              i.RPC,
+		"lock":             i.Lock,
+		"commit":           i.Commit,
+		"convertToJSON":    i.ConvertToJSON,
+	}
+}
+
+// FromMap converts a map to Input struct
+func (i *Input) FromMap(values map[string]interface{}) error {
+	var err error
+	i.Connection, err = ssh.GetSharedConfiguration(values["SSH Connection"])
+	if err != nil {
+		return err
+	}
+
+	i.Host, err = coerce.ToString(values["host"])
+	if err != nil {
+		return err
+	}
+
+	i.Port, err = coerce.ToInt(values["port"])
+	if err != nil {
+		return err
+	}
+
+	i.Operation, err = coerce.ToString(values["operation"])
+	if err != nil {
+		return err
+	}
+
+	i.Source, err = coerce.ToString(values["source"])
+	if err != nil {
+		return err
+	}
+
+	i.Target, err = coerce.ToString(values["target"])
+	if err != nil {
+		return err
+	}
+
+	i.Filter, err = coerce.ToString(values["filter"])
+	if err != nil {
+		return err
+	}
+
+	i.Config, err = coerce.ToString(values["config"])
+	if err != nil {
+		return err
+	}
+
+	i.DefaultOperation, err = coerce.ToString(values["defaultOperation"])
+	if err != nil {
+		return err
+	}
+
+	i.RPC, err = coerce.ToString(values["rpc"])
+	if err != nil {
+		return err
+	}
+
+	i.Lock, err = coerce.ToBool(values["lock"])
+	if err != nil {
+		return err
+	}
+
+	i.Commit, err = coerce.ToBool(values["commit"])
+	if err != nil {
+		return err
+	}
+
+	i.ConvertToJSON, err = coerce.ToBool(values["convertToJSON"])
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// ToMap converts Output struct to map
+func (o *Output) ToMap() map[string]interface{} {
+	return map[string]interface{}{
+		"reply":        o.Reply,
+		"data":         o.Data,
+		"sessionId":    o.SessionID,
+		"capabilities": o.Capabilities,
+	}
+}
+
+// FromMap converts a map to Output struct
+func (o *Output) FromMap(values map[string]interface{}) error {
+	var err error
+	o.Reply, err = coerce.ToString(values["reply"])
+	if err != nil {
+		return err
+	}
+
+	o.Data, err = coerce.ToObject(values["data"])
+	if err != nil {
+		return err
+	}
+
+	o.SessionID, err = coerce.ToString(values["sessionId"])
+	if err != nil {
+		return err
+	}
+
+	o.Capabilities, err = coerce.ToArray(values["capabilities"])
+	if err != nil {
+		return err
+	}
+	return nil
+}
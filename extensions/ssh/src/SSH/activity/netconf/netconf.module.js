@@ -0,0 +1,35 @@
+"use strict";
+var __decorate =
+    (this && this.__decorate) ||
+    function (e, t, r, o) {
+        var n,
+            i = arguments.length,
+            c = i < 3 ? t : null === o ? (o = Object.runOwnPropertyDescriptor(t, r)) : o;
+        if ("object" == typeof Reflect && "function" == typeof Reflect.decorate) c = Reflect.decorate(e, t, r, o);
+        else for (var u = e.length - 1; u >= 0; u--) (n = e[u]) && (c = (i < 3 ? n(c) : i > 3 ? n(t, r, c) : n(t, r)) || c);
+        return i > 3 && c && Object.defineProperty(t, r, c), c;
+    };
+Object.defineProperty(exports, "__esModule", { value: !0 });
+var wi_contrib_1 = require("wi-studio/app/contrib/wi-contrib"),
+    core_1 = require("@angular/core"),
+    common_1 = require("@angular/common"),
+    http_1 = require("@angular/http"),
+    netconfHandler_1 = require("./netconfHandler"),
+    netconfModule = (function () {
+        return function () {};
+    })();
+(netconfModule = __decorate(
+    [
+        core_1.NgModule({
+            imports: [common_1.CommonModule, http_1.HttpModule],
+            exports: [],
+            declarations: [],
+            entryComponents: [],
+            providers: [{ provide: wi_contrib_1.WiServiceContribution, useClass: netconfHandler_1.netconfHandler }],
+            bootstrap: [],
+        }),
+    ],
+    netconfModule
+)),
+    (exports.default = netconfModule);
+//# sourceMappingURL=netconf.module.js.map
@@ -0,0 +1,105 @@
+package netconf
+
+import (
+	"bytes"
+	"encoding/xml"
+	"io"
+	"strings"
+)
+
+// xmlNode is an element of a parsed XML document
+type xmlNode struct {
+	name     string
+	attrs    []xml.Attr
+	text     strings.Builder
+	children []*xmlNode
+}
+
+func parseXML(data []byte) (*xmlNode, error) {
+	decoder := xml.NewDecoder(bytes.NewReader(data))
+	var stack []*xmlNode
+	var root *xmlNode
+	for {
+		token, err := decoder.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		switch t := token.(type) {
+		case xml.StartElement:
+			node := &xmlNode{name: t.Name.Local, attrs: t.Attr}
+			if len(stack) > 0 {
+				parent := stack[len(stack)-1]
+				parent.children = append(parent.children, node)
+			} else if root == nil {
+				root = node
+			}
+			stack = append(stack, node)
+		case xml.EndElement:
+			stack = stack[:len(stack)-1]
+		case xml.CharData:
+			if len(stack) > 0 {
+				stack[len(stack)-1].text.Write(t)
+			}
+		}
+	}
+	return root, nil
+}
+
+// toJSON converts the content of the root element of an XML document to JSON compatible values.
+// Namespaces are dropped, attributes become "@name" keys, repeated elements become arrays and
+// the text of elements that also have children or attributes becomes a "#text" key.
+func toJSON(data []byte) (map[string]interface{}, error) {
+	root, err := parseXML(data)
+	if err != nil {
+		return nil, err
+	}
+	if root == nil {
+		return map[string]interface{}{}, nil
+	}
+	value, ok := root.value().(map[string]interface{})
+	if !ok {
+		return map[string]interface{}{}, nil
+	}
+	return value, nil
+}
+
+func (n *xmlNode) value() interface{} {
+	text := strings.TrimSpace(n.text.String())
+	attrs := map[string]interface{}{}
+	for _, attr := range n.attrs {
+		if attr.Name.Space == "xmlns" || attr.Name.Local == "xmlns" {
+			continue
+		}
+		attrs["@"+attr.Name.Local] = attr.Value
+	}
+	if len(n.children) == 0 && len(attrs) == 0 {
+		return text
+	}
+
+	obj := attrs
+	for _, child := range n.children {
+		value := child.value()
+		existing, ok := obj[child.name]
+		switch {
+		case !ok:
+			obj[child.name] = value
+		case isArray(existing):
+			obj[child.name] = append(existing.([]interface{}), value)
+		default:
+			obj[child.name] = []interface{}{existing, value}
+		}
+	}
+	if text != "" {
+		obj["#text"] = text
+	}
+	return obj
+}
+
+func isArray(v interface{}) bool {
+	_, ok := v.([]interface{})
+	return ok
+}
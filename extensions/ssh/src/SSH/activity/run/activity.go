@@ -1,13 +1,24 @@
 package run
 
 import (
+	gocontext "context"
+	"errors"
+	"fmt"
+	"strings"
+
+	ssh "github.com/mmussett/extensions/SSH/connector/connection"
 	"github.com/project-flogo/core/activity"
 	"github.com/project-flogo/core/support/log"
-	"golang.org/x/crypto/ssh"
 )
 
 var activityMd = activity.ToMetadata(&Input{}, &Output{})
 
+// ErrorCodePolicy is the code of the error returned for commands rejected by the command policy of the connection
+const ErrorCodePolicy = "SSH-RUN-4001"
+
+// ErrorCodeCircuitOpen is the code of the error returned without running the command while the circuit breaker of the host is open
+const ErrorCodeCircuitOpen = "SSH-RUN-4002"
+
 func init() {
 	_ = activity.Register(&MyActivity{}, New)
 }
@@ -41,17 +52,31 @@ func (activity *MyActivity) Eval(context activity.Context) (done bool, err error
 		return false, err
 	}
 
-	session := input.Connection.GetConnection().(*ssh.Session)
-
 	cmd := input.Cmd
 
-	stdOut, err := session.Output(cmd)
+	// the command is checked before a client is looked up, so a rejected command never opens a session
+	if err = ssh.CheckCommand(input.Connection, cmd); err != nil {
+		return false, policyError(err)
+	}
 
+	client, err := ssh.GetHostClient(input.Connection, input.Host, input.Port)
 	if err != nil {
 		return false, err
 	}
 
-	output.StdOut = string(stdOut)
+	// each command runs in its own session, a session can only run one command
+	ctx := ssh.WithActivity(gocontext.Background(), context.ActivityHost().Name(), context.Name())
+	result, err := client.Run(ctx, cmd, nil)
+
+	if err != nil {
+		return false, circuitError(err)
+	}
+
+	if result.ExitCode != 0 {
+		return false, fmt.Errorf("command exited with status %d: %s", result.ExitCode, strings.TrimSpace(string(result.Stderr)))
+	}
+
+	output.StdOut = string(result.Stdout)
 
 	//Set output object
 	err = context.SetOutputObject(output)
@@ -61,3 +86,18 @@ func (activity *MyActivity) Eval(context activity.Context) (done bool, err error
 
 	return true, nil
 }
+
+// policyError returns a policy violation as an activity error with ErrorCodePolicy
+func policyError(err error) error {
+	return activity.NewError(err.Error(), ErrorCodePolicy, nil)
+}
+
+// circuitError returns the error of an open circuit breaker as an activity error with ErrorCodeCircuitOpen,
+// other errors are returned unchanged
+func circuitError(err error) error {
+	var circuitErr *ssh.CircuitOpenError
+	if errors.As(err, &circuitErr) {
+		return activity.NewError(err.Error(), ErrorCodeCircuitOpen, nil)
+	}
+	return err
+}
@@ -9,6 +9,8 @@ import (
 // Input corresponds to activity.json inputs
 type Input struct {
 	Connection connection.Manager `md:"SSH Connection,required"`
+	Host       string             `md:"host"`
+	Port       int                `md:"port"`
 	Cmd        string             `md:"cmd,required"`
 }
 
@@ -21,6 +23,8 @@ type Output struct {
 func (i *Input) ToMap() map[string]interface{} {
 	return map[string]interface{}{
 		"SSH Connection": i.Connection,
+		"host":           i.Host,
+		"port":           i.Port,
 		"cmd":            i.Cmd,
 	}
 }
@@ -33,6 +37,16 @@ func (i *Input) FromMap(values map[string]interface{}) error {
 		return err
 	}
 
+	i.Host, err = coerce.ToString(values["host"])
+	if err != nil {
+		return err
+	}
+
+	i.Port, err = coerce.ToInt(values["port"])
+	if err != nil {
+		return err
+	}
+
 	i.Cmd, err = coerce.ToString(values["cmd"])
 	if err != nil {
 		return err
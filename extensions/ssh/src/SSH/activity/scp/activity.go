@@ -0,0 +1,125 @@
+package scp
+
+import (
+	"bufio"
+	gocontext "context"
+	"fmt"
+	"strings"
+
+	ssh "github.com/mmussett/extensions/SSH/connector/connection"
+	"github.com/mmussett/extensions/SSH/internal/shell"
+	"github.com/project-flogo/core/activity"
+	"github.com/project-flogo/core/support/log"
+)
+
+var activityMd = activity.ToMetadata(&Input{}, &Output{})
+
+func init() {
+	_ = activity.Register(&MyActivity{}, New)
+}
+
+// New creates a new activity
+func New(ctx activity.InitContext) (activity.Activity, error) {
+	return &MyActivity{logger: log.ChildLogger(ctx.Logger(), "SSH-activity-scp"), activityName: "scp"}, nil
+}
+
+// MyActivity transfers files using the scp protocol over a SSH session
+type MyActivity struct {
+	logger       log.Logger
+	activityName string
+}
+
+// Metadata implements activity.Activity.Metadata
+func (*MyActivity) Metadata() *activity.Metadata {
+	return activityMd
+}
+
+// Eval implements activity.Activity.Eval
+func (activity *MyActivity) Eval(context activity.Context) (done bool, err error) {
+
+	input := &Input{}
+	output := &Output{}
+
+	//Get Input Object
+	err = context.GetInputObject(input)
+	if err != nil {
+		return false, err
+	}
+
+	if input.LocalPath == "" || input.RemotePath == "" {
+		return false, fmt.Errorf("required inputs 'localPath' and 'remotePath' must be specified")
+	}
+
+	sshClient, err := ssh.GetHostClient(input.Connection, input.Host, input.Port)
+	if err != nil {
+		return false, err
+	}
+
+	// the command or subsystem of the session is recorded in the audit trail of the connection
+	ctx := ssh.WithActivity(gocontext.Background(), context.ActivityHost().Name(), context.Name())
+	session, err := sshClient.NewSession(ctx)
+	if err != nil {
+		return false, err
+	}
+	defer session.Close()
+
+	stdin, err := session.StdinPipe()
+	if err != nil {
+		return false, err
+	}
+	stdout, err := session.StdoutPipe()
+	if err != nil {
+		return false, err
+	}
+	var stderr strings.Builder
+	session.Stderr = &stderr
+
+	flags := ""
+	if input.Recursive {
+		flags += " -r"
+	}
+	if input.Preserve {
+		flags += " -p"
+	}
+
+	var t *transfer
+	switch input.Operation {
+	case "upload":
+		cmd := "scp -t" + flags + " -- " + shell.Quote(input.RemotePath)
+		activity.logger.Debugf("Starting remote '%s'", cmd)
+		if err = session.Start(cmd); err != nil {
+			return false, fmt.Errorf("failed to start remote scp: %s", err.Error())
+		}
+		t, err = send(stdin, bufio.NewReader(stdout), input.LocalPath, input.Recursive, input.Preserve)
+	case "download":
+		cmd := "scp -f" + flags + " -- " + shell.Quote(input.RemotePath)
+		activity.logger.Debugf("Starting remote '%s'", cmd)
+		if err = session.Start(cmd); err != nil {
+			return false, fmt.Errorf("failed to start remote scp: %s", err.Error())
+		}
+		t, err = receive(stdin, bufio.NewReader(stdout), input.LocalPath, input.Preserve)
+	default:
+		return false, fmt.Errorf("unsupported operation '%s'", input.Operation)
+	}
+	stdin.Close()
+	waitErr := session.Wait()
+	if err != nil {
+		return false, err
+	}
+	if waitErr != nil {
+		return false, fmt.Errorf("remote scp failed: %s %s", waitErr.Error(), strings.TrimSpace(stderr.String()))
+	}
+
+	activity.logger.Debugf("Transferred %d files, %d bytes", len(t.files), t.bytes)
+	output.Files = t.files
+	output.FilesTransferred = len(t.files)
+	output.BytesTransferred = t.bytes
+
+	//Set output object
+	err = context.SetOutputObject(output)
+	if err != nil {
+		return false, err
+	}
+
+	return true, nil
+}
@@ -0,0 +1,120 @@
+package scp
+
+import (
+	"bufio"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/project-flogo/core/activity"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRegister(t *testing.T) {
+	ref := activity.GetRef(&MyActivity{})
+	act := activity.Get(ref)
+
+	assert.NotNil(t, act)
+}
+
+// pipeTransfer connects a source and a sink the same way the remote scp would
+func pipeTransfer(t *testing.T, src, dst string, recursive, preserve bool) (*transfer, *transfer) {
+	sourceRead, sinkWrite := io.Pipe()
+	sinkRead, sourceWrite := io.Pipe()
+
+	var sent *transfer
+	var sendErr error
+	done := make(chan struct{})
+	go func() {
+		sent, sendErr = send(sourceWrite, bufio.NewReader(sourceRead), src, recursive, preserve)
+		sourceWrite.Close()
+		close(done)
+	}()
+
+	received, err := receive(sinkWrite, bufio.NewReader(sinkRead), dst, preserve)
+	sinkWrite.Close()
+	<-done
+	assert.Nil(t, sendErr)
+	assert.Nil(t, err)
+	return sent, received
+}
+
+func TestSingleFile(t *testing.T) {
+	dir := t.TempDir()
+	src := filepath.Join(dir, "report.csv")
+	content := strings.Repeat("a,b,c\n", 10000)
+	assert.Nil(t, os.WriteFile(src, []byte(content), 0640))
+	mtime := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+	assert.Nil(t, os.Chtimes(src, mtime, mtime))
+
+	dst := filepath.Join(dir, "copy.csv")
+	sent, received := pipeTransfer(t, src, dst, false, true)
+	assert.Equal(t, int64(len(content)), sent.bytes)
+	assert.Equal(t, []string{dst}, received.files)
+
+	data, err := os.ReadFile(dst)
+	assert.Nil(t, err)
+	assert.Equal(t, content, string(data))
+
+	info, err := os.Stat(dst)
+	assert.Nil(t, err)
+	assert.Equal(t, os.FileMode(0640), info.Mode().Perm())
+	assert.True(t, info.ModTime().Equal(mtime))
+}
+
+func TestRecursiveDirectory(t *testing.T) {
+	dir := t.TempDir()
+	src := filepath.Join(dir, "bundle")
+	assert.Nil(t, os.MkdirAll(filepath.Join(src, "conf.d"), 0755))
+	assert.Nil(t, os.WriteFile(filepath.Join(src, "main.conf"), []byte("main"), 0644))
+	assert.Nil(t, os.WriteFile(filepath.Join(src, "conf.d", "site.conf"), []byte("site"), 0600))
+
+	dst := filepath.Join(dir, "out")
+	assert.Nil(t, os.Mkdir(dst, 0755))
+	sent, received := pipeTransfer(t, src, dst, true, true)
+	assert.Len(t, sent.files, 2)
+	assert.Len(t, received.files, 2)
+
+	data, err := os.ReadFile(filepath.Join(dst, "bundle", "conf.d", "site.conf"))
+	assert.Nil(t, err)
+	assert.Equal(t, "site", string(data))
+}
+
+func TestRecursiveSkipsSymlinks(t *testing.T) {
+	dir := t.TempDir()
+	src := filepath.Join(dir, "bundle")
+	outside := filepath.Join(dir, "secret")
+	assert.Nil(t, os.MkdirAll(src, 0755))
+	assert.Nil(t, os.WriteFile(outside, []byte("secret"), 0600))
+	assert.Nil(t, os.WriteFile(filepath.Join(src, "main.conf"), []byte("main"), 0644))
+	assert.Nil(t, os.Symlink(outside, filepath.Join(src, "secret")))
+	assert.Nil(t, os.Symlink(src, filepath.Join(src, "loop")))
+
+	dst := filepath.Join(dir, "out")
+	assert.Nil(t, os.Mkdir(dst, 0755))
+	sent, _ := pipeTransfer(t, src, dst, true, false)
+	assert.Equal(t, []string{filepath.Join(src, "main.conf")}, sent.files)
+
+	entries, err := os.ReadDir(filepath.Join(dst, "bundle"))
+	assert.Nil(t, err)
+	if assert.Len(t, entries, 1) {
+		assert.Equal(t, "main.conf", entries[0].Name())
+	}
+}
+
+func TestDirectoryRequiresRecursive(t *testing.T) {
+	sourceRead := bufio.NewReader(strings.NewReader("\x00"))
+	_, err := send(io.Discard, sourceRead, t.TempDir(), false, false)
+	assert.NotNil(t, err)
+}
+
+func TestUnsafeName(t *testing.T) {
+	_, _, _, err := parseEntry("C0644 4 ../passwd\n")
+	assert.NotNil(t, err)
+
+	_, err = receive(io.Discard, bufio.NewReader(strings.NewReader("\x02permission denied\n")), t.TempDir(), false)
+	assert.EqualError(t, err, "scp error: permission denied")
+}
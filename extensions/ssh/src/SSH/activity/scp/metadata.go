@@ -0,0 +1,127 @@
+package scp
+
+import (
+	ssh "github.com/mmussett/extensions/SSH/connector/connection"
+	"github.com/project-flogo/core/data/coerce"
+	"github.com/project-flogo/core/support/connection"
+)
+
+// Input corresponds to activity.json inputs
+type Input struct {
+	Connection connection.Manager `md:"SSH Connection,required"`
+	Host       string             `md:"host"`
+	Port       int                `md:"port"`
+	Operation  string             `md:"operation,required,allowed(upload,download)"`
+	LocalPath  string             `md:"localPath,required"`
+	RemotePath string             `md:"remotePath,required"`
+	Recursive  bool               `md:"recursive"`
+	Preserve   bool               `md:"preserve"`
+}
+
+// Output corresponds to activity.json outputs
+type Output struct {
+	Files            []string `md:"files"`
+	FilesTransferred int      `md:"filesTransferred"`
+	BytesTransferred int64    `md:"bytesTransferred"`
+}
+
+// ToMap converts Input struct to map
+func (i *Input) ToMap() map[string]interface{} {
+	return map[string]interface{}{
+		"SSH Connection": i.Connection,
+		"host":           i.Host,
+		"port":           i.Port,
+		"operation":      i.Operation,
+		"localPath":      i.LocalPath,
+		"remotePath":     i.RemotePath,
+		"recursive":      i.Recursive,
+		"preserve":       i.Preserve,
+	}
+}
+
+// FromMap converts a map to Input struct
+func (i *Input) FromMap(values map[string]interface{}) error {
+	var err error
+	i.Connection, err = ssh.GetSharedConfiguration(values["SSH Connection"])
+	if err != nil {
+		return err
+	}
+
+	i.Host, err = coerce.ToString(values["host"])
+	if err != nil {
+		return err
+	}
+
+	i.Port, err = coerce.ToInt(values["port"])
+	if err != nil {
+		return err
+	}
+
+	i.Operation, err = coerce.ToString(values["operation"])
+	if err != nil {
+		return err
+	}
+
+	i.LocalPath, err = coerce.ToString(values["localPath"])
+	if err != nil {
+		return err
+	}
+
+	i.RemotePath, err = coerce.ToString(values["remotePath"])
+	if err != nil {
+		return err
+	}
+
+	i.Recursive, err = coerce.ToBool(values["recursive"])
+	if err != nil {
+		return err
+	}
+
+	i.Preserve, err = coerce.ToBool(values["preserve"])
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// ToMap converts Output struct to map
+func (o *Output) ToMap() map[string]interface{} {
+	files := make([]interface{}, len(o.Files))
+	for idx, f := range o.Files {
+		files[idx] = f
+	}
+	return map[string]interface{}{
+		"files":            files,
+		"filesTransferred": o.FilesTransferred,
+		"bytesTransferred": o.BytesTransferred,
+	}
+}
+
+// FromMap converts a map to Output struct
+func (o *Output) FromMap(values map[string]interface{}) error {
+	var err error
+	files, err := coerce.ToArray(values["files"])
+	if err != nil {
+		return err
+	}
+	o.Files = make([]string, 0, len(files))
+	for _, f := range files {
+		s, err := coerce.ToString(f)
+		if err != nil {
+			return err
+		}
+		o.Files = append(o.Files, s)
+	}
+
+	o.FilesTransferred, err = coerce.ToInt(values["filesTransferred"])
+	if err != nil {
+		return err
+	}
+
+	o.BytesTransferred, err = coerce.ToInt64(values["bytesTransferred"])
+	if err != nil {
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,306 @@
+package scp
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// transfer records the files moved by one scp run
+type transfer struct {
+	files []string
+	bytes int64
+}
+
+// readAck reads the single byte acknowledgement of the peer.
+// 0 means success, 1 a warning and 2 a fatal error, both followed by a message line.
+func readAck(r *bufio.Reader) error {
+	code, err := r.ReadByte()
+	if err != nil {
+		return fmt.Errorf("failed to read scp acknowledgement: %s", err.Error())
+	}
+	if code == 0 {
+		return nil
+	}
+	msg, _ := r.ReadString('\n')
+	msg = strings.TrimSpace(msg)
+	if code == 1 || code == 2 {
+		return fmt.Errorf("scp error: %s", msg)
+	}
+	return fmt.Errorf("unexpected scp acknowledgement %d: %s", code, msg)
+}
+
+func writeAck(w io.Writer) error {
+	_, err := w.Write([]byte{0})
+	return err
+}
+
+// send acts as the scp source: it writes localPath to the sink at the other end of w and r.
+func send(w io.Writer, r *bufio.Reader, localPath string, recursive, preserve bool) (*transfer, error) {
+	// the sink acknowledges that it is ready before any data is sent
+	if err := readAck(r); err != nil {
+		return nil, err
+	}
+
+	info, err := os.Stat(localPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to stat local path '%s': %s", localPath, err.Error())
+	}
+
+	t := &transfer{}
+	if info.IsDir() {
+		if !recursive {
+			return nil, fmt.Errorf("local path '%s' is a directory, enable recursive to transfer directories", localPath)
+		}
+		err = sendDir(w, r, localPath, info, preserve, t)
+	} else {
+		err = sendFile(w, r, localPath, info, preserve, t)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return t, nil
+}
+
+func sendTimes(w io.Writer, r *bufio.Reader, info os.FileInfo) error {
+	mtime := info.ModTime().Unix()
+	if _, err := fmt.Fprintf(w, "T%d 0 %d 0\n", mtime, mtime); err != nil {
+		return err
+	}
+	return readAck(r)
+}
+
+func sendFile(w io.Writer, r *bufio.Reader, localPath string, info os.FileInfo, preserve bool, t *transfer) error {
+	if preserve {
+		if err := sendTimes(w, r, info); err != nil {
+			return err
+		}
+	}
+
+	f, err := os.Open(localPath)
+	if err != nil {
+		return fmt.Errorf("failed to open local file '%s': %s", localPath, err.Error())
+	}
+	defer f.Close()
+
+	if _, err = fmt.Fprintf(w, "C%04o %d %s\n", info.Mode().Perm(), info.Size(), info.Name()); err != nil {
+		return err
+	}
+	if err = readAck(r); err != nil {
+		return err
+	}
+
+	// stream the content so large files are never held in memory
+	n, err := io.CopyN(w, f, info.Size())
+	if err != nil {
+		return fmt.Errorf("failed to send '%s': %s", localPath, err.Error())
+	}
+	if err = writeAck(w); err != nil {
+		return err
+	}
+	if err = readAck(r); err != nil {
+		return err
+	}
+
+	t.files = append(t.files, localPath)
+	t.bytes += n
+	return nil
+}
+
+func sendDir(w io.Writer, r *bufio.Reader, localPath string, info os.FileInfo, preserve bool, t *transfer) error {
+	if preserve {
+		if err := sendTimes(w, r, info); err != nil {
+			return err
+		}
+	}
+
+	if _, err := fmt.Fprintf(w, "D%04o 0 %s\n", info.Mode().Perm(), info.Name()); err != nil {
+		return err
+	}
+	if err := readAck(r); err != nil {
+		return err
+	}
+
+	entries, err := os.ReadDir(localPath)
+	if err != nil {
+		return fmt.Errorf("failed to read local directory '%s': %s", localPath, err.Error())
+	}
+	for _, entry := range entries {
+		childPath := filepath.Join(localPath, entry.Name())
+		// symbolic links are not followed, so that a link loop or a link out of the tree is never sent
+		childInfo, err := os.Lstat(childPath)
+		if err != nil {
+			return fmt.Errorf("failed to stat local path '%s': %s", childPath, err.Error())
+		}
+		if childInfo.Mode()&os.ModeSymlink != 0 {
+			continue
+		}
+		if childInfo.IsDir() {
+			err = sendDir(w, r, childPath, childInfo, preserve, t)
+		} else if childInfo.Mode().IsRegular() {
+			err = sendFile(w, r, childPath, childInfo, preserve, t)
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	if _, err = fmt.Fprint(w, "E\n"); err != nil {
+		return err
+	}
+	return readAck(r)
+}
+
+// receive acts as the scp sink: it writes what the source at the other end of w and r sends below localPath.
+// If localPath is an existing directory the received entries are created inside it, otherwise
+// the first received entry is created as localPath.
+func receive(w io.Writer, r *bufio.Reader, localPath string, preserve bool) (*transfer, error) {
+	// directory times are applied once the directory is complete, as its content changes them
+	type dirEntry struct {
+		path         string
+		mtime, atime time.Time
+		haveTimes    bool
+	}
+	t := &transfer{}
+	dirs := []dirEntry{}
+	var mtime, atime time.Time
+	haveTimes := false
+
+	target := func(name string) string {
+		if len(dirs) > 0 {
+			return filepath.Join(dirs[len(dirs)-1].path, name)
+		}
+		if info, err := os.Stat(localPath); err == nil && info.IsDir() {
+			return filepath.Join(localPath, name)
+		}
+		return localPath
+	}
+
+	// tell the source we are ready
+	if err := writeAck(w); err != nil {
+		return nil, err
+	}
+
+	for {
+		line, err := r.ReadString('\n')
+		if err == io.EOF && line == "" {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to read scp message: %s", err.Error())
+		}
+		if line == "" {
+			continue
+		}
+
+		switch line[0] {
+		case 1, 2:
+			return nil, fmt.Errorf("scp error: %s", strings.TrimSpace(line[1:]))
+		case 'T':
+			var m, a int64
+			var mu, au int64
+			if _, err = fmt.Sscanf(line, "T%d %d %d %d\n", &m, &mu, &a, &au); err != nil {
+				return nil, fmt.Errorf("invalid scp time message '%s'", strings.TrimSpace(line))
+			}
+			mtime, atime, haveTimes = time.Unix(m, 0), time.Unix(a, 0), true
+			if err = writeAck(w); err != nil {
+				return nil, err
+			}
+		case 'C', 'D':
+			mode, size, name, err := parseEntry(line)
+			if err != nil {
+				return nil, err
+			}
+			p := target(name)
+			if line[0] == 'D' {
+				if err = os.MkdirAll(p, mode); err != nil {
+					return nil, fmt.Errorf("failed to create local directory '%s': %s", p, err.Error())
+				}
+				dirs = append(dirs, dirEntry{path: p, mtime: mtime, atime: atime, haveTimes: haveTimes})
+				if err = writeAck(w); err != nil {
+					return nil, err
+				}
+			} else {
+				if err = writeAck(w); err != nil {
+					return nil, err
+				}
+				if err = receiveFile(r, p, mode, size); err != nil {
+					return nil, err
+				}
+				if err = readAck(r); err != nil {
+					return nil, err
+				}
+				if preserve {
+					os.Chmod(p, mode)
+					if haveTimes {
+						os.Chtimes(p, atime, mtime)
+					}
+				}
+				if err = writeAck(w); err != nil {
+					return nil, err
+				}
+				t.files = append(t.files, p)
+				t.bytes += size
+			}
+			haveTimes = false
+		case 'E':
+			if len(dirs) == 0 {
+				return nil, errors.New("unexpected end of directory in scp stream")
+			}
+			dir := dirs[len(dirs)-1]
+			dirs = dirs[:len(dirs)-1]
+			if preserve && dir.haveTimes {
+				os.Chtimes(dir.path, dir.atime, dir.mtime)
+			}
+			if err = writeAck(w); err != nil {
+				return nil, err
+			}
+		default:
+			return nil, fmt.Errorf("unexpected scp message '%s'", strings.TrimSpace(line))
+		}
+	}
+	return t, nil
+}
+
+func receiveFile(r io.Reader, p string, mode os.FileMode, size int64) error {
+	f, err := os.OpenFile(p, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, mode)
+	if err != nil {
+		return fmt.Errorf("failed to create local file '%s': %s", p, err.Error())
+	}
+	_, err = io.CopyN(f, r, size)
+	closeErr := f.Close()
+	if err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return fmt.Errorf("failed to receive '%s': %s", p, err.Error())
+	}
+	return nil
+}
+
+// parseEntry parses a "C<mode> <size> <name>" or "D<mode> 0 <name>" message
+func parseEntry(line string) (os.FileMode, int64, string, error) {
+	parts := strings.SplitN(strings.TrimSuffix(line[1:], "\n"), " ", 3)
+	if len(parts) != 3 {
+		return 0, 0, "", fmt.Errorf("invalid scp message '%s'", strings.TrimSpace(line))
+	}
+	mode, err := strconv.ParseUint(parts[0], 8, 32)
+	if err != nil {
+		return 0, 0, "", fmt.Errorf("invalid mode in scp message '%s'", strings.TrimSpace(line))
+	}
+	size, err := strconv.ParseInt(parts[1], 10, 64)
+	if err != nil || size < 0 {
+		return 0, 0, "", fmt.Errorf("invalid size in scp message '%s'", strings.TrimSpace(line))
+	}
+	name := parts[2]
+	if name == "" || name == "." || name == ".." || strings.ContainsAny(name, "/\\") {
+		return 0, 0, "", fmt.Errorf("refusing unsafe file name '%s' in scp message", name)
+	}
+	return os.FileMode(mode), size, name, nil
+}
@@ -0,0 +1,85 @@
+package service
+
+import (
+	gocontext "context"
+	"time"
+
+	ssh "github.com/mmussett/extensions/SSH/connector/connection"
+	"github.com/project-flogo/core/activity"
+	"github.com/project-flogo/core/support/log"
+)
+
+var activityMd = activity.ToMetadata(&Input{}, &Output{})
+
+func init() {
+	_ = activity.Register(&MyActivity{}, New)
+}
+
+// New creates a new activity
+func New(ctx activity.InitContext) (activity.Activity, error) {
+	return &MyActivity{logger: log.ChildLogger(ctx.Logger(), "SSH-activity-service"), activityName: "service"}, nil
+}
+
+// MyActivity manages the systemd units of the host of the SSH connection
+type MyActivity struct {
+	logger       log.Logger
+	activityName string
+}
+
+// Metadata implements activity.Activity.Metadata
+func (*MyActivity) Metadata() *activity.Metadata {
+	return activityMd
+}
+
+// Eval implements activity.Activity.Eval
+func (activity *MyActivity) Eval(context activity.Context) (done bool, err error) {
+
+	input := &Input{}
+
+	//Get Input Object
+	err = context.GetInputObject(input)
+	if err != nil {
+		return false, err
+	}
+
+	if err = validateOperation(input.Operation); err != nil {
+		return false, err
+	}
+	if err = validateUnit(input.Unit); err != nil {
+		return false, err
+	}
+	timeout := input.Timeout
+	if timeout <= 0 {
+		timeout = defaultTimeout
+	}
+
+	client, err := ssh.GetHostClient(input.Connection, input.Host, input.Port)
+	if err != nil {
+		return false, err
+	}
+
+	// the timeout covers the operation and the wait until the unit is active
+	ctx := ssh.WithActivity(gocontext.Background(), context.ActivityHost().Name(), context.Name())
+	ctx, cancel := gocontext.WithTimeout(ctx, time.Duration(timeout)*time.Second)
+	defer cancel()
+
+	activity.logger.Debugf("Running %s of %s on %s", input.Operation, input.Unit, client.Host())
+	output, err := manage(ctx, client, &options{
+		operation:       input.Operation,
+		unit:            input.Unit,
+		sudo:            input.Sudo,
+		waitUntilActive: input.WaitUntilActive,
+	})
+	if err != nil {
+		return false, err
+	}
+	activity.logger.Debugf("Unit %s is %s (%s)", output.Unit, output.ActiveState, output.SubState)
+
+	//Set output object
+	err = context.SetOutputObject(output)
+	if err != nil {
+		return false, err
+	}
+
+	return true, nil
+}
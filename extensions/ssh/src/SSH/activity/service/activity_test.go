@@ -0,0 +1,128 @@
+package service
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	ssh "github.com/mmussett/extensions/SSH/connector/connection"
+	"github.com/mmussett/extensions/SSH/internal/sshtest"
+	"github.com/project-flogo/core/activity"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRegister(t *testing.T) {
+	ref := activity.GetRef(&MyActivity{})
+	act := activity.Get(ref)
+
+	assert.NotNil(t, act)
+}
+
+// fakeSystemctl records the commands and answers systemctl show with the next state
+type fakeSystemctl struct {
+	commands []string
+	states   []string
+	result   *ssh.RunResult
+}
+
+func (f *fakeSystemctl) Run(ctx context.Context, cmd string, opts *ssh.RunOptions) (*ssh.RunResult, error) {
+	f.commands = append(f.commands, cmd)
+	if !strings.Contains(cmd, "systemctl show") {
+		if f.result != nil {
+			return f.result, nil
+		}
+		return &ssh.RunResult{}, nil
+	}
+	state := f.states[0]
+	if len(f.states) > 1 {
+		f.states = f.states[1:]
+	}
+	return &ssh.RunResult{Stdout: []byte(state)}, nil
+}
+
+const (
+	activating = "Id=nginx.service\nDescription=A high performance web server\nLoadState=loaded\nActiveState=activating\nSubState=start\nUnitFileState=enabled\nMainPID=0\nActiveEnterTimestamp=n/a\nResult=success\n"
+	active     = "Id=nginx.service\nDescription=A high performance web server\nLoadState=loaded\nActiveState=active\nSubState=running\nUnitFileState=enabled\nMainPID=4121\nActiveEnterTimestamp=Mon 2024-04-15 09:52:04 UTC\nResult=success\n"
+	failed     = "Id=nginx.service\nLoadState=loaded\nActiveState=failed\nSubState=failed\nMainPID=0\nResult=exit-code\n"
+	notFound   = "Id=nginx.srvice\nLoadState=not-found\nActiveState=inactive\nSubState=dead\nMainPID=0\n"
+)
+
+func TestManageRestart(t *testing.T) {
+	pollInterval = time.Millisecond
+	client := &fakeSystemctl{states: []string{activating, activating, active}}
+	output, err := manage(context.Background(), sshtest.RunFunc(client.Run), &options{operation: "restart", unit: "nginx.service", sudo: true, waitUntilActive: true})
+	assert.Nil(t, err)
+
+	assert.Equal(t, &Output{
+		Unit:          "nginx.service",
+		Description:   "A high performance web server",
+		LoadState:     "loaded",
+		ActiveState:   "active",
+		SubState:      "running",
+		UnitFileState: "enabled",
+		MainPID:       4121,
+		Since:         "2024-04-15T09:52:04Z",
+		Result:        "success",
+	}, output)
+	assert.Len(t, client.commands, 4)
+	assert.Equal(t, "sudo -n systemctl restart nginx.service", client.commands[0])
+	assert.Equal(t, "env TZ=UTC systemctl show --no-pager --property=Id,Description,LoadState,ActiveState,SubState,UnitFileState,MainPID,ActiveEnterTimestamp,Result nginx.service", client.commands[1])
+}
+
+func TestManageStatus(t *testing.T) {
+	// without waiting, the status is returned whatever the state
+	client := &fakeSystemctl{states: []string{activating}}
+	output, err := manage(context.Background(), sshtest.RunFunc(client.Run), &options{operation: "status", unit: "nginx.service"})
+	assert.Nil(t, err)
+	assert.Equal(t, "activating", output.ActiveState)
+	assert.Equal(t, "", output.Since)
+	assert.Len(t, client.commands, 1)
+
+	client = &fakeSystemctl{states: []string{active}}
+	_, err = manage(context.Background(), sshtest.RunFunc(client.Run), &options{operation: "enable", unit: "nginx.service"})
+	assert.Nil(t, err)
+	assert.Equal(t, "systemctl enable nginx.service", client.commands[0])
+
+	client = &fakeSystemctl{states: []string{notFound}}
+	_, err = manage(context.Background(), sshtest.RunFunc(client.Run), &options{operation: "status", unit: "nginx.srvice"})
+	assert.EqualError(t, err, "unit nginx.srvice not found")
+}
+
+func TestManageErrors(t *testing.T) {
+	pollInterval = time.Millisecond
+
+	client := &fakeSystemctl{result: &ssh.RunResult{ExitCode: 1, Stderr: []byte("sudo: a password is required\n")}}
+	_, err := manage(context.Background(), sshtest.RunFunc(client.Run), &options{operation: "start", unit: "nginx.service", sudo: true})
+	assert.EqualError(t, err, "start of nginx.service failed: command exited with status 1: sudo: a password is required")
+
+	client = &fakeSystemctl{states: []string{activating, failed}}
+	_, err = manage(context.Background(), sshtest.RunFunc(client.Run), &options{operation: "start", unit: "nginx.service", waitUntilActive: true})
+	assert.EqualError(t, err, "unit nginx.service failed: exit-code")
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	client = &fakeSystemctl{states: []string{activating}}
+	_, err = manage(ctx, sshtest.RunFunc(client.Run), &options{operation: "reload", unit: "nginx.service", waitUntilActive: true})
+	assert.EqualError(t, err, "unit nginx.service not active before the timeout, it is activating (start)")
+
+	// unsupported operations never reach the host
+	client = &fakeSystemctl{}
+	_, err = manage(context.Background(), sshtest.RunFunc(client.Run), &options{operation: "isolate rescue.target; reboot", unit: "nginx.service"})
+	assert.EqualError(t, err, "unsupported operation 'isolate rescue.target; reboot', expected one of status, start, stop, restart, enable, disable, reload")
+	assert.Empty(t, client.commands)
+
+	_, err = parseShow("Failed to connect to bus: No such file or directory")
+	assert.NotNil(t, err)
+	_, err = parseShow("ActiveState=active\nActiveEnterTimestamp=2024-04-15\n")
+	assert.NotNil(t, err)
+}
+
+func TestValidateUnit(t *testing.T) {
+	for _, unit := range []string{"nginx", "nginx.service", "getty@tty1.service", "user-1000.slice"} {
+		assert.Nil(t, validateUnit(unit), unit)
+	}
+	for _, unit := range []string{"", "nginx; reboot", "nginx service", "$(id)", "--now", "a'b", `dev-disk-by\x2duuid-1234.device`} {
+		assert.NotNil(t, validateUnit(unit), unit)
+	}
+}
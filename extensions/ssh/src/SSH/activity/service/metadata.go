@@ -0,0 +1,157 @@
+package service
+
+import (
+	ssh "github.com/mmussett/extensions/SSH/connector/connection"
+	"github.com/project-flogo/core/data/coerce"
+	"github.com/project-flogo/core/support/connection"
+)
+
+// Input corresponds to activity.json inputs
+type Input struct {
+	Connection      connection.Manager `md:"SSH Connection,required"`
+	Host            string             `md:"host"`
+	Port            int                `md:"port"`
+	Operation       string             `md:"operation,required,allowed(status,start,stop,restart,enable,disable,reload)"`
+	Sudo            bool               `md:"sudo"`
+	WaitUntilActive bool               `md:"waitUntilActive"`
+	Timeout         int                `md:"timeout"`
+	Unit            string             `md:"unit,required"`
+}
+
+// Output corresponds to activity.json outputs
+type Output struct {
+	Unit          string `md:"unit"`
+	Description   string `md:"description"`
+	LoadState     string `md:"loadState"`
+	ActiveState   string `md:"activeState"`
+	SubState      string `md:"subState"`
+	UnitFileState string `md:"unitFileState"`
+	MainPID       int    `md:"mainPID"`
+	Since         string `md:"since"`
+	Result        string `md:"result"`
+}
+
+// ToMap converts Input struct to map
+func (i *Input) ToMap() map[string]interface{} {
+	return map[string]interface{}{
+		"SSH Connection":  i.Connection,
+		"host":            i.Host,
+		"port":            i.Port,
+		"operation":       i.Operation,
+		"sudo":            i.Sudo,
+		"waitUntilActive": i.WaitUntilActive,
+		"timeout":         i.Timeout,
+		"unit":            i.Unit,
+	}
+}
+
+// FromMap converts a map to Input struct
+func (i *Input) FromMap(values map[string]interface{}) error {
+	var err error
+	i.Connection, err = ssh.GetSharedConfiguration(values["SSH Connection"])
+	if err != nil {
+		return err
+	}
+
+	i.Host, err = coerce.ToString(values["host"])
+	if err != nil {
+		return err
+	}
+
+	i.Port, err = coerce.ToInt(values["port"])
+	if err != nil {
+		return err
+	}
+
+	i.Operation, err = coerce.ToString(values["operation"])
+	if err != nil {
+		return err
+	}
+
+	i.Sudo, err = coerce.ToBool(values["sudo"])
+	if err != nil {
+		return err
+	}
+
+	i.WaitUntilActive, err = coerce.ToBool(values["waitUntilActive"])
+	if err != nil {
+		return err
+	}
+
+	i.Timeout, err = coerce.ToInt(values["timeout"])
+	if err != nil {
+		return err
+	}
+
+	i.Unit, err = coerce.ToString(values["unit"])
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// ToMap converts Output struct to map
+func (o *Output) ToMap() map[string]interface{} {
+	return map[string]interface{}{
+		"unit":          o.Unit,
+		"description":   o.Description,
+		"loadState":     o.LoadState,
+		"activeState":   o.ActiveState,
+		"subState":      o.SubState,
+		"unitFileState": o.UnitFileState,
+		"mainPID":       o.MainPID,
+		"since":         o.Since,
+		"result":        o.Result,
+	}
+}
+
+// FromMap converts a map to Output struct
+func (o *Output) FromMap(values map[string]interface{}) error {
+	var err error
+	o.Unit, err = coerce.ToString(values["unit"])
+	if err != nil {
+		return err
+	}
+
+	o.Description, err = coerce.ToString(values["description"])
+	if err != nil {
+		return err
+	}
+
+	o.LoadState, err = coerce.ToString(values["loadState"])
+	if err != nil {
+		return err
+	}
+
+	o.ActiveState, err = coerce.ToString(values["activeState"])
+	if err != nil {
+		return err
+	}
+
+	o.SubState, err = coerce.ToString(values["subState"])
+	if err != nil {
+		return err
+	}
+
+	o.UnitFileState, err = coerce.ToString(values["unitFileState"])
+	if err != nil {
+		return err
+	}
+
+	o.MainPID, err = coerce.ToInt(values["mainPID"])
+	if err != nil {
+		return err
+	}
+
+	o.Since, err = coerce.ToString(values["since"])
+	if err != nil {
+		return err
+	}
+
+	o.Result, err = coerce.ToString(values["result"])
+	if err != nil {
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,161 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	ssh "github.com/mmussett/extensions/SSH/connector/connection"
+)
+
+const defaultTimeout = 60
+
+// pollInterval is the delay between two status checks while waiting for a unit to be active
+var pollInterval = time.Second
+
+// unitRegexp matches unit names without shell metacharacters, so names never need quoting.
+// Escaped names, such as dev-disk-by\x2duuid-1234.device, are rejected because the remote
+// shell would remove the backslash.
+var unitRegexp = regexp.MustCompile(`^[A-Za-z0-9:_.@-]+$`)
+
+// operations are the supported operations. The operation is put into the systemctl command, so
+// it must be one of them even though the metadata does not enforce its allowed values.
+var operations = []string{"status", "start", "stop", "restart", "enable", "disable", "reload"}
+
+// showProperties are the unit properties read by systemctl show
+var showProperties = []string{"Id", "Description", "LoadState", "ActiveState", "SubState", "UnitFileState", "MainPID", "ActiveEnterTimestamp", "Result"}
+
+// sinceLayout is the timestamp format of systemctl show with TZ=UTC
+const sinceLayout = "Mon 2006-01-02 15:04:05 MST"
+
+// options of a service operation
+type options struct {
+	operation       string
+	unit            string
+	sudo            bool
+	waitUntilActive bool
+}
+
+func validateUnit(unit string) error {
+	if !unitRegexp.MatchString(unit) || strings.HasPrefix(unit, "-") {
+		return fmt.Errorf("invalid unit name '%s'", unit)
+	}
+	return nil
+}
+
+func validateOperation(operation string) error {
+	for _, op := range operations {
+		if operation == op {
+			return nil
+		}
+	}
+	return fmt.Errorf("unsupported operation '%s', expected one of %s", operation, strings.Join(operations, ", "))
+}
+
+// operationCommand returns the systemctl command of an operation other than status.
+// sudo -n fails instead of prompting when the user needs a password.
+func operationCommand(opts *options) string {
+	cmd := "systemctl " + opts.operation + " " + opts.unit
+	if opts.sudo {
+		cmd = "sudo -n " + cmd
+	}
+	return cmd
+}
+
+// showCommand returns the command reading the status of the unit. Timestamps are printed in
+// UTC, so they can be parsed whatever the timezone of the host.
+func showCommand(unit string) string {
+	return "env TZ=UTC systemctl show --no-pager --property=" + strings.Join(showProperties, ",") + " " + unit
+}
+
+// manage runs the operation and returns the status of the unit. When waitUntilActive is set,
+// the status is checked until the unit is active, it failed, or the context is done.
+func manage(ctx context.Context, client ssh.Client, opts *options) (*Output, error) {
+	if err := validateOperation(opts.operation); err != nil {
+		return nil, err
+	}
+	if opts.operation != "status" {
+		if _, err := run(ctx, client, operationCommand(opts)); err != nil {
+			return nil, fmt.Errorf("%s of %s failed: %s", opts.operation, opts.unit, err.Error())
+		}
+	}
+
+	for {
+		output, err := status(ctx, client, opts.unit)
+		if err != nil {
+			return nil, err
+		}
+		if output.LoadState == "not-found" {
+			return nil, fmt.Errorf("unit %s not found", opts.unit)
+		}
+		if !opts.waitUntilActive || output.ActiveState == "active" {
+			return output, nil
+		}
+		if output.ActiveState == "failed" {
+			return nil, fmt.Errorf("unit %s failed: %s", opts.unit, output.Result)
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil, fmt.Errorf("unit %s not active before the timeout, it is %s (%s)", opts.unit, output.ActiveState, output.SubState)
+		case <-time.After(pollInterval):
+		}
+	}
+}
+
+// status reads the status of the unit
+func status(ctx context.Context, client ssh.Client, unit string) (*Output, error) {
+	stdout, err := run(ctx, client, showCommand(unit))
+	if err != nil {
+		return nil, fmt.Errorf("cannot read the status of %s: %s", unit, err.Error())
+	}
+	return parseShow(stdout)
+}
+
+// run runs a command and returns its standard output, or an error with its standard error
+// when it exits with a non-zero status
+func run(ctx context.Context, client ssh.Client, cmd string) (string, error) {
+	result, err := client.Run(ctx, cmd, nil)
+	if err != nil {
+		return "", err
+	}
+	if result.ExitCode != 0 {
+		return "", fmt.Errorf("command exited with status %d: %s", result.ExitCode, strings.TrimSpace(string(result.Stderr)))
+	}
+	return string(result.Stdout), nil
+}
+
+// parseShow parses the Key=Value lines printed by systemctl show
+func parseShow(stdout string) (*Output, error) {
+	values := make(map[string]string)
+	for _, line := range strings.Split(stdout, "\n") {
+		if key, value, ok := strings.Cut(strings.TrimRight(line, "\r"), "="); ok {
+			values[key] = value
+		}
+	}
+	if values["ActiveState"] == "" {
+		return nil, fmt.Errorf("unexpected output of systemctl show: %s", strings.TrimSpace(stdout))
+	}
+
+	output := &Output{
+		Unit:          values["Id"],
+		Description:   values["Description"],
+		LoadState:     values["LoadState"],
+		ActiveState:   values["ActiveState"],
+		SubState:      values["SubState"],
+		UnitFileState: values["UnitFileState"],
+		Result:        values["Result"],
+	}
+	output.MainPID, _ = strconv.Atoi(values["MainPID"])
+	if since := values["ActiveEnterTimestamp"]; since != "" && since != "n/a" {
+		t, err := time.Parse(sinceLayout, since)
+		if err != nil {
+			return nil, fmt.Errorf("invalid ActiveEnterTimestamp '%s'", since)
+		}
+		output.Since = t.UTC().Format(time.RFC3339)
+	}
+	return output, nil
+}
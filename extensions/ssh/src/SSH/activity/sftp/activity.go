@@ -0,0 +1,409 @@
+package sftp
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"time"
+
+	ssh "github.com/mmussett/extensions/SSH/connector/connection"
+	"github.com/pkg/sftp"
+	"github.com/project-flogo/core/activity"
+	"github.com/project-flogo/core/support/log"
+)
+
+var activityMd = activity.ToMetadata(&Input{}, &Output{})
+
+func init() {
+	_ = activity.Register(&MyActivity{}, New)
+}
+
+// New creates a new activity
+func New(ctx activity.InitContext) (activity.Activity, error) {
+	return &MyActivity{logger: log.ChildLogger(ctx.Logger(), "SSH-activity-sftp"), activityName: "sftp"}, nil
+}
+
+// MyActivity performs file operations over the sftp subsystem of an SSH connection
+type MyActivity struct {
+	logger       log.Logger
+	activityName string
+}
+
+// Metadata implements activity.Activity.Metadata
+func (*MyActivity) Metadata() *activity.Metadata {
+	return activityMd
+}
+
+// Eval implements activity.Activity.Eval
+func (activity *MyActivity) Eval(context activity.Context) (done bool, err error) {
+
+	input := &Input{}
+
+	//Get Input Object
+	err = context.GetInputObject(input)
+	if err != nil {
+		return false, err
+	}
+
+	sshClient, err := ssh.GetHostClient(input.Connection, input.Host, input.Port)
+	if err != nil {
+		return false, err
+	}
+
+	client, err := sshClient.SFTP()
+	if err != nil {
+		return false, err
+	}
+	defer client.Close()
+
+	activity.logger.Debugf("Executing SFTP operation '%s' on '%s'", input.Operation, input.RemotePath)
+	output, err := execute(client, input)
+	if err != nil {
+		return false, err
+	}
+
+	//Set output object
+	err = context.SetOutputObject(output)
+	if err != nil {
+		return false, err
+	}
+
+	return true, nil
+}
+
+// execute runs the requested operation using the given sftp client
+func execute(client *sftp.Client, input *Input) (*Output, error) {
+	if input.RemotePath == "" {
+		return nil, fmt.Errorf("required input 'remotePath' not specified")
+	}
+
+	switch input.Operation {
+	case "put":
+		return put(client, input)
+	case "get":
+		return get(client, input)
+	case "list":
+		return list(client, input)
+	case "stat":
+		info, err := client.Stat(input.RemotePath)
+		if err != nil {
+			return nil, fmt.Errorf("failed to stat '%s': %s", input.RemotePath, err.Error())
+		}
+		return &Output{FileInfo: toFileInfo(input.RemotePath, info)}, nil
+	case "remove":
+		err := client.Remove(input.RemotePath)
+		if err != nil {
+			return nil, fmt.Errorf("failed to remove '%s': %s", input.RemotePath, err.Error())
+		}
+		return &Output{}, nil
+	case "rename":
+		if input.NewPath == "" {
+			return nil, fmt.Errorf("required input 'newPath' not specified for rename")
+		}
+		err := rename(client, input.RemotePath, input.NewPath)
+		if err != nil {
+			return nil, err
+		}
+		return statOutput(client, input.NewPath)
+	case "mkdir":
+		err := client.MkdirAll(input.RemotePath)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create directory '%s': %s", input.RemotePath, err.Error())
+		}
+		err = chmod(client, input.RemotePath, input.Mode)
+		if err != nil {
+			return nil, err
+		}
+		return statOutput(client, input.RemotePath)
+	case "chmod":
+		if input.Mode == "" {
+			return nil, fmt.Errorf("required input 'mode' not specified for chmod")
+		}
+		err := chmod(client, input.RemotePath, input.Mode)
+		if err != nil {
+			return nil, err
+		}
+		return statOutput(client, input.RemotePath)
+	default:
+		return nil, fmt.Errorf("unsupported operation '%s'", input.Operation)
+	}
+}
+
+func put(client *sftp.Client, input *Input) (*Output, error) {
+	src, err := openSource(input)
+	if err != nil {
+		return nil, err
+	}
+	defer src.Close()
+
+	target := input.RemotePath
+	if input.Atomic {
+		target, err = tempName(input.RemotePath)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	f, err := client.Create(target)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create remote file '%s': %s", target, err.Error())
+	}
+
+	hash := sha256.New()
+	n, err := io.Copy(io.MultiWriter(f, hash), src)
+	closeErr := f.Close()
+	if err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		client.Remove(target)
+		return nil, fmt.Errorf("failed to write remote file '%s': %s", target, err.Error())
+	}
+	checksum := hex.EncodeToString(hash.Sum(nil))
+
+	if input.VerifyChecksum {
+		remoteSum, err := remoteChecksum(client, target)
+		if err != nil {
+			return nil, err
+		}
+		if remoteSum != checksum {
+			if input.Atomic {
+				client.Remove(target)
+			}
+			return nil, fmt.Errorf("checksum mismatch after upload of '%s': expected %s, got %s", input.RemotePath, checksum, remoteSum)
+		}
+	}
+
+	err = chmod(client, target, input.Mode)
+	if err != nil {
+		return nil, err
+	}
+
+	if input.Atomic {
+		err = rename(client, target, input.RemotePath)
+		if err != nil {
+			client.Remove(target)
+			return nil, err
+		}
+	}
+
+	output, err := statOutput(client, input.RemotePath)
+	if err != nil {
+		return nil, err
+	}
+	output.Checksum = checksum
+	output.BytesTransferred = n
+	return output, nil
+}
+
+func get(client *sftp.Client, input *Input) (*Output, error) {
+	f, err := client.Open(input.RemotePath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open remote file '%s': %s", input.RemotePath, err.Error())
+	}
+	defer f.Close()
+
+	output := &Output{}
+	hash := sha256.New()
+	if input.LocalPath != "" {
+		target := input.LocalPath
+		if input.Atomic {
+			target, err = localTempName(input.LocalPath)
+			if err != nil {
+				return nil, err
+			}
+		}
+
+		local, err := os.Create(target)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create local file '%s': %s", target, err.Error())
+		}
+		output.BytesTransferred, err = io.Copy(io.MultiWriter(local, hash), f)
+		closeErr := local.Close()
+		if err == nil {
+			err = closeErr
+		}
+		if err != nil {
+			os.Remove(target)
+			return nil, fmt.Errorf("failed to write local file '%s': %s", target, err.Error())
+		}
+		output.Checksum = hex.EncodeToString(hash.Sum(nil))
+
+		if input.VerifyChecksum {
+			remoteSum, err := remoteChecksum(client, input.RemotePath)
+			if err != nil {
+				return nil, err
+			}
+			if remoteSum != output.Checksum {
+				os.Remove(target)
+				return nil, fmt.Errorf("checksum mismatch after download of '%s': expected %s, got %s", input.RemotePath, remoteSum, output.Checksum)
+			}
+		}
+
+		if input.Atomic {
+			err = os.Rename(target, input.LocalPath)
+			if err != nil {
+				os.Remove(target)
+				return nil, fmt.Errorf("failed to rename '%s' to '%s': %s", target, input.LocalPath, err.Error())
+			}
+		}
+	} else {
+		var buf bytes.Buffer
+		output.BytesTransferred, err = io.Copy(io.MultiWriter(&buf, hash), f)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read remote file '%s': %s", input.RemotePath, err.Error())
+		}
+		output.Checksum = hex.EncodeToString(hash.Sum(nil))
+		if input.Encoding == "base64" {
+			output.Content = base64.StdEncoding.EncodeToString(buf.Bytes())
+		} else {
+			output.Content = buf.String()
+		}
+	}
+
+	info, err := f.Stat()
+	if err != nil {
+		return nil, fmt.Errorf("failed to stat '%s': %s", input.RemotePath, err.Error())
+	}
+	output.FileInfo = toFileInfo(input.RemotePath, info)
+	return output, nil
+}
+
+func list(client *sftp.Client, input *Input) (*Output, error) {
+	if input.Pattern != "" {
+		// validate the glob up front so a bad pattern is not reported as "no match"
+		if _, err := path.Match(input.Pattern, ""); err != nil {
+			return nil, fmt.Errorf("invalid pattern '%s': %s", input.Pattern, err.Error())
+		}
+	}
+
+	entries, err := client.ReadDir(input.RemotePath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list '%s': %s", input.RemotePath, err.Error())
+	}
+
+	output := &Output{Files: make([]map[string]interface{}, 0, len(entries))}
+	for _, entry := range entries {
+		if input.Pattern != "" {
+			if ok, _ := path.Match(input.Pattern, entry.Name()); !ok {
+				continue
+			}
+		}
+		output.Files = append(output.Files, toFileInfo(path.Join(input.RemotePath, entry.Name()), entry))
+	}
+	return output, nil
+}
+
+// openSource returns the content to upload from the local file, or from the content input
+// decoded according to the configured encoding.
+func openSource(input *Input) (io.ReadCloser, error) {
+	if input.LocalPath != "" {
+		f, err := os.Open(input.LocalPath)
+		if err != nil {
+			return nil, fmt.Errorf("failed to open local file '%s': %s", input.LocalPath, err.Error())
+		}
+		return f, nil
+	}
+
+	if input.Encoding == "base64" {
+		data, err := base64.StdEncoding.DecodeString(input.Content)
+		if err != nil {
+			return nil, fmt.Errorf("invalid base64 encoded value of input 'content'")
+		}
+		return io.NopCloser(bytes.NewReader(data)), nil
+	}
+	return io.NopCloser(bytes.NewReader([]byte(input.Content))), nil
+}
+
+// rename moves oldPath to newPath, replacing an existing target when the server supports it
+func rename(client *sftp.Client, oldPath, newPath string) error {
+	var err error
+	if _, ok := client.HasExtension("posix-rename@openssh.com"); ok {
+		err = client.PosixRename(oldPath, newPath)
+	} else {
+		if _, statErr := client.Stat(newPath); statErr == nil {
+			client.Remove(newPath)
+		}
+		err = client.Rename(oldPath, newPath)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to rename '%s' to '%s': %s", oldPath, newPath, err.Error())
+	}
+	return nil
+}
+
+func chmod(client *sftp.Client, remotePath string, mode string) error {
+	if mode == "" {
+		return nil
+	}
+	perm, err := strconv.ParseUint(mode, 8, 32)
+	if err != nil {
+		return fmt.Errorf("invalid mode '%s', expected an octal value such as 0644", mode)
+	}
+	err = client.Chmod(remotePath, os.FileMode(perm))
+	if err != nil {
+		return fmt.Errorf("failed to chmod '%s': %s", remotePath, err.Error())
+	}
+	return nil
+}
+
+func remoteChecksum(client *sftp.Client, remotePath string) (string, error) {
+	f, err := client.Open(remotePath)
+	if err != nil {
+		return "", fmt.Errorf("failed to open '%s' for checksum verification: %s", remotePath, err.Error())
+	}
+	defer f.Close()
+
+	hash := sha256.New()
+	if _, err = io.Copy(hash, f); err != nil {
+		return "", fmt.Errorf("failed to read '%s' for checksum verification: %s", remotePath, err.Error())
+	}
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+// tempName returns a hidden sibling of the remote path p used for atomic transfers
+func tempName(p string) (string, error) {
+	suffix := make([]byte, 6)
+	if _, err := rand.Read(suffix); err != nil {
+		return "", err
+	}
+	dir, name := path.Split(p)
+	return dir + "." + name + "." + hex.EncodeToString(suffix) + ".tmp", nil
+}
+
+// localTempName returns a hidden sibling of the local path p used for atomic transfers
+func localTempName(p string) (string, error) {
+	suffix := make([]byte, 6)
+	if _, err := rand.Read(suffix); err != nil {
+		return "", err
+	}
+	return filepath.Join(filepath.Dir(p), "."+filepath.Base(p)+"."+hex.EncodeToString(suffix)+".tmp"), nil
+}
+
+func statOutput(client *sftp.Client, remotePath string) (*Output, error) {
+	info, err := client.Stat(remotePath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to stat '%s': %s", remotePath, err.Error())
+	}
+	return &Output{FileInfo: toFileInfo(remotePath, info)}, nil
+}
+
+func toFileInfo(remotePath string, info os.FileInfo) map[string]interface{} {
+	return map[string]interface{}{
+		"name":        info.Name(),
+		"path":        remotePath,
+		"size":        info.Size(),
+		"mode":        info.Mode().String(),
+		"permissions": fmt.Sprintf("%04o", info.Mode().Perm()),
+		"modTime":     info.ModTime().UTC().Format(time.RFC3339),
+		"isDir":       info.IsDir(),
+	}
+}
@@ -0,0 +1,75 @@
+package sftp
+
+import (
+	"encoding/base64"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/mmussett/extensions/SSH/internal/sshtest"
+	"github.com/project-flogo/core/activity"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRegister(t *testing.T) {
+	ref := activity.GetRef(&MyActivity{})
+	act := activity.Get(ref)
+
+	assert.NotNil(t, act)
+}
+
+func TestPutGetList(t *testing.T) {
+	client := sshtest.NewSFTPClient(t)
+	dir := t.TempDir()
+	remote := filepath.ToSlash(filepath.Join(dir, "upload", "hello.txt"))
+
+	_, err := execute(client, &Input{Operation: "mkdir", RemotePath: filepath.ToSlash(filepath.Join(dir, "upload")), Mode: "0750"})
+	assert.Nil(t, err)
+
+	out, err := execute(client, &Input{Operation: "put", RemotePath: remote, Content: "hello world", Atomic: true, VerifyChecksum: true, Mode: "0600"})
+	assert.Nil(t, err)
+	assert.Equal(t, int64(11), out.BytesTransferred)
+	assert.Equal(t, "b94d27b9934d3e08a52e52d7da7dabfac484efe37a5380ee9088f7ace2efcde9", out.Checksum)
+	assert.Equal(t, "0600", out.FileInfo["permissions"])
+
+	out, err = execute(client, &Input{Operation: "get", RemotePath: remote, Encoding: "base64"})
+	assert.Nil(t, err)
+	assert.Equal(t, base64.StdEncoding.EncodeToString([]byte("hello world")), out.Content)
+
+	local := filepath.Join(dir, "local.txt")
+	_, err = execute(client, &Input{Operation: "get", RemotePath: remote, LocalPath: local, Atomic: true, VerifyChecksum: true})
+	assert.Nil(t, err)
+	data, err := os.ReadFile(local)
+	assert.Nil(t, err)
+	assert.Equal(t, "hello world", string(data))
+
+	_, err = execute(client, &Input{Operation: "put", RemotePath: remote + ".bak", LocalPath: local})
+	assert.Nil(t, err)
+
+	out, err = execute(client, &Input{Operation: "list", RemotePath: filepath.ToSlash(filepath.Join(dir, "upload")), Pattern: "*.txt"})
+	assert.Nil(t, err)
+	assert.Len(t, out.Files, 1)
+	assert.Equal(t, "hello.txt", out.Files[0]["name"])
+
+	_, err = execute(client, &Input{Operation: "rename", RemotePath: remote + ".bak", NewPath: remote})
+	assert.Nil(t, err)
+
+	_, err = execute(client, &Input{Operation: "remove", RemotePath: remote})
+	assert.Nil(t, err)
+
+	_, err = execute(client, &Input{Operation: "stat", RemotePath: remote})
+	assert.NotNil(t, err)
+}
+
+func TestInvalidInputs(t *testing.T) {
+	client := sshtest.NewSFTPClient(t)
+
+	_, err := execute(client, &Input{Operation: "chmod", RemotePath: "/tmp", Mode: "rw"})
+	assert.NotNil(t, err)
+
+	_, err = execute(client, &Input{Operation: "list", RemotePath: "/tmp", Pattern: "["})
+	assert.NotNil(t, err)
+
+	_, err = execute(client, &Input{Operation: "put", RemotePath: "/tmp/x", Content: "%%%", Encoding: "base64"})
+	assert.NotNil(t, err)
+}
@@ -0,0 +1,176 @@
+package sftp
+
+import (
+	ssh "github.com/mmussett/extensions/SSH/connector/connection"
+	"github.com/project-flogo/core/data/coerce"
+	"github.com/project-flogo/core/support/connection"
+)
+
+// Input corresponds to activity.json inputs
+type Input struct {
+	Connection     connection.Manager `md:"SSH Connection,required"`
+	Host           string             `md:"host"`
+	Port           int                `md:"port"`
+	Operation      string             `md:"operation,required,allowed(put,get,list,stat,remove,rename,mkdir,chmod)"`
+	RemotePath     string             `md:"remotePath,required"`
+	NewPath        string             `md:"newPath"`
+	Content        string             `md:"content"`
+	Encoding       string             `md:"encoding,allowed(text,base64)"`
+	LocalPath      string             `md:"localPath"`
+	Pattern        string             `md:"pattern"`
+	Mode           string             `md:"mode"`
+	Atomic         bool               `md:"atomic"`
+	VerifyChecksum bool               `md:"verifyChecksum"`
+}
+
+// Output corresponds to activity.json outputs
+type Output struct {
+	Content          string                   `md:"content"`
+	Files            []map[string]interface{} `md:"files"`
+	FileInfo         map[string]interface{}   `md:"fileInfo"`
+	Checksum         string                   `md:"checksum"`
+	BytesTransferred int64                    `md:"bytesTransferred"`
+}
+
+// ToMap converts Input struct to map
+func (i *Input) ToMap() map[string]interface{} {
+	return map[string]interface{}{
+		"SSH Connection": i.Connection,
+		"host":           i.Host,
+		"port":           i.Port,
+		"operation":      i.Operation,
+		"remotePath":     i.RemotePath,
+		"newPath":        i.NewPath,
+		"content":        i.Content,
+		"encoding":       i.Encoding,
+		"localPath":      i.LocalPath,
+		"pattern":        i.Pattern,
+		"mode":           i.Mode,
+		"atomic":         i.Atomic,
+		"verifyChecksum": i.VerifyChecksum,
+	}
+}
+
+// FromMap converts a map to Input struct
+func (i *Input) FromMap(values map[string]interface{}) error {
+	var err error
+	i.Connection, err = ssh.GetSharedConfiguration(values["SSH Connection"])
+	if err != nil {
+		return err
+	}
+
+	i.Host, err = coerce.ToString(values["host"])
+	if err != nil {
+		return err
+	}
+
+	i.Port, err = coerce.ToInt(values["port"])
+	if err != nil {
+		return err
+	}
+
+	i.Operation, err = coerce.ToString(values["operation"])
+	if err != nil {
+		return err
+	}
+
+	i.RemotePath, err = coerce.ToString(values["remotePath"])
+	if err != nil {
+		return err
+	}
+
+	i.NewPath, err = coerce.ToString(values["newPath"])
+	if err != nil {
+		return err
+	}
+
+	i.Content, err = coerce.ToString(values["content"])
+	if err != nil {
+		return err
+	}
+
+	i.Encoding, err = coerce.ToString(values["encoding"])
+	if err != nil {
+		return err
+	}
+
+	i.LocalPath, err = coerce.ToString(values["localPath"])
+	if err != nil {
+		return err
+	}
+
+	i.Pattern, err = coerce.ToString(values["pattern"])
+	if err != nil {
+		return err
+	}
+
+	i.Mode, err = coerce.ToString(values["mode"])
+	if err != nil {
+		return err
+	}
+
+	i.Atomic, err = coerce.ToBool(values["atomic"])
+	if err != nil {
+		return err
+	}
+
+	i.VerifyChecksum, err = coerce.ToBool(values["verifyChecksum"])
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// ToMap converts Output struct to map
+func (o *Output) ToMap() map[string]interface{} {
+	files := make([]interface{}, len(o.Files))
+	for idx, f := range o.Files {
+		files[idx] = f
+	}
+	return map[string]interface{}{
+		"content":          o.Content,
+		"files":            files,
+		"fileInfo":         o.FileInfo,
+		"checksum":         o.Checksum,
+		"bytesTransferred": o.BytesTransferred,
+	}
+}
+
+// FromMap converts a map to Output struct
+func (o *Output) FromMap(values map[string]interface{}) error {
+	var err error
+	o.Content, err = coerce.ToString(values["content"])
+	if err != nil {
+		return err
+	}
+
+	files, err := coerce.ToArray(values["files"])
+	if err != nil {
+		return err
+	}
+	o.Files = make([]map[string]interface{}, 0, len(files))
+	for _, f := range files {
+		obj, err := coerce.ToObject(f)
+		if err != nil {
+			return err
+		}
+		o.Files = append(o.Files, obj)
+	}
+
+	o.FileInfo, err = coerce.ToObject(values["fileInfo"])
+	if err != nil {
+		return err
+	}
+
+	o.Checksum, err = coerce.ToString(values["checksum"])
+	if err != nil {
+		return err
+	}
+
+	o.BytesTransferred, err = coerce.ToInt64(values["bytesTransferred"])
+	if err != nil {
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,87 @@
+package template
+
+import (
+	gocontext "context"
+
+	ssh "github.com/mmussett/extensions/SSH/connector/connection"
+	"github.com/project-flogo/core/activity"
+	"github.com/project-flogo/core/support/log"
+)
+
+var activityMd = activity.ToMetadata(&Input{}, &Output{})
+
+func init() {
+	_ = activity.Register(&MyActivity{}, New)
+}
+
+// New creates a new activity
+func New(ctx activity.InitContext) (activity.Activity, error) {
+	return &MyActivity{logger: log.ChildLogger(ctx.Logger(), "SSH-activity-template"), activityName: "template"}, nil
+}
+
+// MyActivity renders a template to a file on the host of the SSH connection
+type MyActivity struct {
+	logger       log.Logger
+	activityName string
+}
+
+// Metadata implements activity.Activity.Metadata
+func (*MyActivity) Metadata() *activity.Metadata {
+	return activityMd
+}
+
+// Eval implements activity.Activity.Eval
+func (activity *MyActivity) Eval(context activity.Context) (done bool, err error) {
+
+	input := &Input{}
+
+	//Get Input Object
+	err = context.GetInputObject(input)
+	if err != nil {
+		return false, err
+	}
+
+	mode, err := parseMode(input.Mode)
+	if err != nil {
+		return false, err
+	}
+	if err = validateOwner(input.Owner); err != nil {
+		return false, err
+	}
+	content, err := render(input.Template, input.Variables)
+	if err != nil {
+		return false, err
+	}
+
+	client, err := ssh.GetHostClient(input.Connection, input.Host, input.Port)
+	if err != nil {
+		return false, err
+	}
+	sftpClient, err := client.SFTP()
+	if err != nil {
+		return false, err
+	}
+	defer sftpClient.Close()
+
+	ctx := ssh.WithActivity(gocontext.Background(), context.ActivityHost().Name(), context.Name())
+	output, err := apply(ctx, sftpClient, client, &options{
+		path:            input.RemotePath,
+		content:         content,
+		owner:           input.Owner,
+		mode:            mode,
+		backup:          input.Backup,
+		validateCommand: input.ValidateCommand,
+	})
+	if err != nil {
+		return false, err
+	}
+	activity.logger.Debugf("Applied template to %s on %s, changed: %t", input.RemotePath, client.Host(), output.Changed)
+
+	//Set output object
+	err = context.SetOutputObject(output)
+	if err != nil {
+		return false, err
+	}
+
+	return true, nil
+}
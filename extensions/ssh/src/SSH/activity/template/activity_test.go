@@ -0,0 +1,212 @@
+package template
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	ssh "github.com/mmussett/extensions/SSH/connector/connection"
+	"github.com/mmussett/extensions/SSH/internal/sshtest"
+	"github.com/pkg/sftp"
+	"github.com/project-flogo/core/activity"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRegister(t *testing.T) {
+	ref := activity.GetRef(&MyActivity{})
+	act := activity.Get(ref)
+
+	assert.NotNil(t, act)
+}
+
+// fakeRunner records the commands and returns the same result for all of them
+type fakeRunner struct {
+	commands []string
+	result   ssh.RunResult
+}
+
+func (f *fakeRunner) Run(ctx context.Context, cmd string, opts *ssh.RunOptions) (*ssh.RunResult, error) {
+	f.commands = append(f.commands, cmd)
+	result := f.result
+	return &result, nil
+}
+
+const nginxTemplate = `server {
+    listen {{ port }};
+    server_name {{ name }};
+{% for location in locations %}
+    location {{ location }} { proxy_pass http://backend; }
+{% endfor %}
+}
+`
+
+func TestRender(t *testing.T) {
+	content, err := render(nginxTemplate, map[string]interface{}{"port": 8080, "name": "example.com", "locations": []interface{}{"/api", "/static"}})
+	assert.Nil(t, err)
+	assert.Equal(t, "server {\n    listen 8080;\n    server_name example.com;\n\n    location /api { proxy_pass http://backend; }\n\n    location /static { proxy_pass http://backend; }\n\n}\n", content)
+
+	_, err = render("{% for x in items %}", nil)
+	assert.NotNil(t, err)
+	assert.True(t, strings.HasPrefix(err.Error(), "invalid template: "), err.Error())
+}
+
+func TestParseMode(t *testing.T) {
+	mode, err := parseMode("0640")
+	assert.Nil(t, err)
+	assert.Equal(t, os.FileMode(0640), mode)
+	mode, err = parseMode("")
+	assert.Nil(t, err)
+	assert.Equal(t, os.FileMode(0), mode)
+	for _, value := range []string{"644x", "0888", "4755", "0", "rw-r--r--"} {
+		_, err = parseMode(value)
+		assert.NotNil(t, err, value)
+	}
+
+	for _, owner := range []string{"", "nginx", "nginx:www-data", "0:0", "svc_app"} {
+		assert.Nil(t, validateOwner(owner), owner)
+	}
+	for _, owner := range []string{"root;reboot", "a b", ":group", "user:", "$(id)", "-R"} {
+		assert.NotNil(t, validateOwner(owner), owner)
+	}
+}
+
+func TestApply(t *testing.T) {
+	now = func() time.Time { return time.Date(2024, 4, 15, 9, 52, 4, 0, time.UTC) }
+	defer func() { now = time.Now }()
+	client := sshtest.NewSFTPClient(t)
+	dir := t.TempDir()
+	file := filepath.ToSlash(filepath.Join(dir, "app.conf"))
+	run := &fakeRunner{}
+
+	// a new file is created with the default mode and no backup
+	output, err := apply(context.Background(), client, sshtest.RunFunc(run.Run), &options{path: file, content: "a\nb\n", backup: true})
+	assert.Nil(t, err)
+	assert.True(t, output.Changed)
+	assert.Equal(t, "", output.BackupPath)
+	assert.Equal(t, "--- /dev/null\n+++ "+file+"\n@@ -0,0 +1,2 @@\n+a\n+b\n", output.Diff)
+	info, err := os.Stat(file)
+	assert.Nil(t, err)
+	assert.Equal(t, os.FileMode(0644), info.Mode().Perm())
+
+	// the same content is not written again
+	output, err = apply(context.Background(), client, sshtest.RunFunc(run.Run), &options{path: file, content: "a\nb\n", backup: true})
+	assert.Nil(t, err)
+	assert.False(t, output.Changed)
+	assert.Equal(t, "", output.Diff)
+
+	// only the mode is fixed
+	output, err = apply(context.Background(), client, sshtest.RunFunc(run.Run), &options{path: file, content: "a\nb\n", mode: 0600})
+	assert.Nil(t, err)
+	assert.True(t, output.Changed)
+	assert.Equal(t, "", output.Diff)
+	info, _ = os.Stat(file)
+	assert.Equal(t, os.FileMode(0600), info.Mode().Perm())
+
+	// a change backs up the old file and keeps its mode
+	output, err = apply(context.Background(), client, sshtest.RunFunc(run.Run), &options{path: file, content: "a\nc\n", owner: "app:app", backup: true})
+	assert.Nil(t, err)
+	assert.True(t, output.Changed)
+	assert.Equal(t, file+".20240415T095204Z.bak", output.BackupPath)
+	assert.Equal(t, "--- "+file+"\n+++ "+file+"\n@@ -1,2 +1,2 @@\n a\n-b\n+c\n", output.Diff)
+	data, _ := os.ReadFile(file)
+	assert.Equal(t, "a\nc\n", string(data))
+	info, _ = os.Stat(file)
+	assert.Equal(t, os.FileMode(0600), info.Mode().Perm())
+	data, _ = os.ReadFile(output.BackupPath)
+	assert.Equal(t, "a\nb\n", string(data))
+	info, _ = os.Stat(output.BackupPath)
+	assert.Equal(t, os.FileMode(0600), info.Mode().Perm())
+
+	// the owner is set on the temporary file before it replaces the file
+	assert.Len(t, run.commands, 1)
+	assert.True(t, strings.HasPrefix(run.commands[0], "chown app:app '"+dir+"/.app.conf."), run.commands[0])
+
+	// no temporary file is left behind
+	entries, _ := os.ReadDir(dir)
+	assert.Len(t, entries, 2)
+}
+
+func TestApplyFixesOwner(t *testing.T) {
+	client := sshtest.NewSFTPClient(t)
+	file := filepath.ToSlash(filepath.Join(t.TempDir(), "app.conf"))
+	assert.Nil(t, os.WriteFile(file, []byte("a\n"), 0644))
+
+	// an unchanged file owned by the owner is left as it is
+	run := &fakeRunner{result: ssh.RunResult{Stdout: []byte("-rw-r--r-- 1 app www-data 2 Apr 15 09:52 " + file + "\n")}}
+	output, err := apply(context.Background(), client, sshtest.RunFunc(run.Run), &options{path: file, content: "a\n", owner: "app:www-data"})
+	assert.Nil(t, err)
+	assert.False(t, output.Changed)
+	assert.Equal(t, []string{"ls -ld -- '" + file + "'"}, run.commands)
+
+	// an unchanged file with another owner gets the owner
+	run.commands = nil
+	output, err = apply(context.Background(), client, sshtest.RunFunc(run.Run), &options{path: file, content: "a\n", owner: "nginx"})
+	assert.Nil(t, err)
+	assert.True(t, output.Changed)
+	assert.Equal(t, "", output.Diff)
+	assert.Equal(t, []string{"ls -ld -- '" + file + "'", "chown nginx '" + file + "'"}, run.commands)
+
+	// numeric ids are compared with the attributes of the file
+	run.commands = nil
+	owner := strconv.Itoa(os.Getuid()) + ":" + strconv.Itoa(os.Getgid())
+	output, err = apply(context.Background(), client, sshtest.RunFunc(run.Run), &options{path: file, content: "a\n", owner: owner})
+	assert.Nil(t, err)
+	assert.False(t, output.Changed)
+	assert.Empty(t, run.commands)
+}
+
+func TestApplyKeepsOwner(t *testing.T) {
+	if os.Geteuid() != 0 {
+		t.Skip("changing the owner of a file requires root")
+	}
+	client := sshtest.NewSFTPClient(t)
+	dir := t.TempDir()
+	file := filepath.ToSlash(filepath.Join(dir, "app.conf"))
+	assert.Nil(t, os.WriteFile(file, []byte("a\n"), 0640))
+	assert.Nil(t, os.Chown(file, 1234, 5678))
+
+	// without owner, the file and its backup keep the owner and group of the replaced file
+	output, err := apply(context.Background(), client, sshtest.RunFunc((&fakeRunner{}).Run), &options{path: file, content: "b\n", backup: true})
+	assert.Nil(t, err)
+	for _, name := range []string{file, output.BackupPath} {
+		info, err := client.Stat(name)
+		assert.Nil(t, err)
+		stat := info.Sys().(*sftp.FileStat)
+		assert.Equal(t, []uint32{1234, 5678}, []uint32{stat.UID, stat.GID}, name)
+	}
+}
+
+func TestApplyValidation(t *testing.T) {
+	client := sshtest.NewSFTPClient(t)
+	dir := t.TempDir()
+	file := filepath.ToSlash(filepath.Join(dir, "app.conf"))
+	assert.Nil(t, os.WriteFile(file, []byte("valid\n"), 0640))
+
+	run := &fakeRunner{result: ssh.RunResult{ExitCode: 1, Stderr: []byte("syntax error on line 1\n")}}
+	_, err := apply(context.Background(), client, sshtest.RunFunc(run.Run), &options{path: file, content: "invalid\n", validateCommand: "nginx -t"})
+	assert.EqualError(t, err, "validation of '"+file+"' failed, the change was rolled back: command exited with status 1: syntax error on line 1")
+	assert.Equal(t, []string{"nginx -t"}, run.commands)
+	data, _ := os.ReadFile(file)
+	assert.Equal(t, "valid\n", string(data))
+	info, _ := os.Stat(file)
+	assert.Equal(t, os.FileMode(0640), info.Mode().Perm())
+
+	// a new file is removed
+	created := filepath.ToSlash(filepath.Join(dir, "new.conf"))
+	_, err = apply(context.Background(), client, sshtest.RunFunc(run.Run), &options{path: created, content: "invalid\n", validateCommand: "nginx -t"})
+	assert.NotNil(t, err)
+	_, err = os.Stat(created)
+	assert.True(t, os.IsNotExist(err))
+
+	// a successful validation keeps the change
+	run.result = ssh.RunResult{}
+	output, err := apply(context.Background(), client, sshtest.RunFunc(run.Run), &options{path: file, content: "still valid\n", validateCommand: "nginx -t"})
+	assert.Nil(t, err)
+	assert.True(t, output.Changed)
+	data, _ = os.ReadFile(file)
+	assert.Equal(t, "still valid\n", string(data))
+}
@@ -0,0 +1,136 @@
+package template
+
+import (
+	ssh "github.com/mmussett/extensions/SSH/connector/connection"
+	"github.com/project-flogo/core/data/coerce"
+	"github.com/project-flogo/core/support/connection"
+)
+
+// Input corresponds to activity.json inputs
+type Input struct {
+	Connection      connection.Manager     `md:"SSH Connection,required"`
+	Host            string                 `md:"host"`
+	Port            int                    `md:"port"`
+	Backup          bool                   `md:"backup"`
+	Owner           string                 `md:"owner"`
+	Mode            string                 `md:"mode"`
+	ValidateCommand string                 `md:"validateCommand"`
+	Template        string                 `md:"template,required"`
+	Variables       map[string]interface{} `md:"variables"`
+	RemotePath      string                 `md:"remotePath,required"`
+}
+
+// Output corresponds to activity.json outputs
+type Output struct {
+	Changed    bool   `md:"changed"`
+	Diff       string `md:"diff"`
+	BackupPath string `md:"backupPath"`
+	Content    string `md:"content"`
+}
+
+// ToMap converts Input struct to map
+func (i *Input) ToMap() map[string]interface{} {
+	return map[string]interface{}{
+		"SSH Connection":  i.Connection,
+		"host":            i.Host,
+		"port":            i.Port,
+		"backup":          i.Backup,
+		"owner":           i.Owner,
+		"mode":            i.Mode,
+		"validateCommand": i.ValidateCommand,
+		"template":        i.Template,
+		"variables":       i.Variables,
+		"remotePath":      i.RemotePath,
+	}
+}
+
+// FromMap converts a map to Input struct
+func (i *Input) FromMap(values map[string]interface{}) error {
+	var err error
+	i.Connection, err = ssh.GetSharedConfiguration(values["SSH Connection"])
+	if err != nil {
+		return err
+	}
+
+	i.Host, err = coerce.ToString(values["host"])
+	if err != nil {
+		return err
+	}
+
+	i.Port, err = coerce.ToInt(values["port"])
+	if err != nil {
+		return err
+	}
+
+	i.Backup, err = coerce.ToBool(values["backup"])
+	if err != nil {
+		return err
+	}
+
+	i.Owner, err = coerce.ToString(values["owner"])
+	if err != nil {
+		return err
+	}
+
+	i.Mode, err = coerce.ToString(values["mode"])
+	if err != nil {
+		return err
+	}
+
+	i.ValidateCommand, err = coerce.ToString(values["validateCommand"])
+	if err != nil {
+		return err
+	}
+
+	i.Template, err = coerce.ToString(values["template"])
+	if err != nil {
+		return err
+	}
+
+	i.Variables, err = coerce.ToObject(values["variables"])
+	if err != nil {
+		return err
+	}
+
+	i.RemotePath, err = coerce.ToString(values["remotePath"])
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// ToMap converts Output struct to map
+func (o *Output) ToMap() map[string]interface{} {
+	return map[string]interface{}{
+		"changed":    o.Changed,
+		"diff":       o.Diff,
+		"backupPath": o.BackupPath,
+		"content":    o.Content,
+	}
+}
+
+// FromMap converts a map to Output struct
+func (o *Output) FromMap(values map[string]interface{}) error {
+	var err error
+	o.Changed, err = coerce.ToBool(values["changed"])
+	if err != nil {
+		return err
+	}
+
+	o.Diff, err = coerce.ToString(values["diff"])
+	if err != nil {
+		return err
+	}
+
+	o.BackupPath, err = coerce.ToString(values["backupPath"])
+	if err != nil {
+		return err
+	}
+
+	o.Content, err = coerce.ToString(values["content"])
+	if err != nil {
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,332 @@
+package template
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/flosch/pongo2/v6"
+	ssh "github.com/mmussett/extensions/SSH/connector/connection"
+	"github.com/mmussett/extensions/SSH/internal/shell"
+	"github.com/pkg/sftp"
+	"github.com/pmezard/go-difflib/difflib"
+)
+
+// defaultMode is the mode of a new file when no mode is specified
+const defaultMode os.FileMode = 0644
+
+// backupLayout is the timestamp format of the backup file suffix
+const backupLayout = "20060102T150405Z"
+
+// now returns the time of the backups
+var now = time.Now
+
+// ownerRegexp matches user or user:group, by name or numeric id
+var ownerRegexp = regexp.MustCompile(`^[A-Za-z0-9_][A-Za-z0-9_.-]*(:[A-Za-z0-9_][A-Za-z0-9_.-]*)?$`)
+
+// options of a template deployment
+type options struct {
+	path            string
+	content         string
+	owner           string
+	mode            os.FileMode
+	backup          bool
+	validateCommand string
+}
+
+// render renders the Pongo2 template with the variables
+func render(source string, variables map[string]interface{}) (string, error) {
+	tpl, err := pongo2.FromString(source)
+	if err != nil {
+		return "", fmt.Errorf("invalid template: %s", err.Error())
+	}
+	content, err := tpl.Execute(pongo2.Context(variables))
+	if err != nil {
+		return "", fmt.Errorf("failed to render template: %s", err.Error())
+	}
+	return content, nil
+}
+
+// parseMode parses an octal mode such as 0644, an empty mode returns 0
+func parseMode(mode string) (os.FileMode, error) {
+	if mode == "" {
+		return 0, nil
+	}
+	value, err := strconv.ParseUint(mode, 8, 32)
+	if err != nil || value == 0 || value > 0777 {
+		return 0, fmt.Errorf("invalid mode '%s', an octal permission such as 0644 is expected", mode)
+	}
+	return os.FileMode(value), nil
+}
+
+func validateOwner(owner string) error {
+	if owner != "" && !ownerRegexp.MatchString(owner) {
+		return fmt.Errorf("invalid owner '%s', user or user:group is expected", owner)
+	}
+	return nil
+}
+
+// apply writes the rendered content to the remote file when it differs from the current content.
+// The owner and mode are also fixed on an unchanged file.
+func apply(ctx context.Context, client *sftp.Client, run ssh.Client, opts *options) (*Output, error) {
+	current, info, err := readFile(client, opts.path)
+	if err != nil {
+		return nil, err
+	}
+	exists := info != nil
+
+	output := &Output{Content: opts.content}
+	if exists && current == opts.content {
+		if opts.mode != 0 && info.Mode().Perm() != opts.mode {
+			if err = client.Chmod(opts.path, opts.mode); err != nil {
+				return nil, fmt.Errorf("failed to change the mode of '%s': %s", opts.path, err.Error())
+			}
+			output.Changed = true
+		}
+		if opts.owner != "" {
+			owned, err := ownedBy(ctx, run, opts.path, info, opts.owner)
+			if err != nil {
+				return nil, err
+			}
+			if !owned {
+				if err = chown(ctx, run, opts.owner, opts.path); err != nil {
+					return nil, fmt.Errorf("failed to change the owner of '%s': %s", opts.path, err.Error())
+				}
+				output.Changed = true
+			}
+		}
+		return output, nil
+	}
+
+	output.Changed = true
+	output.Diff, err = unifiedDiff(opts.path, current, opts.content, exists)
+	if err != nil {
+		return nil, err
+	}
+
+	mode := opts.mode
+	if mode == 0 {
+		mode = defaultMode
+		if exists {
+			mode = info.Mode().Perm()
+		}
+	}
+
+	if exists && opts.backup {
+		output.BackupPath = opts.path + "." + now().UTC().Format(backupLayout) + ".bak"
+		if err = writeFile(client, output.BackupPath, current, info.Mode().Perm()); err != nil {
+			return nil, err
+		}
+		if err = keepOwner(client, output.BackupPath, info); err != nil {
+			client.Remove(output.BackupPath)
+			return nil, err
+		}
+	}
+
+	if err = replace(ctx, client, run, opts.path, opts.content, mode, opts.owner, info); err != nil {
+		return nil, err
+	}
+
+	if opts.validateCommand != "" {
+		result, err := run.Run(ctx, opts.validateCommand, nil)
+		if err == nil && result.ExitCode != 0 {
+			err = fmt.Errorf("command exited with status %d: %s", result.ExitCode, strings.TrimSpace(string(result.Stderr)))
+		}
+		if err != nil {
+			if rollbackErr := rollback(ctx, client, run, opts, current, info); rollbackErr != nil {
+				return nil, fmt.Errorf("validation of '%s' failed: %s, and the rollback failed: %s", opts.path, err.Error(), rollbackErr.Error())
+			}
+			return nil, fmt.Errorf("validation of '%s' failed, the change was rolled back: %s", opts.path, err.Error())
+		}
+	}
+	return output, nil
+}
+
+// rollback restores the previous content, mode and ownership of the file, or removes it when it
+// did not exist
+func rollback(ctx context.Context, client *sftp.Client, run ssh.Client, opts *options, current string, info os.FileInfo) error {
+	if info == nil {
+		return client.Remove(opts.path)
+	}
+	return replace(ctx, client, run, opts.path, current, info.Mode().Perm(), "", info)
+}
+
+// unifiedDiff returns the unified diff between the current and the new content
+func unifiedDiff(file, current, content string, exists bool) (string, error) {
+	diff := difflib.UnifiedDiff{
+		B:        splitLines(content),
+		FromFile: file,
+		ToFile:   file,
+		Context:  3,
+	}
+	if exists {
+		diff.A = splitLines(current)
+	} else {
+		diff.FromFile = "/dev/null"
+	}
+	return difflib.GetUnifiedDiffString(diff)
+}
+
+// splitLines splits the content after each newline, a last line without newline gets one so that
+// the diff stays line oriented
+func splitLines(content string) []string {
+	lines := strings.SplitAfter(content, "\n")
+	if last := len(lines) - 1; lines[last] == "" {
+		lines = lines[:last]
+	} else {
+		lines[last] += "\n"
+	}
+	return lines
+}
+
+// readFile returns the content and the attributes of the file, the attributes are nil when the
+// file does not exist
+func readFile(client *sftp.Client, file string) (string, os.FileInfo, error) {
+	f, err := client.Open(file)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return "", nil, nil
+		}
+		return "", nil, fmt.Errorf("failed to open '%s': %s", file, err.Error())
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil {
+		return "", nil, fmt.Errorf("failed to stat '%s': %s", file, err.Error())
+	}
+	if !info.Mode().IsRegular() {
+		return "", nil, fmt.Errorf("'%s' is not a regular file", file)
+	}
+	data, err := io.ReadAll(f)
+	if err != nil {
+		return "", nil, fmt.Errorf("failed to read '%s': %s", file, err.Error())
+	}
+	return string(data), info, nil
+}
+
+// writeFile writes the content to the file with the mode
+func writeFile(client *sftp.Client, file, content string, mode os.FileMode) error {
+	f, err := client.OpenFile(file, os.O_WRONLY|os.O_CREATE|os.O_TRUNC)
+	if err != nil {
+		return fmt.Errorf("failed to create '%s': %s", file, err.Error())
+	}
+	_, err = f.Write([]byte(content))
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = client.Chmod(file, mode)
+	}
+	if err != nil {
+		client.Remove(file)
+		return fmt.Errorf("failed to write '%s': %s", file, err.Error())
+	}
+	return nil
+}
+
+// replace replaces the file through a temporary file in the same directory, so that readers never
+// see a partially written file. The owner is set with chown, which resolves user and group names.
+// Without owner, the replaced file keeps the owner and group of the existing file described by info.
+func replace(ctx context.Context, client *sftp.Client, run ssh.Client, file, content string, mode os.FileMode, owner string, info os.FileInfo) error {
+	suffix := make([]byte, 6)
+	if _, err := rand.Read(suffix); err != nil {
+		return err
+	}
+	dir, name := path.Split(file)
+	temp := dir + "." + name + "." + hex.EncodeToString(suffix) + ".tmp"
+
+	if err := writeFile(client, temp, content, mode); err != nil {
+		return err
+	}
+
+	if owner != "" {
+		if err := chown(ctx, run, owner, temp); err != nil {
+			client.Remove(temp)
+			return fmt.Errorf("failed to change the owner of '%s': %s", file, err.Error())
+		}
+	} else if err := keepOwner(client, temp, info); err != nil {
+		client.Remove(temp)
+		return err
+	}
+
+	var err error
+	if _, ok := client.HasExtension("posix-rename@openssh.com"); ok {
+		err = client.PosixRename(temp, file)
+	} else {
+		client.Remove(file)
+		err = client.Rename(temp, file)
+	}
+	if err != nil {
+		client.Remove(temp)
+		return fmt.Errorf("failed to replace '%s': %s", file, err.Error())
+	}
+	return nil
+}
+
+// chown sets the owner of file with the chown command, which resolves user and group names
+func chown(ctx context.Context, run ssh.Client, owner, file string) error {
+	result, err := run.Run(ctx, "chown "+owner+" "+shell.Quote(file), nil)
+	if err == nil && result.ExitCode != 0 {
+		err = fmt.Errorf("command exited with status %d: %s", result.ExitCode, strings.TrimSpace(string(result.Stderr)))
+	}
+	return err
+}
+
+// ownedBy reports whether the file described by info has the owner, given as user or user:group
+// by name or numeric id. Numeric ids are compared with the attributes of the file, names with
+// those listed by `ls -ld`.
+func ownedBy(ctx context.Context, run ssh.Client, file string, info os.FileInfo, owner string) (bool, error) {
+	stat, ok := info.Sys().(*sftp.FileStat)
+	if !ok {
+		return false, nil
+	}
+	user, group, _ := strings.Cut(owner, ":")
+	ids := []string{strconv.FormatUint(uint64(stat.UID), 10), strconv.FormatUint(uint64(stat.GID), 10)}
+	if user == ids[0] && (group == "" || group == ids[1]) {
+		return true, nil
+	}
+
+	result, err := run.Run(ctx, "ls -ld -- "+shell.Quote(file), nil)
+	if err == nil && result.ExitCode != 0 {
+		err = fmt.Errorf("command exited with status %d: %s", result.ExitCode, strings.TrimSpace(string(result.Stderr)))
+	}
+	if err != nil {
+		return false, fmt.Errorf("failed to read the owner of '%s': %s", file, err.Error())
+	}
+	fields := strings.Fields(string(result.Stdout))
+	if len(fields) < 4 {
+		return false, fmt.Errorf("failed to read the owner of '%s': unexpected output '%s'", file, strings.TrimSpace(string(result.Stdout)))
+	}
+	names := fields[2:4]
+	return (user == names[0] || user == ids[0]) && (group == "" || group == names[1] || group == ids[1]), nil
+}
+
+// keepOwner gives file the owner and group of the existing file described by info. Nothing is
+// changed when info is nil, or when file already has them.
+func keepOwner(client *sftp.Client, file string, info os.FileInfo) error {
+	if info == nil {
+		return nil
+	}
+	stat, ok := info.Sys().(*sftp.FileStat)
+	if !ok {
+		return nil
+	}
+	if current, err := client.Stat(file); err == nil {
+		if currentStat, ok := current.Sys().(*sftp.FileStat); ok && currentStat.UID == stat.UID && currentStat.GID == stat.GID {
+			return nil
+		}
+	}
+	if err := client.Chown(file, int(stat.UID), int(stat.GID)); err != nil {
+		return fmt.Errorf("failed to keep the owner of '%s': %s", info.Name(), err.Error())
+	}
+	return nil
+}
@@ -0,0 +1,290 @@
+package connection
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	defaultAuditMaxSize    = 100
+	defaultAuditMaxBackups = 5
+	auditMask              = "****"
+)
+
+// AuditEvent records one command run on an SSH server
+type AuditEvent struct {
+	Timestamp  time.Time `json:"timestamp"`
+	Connection string    `json:"connection"`
+	Host       string    `json:"host"`
+	User       string    `json:"user"`
+	Command    string    `json:"command"`
+	ExitCode   int       `json:"exitCode"`
+	DurationMs int64     `json:"durationMs"`
+	Flow       string    `json:"flow,omitempty"`
+	Activity   string    `json:"activity,omitempty"`
+	Error      string    `json:"error,omitempty"`
+}
+
+// AuditSink receives the audit events of all SSH connections. Secrets in the command
+// are masked before an event is written. Write is called concurrently and should not block.
+type AuditSink interface {
+	Write(event *AuditEvent) error
+}
+
+var (
+	auditSinksMu sync.RWMutex
+	auditSinks   []AuditSink
+)
+
+// RegisterAuditSink adds a sink for the audit events of all SSH connections,
+// in addition to the audit file configured on each connection
+func RegisterAuditSink(sink AuditSink) {
+	auditSinksMu.Lock()
+	defer auditSinksMu.Unlock()
+	auditSinks = append(auditSinks, sink)
+}
+
+type activityKey struct{}
+
+type activityInfo struct {
+	flow     string
+	activity string
+}
+
+// WithActivity returns a copy of ctx carrying the flow and activity names recorded in the
+// audit events of commands run with it
+func WithActivity(ctx context.Context, flow, activity string) context.Context {
+	return context.WithValue(ctx, activityKey{}, activityInfo{flow: flow, activity: activity})
+}
+
+// auditor writes the audit events of a connection
+type auditor struct {
+	connection string
+	user       string
+	masks      []*regexp.Regexp
+	file       *fileSink
+}
+
+func newAuditor(s *Settings) (*auditor, error) {
+	a := &auditor{connection: s.Name, user: s.User}
+	for _, line := range strings.Split(s.AuditMaskPatterns, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+		re, err := regexp.Compile(line)
+		if err != nil {
+			return nil, fmt.Errorf("invalid mask pattern '%s': %s", line, err.Error())
+		}
+		a.masks = append(a.masks, re)
+	}
+
+	if s.AuditFile != "" {
+		maxSize, maxBackups := s.AuditMaxSize, s.AuditMaxBackups
+		if maxSize == 0 {
+			maxSize = defaultAuditMaxSize
+		}
+		if maxBackups == 0 {
+			maxBackups = defaultAuditMaxBackups
+		}
+		file, err := openFileSink(s.AuditFile, int64(maxSize)*1024*1024, maxBackups)
+		if err != nil {
+			return nil, err
+		}
+		a.file = file
+	}
+	return a, nil
+}
+
+// mask replaces the secrets matched by the mask patterns. Patterns with capture groups only
+// mask the groups, so that `password=(\S+)` keeps the name of the option.
+func (a *auditor) mask(cmd string) string {
+	for _, re := range a.masks {
+		if re.NumSubexp() == 0 {
+			cmd = re.ReplaceAllLiteralString(cmd, auditMask)
+			continue
+		}
+		var b strings.Builder
+		last := 0
+		for _, m := range re.FindAllStringSubmatchIndex(cmd, -1) {
+			for g := 2; g < len(m); g += 2 {
+				if m[g] < last {
+					continue
+				}
+				b.WriteString(cmd[last:m[g]])
+				b.WriteString(auditMask)
+				last = m[g+1]
+			}
+		}
+		b.WriteString(cmd[last:])
+		cmd = b.String()
+	}
+	return cmd
+}
+
+// record writes the event of a command run on host to the audit file and the registered sinks
+func (a *auditor) record(ctx context.Context, host, cmd string, start time.Time, result *RunResult, err error) {
+	event := &AuditEvent{
+		Timestamp:  start.UTC(),
+		Connection: a.connection,
+		Host:       host,
+		User:       a.user,
+		Command:    a.mask(cmd),
+		DurationMs: time.Since(start).Milliseconds(),
+	}
+	if info, ok := ctx.Value(activityKey{}).(activityInfo); ok {
+		event.Flow, event.Activity = info.flow, info.activity
+	}
+	if err != nil {
+		event.ExitCode = -1
+		event.Error = err.Error()
+	} else {
+		event.ExitCode = result.ExitCode
+	}
+
+	if a.file != nil {
+		if err := a.file.Write(event); err != nil {
+			logCache.Errorf("Failed to write audit event of connection '%s': %s", a.connection, err.Error())
+		}
+	}
+	auditSinksMu.RLock()
+	defer auditSinksMu.RUnlock()
+	for _, sink := range auditSinks {
+		if err := sink.Write(event); err != nil {
+			logCache.Errorf("Failed to write audit event of connection '%s': %s", a.connection, err.Error())
+		}
+	}
+}
+
+func (a *auditor) close() {
+	if a.file != nil {
+		a.file.release()
+		a.file = nil
+	}
+}
+
+var (
+	fileSinksMu sync.Mutex
+	fileSinks   = make(map[string]*fileSink)
+)
+
+// fileSink writes audit events as JSON lines and rotates the file when it exceeds maxSize.
+// Rotated files are renamed to <path>.1, <path>.2 and so on, keeping maxBackups of them.
+// Connections configured with the same file share one sink.
+type fileSink struct {
+	path       string
+	maxSize    int64
+	maxBackups int
+	refs       int
+
+	mu   sync.Mutex
+	f    *os.File
+	size int64
+}
+
+func openFileSink(path string, maxSize int64, maxBackups int) (*fileSink, error) {
+	path, err := filepath.Abs(path)
+	if err != nil {
+		return nil, err
+	}
+
+	fileSinksMu.Lock()
+	defer fileSinksMu.Unlock()
+	if sink, ok := fileSinks[path]; ok {
+		sink.refs++
+		return sink, nil
+	}
+
+	sink := &fileSink{path: path, maxSize: maxSize, maxBackups: maxBackups, refs: 1}
+	if err = sink.open(); err != nil {
+		return nil, err
+	}
+	fileSinks[path] = sink
+	return sink, nil
+}
+
+func (fs *fileSink) open() error {
+	if err := os.MkdirAll(filepath.Dir(fs.path), 0755); err != nil {
+		return fmt.Errorf("failed to create audit directory: %s", err.Error())
+	}
+	f, err := os.OpenFile(fs.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0600)
+	if err != nil {
+		return fmt.Errorf("failed to open audit file: %s", err.Error())
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return err
+	}
+	fs.f, fs.size = f, info.Size()
+	return nil
+}
+
+// Write implements AuditSink.Write
+func (fs *fileSink) Write(event *AuditEvent) error {
+	line, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	line = append(line, '\n')
+
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	if fs.f == nil {
+		return fmt.Errorf("audit file '%s' is closed", fs.path)
+	}
+	if fs.size > 0 && fs.size+int64(len(line)) > fs.maxSize {
+		if err = fs.rotate(); err != nil {
+			return err
+		}
+	}
+	n, err := fs.f.Write(line)
+	fs.size += int64(n)
+	return err
+}
+
+// rotate shifts the backups and starts a new file, fs.mu must be held
+func (fs *fileSink) rotate() error {
+	fs.f.Close()
+	fs.f = nil
+
+	os.Remove(fmt.Sprintf("%s.%d", fs.path, fs.maxBackups))
+	for i := fs.maxBackups - 1; i > 0; i-- {
+		os.Rename(fmt.Sprintf("%s.%d", fs.path, i), fmt.Sprintf("%s.%d", fs.path, i+1))
+	}
+	if fs.maxBackups > 0 {
+		if err := os.Rename(fs.path, fs.path+".1"); err != nil {
+			// keep appending to the current file so later events are not lost
+			fs.open()
+			return fmt.Errorf("failed to rotate audit file: %s", err.Error())
+		}
+	} else {
+		os.Remove(fs.path)
+	}
+	return fs.open()
+}
+
+// release closes the file when the last connection using it is stopped
+func (fs *fileSink) release() {
+	fileSinksMu.Lock()
+	defer fileSinksMu.Unlock()
+	fs.refs--
+	if fs.refs > 0 {
+		return
+	}
+	delete(fileSinks, fs.path)
+
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	if fs.f != nil {
+		fs.f.Close()
+		fs.f = nil
+	}
+}
@@ -0,0 +1,270 @@
+package connection
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+)
+
+const (
+	defaultCircuitOpenDuration   = 30
+	defaultCircuitHalfOpenProbes = 1
+)
+
+// CircuitOpenError is returned without contacting the host while the circuit breaker of the host is open
+type CircuitOpenError struct {
+	Host string
+	// RetryAfter is the time left until the circuit is half-open, 0 while probes are running
+	RetryAfter time.Duration
+}
+
+func (e *CircuitOpenError) Error() string {
+	if e.RetryAfter <= 0 {
+		return fmt.Sprintf("circuit open for SSH host %s, waiting for the probes of the host", e.Host)
+	}
+	// the time is rounded up, so that a retry after RetryAfter finds the circuit half-open
+	retry := (e.RetryAfter + time.Second - 1) / time.Second * time.Second
+	return fmt.Sprintf("circuit open for SSH host %s after repeated failures, retry in %s", e.Host, retry)
+}
+
+type circuitState int
+
+const (
+	circuitClosed circuitState = iota
+	circuitOpen
+	circuitHalfOpen
+)
+
+// circuitBreaker stops sending sessions to a host after threshold consecutive failures. The
+// circuit stays open for openDuration, then lets probes sessions through. It closes when they
+// all succeed and opens again when one fails.
+type circuitBreaker struct {
+	host         string
+	threshold    int
+	openDuration time.Duration
+	probes       int
+
+	mu       sync.Mutex
+	state    circuitState
+	failures int
+	until    time.Time
+	// started and passed count the probes of the half-open state
+	started int
+	passed  int
+	// generation changes with the state, so that late outcomes of a previous state are ignored
+	generation uint64
+}
+
+// allow returns a CircuitOpenError when the host must not be contacted, or the generation to
+// pass to done with the outcome
+func (b *circuitBreaker) allow() (uint64, error) {
+	if b == nil {
+		return 0, nil
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.state == circuitOpen {
+		if wait := time.Until(b.until); wait > 0 {
+			return 0, &CircuitOpenError{Host: b.host, RetryAfter: wait}
+		}
+		b.setState(circuitHalfOpen)
+		logCache.Infof("Circuit of SSH host %s is half-open, probing the host", b.host)
+	}
+	if b.state == circuitHalfOpen {
+		if b.started >= b.probes {
+			return 0, &CircuitOpenError{Host: b.host}
+		}
+		b.started++
+	}
+	return b.generation, nil
+}
+
+// done records the outcome of an operation allowed in generation, a nil error is a success
+func (b *circuitBreaker) done(generation uint64, err error) {
+	if b == nil {
+		return
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if generation != b.generation {
+		return
+	}
+
+	switch b.state {
+	case circuitClosed:
+		if err == nil {
+			b.failures = 0
+			return
+		}
+		b.failures++
+		if b.failures >= b.threshold {
+			logCache.Warnf("Circuit of SSH host %s opened for %s after %d consecutive failures, last error: %s", b.host, b.openDuration, b.failures, err.Error())
+			b.open()
+		}
+	case circuitHalfOpen:
+		if err != nil {
+			b.open()
+			logCache.Warnf("Circuit of SSH host %s opened again for %s, probe failed: %s", b.host, b.openDuration, err.Error())
+			return
+		}
+		b.passed++
+		if b.passed >= b.probes {
+			b.setState(circuitClosed)
+			logCache.Infof("Circuit of SSH host %s closed", b.host)
+		}
+	}
+}
+
+// cancel releases an operation allowed in generation that ended before contacting the host
+func (b *circuitBreaker) cancel(generation uint64) {
+	if b == nil {
+		return
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if generation == b.generation && b.state == circuitHalfOpen {
+		b.started--
+	}
+}
+
+// open opens the circuit, b.mu must be held
+func (b *circuitBreaker) open() {
+	b.setState(circuitOpen)
+	b.until = time.Now().Add(b.openDuration)
+}
+
+// setState changes the state and resets the counters, b.mu must be held
+func (b *circuitBreaker) setState(state circuitState) {
+	b.state = state
+	b.failures, b.started, b.passed = 0, 0, 0
+	b.generation++
+}
+
+// tokenBucket limits the rate of new sessions to a host. It holds up to burst tokens and
+// gains rate tokens per second.
+type tokenBucket struct {
+	rate  float64
+	burst float64
+
+	mu     sync.Mutex
+	tokens float64
+	last   time.Time
+}
+
+func newTokenBucket(rate, burst int) *tokenBucket {
+	return &tokenBucket{rate: float64(rate), burst: float64(burst), tokens: float64(burst), last: time.Now()}
+}
+
+// wait takes a token, waiting until one is available or ctx is done. Waiting callers reserve
+// their token, so they are served in order.
+func (b *tokenBucket) wait(ctx context.Context) error {
+	if b == nil {
+		return nil
+	}
+	b.mu.Lock()
+	now := time.Now()
+	b.tokens += now.Sub(b.last).Seconds() * b.rate
+	if b.tokens > b.burst {
+		b.tokens = b.burst
+	}
+	b.last = now
+	b.tokens--
+	if b.tokens >= 0 {
+		b.mu.Unlock()
+		return nil
+	}
+	delay := time.Duration(-b.tokens / b.rate * float64(time.Second))
+	b.mu.Unlock()
+
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		b.mu.Lock()
+		b.tokens++
+		b.mu.Unlock()
+		return ctx.Err()
+	}
+}
+
+// hostGuard applies the circuit breaker and the session rate limit of a host. Either may be nil
+// when it is not configured.
+type hostGuard struct {
+	breaker *circuitBreaker
+	limiter *tokenBucket
+}
+
+// acquire is called before a session is opened. It fails fast while the circuit is open, then
+// waits for the rate limit.
+func (g *hostGuard) acquire(ctx context.Context) (uint64, error) {
+	if g == nil {
+		return 0, nil
+	}
+	generation, err := g.breaker.allow()
+	if err != nil {
+		return 0, err
+	}
+	if err = g.limiter.wait(ctx); err != nil {
+		g.breaker.cancel(generation)
+		return 0, err
+	}
+	return generation, nil
+}
+
+// done records whether the session could be opened
+func (g *hostGuard) done(generation uint64, err error) {
+	if g == nil {
+		return
+	}
+	g.breaker.done(generation, err)
+}
+
+// hostGuards holds the guards of the hosts of a connection. They are kept for the lifetime of
+// the connection, so the state of a host survives the eviction of its client.
+type hostGuards struct {
+	settings *Settings
+	mu       sync.Mutex
+	guards   map[string]*hostGuard
+}
+
+func newHostGuards(s *Settings) *hostGuards {
+	return &hostGuards{settings: s, guards: make(map[string]*hostGuard)}
+}
+
+// get returns the guard of addr, or nil when neither the circuit breaker nor the rate limit is configured
+func (g *hostGuards) get(addr string) *hostGuard {
+	s := g.settings
+	if s.CircuitThreshold == 0 && s.SessionRateLimit == 0 {
+		return nil
+	}
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if guard, ok := g.guards[addr]; ok {
+		return guard
+	}
+
+	guard := &hostGuard{}
+	if s.CircuitThreshold > 0 {
+		openDuration, probes := s.CircuitOpenPeriod, s.CircuitProbes
+		if openDuration == 0 {
+			openDuration = defaultCircuitOpenDuration
+		}
+		if probes == 0 {
+			probes = defaultCircuitHalfOpenProbes
+		}
+		guard.breaker = &circuitBreaker{host: addr, threshold: s.CircuitThreshold, openDuration: time.Duration(openDuration) * time.Second, probes: probes}
+	}
+	if s.SessionRateLimit > 0 {
+		burst := s.SessionRateBurst
+		if burst == 0 {
+			burst = s.SessionRateLimit
+		}
+		guard.limiter = newTokenBucket(s.SessionRateLimit, burst)
+	}
+	g.guards[addr] = guard
+	return guard
+}
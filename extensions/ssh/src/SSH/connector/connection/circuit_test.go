@@ -0,0 +1,137 @@
+package connection
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCircuitBreaker(t *testing.T) {
+	failure := errors.New("connection refused")
+	b := &circuitBreaker{host: "db1:22", threshold: 2, openDuration: 50 * time.Millisecond, probes: 2}
+
+	// a success resets the consecutive failures
+	for _, err := range []error{failure, nil, failure} {
+		generation, allowErr := b.allow()
+		assert.Nil(t, allowErr)
+		b.done(generation, err)
+	}
+	generation, err := b.allow()
+	assert.Nil(t, err)
+	late, _ := b.allow()
+	b.done(generation, failure)
+
+	_, err = b.allow()
+	var circuitErr *CircuitOpenError
+	if assert.True(t, errors.As(err, &circuitErr)) {
+		assert.Equal(t, "db1:22", circuitErr.Host)
+		assert.True(t, circuitErr.RetryAfter > 0 && circuitErr.RetryAfter <= 50*time.Millisecond)
+	}
+	assert.Equal(t, "circuit open for SSH host db1:22 after repeated failures, retry in 1s", err.Error())
+	// the outcome of a session allowed before the circuit opened is ignored
+	b.done(late, nil)
+	_, err = b.allow()
+	assert.NotNil(t, err)
+
+	// half-open, only the probes are let through and a failed probe opens the circuit again
+	time.Sleep(60 * time.Millisecond)
+	probe, err := b.allow()
+	assert.Nil(t, err)
+	b.done(probe, failure)
+	_, err = b.allow()
+	assert.NotNil(t, err)
+
+	time.Sleep(60 * time.Millisecond)
+	first, err := b.allow()
+	assert.Nil(t, err)
+	second, err := b.allow()
+	assert.Nil(t, err)
+	_, err = b.allow()
+	assert.EqualError(t, err, "circuit open for SSH host db1:22, waiting for the probes of the host")
+
+	// a cancelled probe frees its place
+	b.cancel(second)
+	second, err = b.allow()
+	assert.Nil(t, err)
+
+	b.done(first, nil)
+	b.done(second, nil)
+	generation, err = b.allow()
+	assert.Nil(t, err)
+	b.done(generation, failure)
+	_, err = b.allow()
+	assert.Nil(t, err, "the circuit is closed after the probes succeeded")
+}
+
+func TestTokenBucket(t *testing.T) {
+	b := newTokenBucket(20, 2)
+	start := time.Now()
+	assert.Nil(t, b.wait(context.Background()))
+	assert.Nil(t, b.wait(context.Background()))
+	assert.Less(t, time.Since(start), 40*time.Millisecond, "the burst is not limited")
+
+	// the next tokens come every 50ms
+	assert.Nil(t, b.wait(context.Background()))
+	assert.Nil(t, b.wait(context.Background()))
+	assert.GreaterOrEqual(t, time.Since(start), 90*time.Millisecond)
+
+	// a cancelled wait returns its token
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	assert.Equal(t, context.DeadlineExceeded, b.wait(ctx))
+	time.Sleep(50 * time.Millisecond)
+	start = time.Now()
+	assert.Nil(t, b.wait(context.Background()))
+	assert.Less(t, time.Since(start), 20*time.Millisecond)
+}
+
+func TestCircuitOpenHost(t *testing.T) {
+	srv := newTestServer(t)
+	settings := srv.settings("circuit")
+	settings["retryCount"] = 1
+	settings["retryInterval"] = 0
+	settings["circuitFailureThreshold"] = 2
+	settings["circuitOpenDuration"] = 60
+	settings["sessionRateLimit"] = 100
+
+	manager, err := factory.NewManager(settings)
+	assert.Nil(t, err)
+	sharedConn := manager.(*SshSharedConfigManager)
+	t.Cleanup(func() { sharedConn.Stop() })
+
+	port := closedPort(t)
+	down, err := GetHostClient(sharedConn, "", port)
+	assert.Nil(t, err)
+	for i := 0; i < 2; i++ {
+		_, err = down.Run(context.Background(), "hostname", nil)
+		assert.NotNil(t, err)
+		var circuitErr *CircuitOpenError
+		assert.False(t, errors.As(err, &circuitErr), "the host is contacted until the threshold is reached")
+	}
+
+	// the host is not contacted while the circuit is open, the other hosts are not affected
+	_, err = down.Run(context.Background(), "hostname", nil)
+	var circuitErr *CircuitOpenError
+	assert.True(t, errors.As(err, &circuitErr))
+	_, err = down.SFTP()
+	assert.True(t, errors.As(err, &circuitErr))
+
+	result, err := sharedConn.Run(context.Background(), "hostname", nil)
+	assert.Nil(t, err)
+	assert.Equal(t, "hostname", string(result.Stdout))
+
+	// the state of the host survives the eviction of its client
+	sharedConn.hosts.mu.Lock()
+	evicted := sharedConn.hosts.clients[down.Host()]
+	sharedConn.hosts.remove(evicted)
+	sharedConn.hosts.mu.Unlock()
+	evicted.close()
+	again, err := GetHostClient(sharedConn, "", port)
+	assert.Nil(t, err)
+	assert.False(t, again == down)
+	_, err = again.Run(context.Background(), "hostname", nil)
+	assert.True(t, errors.As(err, &circuitErr))
+}
@@ -0,0 +1,250 @@
+package connection
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/sftp"
+	"github.com/project-flogo/core/support/connection"
+	"golang.org/x/crypto/ssh"
+)
+
+// Client is the managed SSH client of a connection. It is safe for concurrent use, and the
+// channels it opens use whichever SSH client is current, so it keeps working after a reconnect.
+// Activities and triggers of other packages obtain it with GetClient.
+type Client interface {
+	// Run runs a command in a new session and waits for it to exit. A non-zero exit status
+	// is reported in the result, not as an error.
+	Run(ctx context.Context, cmd string, opts *RunOptions) (*RunResult, error)
+	// NewSession opens a new session, which the caller must close after use
+	NewSession(ctx context.Context) (*Session, error)
+	// SFTP opens an sftp subsystem channel. Closing the returned client only closes the channel.
+	SFTP() (*sftp.Client, error)
+	// Dial opens a connection to addr from the SSH server
+	Dial(network, addr string) (net.Conn, error)
+	// Host returns the host:port address of the SSH server
+	Host() string
+}
+
+// RunOptions configures a command run by Client.Run
+type RunOptions struct {
+	// Stdin is the standard input of the command
+	Stdin io.Reader
+	// Env is set in the session before the command runs. Servers only accept the variables
+	// allowed by their AcceptEnv configuration.
+	Env map[string]string
+	// Stdout and Stderr additionally receive the output while the command runs
+	Stdout io.Writer
+	Stderr io.Writer
+}
+
+// RunResult is the outcome of a command run by Client.Run
+type RunResult struct {
+	Stdout   []byte
+	Stderr   []byte
+	ExitCode int
+	Duration time.Duration
+}
+
+var _ Client = (*SshSharedConfigManager)(nil)
+
+// GetClient returns the client of an SSH connection
+func GetClient(conn connection.Manager) (Client, error) {
+	client, ok := conn.(Client)
+	if !ok {
+		return nil, fmt.Errorf("connection is not an SSH connection")
+	}
+	return client, nil
+}
+
+// Run implements Client.Run. Commands are checked against the command policy of the connection,
+// and every command, including rejected ones, is recorded in the audit trail.
+func (s *SshSharedConfigManager) Run(ctx context.Context, cmd string, opts *RunOptions) (*RunResult, error) {
+	start := time.Now()
+	result, err := s.run(ctx, cmd, opts)
+	if s.audit != nil {
+		s.audit.record(ctx, s.Host(), cmd, start, result, err)
+	}
+	hostMetrics{connection: s.Settings.Name, host: s.Host()}.command(result, err)
+	return result, err
+}
+
+func (s *SshSharedConfigManager) run(ctx context.Context, cmd string, opts *RunOptions) (*RunResult, error) {
+	if err := s.policy.check(cmd); err != nil {
+		return nil, err
+	}
+	session, err := s.NewSession(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer session.Close()
+	s.commands.update(session.id, kindCommand, cmd)
+	return runSession(ctx, session.Session, cmd, opts)
+}
+
+// NewSession opens a new session on the SSH client of the connection.
+// Unlike the session returned by GetConnection, it is owned by the caller and must be closed after use.
+func (s *SshSharedConfigManager) NewSession(ctx context.Context) (*Session, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	id, err := s.commands.begin(s.Host(), kindSession, "")
+	if err != nil {
+		return nil, err
+	}
+	generation, err := s.guard.acquire(ctx)
+	if err != nil {
+		s.commands.end(id)
+		return nil, err
+	}
+	session, err := s.newSession()
+	s.guard.done(generation, err)
+	if err != nil {
+		s.commands.end(id)
+		return nil, err
+	}
+	metrics := hostMetrics{connection: s.Settings.Name, host: s.Host()}
+	metrics.sessionOpen(1)
+	return wrapSession(ctx, session, s.Host(), s.audit, s.policy, s.commands, id, func() { metrics.sessionOpen(-1) }), nil
+}
+
+func (s *SshSharedConfigManager) newSession() (*ssh.Session, error) {
+	conn, err := s.client()
+	if err != nil {
+		return nil, err
+	}
+
+	logCache.Debug("Creating new SSH session")
+	session, err := conn.NewSession()
+	if err != nil {
+		return nil, fmt.Errorf("failed to create SSH session: %s", err.Error())
+	}
+	return session, nil
+}
+
+// SFTP opens an sftp subsystem channel on the SSH client of the connection.
+// The caller is responsible for closing the returned client, which only closes the
+// channel and leaves the shared SSH client open.
+func (s *SshSharedConfigManager) SFTP() (*sftp.Client, error) {
+	session, err := s.NewSession(context.Background())
+	if err != nil {
+		return nil, err
+	}
+	logCache.Debug("Opening SFTP subsystem channel")
+	return openSFTP(session)
+}
+
+// Dial implements Client.Dial
+func (s *SshSharedConfigManager) Dial(network, addr string) (net.Conn, error) {
+	conn, err := s.client()
+	if err != nil {
+		return nil, err
+	}
+	return conn.Dial(network, addr)
+}
+
+// Host implements Client.Host
+func (s *SshSharedConfigManager) Host() string {
+	return net.JoinHostPort(s.Settings.Host, strconv.Itoa(s.Settings.Port))
+}
+
+// runSession runs cmd in session. When ctx is done first the command is sent SIGKILL
+// and the session closed.
+func runSession(ctx context.Context, session *ssh.Session, cmd string, opts *RunOptions) (*RunResult, error) {
+	if opts == nil {
+		opts = &RunOptions{}
+	}
+	for name, value := range opts.Env {
+		if err := session.Setenv(name, value); err != nil {
+			return nil, fmt.Errorf("failed to set environment variable '%s', check AcceptEnv of the server: %s", name, err.Error())
+		}
+	}
+
+	var stdout, stderr bytes.Buffer
+	session.Stdin = opts.Stdin
+	session.Stdout = writers(&stdout, opts.Stdout)
+	session.Stderr = writers(&stderr, opts.Stderr)
+
+	start := time.Now()
+	if err := session.Start(cmd); err != nil {
+		return nil, fmt.Errorf("failed to start command: %s", err.Error())
+	}
+
+	done := make(chan error, 1)
+	go func() {
+		done <- session.Wait()
+	}()
+
+	var err error
+	select {
+	case err = <-done:
+	case <-ctx.Done():
+		session.Signal(ssh.SIGKILL)
+		session.Close()
+		<-done
+		return nil, ctx.Err()
+	}
+
+	result := &RunResult{Stdout: stdout.Bytes(), Stderr: stderr.Bytes(), Duration: time.Since(start)}
+	if exitErr, ok := err.(*ssh.ExitError); ok {
+		result.ExitCode = exitErr.ExitStatus()
+		return result, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("command failed: %s", err.Error())
+	}
+	return result, nil
+}
+
+func writers(buf *bytes.Buffer, w io.Writer) io.Writer {
+	if w == nil {
+		return buf
+	}
+	return io.MultiWriter(buf, w)
+}
+
+// VerifyLogin opens a new SSH connection to the target of conn, or to host and port when set,
+// and authenticates as user with signer. The host key check of the connection applies.
+// It returns false when the server rejects the key and an error when the server cannot be reached.
+func VerifyLogin(conn connection.Manager, host string, port int, user string, signer ssh.Signer) (bool, error) {
+	sharedConn, ok := conn.(*SshSharedConfigManager)
+	if !ok {
+		return false, fmt.Errorf("connection is not an SSH connection")
+	}
+	if host == "" {
+		host = sharedConn.Settings.Host
+	}
+	if port == 0 {
+		port = sharedConn.Settings.Port
+	}
+	if user == "" {
+		user = sharedConn.Settings.User
+	}
+
+	config, err := sharedConn.hosts.clientConfig()
+	if err != nil {
+		return false, err
+	}
+	verifyConfig := *config
+	verifyConfig.User = user
+	verifyConfig.Auth = []ssh.AuthMethod{ssh.PublicKeys(signer)}
+	if verifyConfig.Timeout == 0 {
+		verifyConfig.Timeout = 30 * time.Second
+	}
+
+	client, err := dial(sharedConn.Settings, net.JoinHostPort(host, strconv.Itoa(port)), &verifyConfig, config)
+	if err != nil {
+		if strings.Contains(err.Error(), "unable to authenticate") {
+			return false, nil
+		}
+		return false, fmt.Errorf("failed to dial: %s", err.Error())
+	}
+	client.Close()
+	return true, nil
+}
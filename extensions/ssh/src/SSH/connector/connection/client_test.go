@@ -0,0 +1,140 @@
+package connection
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/crypto/ssh"
+)
+
+func newTestClient(t *testing.T, srv *testServer) Client {
+	settings := srv.settings("client")
+	settings["retryCount"] = 1
+	settings["retryInterval"] = 0
+
+	manager, err := factory.NewManager(settings)
+	assert.Nil(t, err)
+	t.Cleanup(func() { manager.(*SshSharedConfigManager).Stop() })
+
+	client, err := GetClient(manager)
+	assert.Nil(t, err)
+	return client
+}
+
+func TestClientRun(t *testing.T) {
+	srv := newTestServer(t)
+	srv.exec = func(cmd string, stdin io.Reader, stdout, stderr io.Writer) int {
+		switch cmd {
+		case "cat":
+			io.Copy(stdout, stdin)
+		case "fail":
+			fmt.Fprint(stderr, "no such file")
+			return 2
+		case "sleep":
+			// blocks until the session is closed
+			io.Copy(io.Discard, stdin)
+		}
+		return 0
+	}
+	client := newTestClient(t, srv)
+	assert.Equal(t, fmt.Sprintf("127.0.0.1:%d", srv.port()), client.Host())
+
+	var streamed strings.Builder
+	result, err := client.Run(context.Background(), "cat", &RunOptions{Stdin: strings.NewReader("hello"), Stdout: &streamed})
+	assert.Nil(t, err)
+	assert.Equal(t, "hello", string(result.Stdout))
+	assert.Equal(t, "hello", streamed.String())
+	assert.Equal(t, 0, result.ExitCode)
+
+	result, err = client.Run(context.Background(), "fail", nil)
+	assert.Nil(t, err)
+	assert.Equal(t, 2, result.ExitCode)
+	assert.Equal(t, "no such file", string(result.Stderr))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+	_, err = client.Run(ctx, "sleep", &RunOptions{Stdin: blockingReader{}})
+	assert.Equal(t, context.DeadlineExceeded, err)
+
+	// sessions of the same client run concurrently
+	errs := make(chan error, 5)
+	for i := 0; i < 5; i++ {
+		go func(i int) {
+			result, err := client.Run(context.Background(), "cat", &RunOptions{Stdin: strings.NewReader(fmt.Sprint(i))})
+			if err == nil && string(result.Stdout) != fmt.Sprint(i) {
+				err = fmt.Errorf("unexpected output %q", result.Stdout)
+			}
+			errs <- err
+		}(i)
+	}
+	for i := 0; i < 5; i++ {
+		assert.Nil(t, <-errs)
+	}
+}
+
+func TestClientDial(t *testing.T) {
+	srv := newTestServer(t)
+	echoAddr := startEchoServer(t)
+	client := newTestClient(t, srv)
+
+	conn, err := client.Dial("tcp", echoAddr)
+	assert.Nil(t, err)
+	defer conn.Close()
+	fmt.Fprint(conn, "ping\n")
+	buf := make([]byte, 5)
+	_, err = io.ReadFull(conn, buf)
+	assert.Nil(t, err)
+	assert.Equal(t, "ping\n", string(buf))
+
+	_, err = GetClient(nil)
+	assert.NotNil(t, err)
+}
+
+// blockingReader never returns, like an interactive standard input
+type blockingReader struct{}
+
+func (blockingReader) Read(p []byte) (int, error) {
+	select {}
+}
+
+func TestVerifyLogin(t *testing.T) {
+	srv := newTestServer(t)
+	client := newTestClient(t, srv)
+
+	_, priv, err := ed25519.GenerateKey(rand.Reader)
+	assert.Nil(t, err)
+	signer, err := ssh.NewSignerFromKey(priv)
+	assert.Nil(t, err)
+
+	ok, err := VerifyLogin(client.(*SshSharedConfigManager), "", 0, "", signer)
+	assert.Nil(t, err)
+	assert.False(t, ok)
+
+	srv.mu.Lock()
+	srv.authorizedKeys[ssh.FingerprintSHA256(signer.PublicKey())] = true
+	srv.mu.Unlock()
+	ok, err = VerifyLogin(client.(*SshSharedConfigManager), "", 0, "", signer)
+	assert.Nil(t, err)
+	assert.True(t, ok)
+
+	ok, err = VerifyLogin(client.(*SshSharedConfigManager), "", 0, "other", signer)
+	assert.Nil(t, err)
+	assert.False(t, ok)
+
+	closed, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.Nil(t, err)
+	closed.Close()
+	_, port, _ := net.SplitHostPort(closed.Addr().String())
+	p, _ := strconv.Atoi(port)
+	_, err = VerifyLogin(client.(*SshSharedConfigManager), "127.0.0.1", p, "", signer)
+	assert.NotNil(t, err)
+}
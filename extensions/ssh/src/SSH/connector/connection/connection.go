@@ -4,9 +4,11 @@ import (
 	"encoding/base64"
 	"errors"
 	"fmt"
+	"net"
 	"os"
 	"path/filepath"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/project-flogo/core/data/coerce"
@@ -42,6 +44,30 @@ type Settings struct {
 	PrivateKeyPassword string `md:"privateKeyPassword,required"`
 	HostKeyCheck       bool   `md:"hostKeyFlag,required"`
 	KnownHostFile      string `md:"knownHostFile,required"`
+	LocalForwards      string `md:"localForwards"`
+	RemoteForwards     string `md:"remoteForwards"`
+	MaxClients         int    `md:"maxClients"`
+	ClientIdleTimeout  int    `md:"clientIdleTimeout"`
+	AuditFile          string `md:"auditFile"`
+	AuditMaxSize       int    `md:"auditMaxSize"`
+	AuditMaxBackups    int    `md:"auditMaxBackups"`
+	AuditMaskPatterns  string `md:"auditMaskPatterns"`
+	AllowedCommands    string `md:"allowedCommands"`
+	DeniedCommands     string `md:"deniedCommands"`
+	ForbidMetachars    bool   `md:"forbidMetacharacters"`
+	SSHConfig          string `md:"sshConfig"`
+	HostAlias          string `md:"hostAlias"`
+	ProxyJump          string `md:"proxyJump"`
+	ShutdownTimeout    int    `md:"shutdownTimeout"`
+	CircuitThreshold   int    `md:"circuitFailureThreshold"`
+	CircuitOpenPeriod  int    `md:"circuitOpenDuration"`
+	CircuitProbes      int    `md:"circuitHalfOpenProbes"`
+	SessionRateLimit   int    `md:"sessionRateLimit"`
+	SessionRateBurst   int    `md:"sessionRateBurst"`
+	MetricsAddress     string `md:"metricsAddress"`
+
+	// sshConfig is the parsed SSH config file, used to resolve ProxyJump hosts
+	sshConfig *sshConfigFile
 }
 
 // SshFactory structure
@@ -87,38 +113,137 @@ func (s *Settings) Validate() error {
 	if s.RetryInterval < 0 {
 		return errors.New("parameter 'Connection Retry Interval' cannot be negative")
 	}
+
+	if s.MaxClients < 0 {
+		return errors.New("parameter 'Max Host Override Clients' cannot be negative")
+	}
+
+	if s.ClientIdleTimeout < 0 {
+		return errors.New("parameter 'Host Override Idle Timeout' cannot be negative")
+	}
+
+	if s.ShutdownTimeout < 0 {
+		return errors.New("parameter 'Shutdown Timeout' cannot be negative")
+	}
+
+	if s.CircuitThreshold < 0 {
+		return errors.New("parameter 'Circuit Failure Threshold' cannot be negative")
+	}
+
+	if s.CircuitOpenPeriod < 0 {
+		return errors.New("parameter 'Circuit Open Duration' cannot be negative")
+	}
+
+	if s.CircuitProbes < 0 {
+		return errors.New("parameter 'Circuit Half-Open Probes' cannot be negative")
+	}
+
+	if s.SessionRateLimit < 0 {
+		return errors.New("parameter 'Session Rate Limit' cannot be negative")
+	}
+
+	if s.SessionRateBurst < 0 {
+		return errors.New("parameter 'Session Rate Burst' cannot be negative")
+	}
+
+	if s.MetricsAddress != "" {
+		if _, _, err := net.SplitHostPort(s.MetricsAddress); err != nil {
+			return fmt.Errorf("invalid parameter 'Metrics Endpoint': %s", err.Error())
+		}
+	}
+
+	if s.AuditMaxSize < 0 {
+		return errors.New("parameter 'Audit File Max Size' cannot be negative")
+	}
+
+	if s.AuditMaxBackups < 0 {
+		return errors.New("parameter 'Audit File Backups' cannot be negative")
+	}
+
+	if _, err := newCommandPolicy(s); err != nil {
+		return err
+	}
+
+	if _, err := parseForwardRules(s.LocalForwards); err != nil {
+		return fmt.Errorf("invalid parameter 'Local Forwards': %s", err.Error())
+	}
+
+	if _, err := parseForwardRules(s.RemoteForwards); err != nil {
+		return fmt.Errorf("invalid parameter 'Remote Forwards': %s", err.Error())
+	}
 	return nil
 }
 
 func (sharedConn *SshSharedConfigManager) Connect(s *Settings) error {
 	//2. Get ssh client config
+	config, err := clientConfig(s)
+	if err != nil {
+		return err
+	}
+
+	//3. form the host:port string
+	addr := fmt.Sprintf("%s:%d", s.Host, s.Port)
+
+	//4. Connect to server
+	sharedConn.mu.RLock()
+	reconnect := sharedConn.conn != nil
+	sharedConn.mu.RUnlock()
+	conn, err := dial(s, addr, config, config)
+	hostMetrics{connection: s.Name, host: addr}.connected(err, reconnect)
+	if err != nil {
+		return fmt.Errorf("failed to dial: %s", err.Error())
+	}
+
+	// Create an SSH session on top of the SSH connection
+	logCache.Debug("Creating new SSH session")
+	session, err := conn.NewSession()
+	if err != nil {
+		return fmt.Errorf("failed to create SSH session: %s", err.Error())
+	}
+
+	sharedConn.mu.Lock()
+	if sharedConn.stopped {
+		sharedConn.mu.Unlock()
+		session.Close()
+		conn.Close()
+		return errors.New("SSH connection is stopped")
+	}
+	sharedConn.connName = s.Name
+	//sharedConn.Settings = s
+	sharedConn.session = session
+	sharedConn.conn = conn
+	sharedConn.mu.Unlock()
+
+	go sharedConn.monitor(conn)
+
+	return nil
+}
+
+// clientConfig builds the client configuration of the connection settings. It is shared by
+// the connection and by the clients of host overrides, which only change the target address.
+func clientConfig(s *Settings) (*ssh.ClientConfig, error) {
 	var config ssh.ClientConfig
 	if s.PublicKeyAuth {
 		pemContentBytes, err := decodeFileSelectorContent(s.PrivateKey, "Private Key")
 		if err != nil {
-			return fmt.Errorf("error while decoding private key: %s", err.Error())
+			return nil, fmt.Errorf("error while decoding private key: %s", err.Error())
 		}
 
-		var signer ssh.Signer
-		if s.PrivateKeyPassword != "" {
-			// Parse private key with passphrash
-			signer, err = ssh.ParsePrivateKeyWithPassphrase(pemContentBytes, []byte(s.PrivateKeyPassword))
-		} else {
-			signer, err = ssh.ParsePrivateKey(pemContentBytes)
-		}
+		// OpenSSH, PEM and PuTTY keys are detected from the content
+		signer, err := ParsePrivateKey(pemContentBytes, s.PrivateKeyPassword)
 		if err != nil {
-			return fmt.Errorf("ssh parse private key failed: %s", err.Error())
+			return nil, fmt.Errorf("ssh parse private key failed: %s", err.Error())
 		}
 
 		if s.HostKeyCheck {
 			knownhostFileNames := filepath.Join("ssh", s.Name) // create a temp file with connection name under ssh folder
 			err := createTempFile(s.KnownHostFile, knownhostFileNames)
 			if err != nil {
-				return fmt.Errorf("error in creating temp host file : %s", err.Error())
+				return nil, fmt.Errorf("error in creating temp host file : %s", err.Error())
 			}
 			hostKeyCallback, err := knownhosts.New(knownhostFileNames)
 			if err != nil {
-				return fmt.Errorf("failed to create host key callback: %s", err.Error())
+				return nil, fmt.Errorf("failed to create host key callback: %s", err.Error())
 			}
 
 			config = ssh.ClientConfig{
@@ -144,11 +269,11 @@ func (sharedConn *SshSharedConfigManager) Connect(s *Settings) error {
 			knownhostFileNames := filepath.Join("ssh", s.Name) // create a temp file with connection name under ssh folder
 			err := createTempFile(s.KnownHostFile, knownhostFileNames)
 			if err != nil {
-				return fmt.Errorf("error in creating temp host file : %s", err.Error())
+				return nil, fmt.Errorf("error in creating temp host file : %s", err.Error())
 			}
 			hostKeyCallback, err := knownhosts.New(knownhostFileNames)
 			if err != nil {
-				return fmt.Errorf("failed to create host key callback: %s", err.Error())
+				return nil, fmt.Errorf("failed to create host key callback: %s", err.Error())
 			}
 
 			config = ssh.ClientConfig{
@@ -170,29 +295,7 @@ func (sharedConn *SshSharedConfigManager) Connect(s *Settings) error {
 			logCache.Infof("Connecting using User and Password without strict HostKey check.")
 		}
 	}
-
-	//3. form the host:port string
-	addr := fmt.Sprintf("%s:%d", s.Host, s.Port)
-
-	//4. Connect to server
-	conn, err := ssh.Dial("tcp", addr, &config)
-	if err != nil {
-		return fmt.Errorf("failed to dial: %s", err.Error())
-	}
-
-	// Create an SSH session on top of the SSH connection
-	logCache.Debug("Creating new SSH session")
-	session, err := conn.NewSession()
-	if err != nil {
-		return fmt.Errorf("failed to create SSH session: %s", err.Error())
-	}
-
-	sharedConn.connName = s.Name
-	//sharedConn.Settings = s
-	sharedConn.session = session
-	sharedConn.conn = conn
-
-	return nil
+	return &config, nil
 }
 
 // NewManager method of connection.ManagerFactory must be implemented by SshFactory
@@ -205,6 +308,12 @@ func (*SshFactory) NewManager(settings map[string]interface{}) (connection.Manag
 	if err != nil {
 		return nil, err
 	}
+
+	// the settings defined for the host alias in the SSH config file replace those of the connection
+	err = applySSHConfig(s)
+	if err != nil {
+		return nil, fmt.Errorf("ssh connection validation error: %s", err.Error())
+	}
 	//1. Validate connection
 	err = s.Validate()
 	if err != nil {
@@ -216,9 +325,43 @@ func (*SshFactory) NewManager(settings map[string]interface{}) (connection.Manag
 	}
 
 	sharedConn.Settings = s
+	sharedConn.audit, err = newAuditor(s)
+	if err != nil {
+		return nil, fmt.Errorf("ssh connection audit error: %s", err.Error())
+	}
+	sharedConn.policy, err = newCommandPolicy(s)
+	if err != nil {
+		sharedConn.audit.close()
+		return nil, err
+	}
+	if s.MetricsAddress != "" {
+		sharedConn.metrics, err = openMetricsServer(s.MetricsAddress)
+		if err != nil {
+			sharedConn.audit.close()
+			return nil, fmt.Errorf("ssh connection metrics error: %s", err.Error())
+		}
+	}
+	sharedConn.commands = newCommandTracker()
+	sharedConn.done = make(chan struct{})
+	guards := newHostGuards(s)
+	sharedConn.guard = guards.get(sharedConn.Host())
+	sharedConn.hosts = newHostPool(s, sharedConn.audit, sharedConn.policy, sharedConn.commands, guards)
 
 	err = sharedConn.Reconnect()
 	if err != nil {
+		sharedConn.audit.close()
+		if sharedConn.metrics != nil {
+			sharedConn.metrics.release()
+		}
+		return nil, err
+	}
+
+	err = sharedConn.startLocalForwards()
+	if err == nil {
+		err = sharedConn.startRemoteForwards()
+	}
+	if err != nil {
+		sharedConn.Stop()
 		return nil, err
 	}
 
@@ -227,10 +370,23 @@ func (*SshFactory) NewManager(settings map[string]interface{}) (connection.Manag
 
 // SshSharedConfigManager structure
 type SshSharedConfigManager struct {
-	connName string
-	Settings *Settings
-	session  *ssh.Session
-	conn     *ssh.Client
+	connName       string
+	Settings       *Settings
+	session        *ssh.Session
+	conn           *ssh.Client
+	mu             sync.RWMutex
+	stopped        bool
+	localForwards  []*localForward
+	remoteForwards []*remoteForward
+	remoteStats    []*tunnelStats
+	hosts          *hostPool
+	audit          *auditor
+	policy         *commandPolicy
+	commands       *commandTracker
+	guard          *hostGuard
+	metrics        *metricsServer
+	// done is closed on Stop, it ends the reconnect loop of a lost connection
+	done chan struct{}
 }
 
 // Type method of connection.Manager must be implemented by SshSharedConfigManager
@@ -240,6 +396,8 @@ func (s *SshSharedConfigManager) Type() string {
 
 // GetConnection method of connection.Manager must be implemented by SshSharedConfigManager
 func (s *SshSharedConfigManager) GetConnection() interface{} {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
 	return s.session
 }
 
@@ -262,8 +420,33 @@ func (s *SshSharedConfigManager) Start() error {
 }
 
 // Stop method would do business logic to stop the the shared resource. Closing db connection in this method.
+// New sessions are refused from then on, and running commands and open sessions get up to the shutdown
+// timeout to end.
 func (s *SshSharedConfigManager) Stop() error {
 	var errMsg string
+
+	s.drain()
+
+	s.mu.Lock()
+	if !s.stopped && s.done != nil {
+		close(s.done)
+	}
+	s.stopped = true
+	s.mu.Unlock()
+
+	s.stopLocalForwards()
+	s.closeRemoteListeners()
+	if s.hosts != nil {
+		s.hosts.close()
+	}
+	if s.audit != nil {
+		s.audit.close()
+	}
+	if s.metrics != nil {
+		s.metrics.release()
+		s.metrics = nil
+	}
+
 	logCache.Infof("Closing SSH session..")
 	if s.session != nil {
 		err := s.session.Close()
@@ -327,6 +510,63 @@ func (s *SshSharedConfigManager) Reconnect() error {
 	return nil
 }
 
+// client returns the current SSH client of the connection
+func (s *SshSharedConfigManager) client() (*ssh.Client, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if s.stopped {
+		return nil, errors.New("SSH connection is stopped")
+	}
+	if err := s.commands.check(); err != nil {
+		return nil, err
+	}
+	if s.conn == nil {
+		return nil, errors.New("SSH client is not connected")
+	}
+	return s.conn, nil
+}
+
+// maxReconnectDelay caps the wait between the reconnect rounds of a lost connection
+const maxReconnectDelay = time.Minute
+
+// monitor waits for the SSH client to be closed and reconnects
+// unless the connection was stopped or the client was already replaced.
+func (s *SshSharedConfigManager) monitor(conn *ssh.Client) {
+	err := conn.Wait()
+
+	s.mu.RLock()
+	current := s.conn == conn && !s.stopped
+	s.mu.RUnlock()
+	if !current {
+		return
+	}
+
+	logCache.Infof("SSH connection '%s' lost: %v. Reconnecting..", s.Settings.Name, err)
+	// the connection is retried until it is stopped, waiting longer after each failed round
+	delay := time.Duration(s.Settings.RetryInterval) * time.Second
+	if delay < time.Second {
+		delay = time.Second
+	}
+	for {
+		if err = s.Reconnect(); err == nil {
+			break
+		}
+		logCache.Errorf("Reconnect of SSH connection '%s' failed: %s. Retrying in %s", s.Settings.Name, err.Error(), delay)
+		select {
+		case <-s.done:
+			return
+		case <-time.After(delay):
+		}
+		if delay *= 2; delay > maxReconnectDelay {
+			delay = maxReconnectDelay
+		}
+	}
+
+	if err = s.startRemoteForwards(); err != nil {
+		logCache.Errorf("Failed to re-establish remote forwards of SSH connection '%s': %s", s.Settings.Name, err.Error())
+	}
+}
+
 func decodeFileSelectorContent(fieldVal string, field string) ([]byte, error) {
 	if fieldVal == "" {
 		return nil, fmt.Errorf("field '%s' is not configured", field)
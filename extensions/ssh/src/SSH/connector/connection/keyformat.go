@@ -0,0 +1,476 @@
+package connection
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/des"
+	"crypto/dsa"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/hmac"
+	"crypto/rsa"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"hash"
+	"math/big"
+	"strconv"
+	"strings"
+
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/pbkdf2"
+	"golang.org/x/crypto/scrypt"
+	"golang.org/x/crypto/ssh"
+)
+
+// ParsePrivateKey parses a private key and returns a signer for it. The format is detected
+// from the content: OpenSSH, PEM encoded PKCS#1, SEC 1 and PKCS#8 keys, plain or encrypted, and
+// PuTTY PPK v2 and v3 keys. The passphrase is ignored for keys that are not encrypted.
+func ParsePrivateKey(data []byte, passphrase string) (ssh.Signer, error) {
+	data = bytes.TrimSpace(data)
+	if bytes.HasPrefix(data, []byte("PuTTY-User-Key-File-")) {
+		return parsePPK(data, passphrase)
+	}
+
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, errors.New("unrecognized private key format, expected a PEM encoded, OpenSSH or PuTTY PPK key")
+	}
+	format := pemKeyFormat(block.Type)
+	if block.Type == "ENCRYPTED PRIVATE KEY" {
+		key, err := decryptPKCS8(block.Bytes, passphrase)
+		if err != nil {
+			return nil, fmt.Errorf("%s key: %s", format, err.Error())
+		}
+		return ssh.NewSignerFromKey(key)
+	}
+
+	signer, err := ssh.ParsePrivateKey(data)
+	if _, ok := err.(*ssh.PassphraseMissingError); ok {
+		if passphrase == "" {
+			return nil, fmt.Errorf("%s key is encrypted, a passphrase is required", format)
+		}
+		signer, err = ssh.ParsePrivateKeyWithPassphrase(data, []byte(passphrase))
+		if err == x509.IncorrectPasswordError {
+			return nil, fmt.Errorf("%s key: decryption failed, check the passphrase", format)
+		}
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%s key: %s", format, err.Error())
+	}
+	return signer, nil
+}
+
+// pemKeyFormat names the key format of a PEM block type in error messages
+func pemKeyFormat(blockType string) string {
+	switch blockType {
+	case "OPENSSH PRIVATE KEY":
+		return "OpenSSH"
+	case "RSA PRIVATE KEY":
+		return "PKCS#1 RSA"
+	case "EC PRIVATE KEY":
+		return "SEC 1 EC"
+	case "DSA PRIVATE KEY":
+		return "DSA"
+	case "PRIVATE KEY":
+		return "PKCS#8"
+	case "ENCRYPTED PRIVATE KEY":
+		return "encrypted PKCS#8"
+	}
+	return fmt.Sprintf("PEM '%s'", blockType)
+}
+
+// ppkFile holds the fields of a PuTTY private key file, see the PPK file format appendix of
+// the PuTTY documentation
+type ppkFile struct {
+	version    int
+	algorithm  string
+	encryption string
+	comment    string
+	headers    map[string]string
+	public     []byte
+	private    []byte
+	mac        []byte
+}
+
+// readPPK parses the headers and base64 encoded blobs of a PPK file
+func readPPK(data []byte) (*ppkFile, error) {
+	lines := strings.Split(strings.ReplaceAll(string(data), "\r\n", "\n"), "\n")
+	f := &ppkFile{headers: make(map[string]string)}
+	for i := 0; i < len(lines); i++ {
+		// values are not trimmed, as the comment is covered by the MAC
+		line := lines[i]
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+		idx := strings.Index(line, ":")
+		if idx < 0 {
+			return nil, fmt.Errorf("invalid line %d", i+1)
+		}
+		name, value := line[:idx], strings.TrimPrefix(line[idx+1:], " ")
+		switch name {
+		case "PuTTY-User-Key-File-2", "PuTTY-User-Key-File-3":
+			f.version, _ = strconv.Atoi(name[len(name)-1:])
+			f.algorithm = value
+		case "Public-Lines", "Private-Lines":
+			n, err := strconv.Atoi(value)
+			if err != nil || n < 0 || i+n >= len(lines) {
+				return nil, fmt.Errorf("invalid %s", name)
+			}
+			blob, err := base64.StdEncoding.DecodeString(strings.Join(trimLines(lines[i+1:i+1+n]), ""))
+			if err != nil {
+				return nil, fmt.Errorf("invalid base64 content of %s", name)
+			}
+			if name == "Public-Lines" {
+				f.public = blob
+			} else {
+				f.private = blob
+			}
+			i += n
+		case "Private-MAC":
+			mac, err := hex.DecodeString(value)
+			if err != nil {
+				return nil, errors.New("invalid Private-MAC")
+			}
+			f.mac = mac
+		default:
+			if strings.HasPrefix(name, "PuTTY-User-Key-File-") {
+				return nil, fmt.Errorf("unsupported file version '%s', only versions 2 and 3 are supported", name)
+			}
+			f.headers[name] = value
+		}
+	}
+	f.encryption, f.comment = f.headers["Encryption"], f.headers["Comment"]
+	if f.version == 0 || f.public == nil || f.private == nil || f.mac == nil {
+		return nil, errors.New("incomplete file")
+	}
+	return f, nil
+}
+
+func trimLines(lines []string) []string {
+	for i := range lines {
+		lines[i] = strings.TrimSpace(lines[i])
+	}
+	return lines
+}
+
+// parsePPK decrypts and verifies a PuTTY private key
+func parsePPK(data []byte, passphrase string) (ssh.Signer, error) {
+	f, err := readPPK(data)
+	if err != nil {
+		return nil, fmt.Errorf("PuTTY PPK key: %s", err.Error())
+	}
+	private, err := f.decrypt(passphrase)
+	if err != nil {
+		return nil, fmt.Errorf("PuTTY PPK v%d key: %s", f.version, err.Error())
+	}
+	key, err := ppkPrivateKey(f.algorithm, f.public, private)
+	if err != nil {
+		return nil, fmt.Errorf("PuTTY PPK v%d key: %s", f.version, err.Error())
+	}
+	return ssh.NewSignerFromKey(key)
+}
+
+// decrypt returns the private blob after checking the MAC of the file. Version 2 files derive
+// the keys from SHA-1 hashes of the passphrase and use HMAC-SHA-1, version 3 files derive them
+// with Argon2 and use HMAC-SHA-256.
+func (f *ppkFile) decrypt(passphrase string) ([]byte, error) {
+	encrypted := false
+	switch f.encryption {
+	case "none":
+		passphrase = ""
+	case "aes256-cbc":
+		encrypted = true
+		if passphrase == "" {
+			return nil, errors.New("key is encrypted, a passphrase is required")
+		}
+	default:
+		return nil, fmt.Errorf("unsupported encryption '%s'", f.encryption)
+	}
+
+	var cipherKey, iv, macKey []byte
+	var newHash func() hash.Hash
+	if f.version == 2 {
+		newHash = sha1.New
+		sum := sha1.Sum([]byte("putty-private-key-file-mac-key" + passphrase))
+		macKey = sum[:]
+		if encrypted {
+			k0 := sha1.Sum(append([]byte{0, 0, 0, 0}, passphrase...))
+			k1 := sha1.Sum(append([]byte{0, 0, 0, 1}, passphrase...))
+			cipherKey = append(k0[:], k1[:]...)[:32]
+			iv = make([]byte, aes.BlockSize)
+		}
+	} else {
+		newHash = sha256.New
+		if encrypted {
+			derived, err := f.argon2(passphrase)
+			if err != nil {
+				return nil, err
+			}
+			cipherKey, iv, macKey = derived[:32], derived[32:48], derived[48:]
+		}
+	}
+
+	private := f.private
+	if encrypted {
+		if len(private)%aes.BlockSize != 0 {
+			return nil, errors.New("invalid length of the encrypted private key")
+		}
+		block, err := aes.NewCipher(cipherKey)
+		if err != nil {
+			return nil, err
+		}
+		private = make([]byte, len(f.private))
+		cipher.NewCBCDecrypter(block, iv).CryptBlocks(private, f.private)
+	}
+
+	mac := hmac.New(newHash, macKey)
+	for _, field := range [][]byte{[]byte(f.algorithm), []byte(f.encryption), []byte(f.comment), f.public, private} {
+		binary.Write(mac, binary.BigEndian, uint32(len(field)))
+		mac.Write(field)
+	}
+	if !hmac.Equal(mac.Sum(nil), f.mac) {
+		if encrypted {
+			return nil, errors.New("MAC verification failed, check the passphrase")
+		}
+		return nil, errors.New("MAC verification failed, the file is corrupted")
+	}
+	return private, nil
+}
+
+// argon2 derives the 80 bytes of the AES key, IV and MAC key of a version 3 file
+func (f *ppkFile) argon2(passphrase string) ([]byte, error) {
+	memory, err1 := strconv.ParseUint(f.headers["Argon2-Memory"], 10, 32)
+	passes, err2 := strconv.ParseUint(f.headers["Argon2-Passes"], 10, 32)
+	parallelism, err3 := strconv.ParseUint(f.headers["Argon2-Parallelism"], 10, 8)
+	salt, err4 := hex.DecodeString(f.headers["Argon2-Salt"])
+	if err := errors.Join(err1, err2, err3, err4); err != nil {
+		return nil, fmt.Errorf("invalid Argon2 parameters: %s", err.Error())
+	}
+
+	switch kdf := f.headers["Key-Derivation"]; kdf {
+	case "Argon2id":
+		return argon2.IDKey([]byte(passphrase), salt, uint32(passes), uint32(memory), uint8(parallelism), 80), nil
+	case "Argon2i":
+		return argon2.Key([]byte(passphrase), salt, uint32(passes), uint32(memory), uint8(parallelism), 80), nil
+	default:
+		return nil, fmt.Errorf("unsupported key derivation '%s', expected Argon2id or Argon2i", kdf)
+	}
+}
+
+// ppkPrivateKey builds the private key from the public blob and the decrypted private blob.
+// The private blob may end with padding.
+func ppkPrivateKey(algorithm string, public, private []byte) (interface{}, error) {
+	pub, err := ssh.ParsePublicKey(public)
+	if err != nil {
+		return nil, fmt.Errorf("invalid public key: %s", err.Error())
+	}
+	if pub.Type() != algorithm {
+		return nil, fmt.Errorf("public key type '%s' does not match the key type '%s'", pub.Type(), algorithm)
+	}
+	cryptoPub := pub.(ssh.CryptoPublicKey).CryptoPublicKey()
+
+	mismatch := errors.New("private key does not match the public key")
+	switch pubKey := cryptoPub.(type) {
+	case *rsa.PublicKey:
+		var blob struct {
+			D, P, Q, Iqmp *big.Int
+			Rest          []byte `ssh:"rest"`
+		}
+		if err := ssh.Unmarshal(private, &blob); err != nil {
+			return nil, fmt.Errorf("invalid private key: %s", err.Error())
+		}
+		key := &rsa.PrivateKey{PublicKey: *pubKey, D: blob.D, Primes: []*big.Int{blob.P, blob.Q}}
+		if err := key.Validate(); err != nil {
+			return nil, mismatch
+		}
+		key.Precompute()
+		return key, nil
+	case *dsa.PublicKey:
+		var blob struct {
+			X    *big.Int
+			Rest []byte `ssh:"rest"`
+		}
+		if err := ssh.Unmarshal(private, &blob); err != nil {
+			return nil, fmt.Errorf("invalid private key: %s", err.Error())
+		}
+		if new(big.Int).Exp(pubKey.G, blob.X, pubKey.P).Cmp(pubKey.Y) != 0 {
+			return nil, mismatch
+		}
+		return &dsa.PrivateKey{PublicKey: *pubKey, X: blob.X}, nil
+	case *ecdsa.PublicKey:
+		var blob struct {
+			D    *big.Int
+			Rest []byte `ssh:"rest"`
+		}
+		if err := ssh.Unmarshal(private, &blob); err != nil {
+			return nil, fmt.Errorf("invalid private key: %s", err.Error())
+		}
+		key := &ecdsa.PrivateKey{PublicKey: *pubKey, D: blob.D}
+		ecdhKey, err := key.ECDH()
+		if err != nil {
+			return nil, mismatch
+		}
+		ecdhPub, err := pubKey.ECDH()
+		if err != nil || !ecdhKey.PublicKey().Equal(ecdhPub) {
+			return nil, mismatch
+		}
+		return key, nil
+	case ed25519.PublicKey:
+		var blob struct {
+			Seed []byte
+			Rest []byte `ssh:"rest"`
+		}
+		if err := ssh.Unmarshal(private, &blob); err != nil || len(blob.Seed) != ed25519.SeedSize {
+			return nil, errors.New("invalid private key")
+		}
+		key := ed25519.NewKeyFromSeed(blob.Seed)
+		if !pubKey.Equal(key.Public()) {
+			return nil, mismatch
+		}
+		return key, nil
+	}
+	return nil, fmt.Errorf("unsupported key type '%s'", algorithm)
+}
+
+var (
+	oidPBES2         = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 5, 13}
+	oidPBKDF2        = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 5, 12}
+	oidScrypt        = asn1.ObjectIdentifier{1, 3, 6, 1, 4, 1, 11591, 4, 11}
+	oidHMACWithSHA1  = asn1.ObjectIdentifier{1, 2, 840, 113549, 2, 7}
+	oidHMACWithSHA2s = map[string]func() hash.Hash{
+		"1.2.840.113549.2.8":  sha256.New224,
+		"1.2.840.113549.2.9":  sha256.New,
+		"1.2.840.113549.2.10": sha512.New384,
+		"1.2.840.113549.2.11": sha512.New,
+	}
+)
+
+// pkcs8Cipher is a block cipher of the PBES2 encryption scheme
+type pkcs8Cipher struct {
+	keySize  int
+	newBlock func(key []byte) (cipher.Block, error)
+}
+
+var pkcs8Ciphers = map[string]pkcs8Cipher{
+	"2.16.840.1.101.3.4.1.2":  {16, aes.NewCipher},
+	"2.16.840.1.101.3.4.1.22": {24, aes.NewCipher},
+	"2.16.840.1.101.3.4.1.42": {32, aes.NewCipher},
+	"1.2.840.113549.3.7":      {24, des.NewTripleDESCipher},
+}
+
+// encryptedPrivateKeyInfo, pbes2Params, pbkdf2Params and scryptParams are the ASN.1 structures
+// of RFC 5958, RFC 8018 and RFC 7914
+type encryptedPrivateKeyInfo struct {
+	Algorithm     pkix.AlgorithmIdentifier
+	EncryptedData []byte
+}
+
+type pbes2Params struct {
+	KeyDerivationFunc pkix.AlgorithmIdentifier
+	EncryptionScheme  pkix.AlgorithmIdentifier
+}
+
+type pbkdf2Params struct {
+	Salt           []byte
+	IterationCount int
+	KeyLength      int                      `asn1:"optional"`
+	PRF            pkix.AlgorithmIdentifier `asn1:"optional"`
+}
+
+type scryptParams struct {
+	Salt                     []byte
+	CostParameter            int
+	BlockSize                int
+	ParallelizationParameter int
+	KeyLength                int `asn1:"optional"`
+}
+
+// decryptPKCS8 decrypts a PBES2 encrypted PKCS#8 key, with a PBKDF2 or scrypt key derivation
+// and an AES-CBC or 3DES-CBC cipher
+func decryptPKCS8(der []byte, passphrase string) (interface{}, error) {
+	var info encryptedPrivateKeyInfo
+	if _, err := asn1.Unmarshal(der, &info); err != nil {
+		return nil, fmt.Errorf("invalid structure: %s", err.Error())
+	}
+	if !info.Algorithm.Algorithm.Equal(oidPBES2) {
+		return nil, fmt.Errorf("unsupported encryption scheme %s, only PBES2 is supported", info.Algorithm.Algorithm)
+	}
+	var params pbes2Params
+	if _, err := asn1.Unmarshal(info.Algorithm.Parameters.FullBytes, &params); err != nil {
+		return nil, fmt.Errorf("invalid PBES2 parameters: %s", err.Error())
+	}
+
+	scheme, ok := pkcs8Ciphers[params.EncryptionScheme.Algorithm.String()]
+	if !ok {
+		return nil, fmt.Errorf("unsupported cipher %s", params.EncryptionScheme.Algorithm)
+	}
+	var iv []byte
+	if _, err := asn1.Unmarshal(params.EncryptionScheme.Parameters.FullBytes, &iv); err != nil {
+		return nil, fmt.Errorf("invalid cipher parameters: %s", err.Error())
+	}
+	if passphrase == "" {
+		return nil, errors.New("key is encrypted, a passphrase is required")
+	}
+
+	key, err := pkcs8Key(params.KeyDerivationFunc, passphrase, scheme.keySize)
+	if err != nil {
+		return nil, err
+	}
+	block, err := scheme.newBlock(key)
+	if err != nil {
+		return nil, err
+	}
+	if len(iv) != block.BlockSize() || len(info.EncryptedData) == 0 || len(info.EncryptedData)%block.BlockSize() != 0 {
+		return nil, errors.New("invalid length of the encrypted data")
+	}
+	plain := make([]byte, len(info.EncryptedData))
+	cipher.NewCBCDecrypter(block, iv).CryptBlocks(plain, info.EncryptedData)
+
+	// a wrong passphrase almost always shows as invalid padding, otherwise as an invalid key
+	padding := int(plain[len(plain)-1])
+	if padding == 0 || padding > block.BlockSize() || !bytes.Equal(plain[len(plain)-padding:], bytes.Repeat([]byte{byte(padding)}, padding)) {
+		return nil, errors.New("decryption failed, check the passphrase")
+	}
+	privateKey, err := x509.ParsePKCS8PrivateKey(plain[:len(plain)-padding])
+	if err != nil {
+		return nil, errors.New("decryption failed, check the passphrase")
+	}
+	return privateKey, nil
+}
+
+// pkcs8Key derives the cipher key from the passphrase
+func pkcs8Key(kdf pkix.AlgorithmIdentifier, passphrase string, keySize int) ([]byte, error) {
+	switch {
+	case kdf.Algorithm.Equal(oidPBKDF2):
+		var params pbkdf2Params
+		if _, err := asn1.Unmarshal(kdf.Parameters.FullBytes, &params); err != nil {
+			return nil, fmt.Errorf("invalid PBKDF2 parameters: %s", err.Error())
+		}
+		prf := sha1.New
+		if len(params.PRF.Algorithm) > 0 && !params.PRF.Algorithm.Equal(oidHMACWithSHA1) {
+			var ok bool
+			if prf, ok = oidHMACWithSHA2s[params.PRF.Algorithm.String()]; !ok {
+				return nil, fmt.Errorf("unsupported PBKDF2 pseudorandom function %s", params.PRF.Algorithm)
+			}
+		}
+		return pbkdf2.Key([]byte(passphrase), params.Salt, params.IterationCount, keySize, prf), nil
+	case kdf.Algorithm.Equal(oidScrypt):
+		var params scryptParams
+		if _, err := asn1.Unmarshal(kdf.Parameters.FullBytes, &params); err != nil {
+			return nil, fmt.Errorf("invalid scrypt parameters: %s", err.Error())
+		}
+		return scrypt.Key([]byte(passphrase), params.Salt, params.CostParameter, params.BlockSize, params.ParallelizationParameter, keySize)
+	}
+	return nil, fmt.Errorf("unsupported key derivation function %s", kdf.Algorithm)
+}
@@ -0,0 +1,298 @@
+package connection
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Names of the metrics reported for each connection and host. All metrics have the labels
+// connection and host, MetricCommands also has the label exit_code.
+const (
+	MetricConnects        = "ssh_connects_total"
+	MetricConnectFailures = "ssh_connect_failures_total"
+	MetricAuthFailures    = "ssh_auth_failures_total"
+	MetricReconnects      = "ssh_reconnects_total"
+	MetricSessionsOpen    = "ssh_sessions_open"
+	MetricCommands        = "ssh_commands_total"
+	MetricCommandDuration = "ssh_command_duration_seconds"
+	MetricBytesReceived   = "ssh_received_bytes_total"
+	MetricBytesSent       = "ssh_sent_bytes_total"
+)
+
+// metricHelp describes the metrics in the Prometheus exposition
+var metricHelp = map[string]string{
+	MetricConnects:        "SSH clients connected and authenticated.",
+	MetricConnectFailures: "Failed attempts to connect SSH clients, including authentication failures.",
+	MetricAuthFailures:    "Attempts to connect SSH clients rejected by the authentication of the server.",
+	MetricReconnects:      "SSH clients connected again after the server closed them.",
+	MetricSessionsOpen:    "Sessions open on the SSH clients, including those of Client.Run and SFTP channels.",
+	MetricCommands:        "Commands run with Client.Run, by exit code. The exit code is -1 when the command could not be run.",
+	MetricCommandDuration: "Duration in seconds of the commands that ran to completion.",
+	MetricBytesReceived:   "Bytes received on the network connections of the SSH clients.",
+	MetricBytesSent:       "Bytes sent on the network connections of the SSH clients.",
+}
+
+// MetricsSink receives the metrics of all SSH connections. Its methods are called concurrently,
+// on the hot path of sessions and transfers, and should not block.
+type MetricsSink interface {
+	// AddCounter adds delta to a counter
+	AddCounter(name string, labels map[string]string, delta float64)
+	// AddGauge adds delta, which may be negative, to a gauge
+	AddGauge(name string, labels map[string]string, delta float64)
+	// Observe records a value in a histogram
+	Observe(name string, labels map[string]string, value float64)
+}
+
+var (
+	metricsSinksMu sync.RWMutex
+	// the Prometheus sink always collects, so that endpoints opened later expose the metrics of all connections
+	metricsSinks = []MetricsSink{prometheusMetrics}
+)
+
+// prometheusMetrics is exposed by the metrics endpoints of the connections
+var prometheusMetrics = NewPrometheusSink()
+
+// RegisterMetricsSink adds a sink for the metrics of all SSH connections, in addition to the
+// Prometheus metrics exposed by the metrics endpoints of the connections
+func RegisterMetricsSink(sink MetricsSink) {
+	metricsSinksMu.Lock()
+	defer metricsSinksMu.Unlock()
+	metricsSinks = append(metricsSinks, sink)
+}
+
+// MetricsHandler returns the handler of the Prometheus metrics of all SSH connections, so that
+// they can be served by an HTTP server of the application instead of a metrics endpoint
+func MetricsHandler() http.Handler {
+	return prometheusMetrics
+}
+
+// hostMetrics reports the metrics of one host of a connection
+type hostMetrics struct {
+	connection string
+	host       string
+}
+
+func (m hostMetrics) labels() map[string]string {
+	return map[string]string{"connection": m.connection, "host": m.host}
+}
+
+func (m hostMetrics) counter(name string, labels map[string]string, delta float64) {
+	metricsSinksMu.RLock()
+	defer metricsSinksMu.RUnlock()
+	for _, sink := range metricsSinks {
+		sink.AddCounter(name, labels, delta)
+	}
+}
+
+// connected records the outcome of an attempt to connect a client, reconnect is set when the
+// client was connected before
+func (m hostMetrics) connected(err error, reconnect bool) {
+	labels := m.labels()
+	if err != nil {
+		m.counter(MetricConnectFailures, labels, 1)
+		if strings.Contains(err.Error(), "unable to authenticate") {
+			m.counter(MetricAuthFailures, labels, 1)
+		}
+		return
+	}
+	m.counter(MetricConnects, labels, 1)
+	if reconnect {
+		m.counter(MetricReconnects, labels, 1)
+	}
+}
+
+// sessionOpen adds delta to the open sessions, including SFTP channels
+func (m hostMetrics) sessionOpen(delta float64) {
+	labels := m.labels()
+	metricsSinksMu.RLock()
+	defer metricsSinksMu.RUnlock()
+	for _, sink := range metricsSinks {
+		sink.AddGauge(MetricSessionsOpen, labels, delta)
+	}
+}
+
+// command records a command run with Client.Run
+func (m hostMetrics) command(result *RunResult, err error) {
+	exitCode := -1
+	if err == nil {
+		exitCode = result.ExitCode
+	}
+	labels := m.labels()
+	labels["exit_code"] = strconv.Itoa(exitCode)
+	m.counter(MetricCommands, labels, 1)
+	if err != nil {
+		return
+	}
+
+	labels = m.labels()
+	metricsSinksMu.RLock()
+	defer metricsSinksMu.RUnlock()
+	for _, sink := range metricsSinks {
+		sink.Observe(MetricCommandDuration, labels, result.Duration.Seconds())
+	}
+}
+
+// meteredFlushInterval is how often the bytes counted by the open network connections are
+// reported to the metrics sinks. The Prometheus endpoints also report them before each scrape.
+var meteredFlushInterval = 10 * time.Second
+
+var (
+	meteredConnsMu sync.Mutex
+	meteredConns   = make(map[*meteredConn]struct{})
+	// meteredFlushing is set while the periodic flush runs, it stops when no connection is open
+	meteredFlushing bool
+)
+
+// meteredConn counts the bytes of the network connection of an SSH client. The counts are kept in
+// the connection and reported to the metrics sinks by flush, so that reads and writes do not lock.
+type meteredConn struct {
+	net.Conn
+	metrics  hostMetrics
+	labels   map[string]string
+	received int64
+	sent     int64
+	once     sync.Once
+}
+
+func newMeteredConn(conn net.Conn, metrics hostMetrics) *meteredConn {
+	c := &meteredConn{Conn: conn, metrics: metrics, labels: metrics.labels()}
+	meteredConnsMu.Lock()
+	defer meteredConnsMu.Unlock()
+	meteredConns[c] = struct{}{}
+	if !meteredFlushing {
+		meteredFlushing = true
+		go flushMeteredConnsPeriodically()
+	}
+	return c
+}
+
+func (c *meteredConn) Read(p []byte) (int, error) {
+	n, err := c.Conn.Read(p)
+	if n > 0 {
+		atomic.AddInt64(&c.received, int64(n))
+	}
+	return n, err
+}
+
+func (c *meteredConn) Write(p []byte) (int, error) {
+	n, err := c.Conn.Write(p)
+	if n > 0 {
+		atomic.AddInt64(&c.sent, int64(n))
+	}
+	return n, err
+}
+
+// Close closes the network connection and reports the bytes counted since the last flush
+func (c *meteredConn) Close() error {
+	err := c.Conn.Close()
+	c.once.Do(func() {
+		meteredConnsMu.Lock()
+		delete(meteredConns, c)
+		meteredConnsMu.Unlock()
+		c.flush()
+	})
+	return err
+}
+
+// flush reports the bytes counted since the last flush
+func (c *meteredConn) flush() {
+	if n := atomic.SwapInt64(&c.received, 0); n > 0 {
+		c.metrics.counter(MetricBytesReceived, c.labels, float64(n))
+	}
+	if n := atomic.SwapInt64(&c.sent, 0); n > 0 {
+		c.metrics.counter(MetricBytesSent, c.labels, float64(n))
+	}
+}
+
+// flushMeteredConns reports the bytes counted by the open network connections
+func flushMeteredConns() {
+	meteredConnsMu.Lock()
+	conns := make([]*meteredConn, 0, len(meteredConns))
+	for c := range meteredConns {
+		conns = append(conns, c)
+	}
+	meteredConnsMu.Unlock()
+	for _, c := range conns {
+		c.flush()
+	}
+}
+
+// flushMeteredConnsPeriodically flushes the open network connections every meteredFlushInterval,
+// until none is open
+func flushMeteredConnsPeriodically() {
+	ticker := time.NewTicker(meteredFlushInterval)
+	defer ticker.Stop()
+	for range ticker.C {
+		flushMeteredConns()
+		meteredConnsMu.Lock()
+		if len(meteredConns) == 0 {
+			meteredFlushing = false
+			meteredConnsMu.Unlock()
+			return
+		}
+		meteredConnsMu.Unlock()
+	}
+}
+
+var (
+	metricsServersMu sync.Mutex
+	metricsServers   = make(map[string]*metricsServer)
+)
+
+// metricsServer serves the Prometheus metrics on /metrics. Connections configured with the
+// same address share one server.
+type metricsServer struct {
+	addr     string
+	refs     int
+	listener net.Listener
+	server   *http.Server
+}
+
+func openMetricsServer(addr string) (*metricsServer, error) {
+	metricsServersMu.Lock()
+	defer metricsServersMu.Unlock()
+	if server, ok := metricsServers[addr]; ok {
+		server.refs++
+		return server, nil
+	}
+
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open metrics endpoint: %s", err.Error())
+	}
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", prometheusMetrics)
+	server := &metricsServer{
+		addr:     addr,
+		refs:     1,
+		listener: listener,
+		server:   &http.Server{Handler: mux, ReadHeaderTimeout: 10 * time.Second},
+	}
+	go func() {
+		if err := server.server.Serve(listener); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			logCache.Errorf("Metrics endpoint %s failed: %s", addr, err.Error())
+		}
+	}()
+	metricsServers[addr] = server
+	logCache.Infof("Serving SSH metrics on http://%s/metrics", listener.Addr())
+	return server, nil
+}
+
+// release closes the server when the last connection using it is stopped
+func (m *metricsServer) release() {
+	metricsServersMu.Lock()
+	defer metricsServersMu.Unlock()
+	m.refs--
+	if m.refs > 0 {
+		return
+	}
+	delete(metricsServers, m.addr)
+	m.server.Close()
+}
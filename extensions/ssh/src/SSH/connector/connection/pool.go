@@ -0,0 +1,438 @@
+package connection
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/pkg/sftp"
+	"github.com/project-flogo/core/support/connection"
+	"golang.org/x/crypto/ssh"
+)
+
+const defaultMaxClients = 50
+
+// hostPool caches the SSH clients of host overrides. The clients share the authentication,
+// host key check and algorithm settings of the connection and only differ in the target address.
+type hostPool struct {
+	settings *Settings
+	audit    *auditor
+	policy   *commandPolicy
+	commands *commandTracker
+	guards   *hostGuards
+	mu       sync.Mutex
+	config   *ssh.ClientConfig
+	clients  map[string]*pooledClient
+	closed   bool
+	done     chan struct{}
+	evicting bool
+}
+
+func newHostPool(s *Settings, audit *auditor, policy *commandPolicy, commands *commandTracker, guards *hostGuards) *hostPool {
+	return &hostPool{settings: s, audit: audit, policy: policy, commands: commands, guards: guards, clients: make(map[string]*pooledClient), done: make(chan struct{})}
+}
+
+// GetHostClient returns the client of an SSH connection, or when host or port is set, a client
+// for that target using the credentials and host key policy of the connection.
+// An empty host keeps the host of the connection and port 0 keeps its port.
+func GetHostClient(conn connection.Manager, host string, port int) (Client, error) {
+	if host == "" && port == 0 {
+		return GetClient(conn)
+	}
+	sharedConn, ok := conn.(*SshSharedConfigManager)
+	if !ok {
+		return nil, fmt.Errorf("connection is not an SSH connection")
+	}
+	return sharedConn.ForHost(host, port)
+}
+
+// ForHost returns a client for host and port. Clients are created on demand, cached and closed
+// after the idle timeout of the connection. The connection itself is returned when the
+// target is the host and port of the connection.
+func (s *SshSharedConfigManager) ForHost(host string, port int) (Client, error) {
+	if host == "" {
+		host = s.Settings.Host
+	}
+	if port == 0 {
+		port = s.Settings.Port
+	}
+	if port < 0 || port > 65535 {
+		return nil, fmt.Errorf("invalid port %d", port)
+	}
+	if host == s.Settings.Host && port == s.Settings.Port {
+		return s, nil
+	}
+	if s.hosts == nil {
+		return nil, errors.New("SSH connection does not support host overrides")
+	}
+	return s.hosts.get(net.JoinHostPort(host, strconv.Itoa(port)))
+}
+
+// get returns the client of addr, making room for it in the pool. The client is not pinned: each of
+// its operations takes the pooled SSH client again, which is opened anew after an eviction.
+func (p *hostPool) get(addr string) (*hostClient, error) {
+	c, err := p.acquire(addr)
+	if err != nil {
+		return nil, err
+	}
+	p.release(c)
+	return c.handle, nil
+}
+
+// acquire returns the pooled client of addr, adding a new one when there is none, and pins it
+// until release is called. Clients are only evicted while they are not pinned.
+func (p *hostPool) acquire(addr string) (*pooledClient, error) {
+	p.mu.Lock()
+	if p.closed {
+		p.mu.Unlock()
+		return nil, errors.New("SSH connection is stopped")
+	}
+	c, ok := p.clients[addr]
+	var evicted *pooledClient
+	if !ok {
+		max := p.settings.MaxClients
+		if max == 0 {
+			max = defaultMaxClients
+		}
+		if len(p.clients) >= max {
+			for _, other := range p.clients {
+				if other.active == 0 && (evicted == nil || other.lastUsed.Before(evicted.lastUsed)) {
+					evicted = other
+				}
+			}
+			if evicted == nil {
+				p.mu.Unlock()
+				return nil, fmt.Errorf("maximum of %d host override clients of connection '%s' are in use", max, p.settings.Name)
+			}
+			logCache.Debugf("Closing least recently used SSH client of %s to open %s", evicted.addr, addr)
+			p.remove(evicted)
+		}
+
+		c = &pooledClient{addr: addr}
+		c.handle = &hostClient{pool: p, addr: addr, guard: p.guards.get(addr)}
+		p.clients[addr] = c
+
+		if !p.evicting && p.settings.ClientIdleTimeout > 0 {
+			p.evicting = true
+			go p.evictIdle(time.Duration(p.settings.ClientIdleTimeout) * time.Second)
+		}
+	}
+	c.active++
+	c.lastUsed = time.Now()
+	p.mu.Unlock()
+
+	// closing waits for the network connection, so it is done without holding the pool lock
+	if evicted != nil {
+		evicted.close()
+	}
+	return c, nil
+}
+
+// release unpins a client returned by acquire
+func (p *hostPool) release(c *pooledClient) {
+	p.mu.Lock()
+	c.active--
+	c.lastUsed = time.Now()
+	p.mu.Unlock()
+}
+
+// clientConfig returns the client configuration shared by all clients of the pool
+func (p *hostPool) clientConfig() (*ssh.ClientConfig, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.config == nil {
+		config, err := clientConfig(p.settings)
+		if err != nil {
+			return nil, err
+		}
+		p.config = config
+	}
+	return p.config, nil
+}
+
+// evictIdle periodically closes the clients that have not been used for timeout
+func (p *hostPool) evictIdle(timeout time.Duration) {
+	interval := timeout / 2
+	if interval < time.Second {
+		interval = time.Second
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-p.done:
+			return
+		case now := <-ticker.C:
+			var idle []*pooledClient
+			p.mu.Lock()
+			for _, c := range p.clients {
+				if c.active == 0 && now.Sub(c.lastUsed) >= timeout {
+					logCache.Debugf("Closing SSH client of %s, idle for %s", c.addr, now.Sub(c.lastUsed).Round(time.Second))
+					p.remove(c)
+					idle = append(idle, c)
+				}
+			}
+			p.mu.Unlock()
+			for _, c := range idle {
+				c.close()
+			}
+		}
+	}
+}
+
+// remove removes c from the pool, p.mu must be held. The caller closes c once p.mu is released.
+func (p *hostPool) remove(c *pooledClient) {
+	delete(p.clients, c.addr)
+}
+
+func (p *hostPool) close() {
+	p.mu.Lock()
+	if p.closed {
+		p.mu.Unlock()
+		return
+	}
+	p.closed = true
+	close(p.done)
+	clients := make([]*pooledClient, 0, len(p.clients))
+	for _, c := range p.clients {
+		p.remove(c)
+		clients = append(clients, c)
+	}
+	p.mu.Unlock()
+
+	for _, c := range clients {
+		c.close()
+	}
+}
+
+// pooledClient is the SSH client of a target cached by the pool. It dials on first use and again
+// after the SSH client was closed by the server.
+type pooledClient struct {
+	addr   string
+	handle *hostClient
+
+	// lastUsed and active are guarded by pool.mu
+	lastUsed time.Time
+	active   int
+
+	mu     sync.Mutex
+	conn   *ssh.Client
+	closed bool
+	// dialing is the dial in progress, which the other callers wait for
+	dialing *pendingDial
+	// dialed is set once the client connected, later dials are reconnects
+	dialed bool
+}
+
+// pendingDial is the outcome of a dial, available once done is closed
+type pendingDial struct {
+	done chan struct{}
+	conn *ssh.Client
+	err  error
+}
+
+// client returns the SSH client of c, dialing when it is not connected. The dial is done without
+// holding c.mu, callers that need the client meanwhile wait for its outcome.
+func (c *pooledClient) client(p *hostPool) (*ssh.Client, error) {
+	if err := p.commands.check(); err != nil {
+		return nil, err
+	}
+	config, err := p.clientConfig()
+	if err != nil {
+		return nil, err
+	}
+
+	c.mu.Lock()
+	if c.closed {
+		c.mu.Unlock()
+		return nil, fmt.Errorf("SSH client of %s is closed", c.addr)
+	}
+	if c.conn != nil {
+		conn := c.conn
+		c.mu.Unlock()
+		return conn, nil
+	}
+	if d := c.dialing; d != nil {
+		c.mu.Unlock()
+		<-d.done
+		return d.conn, d.err
+	}
+	d := &pendingDial{done: make(chan struct{})}
+	c.dialing = d
+	reconnect := c.dialed
+	c.mu.Unlock()
+
+	conn, err := dial(p.settings, c.addr, config, config)
+	hostMetrics{connection: p.settings.Name, host: c.addr}.connected(err, reconnect)
+
+	c.mu.Lock()
+	c.dialing = nil
+	switch {
+	case err != nil:
+		d.err = fmt.Errorf("failed to dial %s: %s", c.addr, err.Error())
+	case c.closed:
+		// evicted while dialing
+		conn.Close()
+		d.err = fmt.Errorf("SSH client of %s is closed", c.addr)
+	default:
+		logCache.Infof("Opened SSH client of %s for connection '%s'", c.addr, p.settings.Name)
+		c.conn = conn
+		c.dialed = true
+		d.conn = conn
+		go func() {
+			conn.Wait()
+			c.mu.Lock()
+			if c.conn == conn {
+				c.conn = nil
+			}
+			c.mu.Unlock()
+		}()
+	}
+	c.mu.Unlock()
+	close(d.done)
+	return d.conn, d.err
+}
+
+func (c *pooledClient) close() {
+	c.mu.Lock()
+	c.closed = true
+	conn := c.conn
+	c.conn = nil
+	c.mu.Unlock()
+	if conn != nil {
+		conn.Close()
+	}
+}
+
+// hostClient is the Client of a host override. Each operation pins the pooled SSH client of its
+// target, sessions, SFTP clients and forwarded connections until they are closed.
+type hostClient struct {
+	pool  *hostPool
+	addr  string
+	guard *hostGuard
+}
+
+var _ Client = (*hostClient)(nil)
+
+// Run implements Client.Run
+func (c *hostClient) Run(ctx context.Context, cmd string, opts *RunOptions) (*RunResult, error) {
+	start := time.Now()
+	result, err := c.run(ctx, cmd, opts)
+	c.pool.audit.record(ctx, c.addr, cmd, start, result, err)
+	c.metrics().command(result, err)
+	return result, err
+}
+
+func (c *hostClient) run(ctx context.Context, cmd string, opts *RunOptions) (*RunResult, error) {
+	if err := c.pool.policy.check(cmd); err != nil {
+		return nil, err
+	}
+	session, err := c.NewSession(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer session.Close()
+	c.pool.commands.update(session.id, kindCommand, cmd)
+	return runSession(ctx, session.Session, cmd, opts)
+}
+
+// NewSession implements Client.NewSession
+func (c *hostClient) NewSession(ctx context.Context) (*Session, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	id, err := c.pool.commands.begin(c.addr, kindSession, "")
+	if err != nil {
+		return nil, err
+	}
+	pooled, err := c.pool.acquire(c.addr)
+	if err != nil {
+		c.pool.commands.end(id)
+		return nil, err
+	}
+
+	generation, err := c.guard.acquire(ctx)
+	if err != nil {
+		c.pool.release(pooled)
+		c.pool.commands.end(id)
+		return nil, err
+	}
+	session, err := c.newSession(pooled)
+	c.guard.done(generation, err)
+	if err != nil {
+		c.pool.release(pooled)
+		c.pool.commands.end(id)
+		return nil, err
+	}
+	c.metrics().sessionOpen(1)
+	return wrapSession(ctx, session, c.addr, c.pool.audit, c.pool.policy, c.pool.commands, id, func() {
+		c.metrics().sessionOpen(-1)
+		c.pool.release(pooled)
+	}), nil
+}
+
+// newSession opens a session, dialing the host when it is not connected
+func (c *hostClient) newSession(pooled *pooledClient) (*ssh.Session, error) {
+	conn, err := pooled.client(c.pool)
+	if err != nil {
+		return nil, err
+	}
+	session, err := conn.NewSession()
+	if err != nil {
+		return nil, fmt.Errorf("failed to create SSH session: %s", err.Error())
+	}
+	return session, nil
+}
+
+// SFTP implements Client.SFTP
+func (c *hostClient) SFTP() (*sftp.Client, error) {
+	session, err := c.NewSession(context.Background())
+	if err != nil {
+		return nil, err
+	}
+	return openSFTP(session)
+}
+
+// Dial implements Client.Dial
+func (c *hostClient) Dial(network, addr string) (net.Conn, error) {
+	pooled, err := c.pool.acquire(c.addr)
+	if err != nil {
+		return nil, err
+	}
+	conn, err := pooled.client(c.pool)
+	if err == nil {
+		var forwarded net.Conn
+		if forwarded, err = conn.Dial(network, addr); err == nil {
+			return &pinnedConn{Conn: forwarded, release: func() { c.pool.release(pooled) }}, nil
+		}
+	}
+	c.pool.release(pooled)
+	return nil, err
+}
+
+func (c *hostClient) metrics() hostMetrics {
+	return hostMetrics{connection: c.pool.settings.Name, host: c.addr}
+}
+
+// Host implements Client.Host
+func (c *hostClient) Host() string {
+	return c.addr
+}
+
+// pinnedConn is a connection forwarded by a pooled client, which stays pinned until it is closed
+type pinnedConn struct {
+	net.Conn
+	once    sync.Once
+	release func()
+}
+
+func (c *pinnedConn) Close() error {
+	err := c.Conn.Close()
+	c.once.Do(c.release)
+	return err
+}
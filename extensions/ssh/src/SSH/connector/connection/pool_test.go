@@ -0,0 +1,141 @@
+package connection
+
+import (
+	"context"
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func newPoolManager(t *testing.T, srv *testServer, maxClients, idleTimeout int) *SshSharedConfigManager {
+	settings := srv.settings("pool")
+	settings["retryCount"] = 1
+	settings["retryInterval"] = 0
+	settings["maxClients"] = maxClients
+	settings["clientIdleTimeout"] = idleTimeout
+
+	manager, err := factory.NewManager(settings)
+	assert.Nil(t, err)
+	sharedConn := manager.(*SshSharedConfigManager)
+	t.Cleanup(func() { sharedConn.Stop() })
+	return sharedConn
+}
+
+func poolSize(s *SshSharedConfigManager) int {
+	s.hosts.mu.Lock()
+	defer s.hosts.mu.Unlock()
+	return len(s.hosts.clients)
+}
+
+func TestHostOverride(t *testing.T) {
+	srv := newTestServer(t)
+	other := newTestServer(t)
+	other.exec = func(cmd string, stdin io.Reader, stdout, stderr io.Writer) int {
+		io.WriteString(stdout, "other:"+cmd)
+		return 0
+	}
+	sharedConn := newPoolManager(t, srv, 0, 0)
+
+	// the target of the connection is served by the connection itself
+	client, err := GetHostClient(sharedConn, "127.0.0.1", srv.port())
+	assert.Nil(t, err)
+	assert.Equal(t, sharedConn, client)
+
+	client, err = GetHostClient(sharedConn, "", other.port())
+	assert.Nil(t, err)
+	assert.Equal(t, other.addr, client.Host())
+	result, err := client.Run(context.Background(), "hostname", nil)
+	assert.Nil(t, err)
+	assert.Equal(t, "other:hostname", string(result.Stdout))
+
+	again, err := GetHostClient(sharedConn, "127.0.0.1", other.port())
+	assert.Nil(t, err)
+	assert.True(t, client == again, "clients of the same target are cached")
+
+	// a client redials after the server dropped the connection
+	other.dropConnections()
+	assert.Eventually(t, func() bool {
+		result, err := client.Run(context.Background(), "uptime", nil)
+		return err == nil && string(result.Stdout) == "other:uptime"
+	}, 5*time.Second, 50*time.Millisecond)
+
+	_, err = GetHostClient(sharedConn, "", 70000)
+	assert.NotNil(t, err)
+
+	sharedConn.Stop()
+	_, err = client.Run(context.Background(), "uptime", nil)
+	assert.NotNil(t, err)
+	_, err = GetHostClient(sharedConn, "", other.port())
+	assert.NotNil(t, err)
+}
+
+func TestHostOverrideMaxClients(t *testing.T) {
+	srv := newTestServer(t)
+	first := newTestServer(t)
+	second := newTestServer(t)
+	first.exec = func(cmd string, stdin io.Reader, stdout, stderr io.Writer) int {
+		io.Copy(io.Discard, stdin)
+		return 0
+	}
+	sharedConn := newPoolManager(t, srv, 1, 0)
+
+	client, err := sharedConn.ForHost("", first.port())
+	assert.Nil(t, err)
+
+	// the only client is busy, so no other target can be opened
+	stdin, stdinWriter := io.Pipe()
+	done := make(chan error, 1)
+	go func() {
+		_, err := client.Run(context.Background(), "cat", &RunOptions{Stdin: stdin})
+		done <- err
+	}()
+	assert.Eventually(t, func() bool {
+		_, err := sharedConn.ForHost("", second.port())
+		return err != nil && strings.Contains(err.Error(), "maximum of 1")
+	}, 5*time.Second, 50*time.Millisecond)
+
+	stdinWriter.Close()
+	assert.Nil(t, <-done)
+
+	// once idle, the least recently used client is evicted, and opened again on its next use
+	_, err = sharedConn.ForHost("", second.port())
+	assert.Nil(t, err)
+	assert.Equal(t, 1, poolSize(sharedConn))
+	_, err = client.Run(context.Background(), "cat", nil)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, poolSize(sharedConn))
+
+	// an open session pins its client until it is closed
+	session, err := client.NewSession(context.Background())
+	assert.Nil(t, err)
+	_, err = sharedConn.ForHost("", second.port())
+	assert.NotNil(t, err)
+	assert.Nil(t, session.Close())
+	_, err = sharedConn.ForHost("", second.port())
+	assert.Nil(t, err)
+}
+
+func TestHostOverrideIdleEviction(t *testing.T) {
+	srv := newTestServer(t)
+	other := newTestServer(t)
+	sharedConn := newPoolManager(t, srv, 0, 1)
+
+	client, err := sharedConn.ForHost("", other.port())
+	assert.Nil(t, err)
+	_, err = client.Run(context.Background(), "uptime", nil)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, poolSize(sharedConn))
+
+	assert.Eventually(t, func() bool {
+		return poolSize(sharedConn) == 0
+	}, 5*time.Second, 100*time.Millisecond)
+
+	// a new client is opened on the next use
+	client, err = sharedConn.ForHost("", other.port())
+	assert.Nil(t, err)
+	_, err = client.Run(context.Background(), "uptime", nil)
+	assert.Nil(t, err)
+}
@@ -0,0 +1,183 @@
+package connection
+
+import (
+	"bufio"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// defaultBuckets are the upper bounds of the histogram buckets, in seconds for durations
+var defaultBuckets = []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30, 60, 120, 300}
+
+// PrometheusSink is a MetricsSink that keeps the metrics in memory and serves them in the
+// Prometheus text exposition format
+type PrometheusSink struct {
+	mu       sync.Mutex
+	families map[string]*metricFamily
+}
+
+var _ MetricsSink = (*PrometheusSink)(nil)
+
+// metricFamily holds the series of one metric, by their rendered labels
+type metricFamily struct {
+	kind   string
+	series map[string]*metricSeries
+}
+
+type metricSeries struct {
+	value float64
+	// buckets, sum and count are only used by histograms, buckets are not cumulative
+	buckets []uint64
+	sum     float64
+	count   uint64
+}
+
+// NewPrometheusSink returns an empty PrometheusSink
+func NewPrometheusSink() *PrometheusSink {
+	return &PrometheusSink{families: make(map[string]*metricFamily)}
+}
+
+// AddCounter implements MetricsSink.AddCounter
+func (p *PrometheusSink) AddCounter(name string, labels map[string]string, delta float64) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.series("counter", name, labels).value += delta
+}
+
+// AddGauge implements MetricsSink.AddGauge
+func (p *PrometheusSink) AddGauge(name string, labels map[string]string, delta float64) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.series("gauge", name, labels).value += delta
+}
+
+// Observe implements MetricsSink.Observe
+func (p *PrometheusSink) Observe(name string, labels map[string]string, value float64) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	s := p.series("histogram", name, labels)
+	if s.buckets == nil {
+		s.buckets = make([]uint64, len(defaultBuckets))
+	}
+	if i := sort.SearchFloat64s(defaultBuckets, value); i < len(defaultBuckets) {
+		s.buckets[i]++
+	}
+	s.sum += value
+	s.count++
+}
+
+// series returns the series of name with labels, p.mu must be held
+func (p *PrometheusSink) series(kind, name string, labels map[string]string) *metricSeries {
+	family, ok := p.families[name]
+	if !ok {
+		family = &metricFamily{kind: kind, series: make(map[string]*metricSeries)}
+		p.families[name] = family
+	}
+	key := formatLabels(labels)
+	s, ok := family.series[key]
+	if !ok {
+		s = &metricSeries{}
+		family.series[key] = s
+	}
+	return s
+}
+
+// ServeHTTP writes the metrics in the Prometheus text exposition format. The bytes counted by the
+// open network connections are reported first, so that the scrape includes them.
+func (p *PrometheusSink) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	flushMeteredConns()
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	out := bufio.NewWriter(w)
+	p.write(out)
+	out.Flush()
+}
+
+// write writes the metrics sorted by name and labels, so that the output is stable
+func (p *PrometheusSink) write(out *bufio.Writer) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	names := make([]string, 0, len(p.families))
+	for name := range p.families {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		family := p.families[name]
+		if help, ok := metricHelp[name]; ok {
+			out.WriteString("# HELP " + name + " " + help + "\n")
+		}
+		out.WriteString("# TYPE " + name + " " + family.kind + "\n")
+
+		keys := make([]string, 0, len(family.series))
+		for key := range family.series {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			s := family.series[key]
+			if family.kind != "histogram" {
+				out.WriteString(name + braces(key) + " " + formatValue(s.value) + "\n")
+				continue
+			}
+			var cumulative uint64
+			for i, bound := range defaultBuckets {
+				cumulative += s.buckets[i]
+				out.WriteString(name + "_bucket" + braces(joinLabels(key, `le="`+formatValue(bound)+`"`)) + " " + strconv.FormatUint(cumulative, 10) + "\n")
+			}
+			out.WriteString(name + "_bucket" + braces(joinLabels(key, `le="+Inf"`)) + " " + strconv.FormatUint(s.count, 10) + "\n")
+			out.WriteString(name + "_sum" + braces(key) + " " + formatValue(s.sum) + "\n")
+			out.WriteString(name + "_count" + braces(key) + " " + strconv.FormatUint(s.count, 10) + "\n")
+		}
+	}
+}
+
+// formatLabels renders labels sorted by name, without braces
+func formatLabels(labels map[string]string) string {
+	names := make([]string, 0, len(labels))
+	for name := range labels {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var b strings.Builder
+	for i, name := range names {
+		if i > 0 {
+			b.WriteByte(',')
+		}
+		b.WriteString(name)
+		b.WriteString(`="`)
+		b.WriteString(labelEscaper.Replace(labels[name]))
+		b.WriteByte('"')
+	}
+	return b.String()
+}
+
+// labelEscaper escapes label values as required by the exposition format
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+func joinLabels(labels, label string) string {
+	if labels == "" {
+		return label
+	}
+	return labels + "," + label
+}
+
+func braces(labels string) string {
+	if labels == "" {
+		return ""
+	}
+	return "{" + labels + "}"
+}
+
+func formatValue(v float64) string {
+	if math.IsInf(v, 1) {
+		return "+Inf"
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
@@ -0,0 +1,168 @@
+package connection
+
+import (
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// jumpHop is a jump host of a ProxyJump chain
+type jumpHop struct {
+	addr   string
+	config *ssh.ClientConfig
+}
+
+// jumpHops parses the ProxyJump setting, a comma separated list of [user@]host[:port] jump
+// hosts. Hosts are resolved in the SSH config file of the connection when there is one, so
+// they may be aliases with their own HostName, Port, User and IdentityFile. Jump hosts use the
+// host key check of base and authenticate with their identity file, if any, and the
+// authentication methods of base.
+func jumpHops(s *Settings, base *ssh.ClientConfig) ([]jumpHop, error) {
+	if strings.TrimSpace(s.ProxyJump) == "" {
+		return nil, nil
+	}
+
+	var hops []jumpHop
+	for _, spec := range strings.Split(s.ProxyJump, ",") {
+		spec = strings.TrimSpace(spec)
+		user, host, port := "", spec, 0
+		if i := strings.LastIndex(host, "@"); i >= 0 {
+			user, host = host[:i], host[i+1:]
+		}
+		if h, p, err := net.SplitHostPort(host); err == nil {
+			if port, err = strconv.Atoi(p); err != nil {
+				return nil, fmt.Errorf("invalid port in ProxyJump host '%s'", spec)
+			}
+			host = h
+		}
+		if host == "" {
+			return nil, fmt.Errorf("invalid ProxyJump host '%s'", spec)
+		}
+
+		config := *base
+		config.Auth = base.Auth
+		if s.sshConfig != nil {
+			options := s.sshConfig.resolve(host)
+			if p, ok := options["port"]; ok && port == 0 {
+				port, _ = strconv.Atoi(p)
+			}
+			if u, ok := options["user"]; ok && user == "" {
+				user = u
+			}
+			if identity, ok := options["identityfile"]; ok && !strings.EqualFold(identity, "none") {
+				signer, err := identitySigner(identity, s.PrivateKeyPassword)
+				if err != nil {
+					return nil, err
+				}
+				config.Auth = append([]ssh.AuthMethod{ssh.PublicKeys(signer)}, base.Auth...)
+			}
+			host = hostName(options, host)
+		}
+		if user != "" {
+			config.User = user
+		}
+		if port == 0 {
+			port = 22
+		}
+		hops = append(hops, jumpHop{addr: net.JoinHostPort(host, strconv.Itoa(port)), config: &config})
+	}
+	return hops, nil
+}
+
+// identitySigner reads a private key file referenced by the SSH config
+func identitySigner(p, passphrase string) (ssh.Signer, error) {
+	encoded, err := readConfigFile("IdentityFile", p)
+	if err != nil {
+		return nil, err
+	}
+	pem, err := decodeFileSelectorContent(encoded, "IdentityFile")
+	if err != nil {
+		return nil, err
+	}
+	signer, err := ParsePrivateKey(pem, passphrase)
+	if err != nil {
+		return nil, fmt.Errorf("ssh parse private key '%s' failed: %s", p, err.Error())
+	}
+	return signer, nil
+}
+
+// dial connects to addr with config. With a ProxyJump setting, the connection is tunneled
+// through the jump hosts, which use the host key check and authentication of base.
+// The jump host connections are closed when the returned client is closed.
+func dial(s *Settings, addr string, config, base *ssh.ClientConfig) (*ssh.Client, error) {
+	hops, err := jumpHops(s, base)
+	if err != nil {
+		return nil, err
+	}
+	metrics := hostMetrics{connection: s.Name, host: addr}
+	if len(hops) == 0 {
+		return dialMetered(addr, config, metrics)
+	}
+
+	var jumps []*ssh.Client
+	closeJumps := func() {
+		for i := len(jumps) - 1; i >= 0; i-- {
+			jumps[i].Close()
+		}
+	}
+
+	hops = append(hops, jumpHop{addr: addr, config: config})
+	for i, hop := range hops {
+		var client *ssh.Client
+		if i == 0 {
+			client, err = dialMetered(hop.addr, hop.config, metrics)
+		} else {
+			client, err = dialThrough(jumps[i-1], hop.addr, hop.config)
+		}
+		if err != nil {
+			closeJumps()
+			if i < len(hops)-1 {
+				return nil, fmt.Errorf("jump host %s: %s", hop.addr, err.Error())
+			}
+			return nil, err
+		}
+		jumps = append(jumps, client)
+	}
+
+	target := jumps[len(jumps)-1]
+	jumps = jumps[:len(jumps)-1]
+	logCache.Debugf("Connected to %s through %d jump hosts", addr, len(jumps))
+	go func() {
+		target.Wait()
+		closeJumps()
+	}()
+	return target, nil
+}
+
+// dialMetered opens an SSH client to addr, as ssh.Dial does, counting the bytes of the network
+// connection in the metrics of the target host
+func dialMetered(addr string, config *ssh.ClientConfig, metrics hostMetrics) (*ssh.Client, error) {
+	conn, err := net.DialTimeout("tcp", addr, config.Timeout)
+	if err != nil {
+		return nil, err
+	}
+	metered := newMeteredConn(conn, metrics)
+	c, chans, reqs, err := ssh.NewClientConn(metered, addr, config)
+	if err != nil {
+		metered.Close()
+		return nil, err
+	}
+	return ssh.NewClient(c, chans, reqs), nil
+}
+
+// dialThrough opens an SSH client to addr over a direct-tcpip channel of client
+func dialThrough(client *ssh.Client, addr string, config *ssh.ClientConfig) (*ssh.Client, error) {
+	conn, err := client.Dial("tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+	c, chans, reqs, err := ssh.NewClientConn(conn, addr, config)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return ssh.NewClient(c, chans, reqs), nil
+}
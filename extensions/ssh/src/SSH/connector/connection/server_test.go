@@ -0,0 +1,316 @@
+package connection
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"sync"
+	"testing"
+
+	"github.com/pkg/sftp"
+	"golang.org/x/crypto/ssh"
+)
+
+// testServer is a minimal in-process SSH server supporting exec sessions, direct-tcpip channels
+// and tcpip-forward requests
+type testServer struct {
+	addr     string
+	listener net.Listener
+	config   *ssh.ServerConfig
+	// exec handles "exec" requests and returns the exit status
+	exec func(cmd string, stdin io.Reader, stdout, stderr io.Writer) int
+	// dialTarget dials the target of direct-tcpip channels when set, instead of net.Dial
+	dialTarget func(addr string) (net.Conn, error)
+
+	mu    sync.Mutex
+	conns []*ssh.ServerConn
+	// authorizedKeys are the fingerprints of the public keys accepted for the user tester
+	authorizedKeys map[string]bool
+}
+
+func newTestServer(t *testing.T) *testServer {
+	_, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	signer, err := ssh.NewSignerFromKey(priv)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	srv := &testServer{authorizedKeys: make(map[string]bool)}
+	srv.config = &ssh.ServerConfig{
+		PasswordCallback: func(c ssh.ConnMetadata, pass []byte) (*ssh.Permissions, error) {
+			if c.User() == "tester" && string(pass) == "secret" {
+				return nil, nil
+			}
+			return nil, fmt.Errorf("password rejected for %s", c.User())
+		},
+		PublicKeyCallback: func(c ssh.ConnMetadata, key ssh.PublicKey) (*ssh.Permissions, error) {
+			srv.mu.Lock()
+			defer srv.mu.Unlock()
+			if c.User() == "tester" && srv.authorizedKeys[ssh.FingerprintSHA256(key)] {
+				return nil, nil
+			}
+			return nil, fmt.Errorf("public key rejected for %s", c.User())
+		},
+	}
+	srv.config.AddHostKey(signer)
+
+	srv.listener, err = net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv.addr = srv.listener.Addr().String()
+	srv.exec = func(cmd string, stdin io.Reader, stdout, stderr io.Writer) int {
+		fmt.Fprint(stdout, cmd)
+		return 0
+	}
+	go srv.serve(srv.listener)
+	t.Cleanup(srv.close)
+	return srv
+}
+
+func (srv *testServer) port() int {
+	_, port, _ := net.SplitHostPort(srv.addr)
+	p, _ := strconv.Atoi(port)
+	return p
+}
+
+// settings returns connection settings pointing at the test server
+func (srv *testServer) settings(name string) map[string]interface{} {
+	return map[string]interface{}{
+		"name":          name,
+		"host":          "127.0.0.1",
+		"port":          srv.port(),
+		"user":          "tester",
+		"password":      "secret",
+		"publicKeyFlag": false,
+		"hostKeyFlag":   false,
+	}
+}
+
+// dropConnections closes all server side connections to simulate a network failure
+func (srv *testServer) dropConnections() {
+	srv.mu.Lock()
+	defer srv.mu.Unlock()
+	for _, c := range srv.conns {
+		c.Close()
+	}
+	srv.conns = nil
+}
+
+func (srv *testServer) close() {
+	srv.listener.Close()
+	srv.dropConnections()
+}
+
+// restart listens again on the address of a closed server
+func (srv *testServer) restart(t *testing.T) {
+	listener, err := net.Listen("tcp", srv.addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv.listener = listener
+	go srv.serve(listener)
+}
+
+func (srv *testServer) serve(listener net.Listener) {
+	for {
+		nConn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		go srv.handle(nConn)
+	}
+}
+
+func (srv *testServer) handle(nConn net.Conn) {
+	conn, chans, reqs, err := ssh.NewServerConn(nConn, srv.config)
+	if err != nil {
+		nConn.Close()
+		return
+	}
+	srv.mu.Lock()
+	srv.conns = append(srv.conns, conn)
+	srv.mu.Unlock()
+
+	go handleGlobalRequests(conn, reqs)
+	for newChannel := range chans {
+		switch newChannel.ChannelType() {
+		case "session":
+			go srv.handleSession(newChannel)
+		case "direct-tcpip":
+			go srv.handleDirectTCPIP(newChannel)
+		default:
+			newChannel.Reject(ssh.UnknownChannelType, "unsupported channel type")
+		}
+	}
+}
+
+func (srv *testServer) handleSession(newChannel ssh.NewChannel) {
+	channel, requests, err := newChannel.Accept()
+	if err != nil {
+		return
+	}
+	defer channel.Close()
+
+	for req := range requests {
+		switch req.Type {
+		case "exec":
+			var payload struct{ Command string }
+			ssh.Unmarshal(req.Payload, &payload)
+			req.Reply(true, nil)
+			status := srv.exec(payload.Command, channel, channel, channel.Stderr())
+			channel.SendRequest("exit-status", false, ssh.Marshal(struct{ Status uint32 }{uint32(status)}))
+			return
+		case "subsystem":
+			var payload struct{ Name string }
+			ssh.Unmarshal(req.Payload, &payload)
+			req.Reply(payload.Name == "sftp", nil)
+			if payload.Name == "sftp" {
+				if server, err := sftp.NewServer(channel); err == nil {
+					server.Serve()
+				}
+				return
+			}
+		default:
+			req.Reply(req.Type == "env" || req.Type == "pty-req", nil)
+		}
+	}
+}
+
+func (srv *testServer) handleDirectTCPIP(newChannel ssh.NewChannel) {
+	var payload struct {
+		Host       string
+		Port       uint32
+		OriginHost string
+		OriginPort uint32
+	}
+	if err := ssh.Unmarshal(newChannel.ExtraData(), &payload); err != nil {
+		newChannel.Reject(ssh.ConnectionFailed, "invalid payload")
+		return
+	}
+
+	dialTarget := srv.dialTarget
+	if dialTarget == nil {
+		dialTarget = func(addr string) (net.Conn, error) { return net.Dial("tcp", addr) }
+	}
+	target, err := dialTarget(net.JoinHostPort(payload.Host, strconv.Itoa(int(payload.Port))))
+	if err != nil {
+		newChannel.Reject(ssh.ConnectionFailed, err.Error())
+		return
+	}
+	channel, requests, err := newChannel.Accept()
+	if err != nil {
+		target.Close()
+		return
+	}
+	go ssh.DiscardRequests(requests)
+
+	go func() {
+		io.Copy(channel, target)
+		channel.CloseWrite()
+	}()
+	io.Copy(target, channel)
+	target.Close()
+}
+
+// handleGlobalRequests serves tcpip-forward requests by listening on the server side
+// and opening a forwarded-tcpip channel for each accepted connection
+func handleGlobalRequests(conn *ssh.ServerConn, reqs <-chan *ssh.Request) {
+	listeners := map[string]net.Listener{}
+	defer func() {
+		for _, l := range listeners {
+			l.Close()
+		}
+	}()
+
+	for req := range reqs {
+		var payload struct {
+			Addr string
+			Port uint32
+		}
+		if req.Type != "tcpip-forward" && req.Type != "cancel-tcpip-forward" {
+			req.Reply(false, nil)
+			continue
+		}
+		ssh.Unmarshal(req.Payload, &payload)
+		key := net.JoinHostPort(payload.Addr, strconv.Itoa(int(payload.Port)))
+
+		if req.Type == "cancel-tcpip-forward" {
+			if l, ok := listeners[key]; ok {
+				l.Close()
+				delete(listeners, key)
+			}
+			req.Reply(true, nil)
+			continue
+		}
+
+		l, err := net.Listen("tcp", net.JoinHostPort("127.0.0.1", strconv.Itoa(int(payload.Port))))
+		if err != nil {
+			req.Reply(false, nil)
+			continue
+		}
+		port := uint32(l.Addr().(*net.TCPAddr).Port)
+		if payload.Port == 0 {
+			key = net.JoinHostPort(payload.Addr, strconv.Itoa(int(port)))
+		}
+		listeners[key] = l
+		req.Reply(true, ssh.Marshal(struct{ Port uint32 }{port}))
+
+		go func(addr string) {
+			for {
+				c, err := l.Accept()
+				if err != nil {
+					return
+				}
+				origin := c.RemoteAddr().(*net.TCPAddr)
+				channel, requests, err := conn.OpenChannel("forwarded-tcpip", ssh.Marshal(struct {
+					Addr       string
+					Port       uint32
+					OriginAddr string
+					OriginPort uint32
+				}{addr, port, origin.IP.String(), uint32(origin.Port)}))
+				if err != nil {
+					c.Close()
+					continue
+				}
+				go ssh.DiscardRequests(requests)
+				go func() {
+					io.Copy(channel, c)
+					channel.CloseWrite()
+				}()
+				go func() {
+					io.Copy(c, channel)
+					c.Close()
+				}()
+			}
+		}(payload.Addr)
+	}
+}
+
+// startEchoServer starts a TCP server that echoes what it receives
+func startEchoServer(t *testing.T) string {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { listener.Close() })
+	go func() {
+		for {
+			c, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				io.Copy(c, c)
+				c.Close()
+			}()
+		}
+	}()
+	return listener.Addr().String()
+}
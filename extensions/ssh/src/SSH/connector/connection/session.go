@@ -0,0 +1,240 @@
+package connection
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+
+	"github.com/pkg/sftp"
+	"golang.org/x/crypto/ssh"
+)
+
+// errSessionClosed is recorded for a command whose session was closed before it exited
+var errSessionClosed = errors.New("session closed before the command exited")
+
+// Session is a session opened by Client.NewSession. It is used like the ssh.Session it embeds,
+// and must be closed after use so that the client releases what it holds for the session. Stop
+// waits for open sessions to be closed, up to the shutdown timeout of the connection.
+// Commands started in the session are checked against the command policy of the connection, and
+// recorded in the audit trail when they exit. Subsystems and shells are recorded when the session
+// is closed.
+type Session struct {
+	*ssh.Session
+	ctx     context.Context
+	host    string
+	audit   *auditor
+	policy  *commandPolicy
+	once    sync.Once
+	release func()
+	// commands tracks the session under id until it is closed
+	commands *commandTracker
+	id       uint64
+
+	mu sync.Mutex
+	// started is the command, subsystem or shell of the session until it is recorded
+	started *startedCommand
+}
+
+// startedCommand is what runs in a session, closeErr is recorded when the session is closed first
+type startedCommand struct {
+	cmd      string
+	start    time.Time
+	closeErr error
+}
+
+func wrapSession(ctx context.Context, session *ssh.Session, host string, audit *auditor, policy *commandPolicy, commands *commandTracker, id uint64, release func()) *Session {
+	return &Session{Session: session, ctx: ctx, host: host, audit: audit, policy: policy, commands: commands, id: id, release: release}
+}
+
+// Start starts cmd in the session, as ssh.Session.Start does, unless the command policy rejects it
+func (s *Session) Start(cmd string) error {
+	start := time.Now()
+	if err := s.policy.check(cmd); err != nil {
+		s.record(&startedCommand{cmd: cmd, start: start}, nil, err)
+		return err
+	}
+	if err := s.Session.Start(cmd); err != nil {
+		s.record(&startedCommand{cmd: cmd, start: start}, nil, err)
+		return err
+	}
+	s.begin(kindCommand, &startedCommand{cmd: cmd, start: start, closeErr: errSessionClosed})
+	return nil
+}
+
+// Wait waits for the command or shell of the session to exit, as ssh.Session.Wait does
+func (s *Session) Wait() error {
+	err := s.Session.Wait()
+	if exitErr, ok := err.(*ssh.ExitError); ok {
+		s.end(&RunResult{ExitCode: exitErr.ExitStatus()}, nil)
+	} else {
+		s.end(&RunResult{}, err)
+	}
+	return err
+}
+
+// Run runs cmd in the session, as ssh.Session.Run does
+func (s *Session) Run(cmd string) error {
+	if err := s.Start(cmd); err != nil {
+		return err
+	}
+	return s.Wait()
+}
+
+// Output runs cmd in the session and returns its standard output, as ssh.Session.Output does
+func (s *Session) Output(cmd string) ([]byte, error) {
+	if s.Stdout != nil {
+		return nil, errors.New("ssh: Stdout already set")
+	}
+	var b bytes.Buffer
+	s.Stdout = &b
+	err := s.Run(cmd)
+	return b.Bytes(), err
+}
+
+// CombinedOutput runs cmd in the session and returns its standard output and standard error,
+// as ssh.Session.CombinedOutput does
+func (s *Session) CombinedOutput(cmd string) ([]byte, error) {
+	if s.Stdout != nil {
+		return nil, errors.New("ssh: Stdout already set")
+	}
+	if s.Stderr != nil {
+		return nil, errors.New("ssh: Stderr already set")
+	}
+	var b lockedBuffer
+	s.Stdout = &b
+	s.Stderr = &b
+	err := s.Run(cmd)
+	return b.Bytes(), err
+}
+
+// Shell starts a login shell in the session, as ssh.Session.Shell does
+func (s *Session) Shell() error {
+	start := time.Now()
+	if err := s.Session.Shell(); err != nil {
+		s.record(&startedCommand{cmd: "shell", start: start}, nil, err)
+		return err
+	}
+	s.begin(kindSession, &startedCommand{cmd: "shell", start: start})
+	return nil
+}
+
+// RequestSubsystem starts the subsystem name in the session, as ssh.Session.RequestSubsystem does
+func (s *Session) RequestSubsystem(name string) error {
+	start := time.Now()
+	cmd := "subsystem " + name
+	if err := s.Session.RequestSubsystem(name); err != nil {
+		s.record(&startedCommand{cmd: cmd, start: start}, nil, err)
+		return err
+	}
+	s.begin(kindSession, &startedCommand{cmd: cmd, start: start})
+	return nil
+}
+
+// Close closes the session
+func (s *Session) Close() error {
+	err := s.Session.Close()
+	s.mu.Lock()
+	started := s.started
+	s.mu.Unlock()
+	if started != nil {
+		if started.closeErr != nil {
+			s.end(nil, started.closeErr)
+		} else {
+			s.end(&RunResult{}, nil)
+		}
+	}
+	s.once.Do(func() {
+		s.commands.end(s.id)
+		if s.release != nil {
+			s.release()
+		}
+	})
+	return err
+}
+
+func (s *Session) begin(kind string, started *startedCommand) {
+	s.mu.Lock()
+	s.started = started
+	s.mu.Unlock()
+	s.commands.update(s.id, kind, started.cmd)
+}
+
+// end records what runs in the session, once
+func (s *Session) end(result *RunResult, err error) {
+	s.mu.Lock()
+	started := s.started
+	s.started = nil
+	s.mu.Unlock()
+	if started != nil {
+		s.record(started, result, err)
+		s.commands.update(s.id, kindSession, "")
+	}
+}
+
+func (s *Session) record(started *startedCommand, result *RunResult, err error) {
+	if s.audit != nil {
+		s.audit.record(s.ctx, s.host, started.cmd, started.start, result, err)
+	}
+}
+
+// lockedBuffer is written concurrently by the standard output and error of a command
+type lockedBuffer struct {
+	mu sync.Mutex
+	b  bytes.Buffer
+}
+
+func (b *lockedBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.b.Write(p)
+}
+
+func (b *lockedBuffer) Bytes() []byte {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.b.Bytes()
+}
+
+// sftpPipe is the standard input of the session of an SFTP client. The client closes it when it
+// is closed or loses the channel, which closes the session.
+type sftpPipe struct {
+	io.WriteCloser
+	session *Session
+}
+
+func (p *sftpPipe) Close() error {
+	err := p.WriteCloser.Close()
+	p.session.Close()
+	return err
+}
+
+// openSFTP starts the sftp subsystem in session and returns its client, which owns the session
+func openSFTP(session *Session) (*sftp.Client, error) {
+	client, err := startSFTP(session)
+	if err != nil {
+		session.Close()
+		return nil, fmt.Errorf("failed to open SFTP subsystem: %s", err.Error())
+	}
+	return client, nil
+}
+
+func startSFTP(session *Session) (*sftp.Client, error) {
+	// file transfers are not commands, the sftp subsystem is not audited
+	if err := session.Session.RequestSubsystem("sftp"); err != nil {
+		return nil, err
+	}
+	session.commands.update(session.id, kindSFTP, "")
+	stdin, err := session.StdinPipe()
+	if err != nil {
+		return nil, err
+	}
+	stdout, err := session.StdoutPipe()
+	if err != nil {
+		return nil, err
+	}
+	return sftp.NewClientPipe(stdout, &sftpPipe{WriteCloser: stdin, session: session})
+}
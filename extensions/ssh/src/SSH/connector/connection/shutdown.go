@@ -0,0 +1,168 @@
+package connection
+
+import (
+	"errors"
+	"sort"
+	"sync"
+	"time"
+)
+
+// errShuttingDown is returned for new commands and sessions while the connection is draining
+var errShuttingDown = errors.New("SSH connection is shutting down")
+
+// Kinds of the work tracked by commandTracker
+const (
+	kindCommand = "command"
+	kindSession = "session"
+	kindSFTP    = "SFTP channel"
+)
+
+// commandTracker tracks the commands running on the clients of a connection, and the sessions and
+// SFTP channels open on them, so that Stop can wait for them to finish before the clients are closed
+type commandTracker struct {
+	mu       sync.Mutex
+	draining bool
+	nextID   uint64
+	running  map[uint64]*runningCommand
+	// idle is closed when the last running command ends while draining
+	idle chan struct{}
+}
+
+// runningCommand is a command started by Client.Run or in a session, or a session or SFTP channel
+// open without a running command
+type runningCommand struct {
+	kind string
+	host string
+	// cmd is the command, or the shell or subsystem of a session, empty when nothing was started
+	cmd    string
+	opened time.Time
+	start  time.Time
+}
+
+func newCommandTracker() *commandTracker {
+	return &commandTracker{running: make(map[uint64]*runningCommand)}
+}
+
+// begin registers a command, session or SFTP channel and returns the id to pass to update and
+// end. It fails while draining.
+func (t *commandTracker) begin(host, kind, cmd string) (uint64, error) {
+	if t == nil {
+		return 0, nil
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.draining {
+		return 0, errShuttingDown
+	}
+	now := time.Now()
+	t.nextID++
+	t.running[t.nextID] = &runningCommand{kind: kind, host: host, cmd: cmd, opened: now, start: now}
+	return t.nextID, nil
+}
+
+// update records what now runs in a session, such as a command started in it
+func (t *commandTracker) update(id uint64, kind, cmd string) {
+	if t == nil {
+		return
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if c, ok := t.running[id]; ok {
+		c.kind = kind
+		c.cmd = cmd
+		c.start = time.Now()
+	}
+}
+
+func (t *commandTracker) end(id uint64) {
+	if t == nil {
+		return
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	delete(t.running, id)
+	if t.draining && len(t.running) == 0 && t.idle != nil {
+		close(t.idle)
+		t.idle = nil
+	}
+}
+
+// check returns an error while draining, new sessions are refused from then on
+func (t *commandTracker) check() error {
+	if t == nil {
+		return nil
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.draining {
+		return errShuttingDown
+	}
+	return nil
+}
+
+// drain refuses new commands and sessions, then waits up to timeout for the running commands to
+// finish and the open sessions and SFTP channels to be closed. It returns those still running,
+// the oldest first.
+func (t *commandTracker) drain(timeout time.Duration) []*runningCommand {
+	t.mu.Lock()
+	t.draining = true
+	if len(t.running) > 0 && timeout > 0 {
+		if t.idle == nil {
+			t.idle = make(chan struct{})
+		}
+		idle := t.idle
+		t.mu.Unlock()
+
+		timer := time.NewTimer(timeout)
+		select {
+		case <-idle:
+		case <-timer.C:
+		}
+		timer.Stop()
+		t.mu.Lock()
+	}
+	defer t.mu.Unlock()
+
+	remaining := make([]*runningCommand, 0, len(t.running))
+	for _, c := range t.running {
+		remaining = append(remaining, c)
+	}
+	sort.Slice(remaining, func(i, j int) bool { return remaining[i].opened.Before(remaining[j].opened) })
+	return remaining
+}
+
+// count returns the number of running commands, open sessions and SFTP channels
+func (t *commandTracker) count() int {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return len(t.running)
+}
+
+// drain waits up to the shutdown timeout of the connection for the running commands and the open
+// sessions and SFTP channels, and logs those still running when the clients are closed
+func (s *SshSharedConfigManager) drain() {
+	if s.commands == nil {
+		return
+	}
+	timeout := time.Duration(s.Settings.ShutdownTimeout) * time.Second
+	if n := s.commands.count(); n > 0 && timeout > 0 {
+		logCache.Infof("Waiting up to %s for %d running commands and open sessions of SSH connection '%s'", timeout, n, s.Settings.Name)
+	}
+	for _, c := range s.commands.drain(timeout) {
+		cmd := c.cmd
+		if s.audit != nil {
+			cmd = s.audit.mask(cmd)
+		}
+		if c.kind == kindCommand {
+			logCache.Warnf("Closing SSH connection '%s' while command '%s' on %s is still running, started %s ago",
+				s.Settings.Name, cmd, c.host, time.Since(c.start).Round(time.Millisecond))
+			continue
+		}
+		what := c.kind
+		if cmd != "" {
+			what += " of '" + cmd + "'"
+		}
+		logCache.Warnf("Closing SSH connection '%s' while %s on %s is still open, opened %s ago",
+			s.Settings.Name, what, c.host, time.Since(c.opened).Round(time.Millisecond))
+	}
+}
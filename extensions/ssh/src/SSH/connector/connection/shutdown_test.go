@@ -0,0 +1,175 @@
+package connection
+
+import (
+	"context"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func newShutdownManager(t *testing.T, srv *testServer, shutdownTimeout int) *SshSharedConfigManager {
+	settings := srv.settings("shutdown")
+	settings["retryCount"] = 1
+	settings["retryInterval"] = 0
+	settings["shutdownTimeout"] = shutdownTimeout
+
+	manager, err := factory.NewManager(settings)
+	assert.Nil(t, err)
+	return manager.(*SshSharedConfigManager)
+}
+
+func TestShutdownDrain(t *testing.T) {
+	release := make(chan struct{})
+	srv := newTestServer(t)
+	srv.exec = func(cmd string, stdin io.Reader, stdout, stderr io.Writer) int {
+		<-release
+		io.WriteString(stdout, "done")
+		return 0
+	}
+	other := newTestServer(t)
+	other.exec = srv.exec
+	sharedConn := newShutdownManager(t, srv, 10)
+	overrideClient, err := GetHostClient(sharedConn, "", other.port())
+	assert.Nil(t, err)
+
+	results := make(chan *RunResult, 2)
+	for _, client := range []Client{sharedConn, overrideClient} {
+		go func(client Client) {
+			result, err := client.Run(context.Background(), "backup.sh", nil)
+			assert.Nil(t, err)
+			results <- result
+		}(client)
+	}
+	assert.Eventually(t, func() bool { return sharedConn.commands.count() == 2 }, 5*time.Second, 10*time.Millisecond)
+
+	stopped := make(chan error)
+	go func() { stopped <- sharedConn.Stop() }()
+
+	// new commands and sessions are refused while draining
+	assert.Eventually(t, func() bool { return sharedConn.commands.check() != nil }, 5*time.Second, 10*time.Millisecond)
+	_, err = sharedConn.Run(context.Background(), "hostname", nil)
+	assert.Equal(t, errShuttingDown, err)
+	_, err = overrideClient.NewSession(context.Background())
+	assert.Equal(t, errShuttingDown, err)
+	_, err = sharedConn.SFTP()
+	assert.Equal(t, errShuttingDown, err)
+
+	// the running commands finish before the clients are closed
+	select {
+	case <-stopped:
+		t.Fatal("Stop returned before the running commands finished")
+	case <-time.After(100 * time.Millisecond):
+	}
+	close(release)
+	for i := 0; i < 2; i++ {
+		result := <-results
+		if assert.NotNil(t, result) {
+			assert.Equal(t, "done", string(result.Stdout))
+		}
+	}
+	select {
+	case err = <-stopped:
+		assert.Nil(t, err)
+	case <-time.After(5 * time.Second):
+		t.Fatal("Stop did not return after the running commands finished")
+	}
+}
+
+func TestShutdownTimeout(t *testing.T) {
+	srv := newTestServer(t)
+	srv.exec = func(cmd string, stdin io.Reader, stdout, stderr io.Writer) int {
+		// blocks until the session is closed
+		io.Copy(io.Discard, stdin)
+		return 0
+	}
+	sharedConn := newShutdownManager(t, srv, 1)
+
+	failed := make(chan error)
+	go func() {
+		_, err := sharedConn.Run(context.Background(), "tail -f app.log", &RunOptions{Stdin: blockingReader{}})
+		failed <- err
+	}()
+	assert.Eventually(t, func() bool { return sharedConn.commands.count() == 1 }, 5*time.Second, 10*time.Millisecond)
+
+	start := time.Now()
+	assert.Nil(t, sharedConn.Stop())
+	assert.GreaterOrEqual(t, time.Since(start), time.Second)
+	select {
+	case err := <-failed:
+		assert.NotNil(t, err)
+	case <-time.After(5 * time.Second):
+		t.Fatal("the running command was not interrupted by Stop")
+	}
+}
+
+func TestShutdownSessions(t *testing.T) {
+	srv := newTestServer(t)
+	other := newTestServer(t)
+	sharedConn := newShutdownManager(t, srv, 10)
+	overrideClient, err := GetHostClient(sharedConn, "", other.port())
+	assert.Nil(t, err)
+
+	// sessions and SFTP channels are tracked until they are closed
+	session, err := overrideClient.NewSession(context.Background())
+	assert.Nil(t, err)
+	sftpClient, err := sharedConn.SFTP()
+	assert.Nil(t, err)
+	_, err = sftpClient.Getwd()
+	assert.Nil(t, err)
+	assert.Equal(t, 2, sharedConn.commands.count())
+	sharedConn.commands.mu.Lock()
+	kinds := map[string]bool{}
+	for _, c := range sharedConn.commands.running {
+		kinds[c.kind] = true
+	}
+	sharedConn.commands.mu.Unlock()
+	assert.Equal(t, map[string]bool{kindSession: true, kindSFTP: true}, kinds)
+
+	stopped := make(chan error)
+	go func() { stopped <- sharedConn.Stop() }()
+	select {
+	case <-stopped:
+		t.Fatal("Stop returned before the session and the SFTP channel were closed")
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	assert.Nil(t, session.Close())
+	assert.Nil(t, sftpClient.Close())
+	select {
+	case err = <-stopped:
+		assert.Nil(t, err)
+	case <-time.After(5 * time.Second):
+		t.Fatal("Stop did not return after the session and the SFTP channel were closed")
+	}
+	assert.Equal(t, 0, sharedConn.commands.count())
+}
+
+func TestCommandTracker(t *testing.T) {
+	tracker := newCommandTracker()
+	first, err := tracker.begin("db1:22", kindCommand, "pg_dump app")
+	assert.Nil(t, err)
+	second, err := tracker.begin("db2:22", kindSession, "")
+	assert.Nil(t, err)
+	tracker.update(second, kindCommand, "pg_dump app")
+	assert.Nil(t, err)
+	tracker.end(first)
+
+	remaining := tracker.drain(10 * time.Millisecond)
+	if assert.Len(t, remaining, 1) {
+		assert.Equal(t, "db2:22", remaining[0].host)
+		assert.Equal(t, kindCommand, remaining[0].kind)
+		assert.Equal(t, "pg_dump app", remaining[0].cmd)
+	}
+	_, err = tracker.begin("db1:22", kindCommand, "uptime")
+	assert.Equal(t, errShuttingDown, err)
+	tracker.end(second)
+	assert.Empty(t, tracker.drain(0))
+
+	// a connection without running commands stops immediately
+	tracker = newCommandTracker()
+	start := time.Now()
+	assert.Empty(t, tracker.drain(time.Minute))
+	assert.Less(t, time.Since(start), time.Second)
+}
@@ -0,0 +1,267 @@
+package connection
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// sshConfigFile is a parsed OpenSSH client configuration, see ssh_config(5)
+type sshConfigFile struct {
+	blocks []*sshConfigBlock
+}
+
+// sshConfigBlock holds the options of a Host block in file order. Options before the first
+// Host line, and those of a Match all block, apply to every host.
+type sshConfigBlock struct {
+	patterns []string
+	all      bool
+	options  [][2]string
+}
+
+func (b *sshConfigBlock) matches(host string) bool {
+	if b.all {
+		return true
+	}
+	matched := false
+	for _, pattern := range b.patterns {
+		if strings.HasPrefix(pattern, "!") {
+			// a matching negated pattern excludes the host regardless of the other patterns
+			if matchPattern(strings.ToLower(pattern[1:]), host) {
+				return false
+			}
+			continue
+		}
+		if matchPattern(strings.ToLower(pattern), host) {
+			matched = true
+		}
+	}
+	return matched
+}
+
+// matchPattern matches host against a pattern where * matches any sequence of characters
+// and ? matches exactly one character
+func matchPattern(pattern, host string) bool {
+	for len(pattern) > 0 {
+		switch pattern[0] {
+		case '*':
+			for i := len(host); i >= 0; i-- {
+				if matchPattern(pattern[1:], host[i:]) {
+					return true
+				}
+			}
+			return false
+		case '?':
+			if host == "" {
+				return false
+			}
+		default:
+			if host == "" || host[0] != pattern[0] {
+				return false
+			}
+		}
+		pattern, host = pattern[1:], host[1:]
+	}
+	return host == ""
+}
+
+// parseSSHConfig parses the keywords and arguments of an ssh_config file. Keywords are
+// case-insensitive and may be separated from their arguments by spaces or an equal sign.
+// Include directives and Match blocks other than Match all are skipped.
+func parseSSHConfig(data []byte) (*sshConfigFile, error) {
+	current := &sshConfigBlock{all: true}
+	cfg := &sshConfigFile{blocks: []*sshConfigBlock{current}}
+
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	lineNo := 0
+	for scanner.Scan() {
+		lineNo++
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		keyword, args := line, ""
+		if i := strings.IndexAny(line, " \t="); i >= 0 {
+			keyword = line[:i]
+			args = strings.TrimSpace(line[i:])
+			args = strings.TrimSpace(strings.TrimPrefix(args, "="))
+		}
+		keyword = strings.ToLower(keyword)
+		values, err := splitConfigArgs(args)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %s", lineNo, err.Error())
+		}
+
+		switch keyword {
+		case "host":
+			if len(values) == 0 {
+				return nil, fmt.Errorf("line %d: Host without patterns", lineNo)
+			}
+			current = &sshConfigBlock{patterns: values}
+			cfg.blocks = append(cfg.blocks, current)
+		case "match":
+			current = &sshConfigBlock{all: len(values) == 1 && strings.EqualFold(values[0], "all")}
+			if !current.all {
+				logCache.Debugf("SSH config line %d: only 'Match all' is supported, block is ignored", lineNo)
+				// no patterns, so the block never matches
+			}
+			cfg.blocks = append(cfg.blocks, current)
+		case "include":
+			logCache.Debugf("SSH config line %d: Include is not supported and is ignored", lineNo)
+		default:
+			if len(values) == 0 {
+				return nil, fmt.Errorf("line %d: missing argument for %s", lineNo, keyword)
+			}
+			current.options = append(current.options, [2]string{keyword, strings.Join(values, " ")})
+		}
+	}
+	return cfg, scanner.Err()
+}
+
+// splitConfigArgs splits arguments at whitespace, keeping double quoted arguments together
+func splitConfigArgs(args string) ([]string, error) {
+	var values []string
+	for args != "" {
+		if args[0] == '"' {
+			end := strings.IndexByte(args[1:], '"')
+			if end < 0 {
+				return nil, fmt.Errorf("unterminated quote")
+			}
+			values = append(values, args[1:end+1])
+			args = strings.TrimSpace(args[end+2:])
+			continue
+		}
+		end := strings.IndexAny(args, " \t")
+		if end < 0 {
+			end = len(args)
+		}
+		values = append(values, args[:end])
+		args = strings.TrimSpace(args[end:])
+	}
+	return values, nil
+}
+
+// resolve returns the effective options of host. As with OpenSSH, the first value obtained
+// for each keyword is used, so specific Host blocks belong before general ones.
+func (c *sshConfigFile) resolve(host string) map[string]string {
+	options := make(map[string]string)
+	lower := strings.ToLower(host)
+	for _, block := range c.blocks {
+		if !block.matches(lower) {
+			continue
+		}
+		for _, option := range block.options {
+			if _, ok := options[option[0]]; !ok {
+				options[option[0]] = option[1]
+			}
+		}
+	}
+	return options
+}
+
+// hostName returns the HostName of alias with %h replaced by the alias, or the alias itself
+func hostName(options map[string]string, alias string) string {
+	name, ok := options["hostname"]
+	if !ok {
+		return alias
+	}
+	name = strings.ReplaceAll(name, "%%", "\x00")
+	name = strings.ReplaceAll(name, "%h", alias)
+	return strings.ReplaceAll(name, "\x00", "%")
+}
+
+// expandHome replaces a leading ~ with the home directory of the user running the application
+func expandHome(p string) string {
+	if p == "~" || strings.HasPrefix(p, "~/") {
+		if home, err := os.UserHomeDir(); err == nil {
+			return filepath.Join(home, p[1:])
+		}
+	}
+	return p
+}
+
+// readConfigFile returns the base64 encoded content of a file referenced by the SSH config,
+// the encoding used by the file selector fields of the connection
+func readConfigFile(keyword, p string) (string, error) {
+	data, err := os.ReadFile(expandHome(p))
+	if err != nil {
+		return "", fmt.Errorf("cannot read %s '%s': %s", keyword, p, err.Error())
+	}
+	return base64.StdEncoding.EncodeToString(data), nil
+}
+
+// applySSHConfig resolves the host alias in the SSH config file of the connection and
+// replaces the settings that the config file defines
+func applySSHConfig(s *Settings) error {
+	if s.SSHConfig == "" {
+		return nil
+	}
+	data, err := decodeFileSelectorContent(s.SSHConfig, "SSH Config File")
+	if err != nil {
+		return err
+	}
+	cfg, err := parseSSHConfig(data)
+	if err != nil {
+		return fmt.Errorf("invalid SSH config file: %s", err.Error())
+	}
+	s.sshConfig = cfg
+
+	alias := s.HostAlias
+	if alias == "" {
+		alias = s.Host
+	}
+	if alias == "" {
+		return fmt.Errorf("required parameter 'Host Alias' not specified")
+	}
+	options := cfg.resolve(alias)
+
+	s.Host = hostName(options, alias)
+	if port, ok := options["port"]; ok {
+		if s.Port, err = strconv.Atoi(port); err != nil {
+			return fmt.Errorf("invalid Port '%s' for host '%s' in SSH config file", port, alias)
+		}
+	}
+	if user, ok := options["user"]; ok {
+		s.User = user
+	}
+	if identity, ok := options["identityfile"]; ok && !strings.EqualFold(identity, "none") {
+		if s.PrivateKey, err = readConfigFile("IdentityFile", identity); err != nil {
+			return err
+		}
+		s.PublicKeyAuth = true
+	}
+	if strict, ok := options["stricthostkeychecking"]; ok {
+		switch strings.ToLower(strict) {
+		case "no", "off":
+			s.HostKeyCheck = false
+		default:
+			// yes, ask and accept-new all reject unknown keys, as the application cannot prompt
+			s.HostKeyCheck = true
+		}
+	}
+	if s.HostKeyCheck && s.KnownHostFile == "" {
+		knownHosts := "~/.ssh/known_hosts"
+		if files, ok := options["userknownhostsfile"]; ok {
+			knownHosts = strings.Fields(files)[0]
+		}
+		if s.KnownHostFile, err = readConfigFile("UserKnownHostsFile", knownHosts); err != nil {
+			return err
+		}
+	}
+	if jump, ok := options["proxyjump"]; ok {
+		if strings.EqualFold(jump, "none") {
+			s.ProxyJump = ""
+		} else {
+			s.ProxyJump = jump
+		}
+	}
+
+	logCache.Debugf("SSH config host '%s' resolved to %s@%s:%d", alias, s.User, s.Host, s.Port)
+	return nil
+}
@@ -0,0 +1,190 @@
+package connection
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/pem"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/crypto/ssh"
+)
+
+const testSSHConfig = `# defaults for every host
+ServerAliveInterval 30
+
+Host web-? !web-9
+    HostName %h.example.com
+    User deploy
+
+Host db
+    HostName = "10.0.0.5"
+    Port=2222
+    StrictHostKeyChecking no
+
+Match exec "test -f /tmp/x"
+    User ignored
+
+Host *
+    User admin
+    Port 22
+    ProxyJump bastion
+
+Match all
+    IdentitiesOnly yes
+`
+
+func TestParseSSHConfig(t *testing.T) {
+	cfg, err := parseSSHConfig([]byte(testSSHConfig))
+	assert.Nil(t, err)
+
+	options := cfg.resolve("web-1")
+	assert.Equal(t, "web-1.example.com", hostName(options, "web-1"))
+	assert.Equal(t, "deploy", options["user"], "first match wins over Host *")
+	assert.Equal(t, "22", options["port"])
+	assert.Equal(t, "30", options["serveraliveinterval"])
+	assert.Equal(t, "yes", options["identitiesonly"])
+
+	// negated pattern excludes the host, ? matches exactly one character
+	for _, host := range []string{"web-9", "web-10"} {
+		options = cfg.resolve(host)
+		assert.Equal(t, "admin", options["user"], host)
+		assert.Equal(t, host, hostName(options, host))
+	}
+
+	options = cfg.resolve("DB")
+	assert.Equal(t, "10.0.0.5", hostName(options, "DB"))
+	assert.Equal(t, "2222", options["port"])
+	assert.Equal(t, "no", options["stricthostkeychecking"])
+	assert.Equal(t, "admin", options["user"], "other Match blocks never apply")
+	assert.Equal(t, "bastion", options["proxyjump"])
+
+	assert.True(t, matchPattern("*.example.com", "a.b.example.com"))
+	assert.False(t, matchPattern("*.example.com", "example.com"))
+	assert.Equal(t, "x%y-h", hostName(map[string]string{"hostname": "x%%y-%h"}, "h"))
+
+	_, err = parseSSHConfig([]byte("Host\n"))
+	assert.NotNil(t, err)
+	_, err = parseSSHConfig([]byte("Host a\nHostName \"unterminated\n"))
+	assert.NotNil(t, err)
+}
+
+func TestApplySSHConfig(t *testing.T) {
+	dir := t.TempDir()
+	assert.Nil(t, os.WriteFile(filepath.Join(dir, "id_test"), []byte("private key"), 0600))
+	assert.Nil(t, os.WriteFile(filepath.Join(dir, "known_hosts"), []byte("known hosts"), 0600))
+	config := fmt.Sprintf(`Host app
+    HostName 192.168.1.10
+    Port 2200
+    User deploy
+    IdentityFile %s
+    UserKnownHostsFile %s
+    ProxyJump none
+
+Host *
+    ProxyJump ops@bastion:2222
+`, filepath.Join(dir, "id_test"), filepath.Join(dir, "known_hosts"))
+
+	s := &Settings{
+		Host:         "ignored",
+		HostAlias:    "app",
+		Port:         22,
+		User:         "nobody",
+		HostKeyCheck: true,
+		ProxyJump:    "other",
+		SSHConfig:    `{"filename":"config","content":"data:application/octet-stream;base64,` + base64.StdEncoding.EncodeToString([]byte(config)) + `"}`,
+	}
+	assert.Nil(t, applySSHConfig(s))
+	assert.Equal(t, "192.168.1.10", s.Host)
+	assert.Equal(t, 2200, s.Port)
+	assert.Equal(t, "deploy", s.User)
+	assert.True(t, s.PublicKeyAuth)
+	assert.Equal(t, base64.StdEncoding.EncodeToString([]byte("private key")), s.PrivateKey)
+	assert.Equal(t, base64.StdEncoding.EncodeToString([]byte("known hosts")), s.KnownHostFile)
+	assert.Equal(t, "", s.ProxyJump)
+
+	// the host is the alias when no host alias is set
+	s = &Settings{Host: "other", Port: 22, SSHConfig: base64.StdEncoding.EncodeToString([]byte(config))}
+	assert.Nil(t, applySSHConfig(s))
+	assert.Equal(t, "other", s.Host)
+	assert.Equal(t, "ops@bastion:2222", s.ProxyJump)
+
+	s = &Settings{Host: "app", SSHConfig: base64.StdEncoding.EncodeToString([]byte("Host app\n  IdentityFile /does/not/exist\n"))}
+	assert.NotNil(t, applySSHConfig(s))
+}
+
+func TestProxyJump(t *testing.T) {
+	jump := newTestServer(t)
+	target := newTestServer(t)
+
+	// key authentication with the identity file of the target alias, also used by the jump host
+	_, priv, err := ed25519.GenerateKey(rand.Reader)
+	assert.Nil(t, err)
+	block, err := ssh.MarshalPrivateKey(priv, "")
+	assert.Nil(t, err)
+	identity := filepath.Join(t.TempDir(), "id_ed25519")
+	assert.Nil(t, os.WriteFile(identity, pem.EncodeToMemory(block), 0600))
+	signer, err := ssh.NewSignerFromKey(priv)
+	assert.Nil(t, err)
+	target.authorizedKeys[ssh.FingerprintSHA256(signer.PublicKey())] = true
+	jump.authorizedKeys[ssh.FingerprintSHA256(signer.PublicKey())] = true
+
+	config := fmt.Sprintf(`Host target
+    HostName 127.0.0.1
+    Port %d
+    IdentityFile %s
+    ProxyJump jump
+
+Host jump
+    HostName 127.0.0.1
+    Port %d
+
+Host *
+    User tester
+    StrictHostKeyChecking no
+`, target.port(), identity, jump.port())
+
+	manager, err := factory.NewManager(map[string]interface{}{
+		"name":       "proxyjump",
+		"hostAlias":  "target",
+		"password":   "secret",
+		"retryCount": 0,
+		"sshConfig":  base64.StdEncoding.EncodeToString([]byte(config)),
+	})
+	assert.Nil(t, err)
+	defer manager.(*SshSharedConfigManager).Stop()
+
+	client, err := GetClient(manager)
+	assert.Nil(t, err)
+	result, err := client.Run(context.Background(), "hostname", nil)
+	assert.Nil(t, err)
+	assert.Equal(t, "hostname", string(result.Stdout))
+
+	jump.mu.Lock()
+	assert.NotEmpty(t, jump.conns, "the target is reached through the jump host")
+	jump.mu.Unlock()
+
+	_, err = factory.NewManager(map[string]interface{}{
+		"name":       "proxyjump-invalid",
+		"host":       "127.0.0.1",
+		"port":       target.port(),
+		"user":       "tester",
+		"password":   "secret",
+		"retryCount": 0,
+		"proxyJump":  fmt.Sprintf("tester@127.0.0.1:%d", closedPort(t)),
+	})
+	assert.NotNil(t, err)
+}
+
+// closedPort returns a local port nothing listens on
+func closedPort(t *testing.T) int {
+	srv := newTestServer(t)
+	port := srv.port()
+	srv.close()
+	return port
+}
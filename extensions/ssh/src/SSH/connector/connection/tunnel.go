@@ -0,0 +1,409 @@
+package connection
+
+import (
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// forwardDialTimeout bounds the dial of the local target of a remote forward
+var forwardDialTimeout = 30 * time.Second
+
+// forwardRule is a port forwarding rule in the OpenSSH "[bind_address:]port:host:hostport" notation
+type forwardRule struct {
+	bindAddr   string
+	targetAddr string
+}
+
+// TunnelInfo describes a running port forward and the traffic it has carried
+type TunnelInfo struct {
+	BindAddress       string
+	Port              int
+	Target            string
+	Connections       int64
+	ActiveConnections int64
+	BytesIn           int64
+	BytesOut          int64
+}
+
+// tunnelStats counts the forwarded connections of a tunnel
+type tunnelStats struct {
+	connections int64
+	active      int64
+	bytesIn     int64
+	bytesOut    int64
+}
+
+func (ts *tunnelStats) info(addr net.Addr, target string) TunnelInfo {
+	info := TunnelInfo{
+		Target:            target,
+		Connections:       atomic.LoadInt64(&ts.connections),
+		ActiveConnections: atomic.LoadInt64(&ts.active),
+		BytesIn:           atomic.LoadInt64(&ts.bytesIn),
+		BytesOut:          atomic.LoadInt64(&ts.bytesOut),
+	}
+	if tcpAddr, ok := addr.(*net.TCPAddr); ok {
+		info.BindAddress, info.Port = tcpAddr.IP.String(), tcpAddr.Port
+	} else {
+		host, port, _ := net.SplitHostPort(addr.String())
+		info.BindAddress = host
+		info.Port, _ = strconv.Atoi(port)
+	}
+	return info
+}
+
+// localForward listens on a local address and forwards each accepted connection
+// to the target address through the SSH client of the connection
+type localForward struct {
+	rule     forwardRule
+	listener net.Listener
+	mu       sync.Mutex
+	conns    map[net.Conn]struct{}
+	closed   bool
+	wg       sync.WaitGroup
+	stats    tunnelStats
+}
+
+// remoteForward listens on the SSH server and forwards each accepted connection to a local target address
+type remoteForward struct {
+	rule     forwardRule
+	listener net.Listener
+	mu       sync.Mutex
+	conns    map[net.Conn]struct{}
+	closed   bool
+	wg       sync.WaitGroup
+	stats    *tunnelStats
+}
+
+// parseForwardRules parses one rule per line or comma, for example "127.0.0.1:15432:db.internal:5432".
+// The bind address defaults to localhost and port 0 binds an ephemeral port.
+func parseForwardRules(spec string) ([]forwardRule, error) {
+	var rules []forwardRule
+	for _, line := range strings.FieldsFunc(spec, func(r rune) bool { return r == '\n' || r == ',' }) {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		parts := splitForwardSpec(line)
+		var bindHost, bindPort, host, hostPort string
+		switch len(parts) {
+		case 3:
+			bindHost, bindPort, host, hostPort = "localhost", parts[0], parts[1], parts[2]
+		case 4:
+			bindHost, bindPort, host, hostPort = parts[0], parts[1], parts[2], parts[3]
+			if bindHost == "" || bindHost == "*" {
+				bindHost = ""
+			}
+		default:
+			return nil, fmt.Errorf("invalid forward rule '%s', expected [bind_address:]port:host:hostport", line)
+		}
+
+		if p, err := strconv.Atoi(bindPort); err != nil || p < 0 || p > 65535 {
+			return nil, fmt.Errorf("invalid port '%s' in forward rule '%s'", bindPort, line)
+		}
+		if p, err := strconv.Atoi(hostPort); err != nil || p < 1 || p > 65535 {
+			return nil, fmt.Errorf("invalid port '%s' in forward rule '%s'", hostPort, line)
+		}
+		if host == "" {
+			return nil, fmt.Errorf("missing host in forward rule '%s'", line)
+		}
+
+		rules = append(rules, forwardRule{
+			bindAddr:   net.JoinHostPort(bindHost, bindPort),
+			targetAddr: net.JoinHostPort(host, hostPort),
+		})
+	}
+	return rules, nil
+}
+
+// splitForwardSpec splits on ':' except inside square brackets, which enclose IPv6 addresses
+func splitForwardSpec(spec string) []string {
+	var parts []string
+	var current strings.Builder
+	inBrackets := false
+	for _, r := range spec {
+		switch {
+		case r == '[':
+			inBrackets = true
+		case r == ']':
+			inBrackets = false
+		case r == ':' && !inBrackets:
+			parts = append(parts, current.String())
+			current.Reset()
+		default:
+			current.WriteRune(r)
+		}
+	}
+	return append(parts, current.String())
+}
+
+// startLocalForwards binds the configured local forwards. They live until the connection is stopped
+// and dial through whichever SSH client is current, so they keep working after a reconnect.
+func (s *SshSharedConfigManager) startLocalForwards() error {
+	rules, err := parseForwardRules(s.Settings.LocalForwards)
+	if err != nil {
+		return err
+	}
+
+	for _, rule := range rules {
+		listener, err := net.Listen("tcp", rule.bindAddr)
+		if err != nil {
+			return fmt.Errorf("failed to bind local forward '%s': %s", rule.bindAddr, err.Error())
+		}
+		lf := &localForward{rule: rule, listener: listener, conns: map[net.Conn]struct{}{}}
+
+		s.mu.Lock()
+		s.localForwards = append(s.localForwards, lf)
+		s.mu.Unlock()
+
+		logCache.Infof("Local forward %s -> %s started for connection '%s'", listener.Addr().String(), rule.targetAddr, s.Settings.Name)
+		go s.acceptLocal(lf)
+	}
+	return nil
+}
+
+// LocalForwards returns the bound local forwards of the connection
+func (s *SshSharedConfigManager) LocalForwards() []TunnelInfo {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	infos := make([]TunnelInfo, 0, len(s.localForwards))
+	for _, lf := range s.localForwards {
+		infos = append(infos, lf.stats.info(lf.listener.Addr(), lf.rule.targetAddr))
+	}
+	return infos
+}
+
+func (s *SshSharedConfigManager) acceptLocal(lf *localForward) {
+	for {
+		local, err := lf.listener.Accept()
+		if err != nil {
+			// the listener is closed on Stop
+			return
+		}
+
+		if !lf.track(local, true) {
+			local.Close()
+			return
+		}
+		// the target is dialed by the goroutine of the connection, so that a slow target does
+		// not hold back the connections accepted after it
+		go func() {
+			defer lf.track(local, false)
+			conn, err := s.client()
+			var remote net.Conn
+			if err == nil {
+				remote, err = conn.Dial("tcp", lf.rule.targetAddr)
+			}
+			if err != nil {
+				logCache.Warnf("Local forward %s failed to reach %s: %s", lf.listener.Addr().String(), lf.rule.targetAddr, err.Error())
+				local.Close()
+				return
+			}
+
+			atomic.AddInt64(&lf.stats.connections, 1)
+			atomic.AddInt64(&lf.stats.active, 1)
+			defer atomic.AddInt64(&lf.stats.active, -1)
+			out, in := pipe(local, remote)
+			atomic.AddInt64(&lf.stats.bytesOut, out)
+			atomic.AddInt64(&lf.stats.bytesIn, in)
+		}()
+	}
+}
+
+// track adds or removes a forwarded connection. Adding returns false once the forward is
+// closed, as a connection accepted while closing would outlive it.
+func (lf *localForward) track(c net.Conn, add bool) bool {
+	lf.mu.Lock()
+	defer lf.mu.Unlock()
+	if !add {
+		delete(lf.conns, c)
+		lf.wg.Done()
+		return true
+	}
+	if lf.closed {
+		return false
+	}
+	lf.conns[c] = struct{}{}
+	lf.wg.Add(1)
+	return true
+}
+
+func (lf *localForward) close() {
+	lf.listener.Close()
+
+	lf.mu.Lock()
+	lf.closed = true
+	for c := range lf.conns {
+		c.Close()
+	}
+	lf.mu.Unlock()
+	lf.wg.Wait()
+}
+
+func (s *SshSharedConfigManager) stopLocalForwards() {
+	s.mu.Lock()
+	forwards := s.localForwards
+	s.localForwards = nil
+	s.mu.Unlock()
+
+	for _, lf := range forwards {
+		lf.close()
+		logCache.Infof("Local forward %s -> %s stopped", lf.listener.Addr().String(), lf.rule.targetAddr)
+	}
+}
+
+// startRemoteForwards asks the SSH server to listen for the configured remote forwards.
+// It is called again after a reconnect, as the listeners of the previous SSH client are gone.
+func (s *SshSharedConfigManager) startRemoteForwards() error {
+	rules, err := parseForwardRules(s.Settings.RemoteForwards)
+	if err != nil || len(rules) == 0 {
+		return err
+	}
+
+	conn, err := s.client()
+	if err != nil {
+		return err
+	}
+
+	s.closeRemoteListeners()
+
+	s.mu.Lock()
+	if s.remoteStats == nil {
+		s.remoteStats = make([]*tunnelStats, len(rules))
+		for i := range rules {
+			s.remoteStats[i] = &tunnelStats{}
+		}
+	}
+	stats := s.remoteStats
+	s.mu.Unlock()
+
+	for i, rule := range rules {
+		listener, err := conn.Listen("tcp", rule.bindAddr)
+		if err != nil {
+			return fmt.Errorf("failed to request remote forward '%s': %s", rule.bindAddr, err.Error())
+		}
+		rf := &remoteForward{rule: rule, listener: listener, conns: map[net.Conn]struct{}{}, stats: stats[i]}
+
+		s.mu.Lock()
+		s.remoteForwards = append(s.remoteForwards, rf)
+		s.mu.Unlock()
+
+		logCache.Infof("Remote forward %s -> %s started for connection '%s'", listener.Addr().String(), rule.targetAddr, s.Settings.Name)
+		go rf.accept()
+	}
+	return nil
+}
+
+// RemoteForwards returns the remote forwards of the connection. The connection counters
+// are kept across reconnects.
+func (s *SshSharedConfigManager) RemoteForwards() []TunnelInfo {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	infos := make([]TunnelInfo, 0, len(s.remoteForwards))
+	for _, rf := range s.remoteForwards {
+		infos = append(infos, rf.stats.info(rf.listener.Addr(), rf.rule.targetAddr))
+	}
+	return infos
+}
+
+func (rf *remoteForward) accept() {
+	for {
+		remote, err := rf.listener.Accept()
+		if err != nil {
+			// the listener is closed on Stop or when the SSH client is lost
+			return
+		}
+
+		if !rf.track(remote, true) {
+			remote.Close()
+			return
+		}
+		// the target is dialed by the goroutine of the connection, so that a slow target does
+		// not hold back the connections accepted after it
+		go func() {
+			defer rf.track(remote, false)
+			local, err := net.DialTimeout("tcp", rf.rule.targetAddr, forwardDialTimeout)
+			if err != nil {
+				logCache.Warnf("Remote forward %s failed to reach %s: %s", rf.listener.Addr().String(), rf.rule.targetAddr, err.Error())
+				remote.Close()
+				return
+			}
+
+			atomic.AddInt64(&rf.stats.connections, 1)
+			atomic.AddInt64(&rf.stats.active, 1)
+			defer atomic.AddInt64(&rf.stats.active, -1)
+
+			start := time.Now()
+			in, out := pipe(remote, local)
+			atomic.AddInt64(&rf.stats.bytesIn, in)
+			atomic.AddInt64(&rf.stats.bytesOut, out)
+			logCache.Debugf("Remote forward %s -> %s: connection from %s closed after %s, %d bytes in, %d bytes out",
+				rf.listener.Addr().String(), rf.rule.targetAddr, remote.RemoteAddr().String(), time.Since(start).Round(time.Millisecond), in, out)
+		}()
+	}
+}
+
+// track adds or removes a forwarded connection. Adding returns false once the forward is
+// closed, as a connection accepted while closing would outlive it.
+func (rf *remoteForward) track(c net.Conn, add bool) bool {
+	rf.mu.Lock()
+	defer rf.mu.Unlock()
+	if !add {
+		delete(rf.conns, c)
+		rf.wg.Done()
+		return true
+	}
+	if rf.closed {
+		return false
+	}
+	rf.conns[c] = struct{}{}
+	rf.wg.Add(1)
+	return true
+}
+
+func (rf *remoteForward) close() {
+	rf.listener.Close()
+
+	rf.mu.Lock()
+	rf.closed = true
+	for c := range rf.conns {
+		c.Close()
+	}
+	rf.mu.Unlock()
+	rf.wg.Wait()
+}
+
+func (s *SshSharedConfigManager) closeRemoteListeners() {
+	s.mu.Lock()
+	forwards := s.remoteForwards
+	s.remoteForwards = nil
+	s.mu.Unlock()
+
+	for _, rf := range forwards {
+		rf.close()
+		logCache.Infof("Remote forward %s -> %s stopped", rf.listener.Addr().String(), rf.rule.targetAddr)
+	}
+}
+
+// pipe copies data in both directions until either side is closed and returns the bytes copied each way
+func pipe(a, b net.Conn) (int64, int64) {
+	var aToB, bToA int64
+	done := make(chan struct{})
+	go func() {
+		aToB, _ = io.Copy(b, a)
+		b.Close()
+		close(done)
+	}()
+	bToA, _ = io.Copy(a, b)
+	a.Close()
+	<-done
+	return aToB, bToA
+}
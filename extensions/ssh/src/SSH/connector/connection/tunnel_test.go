@@ -0,0 +1,194 @@
+package connection
+
+import (
+	"bufio"
+	"fmt"
+	"net"
+	"strconv"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseForwardRules(t *testing.T) {
+	rules, err := parseForwardRules("15432:db.internal:5432\n0.0.0.0:8080:web:80, [::1]:0:[fe80::1]:443\n# comment")
+	assert.Nil(t, err)
+	assert.Equal(t, []forwardRule{
+		{bindAddr: "localhost:15432", targetAddr: "db.internal:5432"},
+		{bindAddr: "0.0.0.0:8080", targetAddr: "web:80"},
+		{bindAddr: "[::1]:0", targetAddr: "[fe80::1]:443"},
+	}, rules)
+
+	_, err = parseForwardRules("db:5432")
+	assert.NotNil(t, err)
+
+	_, err = parseForwardRules("15432:db:99999")
+	assert.NotNil(t, err)
+}
+
+func echoThrough(t *testing.T, addr string, msg string) string {
+	c, err := net.DialTimeout("tcp", addr, 5*time.Second)
+	if err != nil {
+		t.Logf("dial %s: %s", addr, err.Error())
+		return ""
+	}
+	defer c.Close()
+	c.SetDeadline(time.Now().Add(5 * time.Second))
+	fmt.Fprintln(c, msg)
+	line, _ := bufio.NewReader(c).ReadString('\n')
+	return line
+}
+
+func TestLocalForward(t *testing.T) {
+	srv := newTestServer(t)
+	echoAddr := startEchoServer(t)
+
+	settings := srv.settings("tunnel")
+	settings["localForwards"] = "127.0.0.1:0:" + echoAddr
+	settings["retryCount"] = 1
+	settings["retryInterval"] = 0
+
+	manager, err := factory.NewManager(settings)
+	assert.Nil(t, err)
+	sharedConn := manager.(*SshSharedConfigManager)
+	defer sharedConn.Stop()
+
+	tunnels := sharedConn.LocalForwards()
+	assert.Len(t, tunnels, 1)
+	assert.NotZero(t, tunnels[0].Port)
+	tunnelAddr := net.JoinHostPort(tunnels[0].BindAddress, strconv.Itoa(tunnels[0].Port))
+
+	assert.Equal(t, "ping\n", echoThrough(t, tunnelAddr, "ping"))
+
+	// the tunnel keeps working once the SSH client has reconnected
+	srv.dropConnections()
+	assert.Eventually(t, func() bool {
+		return echoThrough(t, tunnelAddr, "pong") == "pong\n"
+	}, 10*time.Second, 100*time.Millisecond)
+
+	assert.Nil(t, sharedConn.Stop())
+	_, err = net.DialTimeout("tcp", tunnelAddr, time.Second)
+	assert.NotNil(t, err)
+}
+
+func TestLocalForwardSlowTarget(t *testing.T) {
+	srv := newTestServer(t)
+	echoAddr := startEchoServer(t)
+	release := make(chan struct{})
+	var dials int32
+	srv.dialTarget = func(addr string) (net.Conn, error) {
+		// the first connection reaches a target that does not answer yet
+		if atomic.AddInt32(&dials, 1) == 1 {
+			<-release
+		}
+		return net.Dial("tcp", addr)
+	}
+
+	settings := srv.settings("slowTunnel")
+	settings["localForwards"] = "127.0.0.1:0:" + echoAddr
+	settings["retryCount"] = 1
+	settings["retryInterval"] = 0
+	manager, err := factory.NewManager(settings)
+	assert.Nil(t, err)
+	sharedConn := manager.(*SshSharedConfigManager)
+	defer sharedConn.Stop()
+	tunnel := sharedConn.LocalForwards()[0]
+	tunnelAddr := net.JoinHostPort(tunnel.BindAddress, strconv.Itoa(tunnel.Port))
+
+	slow, err := net.DialTimeout("tcp", tunnelAddr, 5*time.Second)
+	assert.Nil(t, err)
+	defer slow.Close()
+	fmt.Fprintln(slow, "slow")
+	assert.Eventually(t, func() bool { return atomic.LoadInt32(&dials) == 1 }, 5*time.Second, 10*time.Millisecond)
+
+	// the connections accepted after it are forwarded meanwhile
+	assert.Equal(t, "fast\n", echoThrough(t, tunnelAddr, "fast"))
+
+	close(release)
+	slow.SetDeadline(time.Now().Add(5 * time.Second))
+	line, _ := bufio.NewReader(slow).ReadString('\n')
+	assert.Equal(t, "slow\n", line)
+}
+
+func TestLocalForwardAfterOutage(t *testing.T) {
+	srv := newTestServer(t)
+	echoAddr := startEchoServer(t)
+
+	settings := srv.settings("outage")
+	settings["localForwards"] = "127.0.0.1:0:" + echoAddr
+	settings["retryCount"] = 1
+	settings["retryInterval"] = 0
+
+	manager, err := factory.NewManager(settings)
+	assert.Nil(t, err)
+	sharedConn := manager.(*SshSharedConfigManager)
+	defer sharedConn.Stop()
+	tunnels := sharedConn.LocalForwards()
+	tunnelAddr := net.JoinHostPort(tunnels[0].BindAddress, strconv.Itoa(tunnels[0].Port))
+
+	// the server is down for longer than the retries of the connection
+	srv.close()
+	time.Sleep(500 * time.Millisecond)
+	srv.restart(t)
+
+	assert.Eventually(t, func() bool {
+		return echoThrough(t, tunnelAddr, "pong") == "pong\n"
+	}, 10*time.Second, 100*time.Millisecond)
+}
+
+func TestForwardClosedBeforeTrack(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.Nil(t, err)
+	lf := &localForward{listener: listener, conns: map[net.Conn]struct{}{}}
+	a, b := net.Pipe()
+	defer b.Close()
+	assert.True(t, lf.track(a, true))
+	lf.track(a, false)
+	lf.close()
+
+	// a connection accepted while the forward was closing is refused
+	assert.False(t, lf.track(a, true))
+	assert.Empty(t, lf.conns)
+
+	rf := &remoteForward{listener: &closedListener{}, conns: map[net.Conn]struct{}{}}
+	rf.close()
+	assert.False(t, rf.track(a, true))
+}
+
+// closedListener is a net.Listener that is already closed
+type closedListener struct{ net.Listener }
+
+func (*closedListener) Close() error { return nil }
+
+func TestRemoteForward(t *testing.T) {
+	srv := newTestServer(t)
+	echoAddr := startEchoServer(t)
+
+	settings := srv.settings("remoteTunnel")
+	settings["remoteForwards"] = "localhost:0:" + echoAddr
+	settings["retryCount"] = 1
+	settings["retryInterval"] = 0
+
+	manager, err := factory.NewManager(settings)
+	assert.Nil(t, err)
+	sharedConn := manager.(*SshSharedConfigManager)
+	defer sharedConn.Stop()
+
+	forwards := sharedConn.RemoteForwards()
+	assert.Len(t, forwards, 1)
+	assert.Equal(t, "ping\n", echoThrough(t, net.JoinHostPort("127.0.0.1", strconv.Itoa(forwards[0].Port)), "ping"))
+
+	// the remote listener is requested again once the SSH client has reconnected
+	srv.dropConnections()
+	assert.Eventually(t, func() bool {
+		forwards = sharedConn.RemoteForwards()
+		return len(forwards) == 1 && echoThrough(t, net.JoinHostPort("127.0.0.1", strconv.Itoa(forwards[0].Port)), "pong") == "pong\n"
+	}, 10*time.Second, 100*time.Millisecond)
+
+	assert.Eventually(t, func() bool {
+		info := sharedConn.RemoteForwards()[0]
+		return info.Connections >= 2 && info.ActiveConnections == 0 && info.BytesIn >= 10 && info.BytesOut >= 10
+	}, 5*time.Second, 50*time.Millisecond)
+}
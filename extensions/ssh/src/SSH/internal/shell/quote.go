@@ -0,0 +1,9 @@
+// Package shell provides the shell syntax shared by the activities that build remote commands
+package shell
+
+import "strings"
+
+// Quote quotes s for use as a single argument in a POSIX shell
+func Quote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
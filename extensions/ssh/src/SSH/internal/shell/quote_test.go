@@ -0,0 +1,12 @@
+package shell
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestQuote(t *testing.T) {
+	assert.Equal(t, `'/tmp/it'\''s here'`, Quote("/tmp/it's here"))
+	assert.Equal(t, `''`, Quote(""))
+}
@@ -0,0 +1,68 @@
+// Package sshtest provides the fixtures shared by the tests of the activities
+package sshtest
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"testing"
+
+	ssh "github.com/mmussett/extensions/SSH/connector/connection"
+	"github.com/pkg/sftp"
+	"github.com/stretchr/testify/assert"
+)
+
+// errUnsupported is returned by the channels a RunFunc client cannot open
+var errUnsupported = errors.New("not supported by the test client")
+
+// NewSFTPClient returns an sftp client talking to an in-process sftp server over pipes
+func NewSFTPClient(t testing.TB) *sftp.Client {
+	clientRead, serverWrite := io.Pipe()
+	serverRead, clientWrite := io.Pipe()
+
+	server, err := sftp.NewServer(struct {
+		io.Reader
+		io.WriteCloser
+	}{serverRead, serverWrite})
+	assert.Nil(t, err)
+	go server.Serve()
+
+	client, err := sftp.NewClientPipe(clientRead, clientWrite)
+	assert.Nil(t, err)
+	t.Cleanup(func() {
+		server.Close()
+		client.Close()
+	})
+	return client
+}
+
+// RunFunc is an ssh.Client that runs commands with the function. It opens no other channels.
+type RunFunc func(ctx context.Context, cmd string, opts *ssh.RunOptions) (*ssh.RunResult, error)
+
+var _ ssh.Client = RunFunc(nil)
+
+// Run implements ssh.Client.Run
+func (f RunFunc) Run(ctx context.Context, cmd string, opts *ssh.RunOptions) (*ssh.RunResult, error) {
+	return f(ctx, cmd, opts)
+}
+
+// NewSession implements ssh.Client.NewSession
+func (f RunFunc) NewSession(ctx context.Context) (*ssh.Session, error) {
+	return nil, errUnsupported
+}
+
+// SFTP implements ssh.Client.SFTP
+func (f RunFunc) SFTP() (*sftp.Client, error) {
+	return nil, errUnsupported
+}
+
+// Dial implements ssh.Client.Dial
+func (f RunFunc) Dial(network, addr string) (net.Conn, error) {
+	return nil, errUnsupported
+}
+
+// Host implements ssh.Client.Host
+func (f RunFunc) Host() string {
+	return "127.0.0.1:22"
+}
@@ -0,0 +1,262 @@
+// Package server provides the embedded SSH server shared by the server triggers
+package server
+
+import (
+	"bufio"
+	"crypto/subtle"
+	"encoding/base64"
+	"fmt"
+	"net"
+	"strings"
+	"sync"
+
+	"github.com/project-flogo/core/data/coerce"
+	"github.com/project-flogo/core/support/log"
+	"golang.org/x/crypto/bcrypt"
+	"golang.org/x/crypto/ssh"
+)
+
+// Permission extensions set on authenticated connections
+const (
+	ExtUser        = "user"
+	ExtFingerprint = "fingerprint"
+	ExtAuthMethod  = "auth-method"
+)
+
+// Config configures the authentication of an embedded server
+type Config struct {
+	// HostKey is the PEM encoded private host key, plain or from a file selector
+	HostKey string
+	// AuthorizedKeys lists the accepted public keys as "user:key" entries, one per line, where key
+	// is in authorized_keys format. A key only logs in as the user it is listed for.
+	AuthorizedKeys string
+	// Users lists "user:password" pairs, one per line. The password may be a bcrypt hash.
+	Users string
+}
+
+// NewServerConfig returns a server configuration accepting the configured keys and passwords
+func NewServerConfig(c Config) (*ssh.ServerConfig, error) {
+	hostKey, err := DecodeContent(c.HostKey)
+	if err != nil {
+		return nil, fmt.Errorf("invalid host key: %s", err.Error())
+	}
+	signer, err := ssh.ParsePrivateKey(hostKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse host key: %s", err.Error())
+	}
+
+	keys, err := parseAuthorizedKeys(c.AuthorizedKeys)
+	if err != nil {
+		return nil, err
+	}
+	users, err := parseUsers(c.Users)
+	if err != nil {
+		return nil, err
+	}
+	if len(keys) == 0 && len(users) == 0 {
+		return nil, fmt.Errorf("at least one authorized key or user must be configured")
+	}
+
+	config := &ssh.ServerConfig{}
+	if len(keys) > 0 {
+		config.PublicKeyCallback = func(conn ssh.ConnMetadata, key ssh.PublicKey) (*ssh.Permissions, error) {
+			if _, ok := keys[conn.User()][string(key.Marshal())]; !ok {
+				return nil, fmt.Errorf("unknown public key for %s", conn.User())
+			}
+			return permissions(conn.User(), ssh.FingerprintSHA256(key), "publickey"), nil
+		}
+	}
+	if len(users) > 0 {
+		config.PasswordCallback = func(conn ssh.ConnMetadata, password []byte) (*ssh.Permissions, error) {
+			expected, ok := users[conn.User()]
+			if !ok || !checkPassword(expected, password) {
+				return nil, fmt.Errorf("password rejected for %s", conn.User())
+			}
+			return permissions(conn.User(), "", "password"), nil
+		}
+	}
+	config.AddHostKey(signer)
+	return config, nil
+}
+
+func permissions(user, fingerprint, method string) *ssh.Permissions {
+	return &ssh.Permissions{Extensions: map[string]string{
+		ExtUser:        user,
+		ExtFingerprint: fingerprint,
+		ExtAuthMethod:  method,
+	}}
+}
+
+// parseAuthorizedKeys returns the keys of each user, by their wire format
+func parseAuthorizedKeys(content string) (map[string]map[string]struct{}, error) {
+	keys := map[string]map[string]struct{}{}
+	scanner := bufio.NewScanner(strings.NewReader(content))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		i := strings.Index(line, ":")
+		if i < 1 || strings.ContainsAny(line[:i], " \t\"=") {
+			return nil, fmt.Errorf("invalid authorized key entry '%s', expected user:key", line)
+		}
+		key, _, _, _, err := ssh.ParseAuthorizedKey([]byte(line[i+1:]))
+		if err != nil {
+			return nil, fmt.Errorf("invalid authorized key of %s: %s", line[:i], err.Error())
+		}
+		user := line[:i]
+		if keys[user] == nil {
+			keys[user] = map[string]struct{}{}
+		}
+		keys[user][string(key.Marshal())] = struct{}{}
+	}
+	return keys, scanner.Err()
+}
+
+func parseUsers(content string) (map[string]string, error) {
+	users := map[string]string{}
+	scanner := bufio.NewScanner(strings.NewReader(content))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		i := strings.Index(line, ":")
+		if i < 1 {
+			return nil, fmt.Errorf("invalid user entry '%s', expected user:password", line)
+		}
+		users[line[:i]] = line[i+1:]
+	}
+	return users, scanner.Err()
+}
+
+func checkPassword(expected string, password []byte) bool {
+	if strings.HasPrefix(expected, "$2a$") || strings.HasPrefix(expected, "$2b$") || strings.HasPrefix(expected, "$2y$") {
+		return bcrypt.CompareHashAndPassword([]byte(expected), password) == nil
+	}
+	return subtle.ConstantTimeCompare([]byte(expected), password) == 1
+}
+
+// DecodeContent returns the content of a file selector value. Plain text values, such as
+// a PEM key set by an application property, are returned as they are, and other values are
+// expected to be base64 encoded.
+func DecodeContent(value string) ([]byte, error) {
+	if value == "" {
+		return nil, fmt.Errorf("no value configured")
+	}
+	if strings.HasPrefix(value, "{") {
+		obj, err := coerce.ToObject(value)
+		if err != nil {
+			return nil, err
+		}
+		content, ok := obj["content"].(string)
+		if !ok || content == "" {
+			return nil, fmt.Errorf("file selector value has no content")
+		}
+		if i := strings.Index(content, ","); i > -1 {
+			content = content[i+1:]
+		}
+		return base64.StdEncoding.DecodeString(content)
+	}
+	if strings.HasPrefix(strings.TrimSpace(value), "-----BEGIN") {
+		return []byte(value), nil
+	}
+	return base64.StdEncoding.DecodeString(value)
+}
+
+// ChannelHandler serves a channel opened on an authenticated connection
+type ChannelHandler func(conn *ssh.ServerConn, newChannel ssh.NewChannel)
+
+// Server accepts SSH connections and passes their channels to a handler
+type Server struct {
+	listener net.Listener
+	config   *ssh.ServerConfig
+	handle   ChannelHandler
+	logger   log.Logger
+
+	mu     sync.Mutex
+	conns  map[*ssh.ServerConn]struct{}
+	closed bool
+	wg     sync.WaitGroup
+}
+
+// Listen starts a server on addr
+func Listen(addr string, config *ssh.ServerConfig, handle ChannelHandler, logger log.Logger) (*Server, error) {
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, fmt.Errorf("failed to listen on '%s': %s", addr, err.Error())
+	}
+	s := &Server{listener: listener, config: config, handle: handle, logger: logger, conns: map[*ssh.ServerConn]struct{}{}}
+	s.wg.Add(1)
+	go s.serve()
+	return s, nil
+}
+
+// Addr returns the address the server listens on
+func (s *Server) Addr() net.Addr {
+	return s.listener.Addr()
+}
+
+// Close stops accepting connections, closes the open connections and waits for their channel handlers
+func (s *Server) Close() error {
+	s.mu.Lock()
+	s.closed = true
+	for c := range s.conns {
+		c.Close()
+	}
+	s.mu.Unlock()
+
+	err := s.listener.Close()
+	s.wg.Wait()
+	return err
+}
+
+func (s *Server) serve() {
+	defer s.wg.Done()
+	for {
+		nConn, err := s.listener.Accept()
+		if err != nil {
+			return
+		}
+		s.wg.Add(1)
+		go s.serveConn(nConn)
+	}
+}
+
+func (s *Server) serveConn(nConn net.Conn) {
+	defer s.wg.Done()
+
+	conn, chans, reqs, err := ssh.NewServerConn(nConn, s.config)
+	if err != nil {
+		s.logger.Debugf("SSH handshake with %s failed: %s", nConn.RemoteAddr().String(), err.Error())
+		nConn.Close()
+		return
+	}
+
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		conn.Close()
+		return
+	}
+	s.conns[conn] = struct{}{}
+	s.mu.Unlock()
+	defer func() {
+		s.mu.Lock()
+		delete(s.conns, conn)
+		s.mu.Unlock()
+	}()
+
+	s.logger.Debugf("User '%s' connected from %s", conn.User(), conn.RemoteAddr().String())
+	go ssh.DiscardRequests(reqs)
+
+	var channels sync.WaitGroup
+	for newChannel := range chans {
+		channels.Add(1)
+		go func(nc ssh.NewChannel) {
+			defer channels.Done()
+			s.handle(conn, nc)
+		}(newChannel)
+	}
+	channels.Wait()
+}
@@ -0,0 +1,112 @@
+package command
+
+import (
+	"github.com/project-flogo/core/data/coerce"
+)
+
+// Settings corresponds to trigger.json settings
+type Settings struct {
+	Port           int    `md:"port,required"`
+	HostKey        string `md:"hostKey,required"`
+	AuthorizedKeys string `md:"authorizedKeys"`
+	Users          string `md:"users"`
+}
+
+// HandlerSettings corresponds to trigger.json handler settings
+type HandlerSettings struct {
+	Command   string `md:"command,required"`
+	ReadStdin bool   `md:"readStdin"`
+}
+
+// Output corresponds to trigger.json outputs
+type Output struct {
+	Command       string        `md:"command"`
+	Args          []interface{} `md:"args"`
+	Stdin         string        `md:"stdin"`
+	User          string        `md:"user"`
+	Fingerprint   string        `md:"fingerprint"`
+	RemoteAddress string        `md:"remoteAddress"`
+}
+
+// ToMap converts Output struct to map
+func (o *Output) ToMap() map[string]interface{} {
+	return map[string]interface{}{
+		"command":       o.Command,
+		"args":          o.Args,
+		"stdin":         o.Stdin,
+		"user":          o.User,
+		"fingerprint":   o.Fingerprint,
+		"remoteAddress": o.RemoteAddress,
+	}
+}
+
+// FromMap converts a map to Output struct
+func (o *Output) FromMap(values map[string]interface{}) error {
+	var err error
+	o.Command, err = coerce.ToString(values["command"])
+	if err != nil {
+		return err
+	}
+
+	o.Args, err = coerce.ToArray(values["args"])
+	if err != nil {
+		return err
+	}
+
+	o.Stdin, err = coerce.ToString(values["stdin"])
+	if err != nil {
+		return err
+	}
+
+	o.User, err = coerce.ToString(values["user"])
+	if err != nil {
+		return err
+	}
+
+	o.Fingerprint, err = coerce.ToString(values["fingerprint"])
+	if err != nil {
+		return err
+	}
+
+	o.RemoteAddress, err = coerce.ToString(values["remoteAddress"])
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+// Reply corresponds to trigger.json reply
+type Reply struct {
+	Stdout   string `md:"stdout"`
+	Stderr   string `md:"stderr"`
+	ExitCode int    `md:"exitCode"`
+}
+
+// ToMap converts Reply struct to map
+func (r *Reply) ToMap() map[string]interface{} {
+	return map[string]interface{}{
+		"stdout":   r.Stdout,
+		"stderr":   r.Stderr,
+		"exitCode": r.ExitCode,
+	}
+}
+
+// FromMap converts a map to Reply struct
+func (r *Reply) FromMap(values map[string]interface{}) error {
+	var err error
+	r.Stdout, err = coerce.ToString(values["stdout"])
+	if err != nil {
+		return err
+	}
+
+	r.Stderr, err = coerce.ToString(values["stderr"])
+	if err != nil {
+		return err
+	}
+
+	r.ExitCode, err = coerce.ToInt(values["exitCode"])
+	if err != nil {
+		return err
+	}
+	return nil
+}
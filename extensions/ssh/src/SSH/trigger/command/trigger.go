@@ -0,0 +1,231 @@
+package command
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/mmussett/extensions/SSH/server"
+	"github.com/project-flogo/core/data/metadata"
+	"github.com/project-flogo/core/support/log"
+	"github.com/project-flogo/core/trigger"
+	"golang.org/x/crypto/ssh"
+)
+
+// maxStdin bounds the standard input read into a flow
+const maxStdin = 10 << 20
+
+var triggerMd = trigger.NewMetadata(&Settings{}, &HandlerSettings{}, &Output{}, &Reply{})
+
+func init() {
+	_ = trigger.Register(&Trigger{}, &Factory{})
+}
+
+// Factory creates command triggers
+type Factory struct {
+}
+
+// Metadata implements trigger.Factory.Metadata
+func (*Factory) Metadata() *trigger.Metadata {
+	return triggerMd
+}
+
+// New implements trigger.Factory.New
+func (*Factory) New(config *trigger.Config) (trigger.Trigger, error) {
+	s := &Settings{}
+	err := metadata.MapToStruct(config.Settings, s, true)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Trigger{settings: s}, nil
+}
+
+// Trigger runs an embedded SSH server and starts a flow for each remote command
+type Trigger struct {
+	settings *Settings
+	logger   log.Logger
+	config   *ssh.ServerConfig
+	handlers map[string]*commandHandler
+	server   *server.Server
+}
+
+type commandHandler struct {
+	handler   trigger.Handler
+	readStdin bool
+}
+
+// Initialize implements trigger.Trigger.Initialize
+func (t *Trigger) Initialize(ctx trigger.InitContext) error {
+	t.logger = ctx.Logger()
+
+	config, err := server.NewServerConfig(server.Config{
+		HostKey:        t.settings.HostKey,
+		AuthorizedKeys: t.settings.AuthorizedKeys,
+		Users:          t.settings.Users,
+	})
+	if err != nil {
+		return err
+	}
+	t.config = config
+
+	t.handlers = map[string]*commandHandler{}
+	for _, handler := range ctx.GetHandlers() {
+		s := &HandlerSettings{}
+		err := metadata.MapToStruct(handler.Settings(), s, true)
+		if err != nil {
+			return err
+		}
+
+		if strings.ContainsAny(s.Command, " \t\n") {
+			return fmt.Errorf("invalid settings of handler '%s': command '%s' must be a single word", handler.Name(), s.Command)
+		}
+		if _, ok := t.handlers[s.Command]; ok {
+			return fmt.Errorf("command '%s' is configured on more than one handler", s.Command)
+		}
+		t.handlers[s.Command] = &commandHandler{handler: handler, readStdin: s.ReadStdin}
+	}
+	return nil
+}
+
+// Start implements trigger.Trigger.Start
+func (t *Trigger) Start() error {
+	srv, err := server.Listen(":"+strconv.Itoa(t.settings.Port), t.config, t.handleChannel, t.logger)
+	if err != nil {
+		return err
+	}
+	t.server = srv
+	t.logger.Infof("SSH command server listening on %s", srv.Addr().String())
+	return nil
+}
+
+// Stop implements trigger.Trigger.Stop
+func (t *Trigger) Stop() error {
+	if t.server != nil {
+		err := t.server.Close()
+		t.server = nil
+		return err
+	}
+	return nil
+}
+
+func (t *Trigger) handleChannel(conn *ssh.ServerConn, newChannel ssh.NewChannel) {
+	if newChannel.ChannelType() != "session" {
+		newChannel.Reject(ssh.UnknownChannelType, "only session channels are supported")
+		return
+	}
+	channel, requests, err := newChannel.Accept()
+	if err != nil {
+		return
+	}
+	defer channel.Close()
+
+	for req := range requests {
+		switch req.Type {
+		case "exec":
+			var payload struct{ Command string }
+			if err := ssh.Unmarshal(req.Payload, &payload); err != nil {
+				req.Reply(false, nil)
+				continue
+			}
+			req.Reply(true, nil)
+			go ssh.DiscardRequests(requests)
+			t.exec(conn, channel, payload.Command)
+			return
+		case "shell":
+			// there is no interactive shell, the available commands are listed instead
+			req.Reply(true, nil)
+			go ssh.DiscardRequests(requests)
+			fmt.Fprintf(channel, "Available commands: %s\r\n", strings.Join(t.commands(), ", "))
+			sendExitStatus(channel, 0)
+			return
+		case "env", "pty-req", "window-change":
+			req.Reply(true, nil)
+		default:
+			req.Reply(false, nil)
+		}
+	}
+}
+
+func (t *Trigger) exec(conn *ssh.ServerConn, channel ssh.Channel, line string) {
+	args, err := splitArgs(line)
+	if err != nil {
+		fmt.Fprintf(channel.Stderr(), "%s\n", err.Error())
+		sendExitStatus(channel, 2)
+		return
+	}
+	if len(args) == 0 {
+		fmt.Fprintf(channel.Stderr(), "Available commands: %s\n", strings.Join(t.commands(), ", "))
+		sendExitStatus(channel, 2)
+		return
+	}
+
+	ch, ok := t.handlers[args[0]]
+	if !ok {
+		fmt.Fprintf(channel.Stderr(), "%s: command not found\n", args[0])
+		sendExitStatus(channel, 127)
+		return
+	}
+
+	output := &Output{
+		Command:       args[0],
+		Args:          make([]interface{}, 0, len(args)-1),
+		User:          conn.Permissions.Extensions[server.ExtUser],
+		Fingerprint:   conn.Permissions.Extensions[server.ExtFingerprint],
+		RemoteAddress: conn.RemoteAddr().String(),
+	}
+	for _, arg := range args[1:] {
+		output.Args = append(output.Args, arg)
+	}
+	if ch.readStdin {
+		// one byte more than the limit is read, so that oversized input is rejected rather than truncated
+		stdin, err := io.ReadAll(io.LimitReader(channel, maxStdin+1))
+		if err != nil {
+			fmt.Fprintf(channel.Stderr(), "failed to read standard input: %s\n", err.Error())
+			sendExitStatus(channel, 1)
+			return
+		}
+		if len(stdin) > maxStdin {
+			t.logger.Warnf("Rejected command '%s' of user '%s': standard input exceeds %d bytes", output.Command, output.User, maxStdin)
+			fmt.Fprintf(channel.Stderr(), "%s: standard input exceeds %d bytes\n", output.Command, maxStdin)
+			sendExitStatus(channel, 1)
+			return
+		}
+		output.Stdin = string(stdin)
+	}
+
+	t.logger.Debugf("User '%s' runs command '%s'", output.User, output.Command)
+	results, err := ch.handler.Handle(context.Background(), output.ToMap())
+	if err != nil {
+		t.logger.Errorf("Handler '%s' failed for command '%s': %s", ch.handler.Name(), output.Command, err.Error())
+		fmt.Fprintf(channel.Stderr(), "%s: %s\n", output.Command, err.Error())
+		sendExitStatus(channel, 1)
+		return
+	}
+
+	reply := &Reply{}
+	if err = reply.FromMap(results); err != nil {
+		fmt.Fprintf(channel.Stderr(), "%s: invalid reply: %s\n", output.Command, err.Error())
+		sendExitStatus(channel, 1)
+		return
+	}
+	io.WriteString(channel, reply.Stdout)
+	io.WriteString(channel.Stderr(), reply.Stderr)
+	sendExitStatus(channel, reply.ExitCode)
+}
+
+func (t *Trigger) commands() []string {
+	names := make([]string, 0, len(t.handlers))
+	for name := range t.handlers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func sendExitStatus(channel ssh.Channel, status int) {
+	channel.SendRequest("exit-status", false, ssh.Marshal(struct{ Status uint32 }{uint32(status)}))
+}
@@ -0,0 +1,163 @@
+package command
+
+import (
+	"bytes"
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/pem"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/project-flogo/core/support"
+	"github.com/project-flogo/core/support/log"
+	"github.com/project-flogo/core/trigger"
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/crypto/ssh"
+)
+
+type testHandler struct {
+	settings map[string]interface{}
+	handle   func(values map[string]interface{}) (map[string]interface{}, error)
+}
+
+func (h *testHandler) Name() string {
+	return fmt.Sprint(h.settings["command"])
+}
+
+func (h *testHandler) Logger() log.Logger {
+	return log.RootLogger()
+}
+
+func (h *testHandler) Settings() map[string]interface{} {
+	return h.settings
+}
+
+func (h *testHandler) Schemas() *trigger.SchemaConfig {
+	return nil
+}
+
+func (h *testHandler) Handle(ctx context.Context, triggerData interface{}) (map[string]interface{}, error) {
+	return h.handle(triggerData.(map[string]interface{}))
+}
+
+type testInitContext struct {
+	handlers []trigger.Handler
+}
+
+func (c *testInitContext) Logger() log.Logger {
+	return log.RootLogger()
+}
+
+func (c *testInitContext) GetHandlers() []trigger.Handler {
+	return c.handlers
+}
+
+func hostKeyPEM(t *testing.T) string {
+	_, priv, err := ed25519.GenerateKey(rand.Reader)
+	assert.Nil(t, err)
+	block, err := ssh.MarshalPrivateKey(priv, "")
+	assert.Nil(t, err)
+	return string(pem.EncodeToMemory(block))
+}
+
+func TestRegister(t *testing.T) {
+	ref := support.GetRef(&Trigger{})
+	assert.NotNil(t, trigger.GetFactory(ref))
+}
+
+func TestSplitArgs(t *testing.T) {
+	args, err := splitArgs(`deploy 'my app' --tag "v1 \"rc\"" a\ b`)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"deploy", "my app", "--tag", `v1 "rc"`, "a b"}, args)
+
+	_, err = splitArgs(`deploy 'open`)
+	assert.NotNil(t, err)
+}
+
+func TestCommands(t *testing.T) {
+	_, clientKey, err := ed25519.GenerateKey(rand.Reader)
+	assert.Nil(t, err)
+	clientSigner, err := ssh.NewSignerFromKey(clientKey)
+	assert.Nil(t, err)
+
+	f := &Factory{}
+	trg, err := f.New(&trigger.Config{Settings: map[string]interface{}{
+		"port":           0,
+		"hostKey":        hostKeyPEM(t),
+		"authorizedKeys": "ci:" + string(ssh.MarshalAuthorizedKey(clientSigner.PublicKey())),
+		"users":          "operator:s3cret",
+	}})
+	assert.Nil(t, err)
+
+	deploy := &testHandler{settings: map[string]interface{}{"command": "deploy", "readStdin": true}}
+	deploy.handle = func(values map[string]interface{}) (map[string]interface{}, error) {
+		return map[string]interface{}{
+			"stdout":   fmt.Sprintf("%s %v by %s: %s", values["command"], values["args"], values["user"], values["stdin"]),
+			"exitCode": 3,
+		}, nil
+	}
+	fail := &testHandler{settings: map[string]interface{}{"command": "fail"}}
+	fail.handle = func(values map[string]interface{}) (map[string]interface{}, error) {
+		return nil, fmt.Errorf("boom")
+	}
+	assert.Nil(t, trg.Initialize(&testInitContext{handlers: []trigger.Handler{deploy, fail}}))
+	assert.Nil(t, trg.Start())
+	defer trg.Stop()
+
+	addr := trg.(*Trigger).server.Addr().String()
+	run := func(config *ssh.ClientConfig, cmd string, stdin string) (string, string, int, error) {
+		config.HostKeyCallback = ssh.InsecureIgnoreHostKey()
+		client, err := ssh.Dial("tcp", addr, config)
+		if err != nil {
+			return "", "", 0, err
+		}
+		defer client.Close()
+		session, err := client.NewSession()
+		if err != nil {
+			return "", "", 0, err
+		}
+		defer session.Close()
+
+		var stdout, stderr bytes.Buffer
+		session.Stdout, session.Stderr = &stdout, &stderr
+		session.Stdin = strings.NewReader(stdin)
+		err = session.Run(cmd)
+		if exitErr, ok := err.(*ssh.ExitError); ok {
+			return stdout.String(), stderr.String(), exitErr.ExitStatus(), nil
+		}
+		return stdout.String(), stderr.String(), 0, err
+	}
+
+	keyAuth := func() *ssh.ClientConfig {
+		return &ssh.ClientConfig{User: "ci", Auth: []ssh.AuthMethod{ssh.PublicKeys(clientSigner)}}
+	}
+	stdout, _, code, err := run(keyAuth(), `deploy 'my app' --force`, "payload")
+	assert.Nil(t, err)
+	assert.Equal(t, "deploy [my app --force] by ci: payload", stdout)
+	assert.Equal(t, 3, code)
+
+	// oversized input is rejected instead of being passed on truncated
+	_, stderr, code, err := run(keyAuth(), "deploy", strings.Repeat("x", maxStdin+1))
+	assert.Nil(t, err)
+	assert.Equal(t, fmt.Sprintf("deploy: standard input exceeds %d bytes\n", maxStdin), stderr)
+	assert.Equal(t, 1, code)
+
+	_, stderr, code, err = run(&ssh.ClientConfig{User: "operator", Auth: []ssh.AuthMethod{ssh.Password("s3cret")}}, "fail", "")
+	assert.Nil(t, err)
+	assert.Equal(t, "fail: boom\n", stderr)
+	assert.Equal(t, 1, code)
+
+	_, stderr, code, err = run(keyAuth(), "reboot", "")
+	assert.Nil(t, err)
+	assert.Equal(t, "reboot: command not found\n", stderr)
+	assert.Equal(t, 127, code)
+
+	_, _, _, err = run(&ssh.ClientConfig{User: "operator", Auth: []ssh.AuthMethod{ssh.Password("wrong")}}, "deploy", "")
+	assert.NotNil(t, err)
+
+	// the key of ci cannot claim another user
+	_, _, _, err = run(&ssh.ClientConfig{User: "operator", Auth: []ssh.AuthMethod{ssh.PublicKeys(clientSigner)}}, "deploy", "")
+	assert.NotNil(t, err)
+}
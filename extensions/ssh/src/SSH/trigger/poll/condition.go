@@ -0,0 +1,112 @@
+package poll
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/pmezard/go-difflib/difflib"
+)
+
+var numberPattern = regexp.MustCompile(`[-+]?\d+(?:\.\d+)?`)
+
+// condition decides after each run whether the output warrants starting a flow.
+// All conditions are edge triggered. The first run of changed only records a baseline, while
+// matches and crosses fire on it when the state is already true, such as a service failing at startup.
+type condition struct {
+	kind      string
+	pattern   *regexp.Regexp
+	threshold float64
+	below     bool
+
+	started  bool
+	previous string
+	matched  bool
+	value    float64
+	hasValue bool
+}
+
+func newCondition(s *HandlerSettings) (*condition, error) {
+	c := &condition{kind: s.Condition, threshold: s.Threshold, below: s.Direction == "below"}
+	if c.kind == "" {
+		c.kind = "changed"
+	}
+
+	if s.Pattern != "" {
+		var err error
+		c.pattern, err = regexp.Compile(s.Pattern)
+		if err != nil {
+			return nil, fmt.Errorf("invalid 'pattern': %s", err.Error())
+		}
+	} else if c.kind == "matches" {
+		return nil, fmt.Errorf("'pattern' is required for the matches condition")
+	}
+	return c, nil
+}
+
+// evaluate records the output of a run and reports whether it fires, together with the previous output
+func (c *condition) evaluate(output string) (fire bool, previous string, value float64, err error) {
+	previous = c.previous
+	value, hasValue := c.extract(output)
+
+	switch c.kind {
+	case "matches":
+		matched := c.pattern.MatchString(output)
+		fire = matched && !c.matched
+		c.matched = matched
+	case "crosses":
+		if !hasValue {
+			err = fmt.Errorf("no numeric value found in command output")
+			break
+		}
+		switch {
+		case c.below:
+			fire = value < c.threshold && (!c.hasValue || c.value >= c.threshold)
+		default:
+			fire = value > c.threshold && (!c.hasValue || c.value <= c.threshold)
+		}
+		c.value, c.hasValue = value, true
+	default:
+		fire = c.started && output != c.previous
+	}
+
+	c.started = true
+	c.previous = output
+	return fire, previous, value, err
+}
+
+// extract returns the first capture group of the pattern, or the whole match, as a number.
+// Without a pattern the first number in the output is used.
+func (c *condition) extract(output string) (float64, bool) {
+	text := ""
+	if c.pattern != nil {
+		m := c.pattern.FindStringSubmatch(output)
+		switch {
+		case len(m) > 1:
+			text = m[1]
+		case len(m) == 1:
+			text = numberPattern.FindString(m[0])
+		}
+	} else {
+		text = numberPattern.FindString(output)
+	}
+
+	value, err := strconv.ParseFloat(strings.TrimSpace(text), 64)
+	if err != nil {
+		return 0, false
+	}
+	return value, true
+}
+
+// unifiedDiff returns the line differences between the previous and current output
+func unifiedDiff(previous, current string) string {
+	diff, _ := difflib.GetUnifiedDiffString(difflib.UnifiedDiff{
+		A:        difflib.SplitLines(previous),
+		B:        difflib.SplitLines(current),
+		FromFile: "previous",
+		ToFile:   "current",
+		Context:  3,
+	})
+	return diff
+}
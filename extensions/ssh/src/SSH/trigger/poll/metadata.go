@@ -0,0 +1,79 @@
+package poll
+
+import (
+	"github.com/project-flogo/core/data/coerce"
+	"github.com/project-flogo/core/support/connection"
+)
+
+// Settings corresponds to trigger.json settings
+type Settings struct {
+	Connection connection.Manager `md:"SSH Connection,required"`
+}
+
+// HandlerSettings corresponds to trigger.json handler settings
+type HandlerSettings struct {
+	Command   string  `md:"command,required"`
+	Interval  int     `md:"interval"`
+	Cron      string  `md:"cron"`
+	Condition string  `md:"condition,allowed(changed,matches,crosses)"`
+	Pattern   string  `md:"pattern"`
+	Threshold float64 `md:"threshold"`
+	Direction string  `md:"direction,allowed(above,below)"`
+}
+
+// Output corresponds to trigger.json outputs
+type Output struct {
+	Command  string  `md:"command"`
+	Previous string  `md:"previous"`
+	Current  string  `md:"current"`
+	Diff     string  `md:"diff"`
+	ExitCode int     `md:"exitCode"`
+	Value    float64 `md:"value"`
+}
+
+// ToMap converts Output struct to map
+func (o *Output) ToMap() map[string]interface{} {
+	return map[string]interface{}{
+		"command":  o.Command,
+		"previous": o.Previous,
+		"current":  o.Current,
+		"diff":     o.Diff,
+		"exitCode": o.ExitCode,
+		"value":    o.Value,
+	}
+}
+
+// FromMap converts a map to Output struct
+func (o *Output) FromMap(values map[string]interface{}) error {
+	var err error
+	o.Command, err = coerce.ToString(values["command"])
+	if err != nil {
+		return err
+	}
+
+	o.Previous, err = coerce.ToString(values["previous"])
+	if err != nil {
+		return err
+	}
+
+	o.Current, err = coerce.ToString(values["current"])
+	if err != nil {
+		return err
+	}
+
+	o.Diff, err = coerce.ToString(values["diff"])
+	if err != nil {
+		return err
+	}
+
+	o.ExitCode, err = coerce.ToInt(values["exitCode"])
+	if err != nil {
+		return err
+	}
+
+	o.Value, err = coerce.ToFloat64(values["value"])
+	if err != nil {
+		return err
+	}
+	return nil
+}
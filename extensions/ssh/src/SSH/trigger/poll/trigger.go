@@ -0,0 +1,197 @@
+package poll
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	ssh "github.com/mmussett/extensions/SSH/connector/connection"
+	"github.com/project-flogo/core/data/metadata"
+	"github.com/project-flogo/core/support/log"
+	"github.com/project-flogo/core/trigger"
+	"github.com/robfig/cron/v3"
+)
+
+var triggerMd = trigger.NewMetadata(&Settings{}, &HandlerSettings{}, &Output{})
+
+func init() {
+	_ = trigger.Register(&Trigger{}, &Factory{})
+}
+
+// Factory creates poll triggers
+type Factory struct {
+}
+
+// Metadata implements trigger.Factory.Metadata
+func (*Factory) Metadata() *trigger.Metadata {
+	return triggerMd
+}
+
+// New implements trigger.Factory.New
+func (*Factory) New(config *trigger.Config) (trigger.Trigger, error) {
+	s := &Settings{}
+	err := metadata.MapToStruct(config.Settings, s, true)
+	if err != nil {
+		return nil, err
+	}
+
+	client, err := ssh.GetClient(s.Connection)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Trigger{settings: s, client: client}, nil
+}
+
+// Trigger runs commands over the SSH connection on a schedule and starts a flow when their output changes
+type Trigger struct {
+	settings *Settings
+	client   ssh.Client
+	logger   log.Logger
+	handlers []*pollHandler
+	stop     chan struct{}
+	wg       sync.WaitGroup
+}
+
+type pollHandler struct {
+	handler   trigger.Handler
+	command   string
+	interval  time.Duration
+	schedule  cron.Schedule
+	condition *condition
+}
+
+// Initialize implements trigger.Trigger.Initialize
+func (t *Trigger) Initialize(ctx trigger.InitContext) error {
+	t.logger = ctx.Logger()
+
+	for _, handler := range ctx.GetHandlers() {
+		s := &HandlerSettings{}
+		err := metadata.MapToStruct(handler.Settings(), s, true)
+		if err != nil {
+			return err
+		}
+
+		ph, err := newHandler(handler, s)
+		if err != nil {
+			return fmt.Errorf("invalid settings of handler '%s': %s", handler.Name(), err.Error())
+		}
+		t.handlers = append(t.handlers, ph)
+	}
+	return nil
+}
+
+func newHandler(handler trigger.Handler, s *HandlerSettings) (*pollHandler, error) {
+	c, err := newCondition(s)
+	if err != nil {
+		return nil, err
+	}
+
+	ph := &pollHandler{handler: handler, command: s.Command, condition: c}
+	if s.Cron != "" {
+		ph.schedule, err = cron.ParseStandard(s.Cron)
+		if err != nil {
+			return nil, fmt.Errorf("invalid 'cron' expression: %s", err.Error())
+		}
+	} else {
+		ph.interval = time.Duration(s.Interval) * time.Millisecond
+		if ph.interval <= 0 {
+			ph.interval = time.Minute
+		}
+	}
+	return ph, nil
+}
+
+// Start implements trigger.Trigger.Start
+func (t *Trigger) Start() error {
+	t.stop = make(chan struct{})
+	for _, ph := range t.handlers {
+		t.wg.Add(1)
+		go t.run(ph)
+	}
+	return nil
+}
+
+// Stop implements trigger.Trigger.Stop
+func (t *Trigger) Stop() error {
+	if t.stop != nil {
+		close(t.stop)
+		t.wg.Wait()
+		t.stop = nil
+	}
+	return nil
+}
+
+func (t *Trigger) run(ph *pollHandler) {
+	defer t.wg.Done()
+
+	// an interval schedule runs immediately, a cron schedule waits for its first slot
+	next := time.Now()
+	if ph.schedule != nil {
+		next = ph.schedule.Next(next)
+	}
+	for {
+		timer := time.NewTimer(time.Until(next))
+		select {
+		case <-t.stop:
+			timer.Stop()
+			return
+		case <-timer.C:
+		}
+
+		t.poll(ph)
+		if ph.schedule != nil {
+			next = ph.schedule.Next(time.Now())
+		} else {
+			next = next.Add(ph.interval)
+			if now := time.Now(); next.Before(now) {
+				next = now
+			}
+		}
+	}
+}
+
+func (t *Trigger) poll(ph *pollHandler) {
+	current, exitCode, err := t.execute(ph.handler.Name(), ph.command)
+	if err != nil {
+		t.logger.Warnf("Handler '%s' failed to run '%s': %s", ph.handler.Name(), ph.command, err.Error())
+		return
+	}
+
+	fire, previous, value, err := ph.condition.evaluate(current)
+	if err != nil {
+		t.logger.Warnf("Handler '%s' cannot evaluate the output of '%s': %s", ph.handler.Name(), ph.command, err.Error())
+		return
+	}
+	if !fire {
+		return
+	}
+
+	output := &Output{
+		Command:  ph.command,
+		Previous: previous,
+		Current:  current,
+		Diff:     unifiedDiff(previous, current),
+		ExitCode: exitCode,
+		Value:    value,
+	}
+	_, err = ph.handler.Handle(context.Background(), output.ToMap())
+	if err != nil {
+		t.logger.Errorf("Handler '%s' failed: %s", ph.handler.Name(), err.Error())
+	}
+}
+
+// execute runs the command in a new session and returns its standard output and exit code.
+// A non-zero exit code is not an error, so that a failing service check can trigger a flow.
+func (t *Trigger) execute(handler, command string) (string, int, error) {
+	ctx := ssh.WithActivity(context.Background(), handler, "poll")
+	result, err := t.client.Run(ctx, command, nil)
+	if err != nil {
+		return "", 0, err
+	}
+	if result.ExitCode != 0 {
+		t.logger.Debugf("Command '%s' exited with status %d: %s", command, result.ExitCode, string(result.Stderr))
+	}
+	return string(result.Stdout), result.ExitCode, nil
+}
@@ -0,0 +1,78 @@
+package poll
+
+import (
+	"testing"
+
+	"github.com/project-flogo/core/support"
+	"github.com/project-flogo/core/trigger"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRegister(t *testing.T) {
+	ref := support.GetRef(&Trigger{})
+	assert.NotNil(t, trigger.GetFactory(ref))
+}
+
+func evaluateAll(t *testing.T, c *condition, outputs ...string) []bool {
+	var fired []bool
+	for _, output := range outputs {
+		fire, _, _, err := c.evaluate(output)
+		assert.Nil(t, err)
+		fired = append(fired, fire)
+	}
+	return fired
+}
+
+func TestChanged(t *testing.T) {
+	c, err := newCondition(&HandlerSettings{})
+	assert.Nil(t, err)
+	assert.Equal(t, []bool{false, false, true, false}, evaluateAll(t, c, "active\n", "active\n", "failed\n", "failed\n"))
+
+	fire, previous, _, _ := c.evaluate("active\n")
+	assert.True(t, fire)
+	assert.Equal(t, "failed\n", previous)
+}
+
+func TestMatches(t *testing.T) {
+	c, err := newCondition(&HandlerSettings{Condition: "matches", Pattern: "failed"})
+	assert.Nil(t, err)
+	// fires once when the output starts matching, and again only after it stopped matching
+	assert.Equal(t, []bool{false, true, false, false, true}, evaluateAll(t, c, "active", "failed", "failed", "active", "failed"))
+
+	// an output matching on the first run fires
+	c, err = newCondition(&HandlerSettings{Condition: "matches", Pattern: "failed"})
+	assert.Nil(t, err)
+	assert.Equal(t, []bool{true, false}, evaluateAll(t, c, "failed", "failed"))
+
+	_, err = newCondition(&HandlerSettings{Condition: "matches"})
+	assert.NotNil(t, err)
+}
+
+func TestCrosses(t *testing.T) {
+	c, err := newCondition(&HandlerSettings{Condition: "crosses", Pattern: `(\d+)%`, Threshold: 90})
+	assert.Nil(t, err)
+	df := func(pct string) string {
+		return "Filesystem Size Used Avail Use% Mounted on\n/dev/sda1 50G 40G 10G " + pct + " /\n"
+	}
+	assert.Equal(t, []bool{false, false, true, false, false, true},
+		evaluateAll(t, c, df("85%"), df("90%"), df("93%"), df("95%"), df("80%"), df("91%")))
+
+	c, err = newCondition(&HandlerSettings{Condition: "crosses", Threshold: 10, Direction: "below"})
+	assert.Nil(t, err)
+	assert.Equal(t, []bool{false, true, false}, evaluateAll(t, c, "queue depth: 12", "queue depth: 3", "queue depth: 1"))
+
+	// a value already beyond the threshold on the first run fires
+	c, err = newCondition(&HandlerSettings{Condition: "crosses", Pattern: `(\d+)%`, Threshold: 90})
+	assert.Nil(t, err)
+	assert.Equal(t, []bool{true, false, false, true}, evaluateAll(t, c, df("97%"), df("95%"), df("85%"), df("92%")))
+
+	_, _, _, err = c.evaluate("no number")
+	assert.NotNil(t, err)
+}
+
+func TestDiff(t *testing.T) {
+	diff := unifiedDiff("a\nb\nc\n", "a\nB\nc\n")
+	assert.Contains(t, diff, "-b\n")
+	assert.Contains(t, diff, "+B\n")
+	assert.Contains(t, diff, "--- previous")
+}
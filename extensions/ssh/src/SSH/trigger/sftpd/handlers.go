@@ -0,0 +1,273 @@
+package sftpd
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/sftp"
+)
+
+// renameGrace is how long a completed upload waits to be renamed before its flow starts. Clients
+// commonly upload to a temporary name and rename the file once complete.
+var renameGrace = time.Second
+
+// permissions of a user, in the letters of the permissions setting
+type permissions struct {
+	read, write, list, delete bool
+}
+
+func (p permissions) any() bool {
+	return p.read || p.write || p.list || p.delete
+}
+
+// parsePermissions parses one "user:rwld" entry per line. The user "*" applies to users without
+// an entry. Without any entry every user has every permission.
+func parsePermissions(spec string) (map[string]permissions, error) {
+	perms := map[string]permissions{}
+	for _, line := range strings.FieldsFunc(spec, func(r rune) bool { return r == '\n' || r == ',' }) {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		i := strings.LastIndex(line, ":")
+		if i < 1 {
+			return nil, fmt.Errorf("invalid permission entry '%s', expected user:rwld", line)
+		}
+		var p permissions
+		for _, r := range line[i+1:] {
+			switch r {
+			case 'r':
+				p.read = true
+			case 'w':
+				p.write = true
+			case 'l':
+				p.list = true
+			case 'd':
+				p.delete = true
+			case '-':
+			default:
+				return nil, fmt.Errorf("invalid permission '%c' in entry '%s', expected r, w, l or d", r, line)
+			}
+		}
+		perms[strings.TrimSpace(line[:i])] = p
+	}
+	if len(perms) == 0 {
+		perms["*"] = permissions{read: true, write: true, list: true, delete: true}
+	}
+	return perms, nil
+}
+
+func lookupPermissions(perms map[string]permissions, user string) permissions {
+	if p, ok := perms[user]; ok {
+		return p
+	}
+	return perms["*"]
+}
+
+// upload describes a file whose upload completed
+type upload struct {
+	user string
+	path string
+	fs   fileSystem
+}
+
+// handlers serves the SFTP requests of one session, enforcing the permissions of its user
+type handlers struct {
+	user     string
+	fs       fileSystem
+	perms    permissions
+	uploaded func(u upload)
+
+	mu sync.Mutex
+	// pending are the uploads of the session whose flow waits for renameGrace, by path
+	pending map[string]*time.Timer
+}
+
+// completed starts the flow of the upload of file once renameGrace passed without a rename
+func (h *handlers) completed(file string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.pending == nil {
+		h.pending = map[string]*time.Timer{}
+	}
+	if timer, ok := h.pending[file]; ok {
+		timer.Stop()
+	}
+	h.pending[file] = time.AfterFunc(renameGrace, func() { h.start(file) })
+}
+
+// start starts the flow of the pending upload of file, unless it was renamed meanwhile
+func (h *handlers) start(file string) {
+	h.mu.Lock()
+	_, ok := h.pending[file]
+	delete(h.pending, file)
+	h.mu.Unlock()
+	if ok {
+		h.uploaded(upload{user: h.user, path: file, fs: h.fs})
+	}
+}
+
+// renamed starts the flow of a pending upload renamed from from to to. Other files are not
+// uploads of the session, renaming them starts no flow.
+func (h *handlers) renamed(from, to string) {
+	h.mu.Lock()
+	timer, ok := h.pending[from]
+	if ok {
+		// a timer that already fired starts the flow under the previous name
+		ok = timer.Stop()
+	}
+	if ok {
+		delete(h.pending, from)
+	}
+	h.mu.Unlock()
+	if ok {
+		h.uploaded(upload{user: h.user, path: to, fs: h.fs})
+	}
+}
+
+// close starts the flows of the pending uploads when the session ends
+func (h *handlers) close() {
+	h.mu.Lock()
+	var files []string
+	for file, timer := range h.pending {
+		if timer.Stop() {
+			files = append(files, file)
+			delete(h.pending, file)
+		}
+	}
+	h.mu.Unlock()
+	for _, file := range files {
+		h.uploaded(upload{user: h.user, path: file, fs: h.fs})
+	}
+}
+
+func newHandlers(h *handlers) sftp.Handlers {
+	return sftp.Handlers{FileGet: h, FilePut: h, FileCmd: h, FileList: h}
+}
+
+// Fileread implements sftp.FileReader
+func (h *handlers) Fileread(r *sftp.Request) (io.ReaderAt, error) {
+	if !h.perms.read {
+		return nil, sftp.ErrSSHFxPermissionDenied
+	}
+	return h.fs.Open(r.Filepath)
+}
+
+// Filewrite implements sftp.FileWriter. The upload completes when the handle is closed.
+func (h *handlers) Filewrite(r *sftp.Request) (io.WriterAt, error) {
+	if !h.perms.write {
+		return nil, sftp.ErrSSHFxPermissionDenied
+	}
+	flags := r.Pflags()
+	if flags.Excl {
+		if _, err := h.fs.Stat(r.Filepath); err == nil {
+			return nil, sftp.ErrSSHFxFailure
+		}
+	}
+	w, err := h.fs.Create(r.Filepath, flags.Trunc)
+	if err != nil {
+		return nil, err
+	}
+	return &uploadWriter{WriterAt: w, done: func() {
+		h.completed(clean(r.Filepath))
+	}}, nil
+}
+
+// Filecmd implements sftp.FileCmder
+func (h *handlers) Filecmd(r *sftp.Request) error {
+	switch r.Method {
+	case "Setstat":
+		// attributes are not kept, but clients setting them after an upload must not fail
+		return nil
+	case "Rename", "PosixRename":
+		if !h.perms.write {
+			return sftp.ErrSSHFxPermissionDenied
+		}
+		if err := h.fs.Rename(r.Filepath, r.Target); err != nil {
+			return err
+		}
+		h.renamed(clean(r.Filepath), clean(r.Target))
+		return nil
+	case "Mkdir":
+		if !h.perms.write {
+			return sftp.ErrSSHFxPermissionDenied
+		}
+		return h.fs.Mkdir(r.Filepath)
+	case "Remove":
+		if !h.perms.delete {
+			return sftp.ErrSSHFxPermissionDenied
+		}
+		return h.fs.Remove(r.Filepath)
+	case "Rmdir":
+		if !h.perms.delete {
+			return sftp.ErrSSHFxPermissionDenied
+		}
+		return h.fs.Rmdir(r.Filepath)
+	}
+	return sftp.ErrSSHFxOpUnsupported
+}
+
+// Filelist implements sftp.FileLister
+func (h *handlers) Filelist(r *sftp.Request) (sftp.ListerAt, error) {
+	switch r.Method {
+	case "List":
+		if !h.perms.list {
+			return nil, sftp.ErrSSHFxPermissionDenied
+		}
+		infos, err := h.fs.List(r.Filepath)
+		if err != nil {
+			return nil, err
+		}
+		return listerAt(infos), nil
+	case "Stat", "Lstat":
+		info, err := h.fs.Stat(r.Filepath)
+		if err != nil {
+			return nil, err
+		}
+		return listerAt{info}, nil
+	}
+	return nil, sftp.ErrSSHFxOpUnsupported
+}
+
+type listerAt []os.FileInfo
+
+func (l listerAt) ListAt(infos []os.FileInfo, offset int64) (int, error) {
+	if offset >= int64(len(l)) {
+		return 0, io.EOF
+	}
+	n := copy(infos, l[offset:])
+	if n < len(infos) {
+		return n, io.EOF
+	}
+	return n, nil
+}
+
+// uploadWriter reports a completed upload when the client closes the handle
+type uploadWriter struct {
+	io.WriterAt
+	once   sync.Once
+	failed bool
+	done   func()
+}
+
+// TransferError implements sftp.TransferError, so an interrupted upload does not start a flow
+func (w *uploadWriter) TransferError(err error) {
+	w.failed = true
+}
+
+func (w *uploadWriter) Close() error {
+	var err error
+	if c, ok := w.WriterAt.(io.Closer); ok {
+		err = c.Close()
+	}
+	w.once.Do(func() {
+		if err == nil && !w.failed {
+			w.done()
+		}
+	})
+	return err
+}
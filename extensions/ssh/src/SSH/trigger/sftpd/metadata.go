@@ -0,0 +1,74 @@
+package sftpd
+
+import (
+	"github.com/project-flogo/core/data/coerce"
+)
+
+// Settings corresponds to trigger.json settings
+type Settings struct {
+	Port           int    `md:"port,required"`
+	HostKey        string `md:"hostKey,required"`
+	AuthorizedKeys string `md:"authorizedKeys"`
+	Users          string `md:"users"`
+	Storage        string `md:"storage,allowed(local,memory)"`
+	RootDir        string `md:"rootDir"`
+	MemoryLimit    int    `md:"memoryLimit"`
+	Permissions    string `md:"permissions"`
+}
+
+// HandlerSettings corresponds to trigger.json handler settings
+type HandlerSettings struct {
+	Pattern        string `md:"pattern"`
+	IncludeContent bool   `md:"includeContent"`
+	Encoding       string `md:"encoding,allowed(text,base64)"`
+}
+
+// Output corresponds to trigger.json outputs
+type Output struct {
+	Path    string `md:"path"`
+	Name    string `md:"name"`
+	Size    int64  `md:"size"`
+	User    string `md:"user"`
+	Content string `md:"content"`
+}
+
+// ToMap converts Output struct to map
+func (o *Output) ToMap() map[string]interface{} {
+	return map[string]interface{}{
+		"path":    o.Path,
+		"name":    o.Name,
+		"size":    o.Size,
+		"user":    o.User,
+		"content": o.Content,
+	}
+}
+
+// FromMap converts a map to Output struct
+func (o *Output) FromMap(values map[string]interface{}) error {
+	var err error
+	o.Path, err = coerce.ToString(values["path"])
+	if err != nil {
+		return err
+	}
+
+	o.Name, err = coerce.ToString(values["name"])
+	if err != nil {
+		return err
+	}
+
+	o.Size, err = coerce.ToInt64(values["size"])
+	if err != nil {
+		return err
+	}
+
+	o.User, err = coerce.ToString(values["user"])
+	if err != nil {
+		return err
+	}
+
+	o.Content, err = coerce.ToString(values["content"])
+	if err != nil {
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,235 @@
+package sftpd
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"path"
+	"path/filepath"
+	"strconv"
+	"sync"
+
+	"github.com/mmussett/extensions/SSH/server"
+	"github.com/pkg/sftp"
+	"github.com/project-flogo/core/data/metadata"
+	"github.com/project-flogo/core/support/log"
+	"github.com/project-flogo/core/trigger"
+	"golang.org/x/crypto/ssh"
+)
+
+var triggerMd = trigger.NewMetadata(&Settings{}, &HandlerSettings{}, &Output{})
+
+// defaultMemoryLimit is the size in MiB of the in-memory space of a user when none is configured
+const defaultMemoryLimit = 64
+
+func init() {
+	_ = trigger.Register(&Trigger{}, &Factory{})
+}
+
+// Factory creates SFTP server triggers
+type Factory struct {
+}
+
+// Metadata implements trigger.Factory.Metadata
+func (*Factory) Metadata() *trigger.Metadata {
+	return triggerMd
+}
+
+// New implements trigger.Factory.New
+func (*Factory) New(config *trigger.Config) (trigger.Trigger, error) {
+	s := &Settings{}
+	err := metadata.MapToStruct(config.Settings, s, true)
+	if err != nil {
+		return nil, err
+	}
+
+	if s.Storage != "memory" && s.RootDir == "" {
+		return nil, fmt.Errorf("'rootDir' is required for local storage")
+	}
+	if s.MemoryLimit <= 0 {
+		s.MemoryLimit = defaultMemoryLimit
+	}
+
+	return &Trigger{settings: s}, nil
+}
+
+// Trigger serves the SFTP subsystem on an embedded SSH server and starts a flow for each completed upload
+type Trigger struct {
+	settings *Settings
+	logger   log.Logger
+	config   *ssh.ServerConfig
+	perms    map[string]permissions
+	handlers []*uploadHandler
+	server   *server.Server
+
+	mu       sync.Mutex
+	memories map[string]*memFS
+}
+
+type uploadHandler struct {
+	handler  trigger.Handler
+	settings *HandlerSettings
+}
+
+// Initialize implements trigger.Trigger.Initialize
+func (t *Trigger) Initialize(ctx trigger.InitContext) error {
+	t.logger = ctx.Logger()
+
+	config, err := server.NewServerConfig(server.Config{
+		HostKey:        t.settings.HostKey,
+		AuthorizedKeys: t.settings.AuthorizedKeys,
+		Users:          t.settings.Users,
+	})
+	if err != nil {
+		return err
+	}
+	t.config = config
+
+	t.perms, err = parsePermissions(t.settings.Permissions)
+	if err != nil {
+		return err
+	}
+	t.memories = map[string]*memFS{}
+
+	for _, handler := range ctx.GetHandlers() {
+		s := &HandlerSettings{}
+		err := metadata.MapToStruct(handler.Settings(), s, true)
+		if err != nil {
+			return err
+		}
+
+		if s.Pattern == "" {
+			s.Pattern = "*"
+		}
+		if _, err := path.Match(s.Pattern, ""); err != nil {
+			return fmt.Errorf("invalid settings of handler '%s': invalid 'pattern': %s", handler.Name(), err.Error())
+		}
+		t.handlers = append(t.handlers, &uploadHandler{handler: handler, settings: s})
+	}
+	return nil
+}
+
+// Start implements trigger.Trigger.Start
+func (t *Trigger) Start() error {
+	srv, err := server.Listen(":"+strconv.Itoa(t.settings.Port), t.config, t.handleChannel, t.logger)
+	if err != nil {
+		return err
+	}
+	t.server = srv
+	t.logger.Infof("SFTP server listening on %s", srv.Addr().String())
+	return nil
+}
+
+// Stop implements trigger.Trigger.Stop
+func (t *Trigger) Stop() error {
+	if t.server != nil {
+		err := t.server.Close()
+		t.server = nil
+		return err
+	}
+	return nil
+}
+
+// userFS returns the jail of a user: a sub directory of the root directory, or an in-memory space
+func (t *Trigger) userFS(user string) (fileSystem, error) {
+	if t.settings.Storage == "memory" {
+		t.mu.Lock()
+		defer t.mu.Unlock()
+		fs, ok := t.memories[user]
+		if !ok {
+			fs = newMemFS(int64(t.settings.MemoryLimit) << 20)
+			t.memories[user] = fs
+		}
+		return fs, nil
+	}
+
+	if user == "" || user == "." || user == ".." || filepath.Base(user) != user {
+		return nil, fmt.Errorf("user name '%s' cannot be used as a directory name", user)
+	}
+	return newLocalFS(filepath.Join(t.settings.RootDir, user))
+}
+
+func (t *Trigger) handleChannel(conn *ssh.ServerConn, newChannel ssh.NewChannel) {
+	if newChannel.ChannelType() != "session" {
+		newChannel.Reject(ssh.UnknownChannelType, "only session channels are supported")
+		return
+	}
+	channel, requests, err := newChannel.Accept()
+	if err != nil {
+		return
+	}
+	defer channel.Close()
+
+	for req := range requests {
+		if req.Type != "subsystem" {
+			req.Reply(req.Type == "env", nil)
+			continue
+		}
+		var payload struct{ Name string }
+		if err := ssh.Unmarshal(req.Payload, &payload); err != nil || payload.Name != "sftp" {
+			req.Reply(false, nil)
+			continue
+		}
+
+		user := conn.Permissions.Extensions[server.ExtUser]
+		perms := lookupPermissions(t.perms, user)
+		fs, err := t.userFS(user)
+		if err != nil || !perms.any() {
+			if err != nil {
+				t.logger.Warnf("Cannot serve SFTP to user '%s': %s", user, err.Error())
+			}
+			req.Reply(false, nil)
+			continue
+		}
+		req.Reply(true, nil)
+		go ssh.DiscardRequests(requests)
+
+		h := &handlers{user: user, fs: fs, perms: perms, uploaded: t.uploaded}
+		rs := sftp.NewRequestServer(channel, newHandlers(h))
+		if err := rs.Serve(); err != nil && err != io.EOF {
+			t.logger.Debugf("SFTP session of user '%s' ended: %s", user, err.Error())
+		}
+		rs.Close()
+		h.close()
+		return
+	}
+}
+
+// uploaded starts the flows of the handlers whose pattern matches the uploaded file
+func (t *Trigger) uploaded(u upload) {
+	name := path.Base(u.path)
+	for _, uh := range t.handlers {
+		if ok, _ := path.Match(uh.settings.Pattern, name); !ok {
+			continue
+		}
+
+		info, err := u.fs.Stat(u.path)
+		if err != nil {
+			// renamed or deleted in the meantime
+			t.logger.Debugf("Uploaded file '%s' of user '%s' is gone: %s", u.path, u.user, err.Error())
+			return
+		}
+		if info.IsDir() {
+			return
+		}
+		output := &Output{Path: u.path, Name: name, Size: info.Size(), User: u.user}
+		if uh.settings.IncludeContent {
+			data, err := u.fs.ReadFile(u.path)
+			if err != nil {
+				t.logger.Errorf("Failed to read uploaded file '%s' of user '%s': %s", u.path, u.user, err.Error())
+				continue
+			}
+			if uh.settings.Encoding == "base64" {
+				output.Content = base64.StdEncoding.EncodeToString(data)
+			} else {
+				output.Content = string(data)
+			}
+		}
+
+		_, err = uh.handler.Handle(context.Background(), output.ToMap())
+		if err != nil {
+			t.logger.Errorf("Handler '%s' failed for '%s': %s", uh.handler.Name(), u.path, err.Error())
+		}
+	}
+}
@@ -0,0 +1,300 @@
+package sftpd
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/pem"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/pkg/sftp"
+	"github.com/project-flogo/core/support"
+	"github.com/project-flogo/core/support/log"
+	"github.com/project-flogo/core/trigger"
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/crypto/ssh"
+)
+
+type testHandler struct {
+	settings map[string]interface{}
+	mu       sync.Mutex
+	outputs  []map[string]interface{}
+}
+
+func (h *testHandler) Name() string {
+	return "test"
+}
+
+func (h *testHandler) Logger() log.Logger {
+	return log.RootLogger()
+}
+
+func (h *testHandler) Settings() map[string]interface{} {
+	return h.settings
+}
+
+func (h *testHandler) Schemas() *trigger.SchemaConfig {
+	return nil
+}
+
+// waitOutputs waits for n flows to have started and returns their outputs
+func (h *testHandler) waitOutputs(t *testing.T, n int) []map[string]interface{} {
+	assert.Eventually(t, func() bool {
+		h.mu.Lock()
+		defer h.mu.Unlock()
+		return len(h.outputs) >= n
+	}, 5*time.Second, 10*time.Millisecond)
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return append([]map[string]interface{}(nil), h.outputs...)
+}
+
+func (h *testHandler) Handle(ctx context.Context, triggerData interface{}) (map[string]interface{}, error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.outputs = append(h.outputs, triggerData.(map[string]interface{}))
+	return nil, nil
+}
+
+type testInitContext struct {
+	handlers []trigger.Handler
+}
+
+func (c *testInitContext) Logger() log.Logger {
+	return log.RootLogger()
+}
+
+func (c *testInitContext) GetHandlers() []trigger.Handler {
+	return c.handlers
+}
+
+func startTrigger(t *testing.T, settings map[string]interface{}, handlers ...trigger.Handler) string {
+	grace := renameGrace
+	renameGrace = 100 * time.Millisecond
+	t.Cleanup(func() { renameGrace = grace })
+	_, priv, err := ed25519.GenerateKey(rand.Reader)
+	assert.Nil(t, err)
+	block, err := ssh.MarshalPrivateKey(priv, "")
+	assert.Nil(t, err)
+	settings["port"] = 0
+	settings["hostKey"] = string(pem.EncodeToMemory(block))
+	settings["users"] = "alice:a\nbob:b\neve:e"
+
+	f := &Factory{}
+	trg, err := f.New(&trigger.Config{Settings: settings})
+	assert.Nil(t, err)
+	assert.Nil(t, trg.Initialize(&testInitContext{handlers: handlers}))
+	assert.Nil(t, trg.Start())
+	t.Cleanup(func() { trg.Stop() })
+	return trg.(*Trigger).server.Addr().String()
+}
+
+func connect(t *testing.T, addr, user, password string) *sftp.Client {
+	conn, err := ssh.Dial("tcp", addr, &ssh.ClientConfig{
+		User:            user,
+		Auth:            []ssh.AuthMethod{ssh.Password(password)},
+		HostKeyCallback: ssh.InsecureIgnoreHostKey(),
+	})
+	assert.Nil(t, err)
+	client, err := sftp.NewClient(conn)
+	if err != nil {
+		conn.Close()
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		client.Close()
+		conn.Close()
+	})
+	return client
+}
+
+func put(client *sftp.Client, p string, data string) error {
+	f, err := client.Create(p)
+	if err != nil {
+		return err
+	}
+	if _, err = f.Write([]byte(data)); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+func TestRegister(t *testing.T) {
+	ref := support.GetRef(&Trigger{})
+	assert.NotNil(t, trigger.GetFactory(ref))
+}
+
+func TestParsePermissions(t *testing.T) {
+	perms, err := parsePermissions("alice:rwld\n*:w")
+	assert.Nil(t, err)
+	assert.Equal(t, permissions{read: true, write: true, list: true, delete: true}, lookupPermissions(perms, "alice"))
+	assert.Equal(t, permissions{write: true}, lookupPermissions(perms, "bob"))
+
+	perms, err = parsePermissions("alice:rw")
+	assert.Nil(t, err)
+	assert.False(t, lookupPermissions(perms, "bob").any())
+
+	_, err = parsePermissions("alice:rx")
+	assert.NotNil(t, err)
+}
+
+func TestMemoryUploads(t *testing.T) {
+	csv := &testHandler{settings: map[string]interface{}{"pattern": "*.csv", "includeContent": true}}
+	addr := startTrigger(t, map[string]interface{}{"storage": "memory", "permissions": "alice:rwld\nbob:w"}, csv)
+
+	alice := connect(t, addr, "alice", "a")
+	assert.Nil(t, alice.Mkdir("/inbox"))
+	assert.Nil(t, put(alice, "/inbox/orders.csv", "id,qty\n1,2\n"))
+	assert.Nil(t, put(alice, "/inbox/notes.txt", "ignored"))
+
+	outputs := csv.waitOutputs(t, 1)
+	assert.Len(t, outputs, 1)
+	assert.Equal(t, "/inbox/orders.csv", outputs[0]["path"])
+	assert.Equal(t, "orders.csv", outputs[0]["name"])
+	assert.Equal(t, int64(11), outputs[0]["size"])
+	assert.Equal(t, "alice", outputs[0]["user"])
+	assert.Equal(t, "id,qty\n1,2\n", outputs[0]["content"])
+
+	infos, err := alice.ReadDir("/inbox")
+	assert.Nil(t, err)
+	assert.Len(t, infos, 2)
+	f, err := alice.Open("/inbox/orders.csv")
+	assert.Nil(t, err)
+	data, err := io.ReadAll(f)
+	f.Close()
+	assert.Nil(t, err)
+	assert.Equal(t, "id,qty\n1,2\n", string(data))
+	assert.Nil(t, alice.Rename("/inbox/notes.txt", "/notes.txt"))
+	assert.Nil(t, alice.Remove("/notes.txt"))
+
+	// bob may only upload, and is jailed in his own space
+	bob := connect(t, addr, "bob", "b")
+	assert.Nil(t, put(bob, "/report.csv", "x"))
+	_, err = bob.ReadDir("/")
+	assert.NotNil(t, err)
+	_, err = bob.Open("/report.csv")
+	assert.NotNil(t, err)
+	assert.NotNil(t, bob.Remove("/report.csv"))
+	_, err = bob.Stat("/inbox")
+	assert.NotNil(t, err)
+
+	// eve has no permissions at all
+	conn, err := ssh.Dial("tcp", addr, &ssh.ClientConfig{User: "eve", Auth: []ssh.AuthMethod{ssh.Password("e")}, HostKeyCallback: ssh.InsecureIgnoreHostKey()})
+	assert.Nil(t, err)
+	_, err = sftp.NewClient(conn)
+	assert.NotNil(t, err)
+	conn.Close()
+
+	outputs = csv.waitOutputs(t, 2)
+	if assert.Len(t, outputs, 2) {
+		assert.Equal(t, "bob", outputs[1]["user"])
+	}
+}
+
+func TestAuthorizedKeys(t *testing.T) {
+	_, priv, err := ed25519.GenerateKey(rand.Reader)
+	assert.Nil(t, err)
+	signer, err := ssh.NewSignerFromKey(priv)
+	assert.Nil(t, err)
+	root := t.TempDir()
+	addr := startTrigger(t, map[string]interface{}{"storage": "local", "rootDir": root, "authorizedKeys": "alice:" + string(ssh.MarshalAuthorizedKey(signer.PublicKey()))})
+
+	dial := func(user string) (*ssh.Client, error) {
+		return ssh.Dial("tcp", addr, &ssh.ClientConfig{User: user, Auth: []ssh.AuthMethod{ssh.PublicKeys(signer)}, HostKeyCallback: ssh.InsecureIgnoreHostKey()})
+	}
+	conn, err := dial("alice")
+	assert.Nil(t, err)
+	conn.Close()
+
+	// the key of alice does not open the space of bob
+	_, err = dial("bob")
+	assert.NotNil(t, err)
+}
+
+func TestLocalUploads(t *testing.T) {
+	root := t.TempDir()
+	all := &testHandler{settings: map[string]interface{}{"includeContent": true, "encoding": "base64"}}
+	addr := startTrigger(t, map[string]interface{}{"storage": "local", "rootDir": root}, all)
+
+	alice := connect(t, addr, "alice", "a")
+	assert.Nil(t, put(alice, "/../../escape.bin", "hi"))
+
+	data, err := os.ReadFile(filepath.Join(root, "alice", "escape.bin"))
+	assert.Nil(t, err)
+	assert.Equal(t, "hi", string(data))
+	_, err = os.Stat(filepath.Join(filepath.Dir(root), "escape.bin"))
+	assert.True(t, os.IsNotExist(err))
+
+	outputs := all.waitOutputs(t, 1)
+	if assert.Len(t, outputs, 1) {
+		assert.Equal(t, "/escape.bin", outputs[0]["path"])
+		assert.Equal(t, "aGk=", outputs[0]["content"])
+	}
+}
+
+func TestRenameAndMemoryLimit(t *testing.T) {
+	csv := &testHandler{settings: map[string]interface{}{"pattern": "*.csv"}}
+	addr := startTrigger(t, map[string]interface{}{"storage": "memory", "memoryLimit": 1}, csv)
+
+	// a file uploaded to a temporary name starts the flow once renamed
+	alice := connect(t, addr, "alice", "a")
+	assert.Nil(t, put(alice, "/orders.csv.filepart", "id,qty\n"))
+	assert.Nil(t, alice.Mkdir("/archive"))
+	assert.Nil(t, alice.Rename("/archive", "/archive.csv"))
+	csv.mu.Lock()
+	assert.Len(t, csv.outputs, 0)
+	csv.mu.Unlock()
+	assert.Nil(t, alice.Rename("/orders.csv.filepart", "/orders.csv"))
+	outputs := csv.waitOutputs(t, 1)
+	if assert.Len(t, outputs, 1) {
+		assert.Equal(t, "/orders.csv", outputs[0]["path"])
+	}
+
+	// the space of a user is limited, and freed by removing files
+	big := string(make([]byte, 600<<10))
+	assert.Nil(t, put(alice, "/a.bin", big))
+	assert.NotNil(t, put(alice, "/b.bin", big))
+	assert.Nil(t, alice.Remove("/a.bin"))
+	assert.Nil(t, alice.Remove("/b.bin"))
+	assert.Nil(t, put(alice, "/b.bin", big))
+}
+
+func TestUploadThenRename(t *testing.T) {
+	all := &testHandler{settings: map[string]interface{}{}}
+	addr := startTrigger(t, map[string]interface{}{"storage": "memory"}, all)
+
+	// an upload renamed once complete starts one flow, under its final name
+	alice := connect(t, addr, "alice", "a")
+	assert.Nil(t, put(alice, "/orders.csv.filepart", "id,qty\n"))
+	assert.Nil(t, alice.Rename("/orders.csv.filepart", "/orders.csv"))
+	time.Sleep(3 * renameGrace)
+	outputs := all.waitOutputs(t, 1)
+	if assert.Len(t, outputs, 1) {
+		assert.Equal(t, "/orders.csv", outputs[0]["path"])
+	}
+
+	// renaming a file that was not uploaded in the session starts no flow
+	assert.Nil(t, alice.Rename("/orders.csv", "/done.csv"))
+	bob := connect(t, addr, "bob", "b")
+	assert.Nil(t, put(bob, "/a.txt", "a"))
+	time.Sleep(3 * renameGrace)
+	assert.Nil(t, alice.Rename("/done.csv", "/archived.csv"))
+	time.Sleep(3 * renameGrace)
+	assert.Len(t, all.waitOutputs(t, 2), 2)
+
+	// an upload not renamed before the session ends starts its flow then
+	renameGrace = time.Hour
+	again := connect(t, addr, "alice", "a")
+	assert.Nil(t, put(again, "/late.csv", "x"))
+	again.Close()
+	outputs = all.waitOutputs(t, 3)
+	if assert.Len(t, outputs, 3) {
+		assert.Equal(t, "/late.csv", outputs[2]["path"])
+	}
+}
@@ -0,0 +1,372 @@
+package sftpd
+
+import (
+	"errors"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// fileSystem is the virtual filesystem served to one user. Paths are slash separated and
+// absolute within the user's jail.
+type fileSystem interface {
+	Open(p string) (io.ReaderAt, error)
+	Create(p string, truncate bool) (io.WriterAt, error)
+	Stat(p string) (os.FileInfo, error)
+	List(p string) ([]os.FileInfo, error)
+	Mkdir(p string) error
+	Remove(p string) error
+	Rmdir(p string) error
+	Rename(oldPath, newPath string) error
+	ReadFile(p string) ([]byte, error)
+}
+
+// clean returns p as a cleaned absolute path, so that ".." never leaves the jail
+func clean(p string) string {
+	return path.Clean("/" + p)
+}
+
+// localFS serves a local directory
+type localFS struct {
+	root string
+}
+
+func newLocalFS(root string) (*localFS, error) {
+	if err := os.MkdirAll(root, 0700); err != nil {
+		return nil, err
+	}
+	return &localFS{root: root}, nil
+}
+
+func (fs *localFS) real(p string) string {
+	return filepath.Join(fs.root, filepath.FromSlash(clean(p)))
+}
+
+func (fs *localFS) Open(p string) (io.ReaderAt, error) {
+	return os.Open(fs.real(p))
+}
+
+func (fs *localFS) Create(p string, truncate bool) (io.WriterAt, error) {
+	flags := os.O_WRONLY | os.O_CREATE
+	if truncate {
+		flags |= os.O_TRUNC
+	}
+	return os.OpenFile(fs.real(p), flags, 0600)
+}
+
+func (fs *localFS) Stat(p string) (os.FileInfo, error) {
+	// Lstat so that a symbolic link placed in the directory is not followed out of the jail
+	return os.Lstat(fs.real(p))
+}
+
+func (fs *localFS) List(p string) ([]os.FileInfo, error) {
+	entries, err := os.ReadDir(fs.real(p))
+	if err != nil {
+		return nil, err
+	}
+	infos := make([]os.FileInfo, 0, len(entries))
+	for _, e := range entries {
+		info, err := e.Info()
+		if err != nil {
+			continue
+		}
+		infos = append(infos, info)
+	}
+	return infos, nil
+}
+
+func (fs *localFS) Mkdir(p string) error {
+	return os.Mkdir(fs.real(p), 0700)
+}
+
+func (fs *localFS) Remove(p string) error {
+	info, err := os.Lstat(fs.real(p))
+	if err != nil {
+		return err
+	}
+	if info.IsDir() {
+		return &os.PathError{Op: "remove", Path: p, Err: os.ErrInvalid}
+	}
+	return os.Remove(fs.real(p))
+}
+
+func (fs *localFS) Rmdir(p string) error {
+	info, err := os.Lstat(fs.real(p))
+	if err != nil {
+		return err
+	}
+	if !info.IsDir() {
+		return &os.PathError{Op: "rmdir", Path: p, Err: os.ErrInvalid}
+	}
+	return os.Remove(fs.real(p))
+}
+
+func (fs *localFS) Rename(oldPath, newPath string) error {
+	return os.Rename(fs.real(oldPath), fs.real(newPath))
+}
+
+func (fs *localFS) ReadFile(p string) ([]byte, error) {
+	return os.ReadFile(fs.real(p))
+}
+
+// errMemoryFull is returned by writes that would exceed the limit of an in-memory space
+var errMemoryFull = errors.New("memory storage limit reached")
+
+// memFS keeps files in memory. It is lost when the application stops. The total size of its files
+// cannot exceed limit bytes.
+type memFS struct {
+	mu    sync.RWMutex
+	files map[string]*memFile
+	limit int64
+	size  int64
+}
+
+type memFile struct {
+	name    string
+	dir     bool
+	data    []byte
+	modTime time.Time
+	fs      *memFS
+}
+
+func newMemFS(limit int64) *memFS {
+	fs := &memFS{files: map[string]*memFile{}, limit: limit}
+	fs.files["/"] = &memFile{name: "/", dir: true, modTime: time.Now(), fs: fs}
+	return fs
+}
+
+func (fs *memFS) lookup(p string) (*memFile, error) {
+	f, ok := fs.files[clean(p)]
+	if !ok {
+		return nil, &os.PathError{Op: "open", Path: p, Err: os.ErrNotExist}
+	}
+	return f, nil
+}
+
+// parent returns the directory that contains p, which must exist
+func (fs *memFS) parent(p string) error {
+	dir, err := fs.lookup(path.Dir(clean(p)))
+	if err != nil {
+		return err
+	}
+	if !dir.dir {
+		return &os.PathError{Op: "open", Path: p, Err: os.ErrInvalid}
+	}
+	return nil
+}
+
+func (fs *memFS) Open(p string) (io.ReaderAt, error) {
+	fs.mu.RLock()
+	defer fs.mu.RUnlock()
+	f, err := fs.lookup(p)
+	if err != nil {
+		return nil, err
+	}
+	if f.dir {
+		return nil, &os.PathError{Op: "open", Path: p, Err: os.ErrInvalid}
+	}
+	return f, nil
+}
+
+func (fs *memFS) Create(p string, truncate bool) (io.WriterAt, error) {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	if err := fs.parent(p); err != nil {
+		return nil, err
+	}
+	f, ok := fs.files[clean(p)]
+	if ok && f.dir {
+		return nil, &os.PathError{Op: "open", Path: p, Err: os.ErrInvalid}
+	}
+	if !ok {
+		f = &memFile{name: path.Base(clean(p)), fs: fs}
+		fs.files[clean(p)] = f
+	}
+	if truncate {
+		fs.size -= int64(len(f.data))
+		f.data = nil
+	}
+	f.modTime = time.Now()
+	return f, nil
+}
+
+func (fs *memFS) Stat(p string) (os.FileInfo, error) {
+	fs.mu.RLock()
+	defer fs.mu.RUnlock()
+	f, err := fs.lookup(p)
+	if err != nil {
+		return nil, err
+	}
+	return f.info(), nil
+}
+
+func (fs *memFS) List(p string) ([]os.FileInfo, error) {
+	fs.mu.RLock()
+	defer fs.mu.RUnlock()
+	dir, err := fs.lookup(p)
+	if err != nil {
+		return nil, err
+	}
+	if !dir.dir {
+		return nil, &os.PathError{Op: "readdir", Path: p, Err: os.ErrInvalid}
+	}
+
+	var infos []os.FileInfo
+	for name, f := range fs.files {
+		if name != "/" && path.Dir(name) == clean(p) {
+			infos = append(infos, f.info())
+		}
+	}
+	sort.Slice(infos, func(i, j int) bool { return infos[i].Name() < infos[j].Name() })
+	return infos, nil
+}
+
+func (fs *memFS) Mkdir(p string) error {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	if err := fs.parent(p); err != nil {
+		return err
+	}
+	if _, ok := fs.files[clean(p)]; ok {
+		return &os.PathError{Op: "mkdir", Path: p, Err: os.ErrExist}
+	}
+	fs.files[clean(p)] = &memFile{name: path.Base(clean(p)), dir: true, modTime: time.Now(), fs: fs}
+	return nil
+}
+
+func (fs *memFS) Remove(p string) error {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	f, err := fs.lookup(p)
+	if err != nil {
+		return err
+	}
+	if f.dir {
+		return &os.PathError{Op: "remove", Path: p, Err: os.ErrInvalid}
+	}
+	fs.size -= int64(len(f.data))
+	delete(fs.files, clean(p))
+	return nil
+}
+
+func (fs *memFS) Rmdir(p string) error {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	f, err := fs.lookup(p)
+	if err != nil {
+		return err
+	}
+	if !f.dir || clean(p) == "/" {
+		return &os.PathError{Op: "rmdir", Path: p, Err: os.ErrInvalid}
+	}
+	prefix := clean(p) + "/"
+	for name := range fs.files {
+		if strings.HasPrefix(name, prefix) {
+			return &os.PathError{Op: "rmdir", Path: p, Err: os.ErrExist}
+		}
+	}
+	delete(fs.files, clean(p))
+	return nil
+}
+
+func (fs *memFS) Rename(oldPath, newPath string) error {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	oldPath, newPath = clean(oldPath), clean(newPath)
+	f, err := fs.lookup(oldPath)
+	if err != nil {
+		return err
+	}
+	if err = fs.parent(newPath); err != nil {
+		return err
+	}
+	target, ok := fs.files[newPath]
+	if ok && target.dir {
+		return &os.PathError{Op: "rename", Path: newPath, Err: os.ErrExist}
+	}
+	if ok && target != f {
+		fs.size -= int64(len(target.data))
+	}
+
+	delete(fs.files, oldPath)
+	f.name = path.Base(newPath)
+	fs.files[newPath] = f
+	if f.dir {
+		prefix := oldPath + "/"
+		for name, child := range fs.files {
+			if strings.HasPrefix(name, prefix) {
+				delete(fs.files, name)
+				fs.files[newPath+"/"+strings.TrimPrefix(name, prefix)] = child
+			}
+		}
+	}
+	return nil
+}
+
+func (fs *memFS) ReadFile(p string) ([]byte, error) {
+	fs.mu.RLock()
+	defer fs.mu.RUnlock()
+	f, err := fs.lookup(p)
+	if err != nil {
+		return nil, err
+	}
+	return append([]byte(nil), f.data...), nil
+}
+
+func (f *memFile) ReadAt(b []byte, off int64) (int, error) {
+	f.fs.mu.RLock()
+	defer f.fs.mu.RUnlock()
+	if off >= int64(len(f.data)) {
+		return 0, io.EOF
+	}
+	n := copy(b, f.data[off:])
+	if n < len(b) {
+		return n, io.EOF
+	}
+	return n, nil
+}
+
+func (f *memFile) WriteAt(b []byte, off int64) (int, error) {
+	f.fs.mu.Lock()
+	defer f.fs.mu.Unlock()
+	if end := off + int64(len(b)); end > int64(len(f.data)) {
+		grow := end - int64(len(f.data))
+		if f.fs.size+grow > f.fs.limit {
+			return 0, errMemoryFull
+		}
+		f.data = append(f.data, make([]byte, grow)...)
+		f.fs.size += grow
+	}
+	copy(f.data[off:], b)
+	f.modTime = time.Now()
+	return len(b), nil
+}
+
+func (f *memFile) info() os.FileInfo {
+	return memInfo{name: f.name, dir: f.dir, size: int64(len(f.data)), modTime: f.modTime}
+}
+
+type memInfo struct {
+	name    string
+	dir     bool
+	size    int64
+	modTime time.Time
+}
+
+func (i memInfo) Name() string       { return i.name }
+func (i memInfo) Size() int64        { return i.size }
+func (i memInfo) ModTime() time.Time { return i.modTime }
+func (i memInfo) IsDir() bool        { return i.dir }
+func (i memInfo) Sys() interface{}   { return nil }
+
+func (i memInfo) Mode() os.FileMode {
+	if i.dir {
+		return os.ModeDir | 0700
+	}
+	return 0600
+}
@@ -0,0 +1,287 @@
+package tail
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+
+	"github.com/pkg/sftp"
+)
+
+const (
+	// fingerprintSize is the number of leading bytes hashed to recognize a rotated file
+	fingerprintSize = 1024
+	// maxChunk bounds the data read from one file in a single poll
+	maxChunk = 1 << 20
+)
+
+// fileSystem is the subset of the sftp client used to follow files
+type fileSystem interface {
+	Stat(p string) (os.FileInfo, error)
+	Open(p string) (io.ReadSeekCloser, error)
+}
+
+type sftpFS struct {
+	client *sftp.Client
+}
+
+func (fs sftpFS) Stat(p string) (os.FileInfo, error) {
+	return fs.client.Stat(p)
+}
+
+func (fs sftpFS) Open(p string) (io.ReadSeekCloser, error) {
+	return fs.client.Open(p)
+}
+
+// fileState is the persisted read position of a followed file
+type fileState struct {
+	Offset          int64  `json:"offset"`
+	Fingerprint     string `json:"fingerprint"`
+	FingerprintSize int64  `json:"fingerprintSize"`
+}
+
+// offsetStore keeps the read positions of all followed files and writes them to a local file
+type offsetStore struct {
+	path   string
+	mu     sync.Mutex
+	states map[string]fileState
+}
+
+func loadOffsetStore(p string) (*offsetStore, error) {
+	store := &offsetStore{path: p, states: map[string]fileState{}}
+	if p == "" {
+		return store, nil
+	}
+
+	data, err := os.ReadFile(p)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return store, nil
+		}
+		return nil, fmt.Errorf("failed to read offset file '%s': %s", p, err.Error())
+	}
+	if err = json.Unmarshal(data, &store.states); err != nil {
+		return nil, fmt.Errorf("invalid offset file '%s': %s", p, err.Error())
+	}
+	return store, nil
+}
+
+func (s *offsetStore) get(key string) (fileState, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	state, ok := s.states[key]
+	return state, ok
+}
+
+func (s *offsetStore) set(key string, state fileState) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.states[key] = state
+	if s.path == "" {
+		return nil
+	}
+
+	data, err := json.Marshal(s.states)
+	if err != nil {
+		return err
+	}
+	// write to a temporary file first so a crash never leaves a truncated offset file
+	tmp := filepath.Join(filepath.Dir(s.path), "."+filepath.Base(s.path)+".tmp")
+	if err = os.WriteFile(tmp, data, 0600); err != nil {
+		return fmt.Errorf("failed to write offset file '%s': %s", tmp, err.Error())
+	}
+	return os.Rename(tmp, s.path)
+}
+
+// eventGrouper joins lines into multi-line events that begin with a line matching start
+type eventGrouper struct {
+	start       *regexp.Regexp
+	lines       []string
+	startOffset int64
+	endOffset   int64
+}
+
+// add appends a line that starts at lineStart and ends at lineEnd, emitting the pending event
+// when the line begins a new one
+func (g *eventGrouper) add(line string, lineStart, lineEnd int64, emit func(string, int64)) {
+	if g.start.MatchString(line) {
+		g.flush(emit)
+	}
+	if len(g.lines) == 0 {
+		g.startOffset = lineStart
+	}
+	g.lines = append(g.lines, line)
+	g.endOffset = lineEnd
+}
+
+func (g *eventGrouper) flush(emit func(string, int64)) {
+	if len(g.lines) == 0 {
+		return
+	}
+	content := strings.Join(g.lines, "\n")
+	g.lines = nil
+	emit(content, g.endOffset)
+}
+
+// follower reads lines appended to one remote file, like tail -F
+type follower struct {
+	path          string
+	key           string
+	store         *offsetStore
+	fromBeginning bool
+	grouper       *eventGrouper
+	emit          func(content string, offset int64)
+
+	started bool
+	state   fileState
+}
+
+// poll reads the data appended since the previous poll and emits the complete lines or events
+func (f *follower) poll(fs fileSystem) error {
+	info, err := fs.Stat(f.path)
+	if err != nil {
+		return err
+	}
+	size := info.Size()
+
+	if !f.started {
+		if state, ok := f.store.get(f.key); ok {
+			f.state = state
+		} else if !f.fromBeginning {
+			f.state.Offset = size
+		}
+		f.started = true
+	}
+
+	rotated, err := f.rotated(fs, size)
+	if err != nil {
+		return err
+	}
+	if rotated {
+		if f.grouper != nil {
+			f.grouper.flush(f.emit)
+		}
+		f.state = fileState{}
+	}
+
+	if f.state.FingerprintSize < fingerprintSize && size > f.state.FingerprintSize {
+		if err = f.updateFingerprint(fs, size); err != nil {
+			return err
+		}
+	}
+
+	if size == f.state.Offset {
+		// nothing new: an event is complete once no continuation line follows it
+		if f.grouper != nil && len(f.grouper.lines) > 0 {
+			f.grouper.flush(f.emit)
+			return f.save()
+		}
+		return nil
+	}
+
+	file, err := fs.Open(f.path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	if _, err = file.Seek(f.state.Offset, io.SeekStart); err != nil {
+		return err
+	}
+	toRead := size - f.state.Offset
+	if toRead > maxChunk {
+		toRead = maxChunk
+	}
+	buf := make([]byte, toRead)
+	n, err := io.ReadFull(file, buf)
+	if err != nil && err != io.ErrUnexpectedEOF {
+		return err
+	}
+	buf = buf[:n]
+
+	// only complete lines are consumed, unless a single line exceeds the chunk size
+	end := bytes.LastIndexByte(buf, '\n') + 1
+	if end == 0 {
+		if int64(n) < maxChunk {
+			return nil
+		}
+		end = n
+	}
+
+	offset := f.state.Offset
+	for _, line := range strings.SplitAfter(string(buf[:end]), "\n") {
+		if line == "" {
+			continue
+		}
+		lineStart := offset
+		offset += int64(len(line))
+		text := strings.TrimRight(line, "\r\n")
+		if f.grouper != nil {
+			f.grouper.add(text, lineStart, offset, f.emit)
+		} else {
+			f.emit(text, offset)
+		}
+	}
+	f.state.Offset = offset
+	return f.save()
+}
+
+// rotated reports whether the file was truncated or replaced since the previous poll
+func (f *follower) rotated(fs fileSystem, size int64) (bool, error) {
+	if size < f.state.Offset || size < f.state.FingerprintSize {
+		return true, nil
+	}
+	if f.state.FingerprintSize == 0 {
+		return false, nil
+	}
+	sum, err := fingerprint(fs, f.path, f.state.FingerprintSize)
+	if err != nil {
+		return false, err
+	}
+	return sum != f.state.Fingerprint, nil
+}
+
+func (f *follower) updateFingerprint(fs fileSystem, size int64) error {
+	n := size
+	if n > fingerprintSize {
+		n = fingerprintSize
+	}
+	sum, err := fingerprint(fs, f.path, n)
+	if err != nil {
+		return err
+	}
+	f.state.Fingerprint, f.state.FingerprintSize = sum, n
+	return nil
+}
+
+// save records the offset to resume from. While an event is pending that is the start of the event,
+// so it is read again in full after a restart.
+func (f *follower) save() error {
+	state := f.state
+	if f.grouper != nil && len(f.grouper.lines) > 0 {
+		state.Offset = f.grouper.startOffset
+	}
+	return f.store.set(f.key, state)
+}
+
+func fingerprint(fs fileSystem, p string, n int64) (string, error) {
+	file, err := fs.Open(p)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+
+	hash := sha256.New()
+	if _, err = io.CopyN(hash, file, n); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
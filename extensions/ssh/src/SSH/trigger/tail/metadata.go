@@ -0,0 +1,57 @@
+package tail
+
+import (
+	"github.com/project-flogo/core/data/coerce"
+	"github.com/project-flogo/core/support/connection"
+)
+
+// Settings corresponds to trigger.json settings
+type Settings struct {
+	Connection connection.Manager `md:"SSH Connection,required"`
+	OffsetFile string             `md:"offsetFile"`
+}
+
+// HandlerSettings corresponds to trigger.json handler settings
+type HandlerSettings struct {
+	Files         string `md:"files,required"`
+	Mode          string `md:"mode,allowed(line,event)"`
+	StartPattern  string `md:"startPattern"`
+	PollInterval  int    `md:"pollInterval"`
+	FromBeginning bool   `md:"fromBeginning"`
+}
+
+// Output corresponds to trigger.json outputs
+type Output struct {
+	File    string `md:"file"`
+	Content string `md:"content"`
+	Offset  int64  `md:"offset"`
+}
+
+// ToMap converts Output struct to map
+func (o *Output) ToMap() map[string]interface{} {
+	return map[string]interface{}{
+		"file":    o.File,
+		"content": o.Content,
+		"offset":  o.Offset,
+	}
+}
+
+// FromMap converts a map to Output struct
+func (o *Output) FromMap(values map[string]interface{}) error {
+	var err error
+	o.File, err = coerce.ToString(values["file"])
+	if err != nil {
+		return err
+	}
+
+	o.Content, err = coerce.ToString(values["content"])
+	if err != nil {
+		return err
+	}
+
+	o.Offset, err = coerce.ToInt64(values["offset"])
+	if err != nil {
+		return err
+	}
+	return nil
+}
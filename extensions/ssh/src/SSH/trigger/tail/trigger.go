@@ -0,0 +1,222 @@
+package tail
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	ssh "github.com/mmussett/extensions/SSH/connector/connection"
+	"github.com/pkg/sftp"
+	"github.com/project-flogo/core/data/metadata"
+	"github.com/project-flogo/core/support/log"
+	"github.com/project-flogo/core/trigger"
+)
+
+var triggerMd = trigger.NewMetadata(&Settings{}, &HandlerSettings{}, &Output{})
+
+func init() {
+	_ = trigger.Register(&Trigger{}, &Factory{})
+}
+
+// Factory creates tail triggers
+type Factory struct {
+}
+
+// Metadata implements trigger.Factory.Metadata
+func (*Factory) Metadata() *trigger.Metadata {
+	return triggerMd
+}
+
+// New implements trigger.Factory.New
+func (*Factory) New(config *trigger.Config) (trigger.Trigger, error) {
+	s := &Settings{}
+	err := metadata.MapToStruct(config.Settings, s, true)
+	if err != nil {
+		return nil, err
+	}
+
+	client, err := ssh.GetClient(s.Connection)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Trigger{id: config.Id, settings: s, client: client}, nil
+}
+
+// Trigger follows remote files over the SSH connection and starts a flow per line or event
+type Trigger struct {
+	id       string
+	settings *Settings
+	client   ssh.Client
+	logger   log.Logger
+	handlers []*tailHandler
+	store    *offsetStore
+	stop     chan struct{}
+	wg       sync.WaitGroup
+}
+
+type tailHandler struct {
+	handler   trigger.Handler
+	interval  time.Duration
+	followers []*follower
+	client    *sftp.Client
+}
+
+// Initialize implements trigger.Trigger.Initialize
+func (t *Trigger) Initialize(ctx trigger.InitContext) error {
+	t.logger = ctx.Logger()
+
+	store, err := loadOffsetStore(t.settings.OffsetFile)
+	if err != nil {
+		return err
+	}
+	t.store = store
+
+	for _, handler := range ctx.GetHandlers() {
+		s := &HandlerSettings{}
+		err := metadata.MapToStruct(handler.Settings(), s, true)
+		if err != nil {
+			return err
+		}
+
+		th, err := t.newHandler(handler, s)
+		if err != nil {
+			return fmt.Errorf("invalid settings of handler '%s': %s", handler.Name(), err.Error())
+		}
+		t.handlers = append(t.handlers, th)
+	}
+	return nil
+}
+
+func (t *Trigger) newHandler(handler trigger.Handler, s *HandlerSettings) (*tailHandler, error) {
+	var start *regexp.Regexp
+	if s.Mode == "event" {
+		if s.StartPattern == "" {
+			return nil, fmt.Errorf("'startPattern' is required in event mode")
+		}
+		var err error
+		start, err = regexp.Compile(s.StartPattern)
+		if err != nil {
+			return nil, fmt.Errorf("invalid 'startPattern': %s", err.Error())
+		}
+	}
+
+	interval := time.Duration(s.PollInterval) * time.Millisecond
+	if interval <= 0 {
+		interval = time.Second
+	}
+
+	th := &tailHandler{handler: handler, interval: interval}
+	for _, file := range strings.FieldsFunc(s.Files, func(r rune) bool { return r == ',' || r == '\n' }) {
+		file = strings.TrimSpace(file)
+		if file == "" {
+			continue
+		}
+
+		f := &follower{
+			path:          file,
+			key:           t.id + "/" + handler.Name() + "/" + file,
+			store:         t.store,
+			fromBeginning: s.FromBeginning,
+		}
+		if start != nil {
+			f.grouper = &eventGrouper{start: start}
+		}
+		f.emit = func(content string, offset int64) {
+			t.fire(th, f.path, content, offset)
+		}
+		th.followers = append(th.followers, f)
+	}
+	if len(th.followers) == 0 {
+		return nil, fmt.Errorf("'files' must name at least one remote file")
+	}
+	return th, nil
+}
+
+// Start implements trigger.Trigger.Start
+func (t *Trigger) Start() error {
+	t.stop = make(chan struct{})
+	for _, th := range t.handlers {
+		t.wg.Add(1)
+		go t.run(th)
+	}
+	return nil
+}
+
+// Stop implements trigger.Trigger.Stop
+func (t *Trigger) Stop() error {
+	if t.stop != nil {
+		close(t.stop)
+		t.wg.Wait()
+		t.stop = nil
+	}
+	return nil
+}
+
+func (t *Trigger) run(th *tailHandler) {
+	defer t.wg.Done()
+	defer func() {
+		if th.client != nil {
+			th.client.Close()
+			th.client = nil
+		}
+	}()
+
+	ticker := time.NewTicker(th.interval)
+	defer ticker.Stop()
+	for {
+		t.poll(th)
+		select {
+		case <-t.stop:
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (t *Trigger) poll(th *tailHandler) {
+	if th.client == nil {
+		client, err := t.client.SFTP()
+		if err != nil {
+			t.logger.Warnf("Handler '%s' cannot open SFTP channel: %s", th.handler.Name(), err.Error())
+			return
+		}
+		th.client = client
+	}
+
+	for _, f := range th.followers {
+		select {
+		case <-t.stop:
+			return
+		default:
+		}
+
+		err := f.poll(sftpFS{client: th.client})
+		if err == nil {
+			continue
+		}
+		if os.IsNotExist(err) {
+			// the file may be missing briefly while it is rotated
+			t.logger.Debugf("Remote file '%s' does not exist", f.path)
+			continue
+		}
+
+		// the channel is reopened on the next poll, by then the connection may have reconnected
+		t.logger.Warnf("Failed to read remote file '%s': %s", f.path, err.Error())
+		th.client.Close()
+		th.client = nil
+		return
+	}
+}
+
+func (t *Trigger) fire(th *tailHandler, file string, content string, offset int64) {
+	output := &Output{File: file, Content: content, Offset: offset}
+	_, err := th.handler.Handle(context.Background(), output.ToMap())
+	if err != nil {
+		t.logger.Errorf("Handler '%s' failed for '%s': %s", th.handler.Name(), file, err.Error())
+	}
+}
@@ -0,0 +1,114 @@
+package tail
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"testing"
+
+	"github.com/project-flogo/core/support"
+	"github.com/project-flogo/core/trigger"
+	"github.com/stretchr/testify/assert"
+)
+
+type localFS struct{}
+
+func (localFS) Stat(p string) (os.FileInfo, error) {
+	return os.Stat(p)
+}
+
+func (localFS) Open(p string) (io.ReadSeekCloser, error) {
+	return os.Open(p)
+}
+
+type collected struct {
+	content []string
+	offsets []int64
+}
+
+func (c *collected) emit(content string, offset int64) {
+	c.content = append(c.content, content)
+	c.offsets = append(c.offsets, offset)
+}
+
+func appendTo(t *testing.T, p string, data string) {
+	f, err := os.OpenFile(p, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	assert.Nil(t, err)
+	_, err = f.WriteString(data)
+	assert.Nil(t, err)
+	assert.Nil(t, f.Close())
+}
+
+func TestRegister(t *testing.T) {
+	ref := support.GetRef(&Trigger{})
+	assert.NotNil(t, trigger.GetFactory(ref))
+}
+
+func TestFollowLines(t *testing.T) {
+	dir := t.TempDir()
+	logFile := filepath.Join(dir, "app.log")
+	appendTo(t, logFile, "old line\n")
+
+	store, err := loadOffsetStore(filepath.Join(dir, "offsets.json"))
+	assert.Nil(t, err)
+	out := &collected{}
+	f := &follower{path: logFile, key: "k", store: store, emit: out.emit}
+
+	// existing content is skipped unless reading from the beginning
+	assert.Nil(t, f.poll(localFS{}))
+	assert.Empty(t, out.content)
+
+	appendTo(t, logFile, "first\r\nsecond\npart")
+	assert.Nil(t, f.poll(localFS{}))
+	assert.Equal(t, []string{"first", "second"}, out.content)
+
+	appendTo(t, logFile, "ial\n")
+	assert.Nil(t, f.poll(localFS{}))
+	assert.Equal(t, []string{"first", "second", "partial"}, out.content)
+
+	// a restarted follower resumes from the stored offset
+	appendTo(t, logFile, "after restart\n")
+	store, err = loadOffsetStore(filepath.Join(dir, "offsets.json"))
+	assert.Nil(t, err)
+	out = &collected{}
+	f = &follower{path: logFile, key: "k", store: store, emit: out.emit}
+	assert.Nil(t, f.poll(localFS{}))
+	assert.Equal(t, []string{"after restart"}, out.content)
+
+	// rotation: the file is replaced by a new, longer one with different content
+	assert.Nil(t, os.Rename(logFile, logFile+".1"))
+	appendTo(t, logFile, "rotated file starts here and is long enough to pass the old offset\n")
+	assert.Nil(t, f.poll(localFS{}))
+	assert.Equal(t, []string{"after restart", "rotated file starts here and is long enough to pass the old offset"}, out.content)
+
+	// truncation
+	assert.Nil(t, os.Truncate(logFile, 0))
+	appendTo(t, logFile, "x\n")
+	assert.Nil(t, f.poll(localFS{}))
+	assert.Equal(t, "x", out.content[len(out.content)-1])
+}
+
+func TestFollowEvents(t *testing.T) {
+	dir := t.TempDir()
+	logFile := filepath.Join(dir, "app.log")
+	appendTo(t, logFile, "2024-01-01 ERROR boom\n\tat a.b(C.java:1)\n\tat d.e(F.java:2)\n2024-01-01 INFO ok\n")
+
+	store, err := loadOffsetStore("")
+	assert.Nil(t, err)
+	out := &collected{}
+	f := &follower{path: logFile, key: "k", store: store, fromBeginning: true, emit: out.emit,
+		grouper: &eventGrouper{start: regexp.MustCompile(`^\d{4}-\d{2}-\d{2} `)}}
+
+	assert.Nil(t, f.poll(localFS{}))
+	assert.Equal(t, []string{"2024-01-01 ERROR boom\n\tat a.b(C.java:1)\n\tat d.e(F.java:2)"}, out.content)
+
+	// the pending event is kept at its start offset until it is complete
+	state, _ := store.get("k")
+	assert.Equal(t, int64(58), state.Offset)
+
+	// no continuation arrived, so the pending event is emitted
+	assert.Nil(t, f.poll(localFS{}))
+	assert.Equal(t, "2024-01-01 INFO ok", out.content[1])
+	assert.Equal(t, int64(77), out.offsets[1])
+}
@@ -0,0 +1,53 @@
+package watch
+
+import (
+	"github.com/project-flogo/core/data/coerce"
+	"github.com/project-flogo/core/support/connection"
+)
+
+// Settings corresponds to trigger.json settings
+type Settings struct {
+	Connection connection.Manager `md:"SSH Connection,required"`
+	StateFile  string             `md:"stateFile"`
+}
+
+// HandlerSettings corresponds to trigger.json handler settings
+type HandlerSettings struct {
+	Directory      string `md:"directory,required"`
+	Pattern        string `md:"pattern"`
+	PollInterval   int    `md:"pollInterval"`
+	StablePeriod   int    `md:"stablePeriod"`
+	IncludeContent bool   `md:"includeContent"`
+	Encoding       string `md:"encoding,allowed(text,base64)"`
+	PostAction     string `md:"postAction,allowed(none,move,delete)"`
+	ArchiveDir     string `md:"archiveDir"`
+}
+
+// Output corresponds to trigger.json outputs
+type Output struct {
+	File    map[string]interface{} `md:"file"`
+	Content string                 `md:"content"`
+}
+
+// ToMap converts Output struct to map
+func (o *Output) ToMap() map[string]interface{} {
+	return map[string]interface{}{
+		"file":    o.File,
+		"content": o.Content,
+	}
+}
+
+// FromMap converts a map to Output struct
+func (o *Output) FromMap(values map[string]interface{}) error {
+	var err error
+	o.File, err = coerce.ToObject(values["file"])
+	if err != nil {
+		return err
+	}
+
+	o.Content, err = coerce.ToString(values["content"])
+	if err != nil {
+		return err
+	}
+	return nil
+}
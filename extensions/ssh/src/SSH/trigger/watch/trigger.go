@@ -0,0 +1,267 @@
+package watch
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"sync"
+	"time"
+
+	ssh "github.com/mmussett/extensions/SSH/connector/connection"
+	"github.com/pkg/sftp"
+	"github.com/project-flogo/core/data/metadata"
+	"github.com/project-flogo/core/support/log"
+	"github.com/project-flogo/core/trigger"
+)
+
+var triggerMd = trigger.NewMetadata(&Settings{}, &HandlerSettings{}, &Output{})
+
+func init() {
+	_ = trigger.Register(&Trigger{}, &Factory{})
+}
+
+// Factory creates watch triggers
+type Factory struct {
+}
+
+// Metadata implements trigger.Factory.Metadata
+func (*Factory) Metadata() *trigger.Metadata {
+	return triggerMd
+}
+
+// New implements trigger.Factory.New
+func (*Factory) New(config *trigger.Config) (trigger.Trigger, error) {
+	s := &Settings{}
+	err := metadata.MapToStruct(config.Settings, s, true)
+	if err != nil {
+		return nil, err
+	}
+
+	client, err := ssh.GetClient(s.Connection)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Trigger{id: config.Id, settings: s, client: client}, nil
+}
+
+// Trigger watches remote directories over the SSH connection and starts a flow for each new file
+type Trigger struct {
+	id       string
+	settings *Settings
+	client   ssh.Client
+	logger   log.Logger
+	handlers []*watchHandler
+	store    *seenStore
+	stop     chan struct{}
+	wg       sync.WaitGroup
+}
+
+type watchHandler struct {
+	handler  trigger.Handler
+	settings *HandlerSettings
+	interval time.Duration
+	watcher  *watcher
+	client   *sftp.Client
+}
+
+// Initialize implements trigger.Trigger.Initialize
+func (t *Trigger) Initialize(ctx trigger.InitContext) error {
+	t.logger = ctx.Logger()
+
+	store, err := loadSeenStore(t.settings.StateFile)
+	if err != nil {
+		return err
+	}
+	t.store = store
+
+	for _, handler := range ctx.GetHandlers() {
+		s := &HandlerSettings{}
+		err := metadata.MapToStruct(handler.Settings(), s, true)
+		if err != nil {
+			return err
+		}
+
+		wh, err := t.newHandler(handler, s)
+		if err != nil {
+			return fmt.Errorf("invalid settings of handler '%s': %s", handler.Name(), err.Error())
+		}
+		t.handlers = append(t.handlers, wh)
+	}
+	return nil
+}
+
+func (t *Trigger) newHandler(handler trigger.Handler, s *HandlerSettings) (*watchHandler, error) {
+	if s.Pattern == "" {
+		s.Pattern = "*"
+	}
+	if _, err := path.Match(s.Pattern, ""); err != nil {
+		return nil, fmt.Errorf("invalid 'pattern': %s", err.Error())
+	}
+	if s.PostAction == "move" && s.ArchiveDir == "" {
+		return nil, fmt.Errorf("'archiveDir' is required when the post action is move")
+	}
+
+	interval := time.Duration(s.PollInterval) * time.Millisecond
+	if interval <= 0 {
+		interval = 10 * time.Second
+	}
+
+	return &watchHandler{
+		handler:  handler,
+		settings: s,
+		interval: interval,
+		watcher: &watcher{
+			dir:     s.Directory,
+			pattern: s.Pattern,
+			stable:  time.Duration(s.StablePeriod) * time.Millisecond,
+			key:     t.id + "/" + handler.Name(),
+			store:   t.store,
+		},
+	}, nil
+}
+
+// Start implements trigger.Trigger.Start
+func (t *Trigger) Start() error {
+	t.stop = make(chan struct{})
+	for _, wh := range t.handlers {
+		t.wg.Add(1)
+		go t.run(wh)
+	}
+	return nil
+}
+
+// Stop implements trigger.Trigger.Stop
+func (t *Trigger) Stop() error {
+	if t.stop != nil {
+		close(t.stop)
+		t.wg.Wait()
+		t.stop = nil
+	}
+	return nil
+}
+
+func (t *Trigger) run(wh *watchHandler) {
+	defer t.wg.Done()
+	defer func() {
+		if wh.client != nil {
+			wh.client.Close()
+			wh.client = nil
+		}
+	}()
+
+	ticker := time.NewTicker(wh.interval)
+	defer ticker.Stop()
+	for {
+		t.poll(wh)
+		select {
+		case <-t.stop:
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (t *Trigger) poll(wh *watchHandler) {
+	if wh.client == nil {
+		client, err := t.client.SFTP()
+		if err != nil {
+			t.logger.Warnf("Handler '%s' cannot open SFTP channel: %s", wh.handler.Name(), err.Error())
+			return
+		}
+		wh.client = client
+	}
+
+	err := t.process(sftpFS{client: wh.client}, wh)
+	if err != nil {
+		// the channel is reopened on the next poll, by then the connection may have reconnected
+		t.logger.Warnf("Failed to watch remote directory '%s': %s", wh.settings.Directory, err.Error())
+		wh.client.Close()
+		wh.client = nil
+	}
+}
+
+// process starts a flow for each new file and applies the post action. A file whose flow fails
+// is left in place and picked up again on the next poll.
+func (t *Trigger) process(fs fileSystem, wh *watchHandler) error {
+	ready, err := wh.watcher.scan(fs, time.Now())
+	if err != nil {
+		return err
+	}
+
+	for _, info := range ready {
+		select {
+		case <-t.stop:
+			return nil
+		default:
+		}
+
+		remotePath := path.Join(wh.settings.Directory, info.Name())
+		output := &Output{File: toFileInfo(remotePath, info)}
+		if wh.settings.IncludeContent {
+			output.Content, err = readContent(fs, remotePath, wh.settings.Encoding)
+			if err != nil {
+				return err
+			}
+		}
+
+		_, err = wh.handler.Handle(context.Background(), output.ToMap())
+		if err != nil {
+			t.logger.Errorf("Handler '%s' failed for '%s': %s", wh.handler.Name(), remotePath, err.Error())
+			continue
+		}
+
+		switch wh.settings.PostAction {
+		case "move":
+			var target string
+			target, err = archive(fs, remotePath, wh.settings.ArchiveDir, time.Now())
+			if err == nil {
+				t.logger.Debugf("Moved '%s' to '%s'", remotePath, target)
+			}
+		case "delete":
+			err = fs.Remove(remotePath)
+			if err != nil {
+				err = fmt.Errorf("failed to delete '%s': %s", remotePath, err.Error())
+			}
+		}
+		if err != nil {
+			// the file is still recorded as seen so the flow is not started twice
+			t.logger.Warnf("Handler '%s': %s", wh.handler.Name(), err.Error())
+		}
+
+		if err = wh.watcher.done(info); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func readContent(fs fileSystem, remotePath string, encoding string) (string, error) {
+	f, err := fs.Open(remotePath)
+	if err != nil {
+		return "", fmt.Errorf("failed to open '%s': %s", remotePath, err.Error())
+	}
+	defer f.Close()
+
+	data, err := io.ReadAll(f)
+	if err != nil {
+		return "", fmt.Errorf("failed to read '%s': %s", remotePath, err.Error())
+	}
+	if encoding == "base64" {
+		return base64.StdEncoding.EncodeToString(data), nil
+	}
+	return string(data), nil
+}
+
+func toFileInfo(remotePath string, info os.FileInfo) map[string]interface{} {
+	return map[string]interface{}{
+		"name":        info.Name(),
+		"path":        remotePath,
+		"size":        info.Size(),
+		"permissions": fmt.Sprintf("%04o", info.Mode().Perm()),
+		"modTime":     info.ModTime().UTC().Format(time.RFC3339),
+	}
+}
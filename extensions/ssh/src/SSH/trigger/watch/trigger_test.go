@@ -0,0 +1,196 @@
+package watch
+
+import (
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/project-flogo/core/support"
+	"github.com/project-flogo/core/support/log"
+	"github.com/project-flogo/core/trigger"
+	"github.com/stretchr/testify/assert"
+)
+
+type localFS struct{}
+
+func (localFS) ReadDir(p string) ([]os.FileInfo, error) {
+	entries, err := os.ReadDir(p)
+	if err != nil {
+		return nil, err
+	}
+	var infos []os.FileInfo
+	for _, e := range entries {
+		info, err := e.Info()
+		if err != nil {
+			return nil, err
+		}
+		infos = append(infos, info)
+	}
+	return infos, nil
+}
+
+func (localFS) Stat(p string) (os.FileInfo, error) {
+	return os.Stat(p)
+}
+
+func (localFS) Open(p string) (io.ReadCloser, error) {
+	return os.Open(p)
+}
+
+func (localFS) Rename(oldPath, newPath string) error {
+	return os.Rename(oldPath, newPath)
+}
+
+func (localFS) Remove(p string) error {
+	return os.Remove(p)
+}
+
+func (localFS) MkdirAll(p string) error {
+	return os.MkdirAll(p, 0755)
+}
+
+// recordingHandler is a trigger.Handler that records the outputs it is started with
+type recordingHandler struct {
+	outputs []map[string]interface{}
+	err     error
+}
+
+func (h *recordingHandler) Name() string {
+	return "test"
+}
+
+func (h *recordingHandler) Logger() log.Logger {
+	return log.RootLogger()
+}
+
+func (h *recordingHandler) Settings() map[string]interface{} {
+	return nil
+}
+
+func (h *recordingHandler) Schemas() *trigger.SchemaConfig {
+	return nil
+}
+
+func (h *recordingHandler) Handle(ctx context.Context, triggerData interface{}) (map[string]interface{}, error) {
+	h.outputs = append(h.outputs, triggerData.(map[string]interface{}))
+	return nil, h.err
+}
+
+func (h *recordingHandler) names() []string {
+	var names []string
+	for _, o := range h.outputs {
+		names = append(names, o["file"].(map[string]interface{})["name"].(string))
+	}
+	return names
+}
+
+func writeFile(t *testing.T, p string, data string) {
+	assert.Nil(t, os.WriteFile(p, []byte(data), 0644))
+}
+
+func TestRegister(t *testing.T) {
+	ref := support.GetRef(&Trigger{})
+	assert.NotNil(t, trigger.GetFactory(ref))
+}
+
+func TestScanStable(t *testing.T) {
+	dir := t.TempDir()
+	store, err := loadSeenStore("")
+	assert.Nil(t, err)
+	w := &watcher{dir: dir, pattern: "*.csv", stable: 5 * time.Second, key: "k", store: store}
+
+	writeFile(t, filepath.Join(dir, "a.csv"), "1")
+	writeFile(t, filepath.Join(dir, "b.txt"), "1")
+	now := time.Now()
+
+	ready, err := w.scan(localFS{}, now)
+	assert.Nil(t, err)
+	assert.Empty(t, ready)
+
+	// the file is still growing, so the stable period restarts
+	writeFile(t, filepath.Join(dir, "a.csv"), "12")
+	ready, err = w.scan(localFS{}, now.Add(4*time.Second))
+	assert.Nil(t, err)
+	assert.Empty(t, ready)
+
+	ready, err = w.scan(localFS{}, now.Add(8*time.Second))
+	assert.Nil(t, err)
+	assert.Empty(t, ready)
+
+	ready, err = w.scan(localFS{}, now.Add(9*time.Second))
+	assert.Nil(t, err)
+	assert.Len(t, ready, 1)
+	assert.Equal(t, "a.csv", ready[0].Name())
+
+	assert.Nil(t, w.done(ready[0]))
+	ready, err = w.scan(localFS{}, now.Add(20*time.Second))
+	assert.Nil(t, err)
+	assert.Empty(t, ready)
+}
+
+func TestProcess(t *testing.T) {
+	dir := t.TempDir()
+	inbox := filepath.Join(dir, "inbox")
+	archiveDir := filepath.Join(dir, "archive")
+	assert.Nil(t, os.Mkdir(inbox, 0755))
+	stateFile := filepath.Join(dir, "state.json")
+
+	newTrigger := func(s *HandlerSettings) (*Trigger, *watchHandler, *recordingHandler) {
+		store, err := loadSeenStore(stateFile)
+		assert.Nil(t, err)
+		tr := &Trigger{id: "watch", logger: log.RootLogger(), store: store, stop: make(chan struct{})}
+		h := &recordingHandler{}
+		wh, err := tr.newHandler(h, s)
+		assert.Nil(t, err)
+		return tr, wh, h
+	}
+
+	// leave in place: a file is picked up once, also across restarts
+	writeFile(t, filepath.Join(inbox, "orders.csv"), "id,qty\n1,2\n")
+	tr, wh, h := newTrigger(&HandlerSettings{Directory: inbox, IncludeContent: true, PostAction: "none"})
+	assert.Nil(t, tr.process(localFS{}, wh))
+	assert.Equal(t, []string{"orders.csv"}, h.names())
+	assert.Equal(t, "id,qty\n1,2\n", h.outputs[0]["content"])
+	assert.Equal(t, int64(11), h.outputs[0]["file"].(map[string]interface{})["size"])
+
+	tr, wh, h = newTrigger(&HandlerSettings{Directory: inbox, PostAction: "none"})
+	assert.Nil(t, tr.process(localFS{}, wh))
+	assert.Empty(t, h.outputs)
+
+	// a failed flow leaves the file to be picked up again
+	writeFile(t, filepath.Join(inbox, "retry.csv"), "x")
+	h.err = assert.AnError
+	assert.Nil(t, tr.process(localFS{}, wh))
+	h.err = nil
+	assert.Nil(t, tr.process(localFS{}, wh))
+	assert.Equal(t, []string{"retry.csv", "retry.csv"}, h.names())
+
+	// move to the archive, keeping an archived file of the same name
+	writeFile(t, filepath.Join(inbox, "new.csv"), "y")
+	tr, wh, h = newTrigger(&HandlerSettings{Directory: inbox, Pattern: "new*", IncludeContent: true, Encoding: "base64", PostAction: "move", ArchiveDir: archiveDir})
+	assert.Nil(t, tr.process(localFS{}, wh))
+	assert.Equal(t, "eQ==", h.outputs[0]["content"])
+	writeFile(t, filepath.Join(inbox, "new.csv"), "z")
+	assert.Nil(t, tr.process(localFS{}, wh))
+	assert.Len(t, h.outputs, 2)
+	archived, _ := filepath.Glob(filepath.Join(archiveDir, "new.csv*"))
+	assert.Len(t, archived, 2)
+	_, err := os.Stat(filepath.Join(inbox, "new.csv"))
+	assert.True(t, os.IsNotExist(err))
+
+	// delete
+	tr, wh, h = newTrigger(&HandlerSettings{Directory: inbox, PostAction: "delete"})
+	assert.Nil(t, tr.process(localFS{}, wh))
+	assert.Empty(t, h.outputs)
+	writeFile(t, filepath.Join(inbox, "gone.csv"), "g")
+	assert.Nil(t, tr.process(localFS{}, wh))
+	assert.Equal(t, []string{"gone.csv"}, h.names())
+	_, err = os.Stat(filepath.Join(inbox, "gone.csv"))
+	assert.True(t, os.IsNotExist(err))
+
+	_, err = tr.newHandler(h, &HandlerSettings{Directory: inbox, PostAction: "move"})
+	assert.NotNil(t, err)
+}
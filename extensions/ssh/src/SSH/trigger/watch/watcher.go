@@ -0,0 +1,229 @@
+package watch
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/sftp"
+)
+
+// fileSystem is the subset of the sftp client used to watch a directory
+type fileSystem interface {
+	ReadDir(p string) ([]os.FileInfo, error)
+	Stat(p string) (os.FileInfo, error)
+	Open(p string) (io.ReadCloser, error)
+	Rename(oldPath, newPath string) error
+	Remove(p string) error
+	MkdirAll(p string) error
+}
+
+type sftpFS struct {
+	client *sftp.Client
+}
+
+func (fs sftpFS) ReadDir(p string) ([]os.FileInfo, error) {
+	return fs.client.ReadDir(p)
+}
+
+func (fs sftpFS) Stat(p string) (os.FileInfo, error) {
+	return fs.client.Stat(p)
+}
+
+func (fs sftpFS) Open(p string) (io.ReadCloser, error) {
+	return fs.client.Open(p)
+}
+
+func (fs sftpFS) Rename(oldPath, newPath string) error {
+	if _, ok := fs.client.HasExtension("posix-rename@openssh.com"); ok {
+		return fs.client.PosixRename(oldPath, newPath)
+	}
+	return fs.client.Rename(oldPath, newPath)
+}
+
+func (fs sftpFS) Remove(p string) error {
+	return fs.client.Remove(p)
+}
+
+func (fs sftpFS) MkdirAll(p string) error {
+	return fs.client.MkdirAll(p)
+}
+
+// seenFile identifies a version of a file that was already picked up
+type seenFile struct {
+	Size    int64     `json:"size"`
+	ModTime time.Time `json:"modTime"`
+}
+
+// seenStore keeps the files already picked up by all handlers and writes them to a local file
+type seenStore struct {
+	path  string
+	mu    sync.Mutex
+	files map[string]seenFile
+}
+
+func loadSeenStore(p string) (*seenStore, error) {
+	store := &seenStore{path: p, files: map[string]seenFile{}}
+	if p == "" {
+		return store, nil
+	}
+
+	data, err := os.ReadFile(p)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return store, nil
+		}
+		return nil, fmt.Errorf("failed to read state file '%s': %s", p, err.Error())
+	}
+	if err = json.Unmarshal(data, &store.files); err != nil {
+		return nil, fmt.Errorf("invalid state file '%s': %s", p, err.Error())
+	}
+	return store, nil
+}
+
+func (s *seenStore) seen(key string, info os.FileInfo) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	f, ok := s.files[key]
+	return ok && f.Size == info.Size() && f.ModTime.Equal(info.ModTime())
+}
+
+func (s *seenStore) mark(key string, info os.FileInfo) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.files[key] = seenFile{Size: info.Size(), ModTime: info.ModTime()}
+	return s.save()
+}
+
+// prune forgets the files below prefix that are no longer present, so a file dropped again
+// under the same name is picked up again
+func (s *seenStore) prune(prefix string, present map[string]bool) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	changed := false
+	for key := range s.files {
+		if strings.HasPrefix(key, prefix) && !present[key] {
+			delete(s.files, key)
+			changed = true
+		}
+	}
+	if !changed {
+		return nil
+	}
+	return s.save()
+}
+
+func (s *seenStore) save() error {
+	if s.path == "" {
+		return nil
+	}
+	data, err := json.Marshal(s.files)
+	if err != nil {
+		return err
+	}
+	// write to a temporary file first so a crash never leaves a truncated state file
+	tmp := filepath.Join(filepath.Dir(s.path), "."+filepath.Base(s.path)+".tmp")
+	if err = os.WriteFile(tmp, data, 0600); err != nil {
+		return fmt.Errorf("failed to write state file '%s': %s", tmp, err.Error())
+	}
+	return os.Rename(tmp, s.path)
+}
+
+// pendingFile is a new file whose size has not yet been stable for the stable period
+type pendingFile struct {
+	size    int64
+	modTime time.Time
+	since   time.Time
+}
+
+// watcher finds new files in one remote directory
+type watcher struct {
+	dir     string
+	pattern string
+	stable  time.Duration
+	key     string
+	store   *seenStore
+	pending map[string]pendingFile
+}
+
+// scan lists the directory and returns the new files matching the pattern whose size and
+// modification time have not changed for the stable period
+func (w *watcher) scan(fs fileSystem, now time.Time) ([]os.FileInfo, error) {
+	infos, err := fs.ReadDir(w.dir)
+	if err != nil {
+		return nil, err
+	}
+	if w.pending == nil {
+		w.pending = map[string]pendingFile{}
+	}
+
+	var ready []os.FileInfo
+	present := map[string]bool{}
+	for _, info := range infos {
+		if !info.Mode().IsRegular() {
+			continue
+		}
+		key := w.storeKey(info.Name())
+		present[key] = true
+		if ok, _ := path.Match(w.pattern, info.Name()); !ok {
+			continue
+		}
+		if w.store.seen(key, info) {
+			continue
+		}
+
+		p, ok := w.pending[info.Name()]
+		if !ok || p.size != info.Size() || !p.modTime.Equal(info.ModTime()) {
+			p = pendingFile{size: info.Size(), modTime: info.ModTime(), since: now}
+			w.pending[info.Name()] = p
+		}
+		if now.Sub(p.since) >= w.stable {
+			ready = append(ready, info)
+		}
+	}
+
+	for name := range w.pending {
+		if !present[w.storeKey(name)] {
+			delete(w.pending, name)
+		}
+	}
+	if err = w.store.prune(w.key+"/", present); err != nil {
+		return nil, err
+	}
+
+	sort.Slice(ready, func(i, j int) bool { return ready[i].ModTime().Before(ready[j].ModTime()) })
+	return ready, nil
+}
+
+// done records that a file was picked up
+func (w *watcher) done(info os.FileInfo) error {
+	delete(w.pending, info.Name())
+	return w.store.mark(w.storeKey(info.Name()), info)
+}
+
+func (w *watcher) storeKey(name string) string {
+	return w.key + "/" + name
+}
+
+// archive moves the file into the archive directory. An archived file of the same name is
+// kept by suffixing the new one with a timestamp.
+func archive(fs fileSystem, remotePath, archiveDir string, now time.Time) (string, error) {
+	if err := fs.MkdirAll(archiveDir); err != nil {
+		return "", fmt.Errorf("failed to create archive directory '%s': %s", archiveDir, err.Error())
+	}
+	target := path.Join(archiveDir, path.Base(remotePath))
+	if _, err := fs.Stat(target); err == nil {
+		target = target + "." + now.UTC().Format("20060102T150405.000000000")
+	}
+	if err := fs.Rename(remotePath, target); err != nil {
+		return "", fmt.Errorf("failed to move '%s' to '%s': %s", remotePath, target, err.Error())
+	}
+	return target, nil
+}